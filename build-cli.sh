@@ -1,8 +1,8 @@
 #!/bin/sh
 set -e
 DISABLE_QUIC=""
-if [ ! -z "`go version | grep go1.15`" ]; then
-  echo "Warning: disabling QUIC when using Go 1.15."
+if [ -z "`go version | grep 'go1\.14'`" ]; then
+  echo "Warning: disabling QUIC when not using Go 1.14."
   echo "See https://github.com/ooni/probe-engine/issues/866 for more info."
   DISABLE_QUIC="DISABLE_QUIC"
 fi
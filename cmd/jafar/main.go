@@ -22,8 +22,10 @@ import (
 	"github.com/ooni/probe-engine/cmd/jafar/flagx"
 	"github.com/ooni/probe-engine/cmd/jafar/httpproxy"
 	"github.com/ooni/probe-engine/cmd/jafar/iptables"
+	"github.com/ooni/probe-engine/cmd/jafar/policy"
 	"github.com/ooni/probe-engine/cmd/jafar/resolver"
 	"github.com/ooni/probe-engine/cmd/jafar/shellx"
+	"github.com/ooni/probe-engine/cmd/jafar/socksproxy"
 	"github.com/ooni/probe-engine/cmd/jafar/tlsproxy"
 	"github.com/ooni/probe-engine/cmd/jafar/uncensored"
 	"github.com/ooni/probe-engine/internal/runtimex"
@@ -56,6 +58,10 @@ var (
 	mainCommand *string
 	mainUser    *string
 
+	policyFile *string
+
+	socksProxyAddress *string
+
 	tag *string
 
 	tlsProxyAddress *string
@@ -153,6 +159,18 @@ func init() {
 	mainCommand = flag.String("main-command", "", "Optional command to execute")
 	mainUser = flag.String("main-user", "nobody", "Run command as user")
 
+	// policy
+	policyFile = flag.String(
+		"policy-file", "",
+		"Load censorship rules from the specified policy file",
+	)
+
+	// socksProxy
+	socksProxyAddress = flag.String(
+		"socks-proxy-address", "",
+		"Apply the iptables rules using a SOCKS5 proxy listening at this address",
+	)
+
 	// tag
 	tag = flag.String("tag", "", "Add tag to a specific run")
 
@@ -226,6 +244,36 @@ func iptablesStart() *iptables.CensoringPolicy {
 	return policy
 }
 
+func policyApply() {
+	if *policyFile == "" {
+		return
+	}
+	p, err := policy.Load(*policyFile)
+	runtimex.PanicOnError(err, "policy.Load failed")
+	log.Infof("jafar policy: %s", p.Name)
+	for _, rule := range p.Rules {
+		log.Infof("jafar policy rule: %s: -%s %s", rule.Name, rule.Action, rule.Target)
+	}
+	err = p.Apply(flag.Set)
+	runtimex.PanicOnError(err, "p.Apply failed")
+}
+
+func socksProxyStart(uncensored *uncensored.Client) net.Listener {
+	proxy := socksproxy.NewCensoringProxy(uncensored)
+	proxy.DropIPs = iptablesDropIP
+	proxy.DropKeywordsHex = iptablesDropKeywordHex
+	proxy.DropKeywords = iptablesDropKeyword
+	proxy.HijackDNSAddress = *iptablesHijackDNSTo
+	proxy.HijackHTTPSAddress = *iptablesHijackHTTPSTo
+	proxy.HijackHTTPAddress = *iptablesHijackHTTPTo
+	proxy.ResetIPs = iptablesResetIP
+	proxy.ResetKeywordsHex = iptablesResetKeywordHex
+	proxy.ResetKeywords = iptablesResetKeyword
+	listener, err := proxy.Start(*socksProxyAddress)
+	runtimex.PanicOnError(err, "proxy.Start failed")
+	return listener
+}
+
 func tlsProxyStart(uncensored *uncensored.Client) net.Listener {
 	proxy := tlsproxy.NewCensoringProxy(tlsProxyBlock, uncensored)
 	listener, err := proxy.Start(*tlsProxyAddress)
@@ -260,6 +308,7 @@ func main() {
 	log.SetHandler(cli.Default)
 	log.Infof("jafar command line: [%s]", strings.Join(os.Args, ", "))
 	log.Infof("jafar tag: %s", *tag)
+	policyApply()
 	uncensoredClient := newUncensoredClient()
 	defer uncensoredClient.CloseIdleConnections()
 	badlistener := badProxyStart()
@@ -272,7 +321,13 @@ func main() {
 	defer httpproxy.Close()
 	tlslistener := tlsProxyStart(uncensoredClient)
 	defer tlslistener.Close()
-	policy := iptablesStart()
+	var policy *iptables.CensoringPolicy
+	if *socksProxyAddress != "" {
+		sockslistener := socksProxyStart(uncensoredClient)
+		defer sockslistener.Close()
+	} else {
+		policy = iptablesStart()
+	}
 	var err error
 	if *mainCommand != "" {
 		err = shellx.RunCommandline(fmt.Sprintf(
@@ -281,6 +336,8 @@ func main() {
 	} else {
 		<-mainCh
 	}
-	policy.Waive()
+	if policy != nil {
+		policy.Waive()
+	}
 	mustx(err, "subcommand failed", os.Exit)
 }
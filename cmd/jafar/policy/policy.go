@@ -0,0 +1,162 @@
+// Package policy contains code for loading a censorship policy from a
+// file. A policy describes a whole censorship scenario using named rules,
+// so we can version censorship profiles and replay them.
+//
+// The file is JSON and looks like this:
+//
+//     {
+//       "name": "example-profile",
+//       "rules": [{
+//         "name": "reset TLS connections to example.com",
+//         "action": "iptables-reset-keyword",
+//         "target": "example.com"
+//       }, {
+//         "name": "return NXDOMAIN for example.org",
+//         "action": "dns-proxy-block",
+//         "target": "example.org"
+//       }]
+//     }
+//
+// The action of each rule is the name of the Jafar command line flag
+// implementing such action and the target is the flag value. Hence, the
+// above policy is equivalent to running Jafar with the
+// `-iptables-reset-keyword example.com -dns-proxy-block example.org` flags.
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+)
+
+// Rule is a named censorship rule.
+type Rule struct {
+	Action string `json:"action"`
+	Name   string `json:"name"`
+	Target string `json:"target"`
+}
+
+// Policy is a named list of censorship rules.
+type Policy struct {
+	Name  string `json:"name"`
+	Rules []Rule `json:"rules"`
+}
+
+// kind tells us how to validate the target of an action.
+type kind int
+
+const (
+	kindKeyword = kind(iota)
+	kindIP
+	kindEndpoint
+)
+
+// actions contains the actions that we support.
+var actions = map[string]kind{
+	"dns-proxy-block":            kindKeyword,
+	"dns-proxy-hijack":           kindKeyword,
+	"dns-proxy-ignore":           kindKeyword,
+	"http-proxy-block":           kindKeyword,
+	"iptables-drop-ip":           kindIP,
+	"iptables-drop-keyword":      kindKeyword,
+	"iptables-drop-keyword-hex":  kindKeyword,
+	"iptables-hijack-dns-to":     kindEndpoint,
+	"iptables-hijack-http-to":    kindEndpoint,
+	"iptables-hijack-https-to":   kindEndpoint,
+	"iptables-reset-ip":          kindIP,
+	"iptables-reset-keyword":     kindKeyword,
+	"iptables-reset-keyword-hex": kindKeyword,
+	"tls-proxy-block":            kindKeyword,
+}
+
+// The following errors are returned when a policy is not valid.
+var (
+	ErrDuplicateRule     = errors.New("policy: duplicate rule name")
+	ErrEmptyRuleName     = errors.New("policy: empty rule name")
+	ErrEmptyTarget       = errors.New("policy: empty target")
+	ErrInvalidTarget     = errors.New("policy: invalid target")
+	ErrMultipleHijacking = errors.New("policy: more than one hijacking rule for the same traffic")
+	ErrUnknownAction     = errors.New("policy: unknown action")
+)
+
+// Load loads and validates the policy at the specified path.
+func Load(path string) (*Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse parses and validates the policy serialized in data. We reject
+// unknown fields, because they most likely are typos.
+func Parse(data []byte) (*Policy, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var policy Policy
+	if err := decoder.Decode(&policy); err != nil {
+		return nil, err
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// Validate returns an error if the policy is not valid.
+func (p *Policy) Validate() error {
+	names := make(map[string]bool)
+	hijacks := make(map[string]bool)
+	for _, rule := range p.Rules {
+		if rule.Name == "" {
+			return ErrEmptyRuleName
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("%w: %s", ErrDuplicateRule, rule.Name)
+		}
+		names[rule.Name] = true
+		kind, found := actions[rule.Action]
+		if !found {
+			return fmt.Errorf("%w: %s", ErrUnknownAction, rule.Action)
+		}
+		if rule.Target == "" {
+			return fmt.Errorf("%w: %s", ErrEmptyTarget, rule.Name)
+		}
+		switch kind {
+		case kindIP:
+			if net.ParseIP(rule.Target) == nil {
+				return fmt.Errorf("%w: %s", ErrInvalidTarget, rule.Name)
+			}
+		case kindEndpoint:
+			if _, _, err := net.SplitHostPort(rule.Target); err != nil {
+				return fmt.Errorf("%w: %s", ErrInvalidTarget, rule.Name)
+			}
+			if hijacks[rule.Action] {
+				return fmt.Errorf("%w: %s", ErrMultipleHijacking, rule.Name)
+			}
+			hijacks[rule.Action] = true
+		case kindKeyword:
+			// The flags accepting keywords split their value on
+			// commas, hence a comma would yield many rules.
+			if strings.Contains(rule.Target, ",") {
+				return fmt.Errorf("%w: %s", ErrInvalidTarget, rule.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// Apply applies the policy by calling set for each rule with the
+// action and the target of the rule. In Jafar, set is flag.Set.
+func (p *Policy) Apply(set func(name, value string) error) error {
+	for _, rule := range p.Rules {
+		if err := set(rule.Action, rule.Target); err != nil {
+			return fmt.Errorf("policy: cannot apply %s: %w", rule.Name, err)
+		}
+	}
+	return nil
+}
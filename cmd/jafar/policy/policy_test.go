@@ -0,0 +1,157 @@
+package policy_test
+
+import (
+	"errors"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ooni/probe-engine/cmd/jafar/flagx"
+	"github.com/ooni/probe-engine/cmd/jafar/policy"
+)
+
+const examplePolicy = `{
+  "name": "example-profile",
+  "rules": [{
+    "name": "reset connections mentioning example.com",
+    "action": "iptables-reset-keyword",
+    "target": "example.com"
+  }, {
+    "name": "hijack DNS to the DNS proxy",
+    "action": "iptables-hijack-dns-to",
+    "target": "127.0.0.1:5353"
+  }, {
+    "name": "return NXDOMAIN for example.org",
+    "action": "dns-proxy-block",
+    "target": "example.org"
+  }, {
+    "name": "return NXDOMAIN for example.net",
+    "action": "dns-proxy-block",
+    "target": "example.net"
+  }]
+}`
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jafar-policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "policy.json")
+	if err := ioutil.WriteFile(path, []byte(examplePolicy), 0600); err != nil {
+		t.Fatal(err)
+	}
+	p, err := policy.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "example-profile" || len(p.Rules) != 4 {
+		t.Fatal("unexpected policy")
+	}
+}
+
+func TestLoadNonexistentFile(t *testing.T) {
+	if _, err := policy.Load("/nonexistent"); err == nil {
+		t.Fatal("expected an error here")
+	}
+}
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		name     string
+		data     string
+		expected error
+	}{{
+		name: "with unknown field",
+		data: `{"name": "x", "rulez": []}`,
+	}, {
+		name:     "with empty rule name",
+		data:     `{"rules": [{"action": "dns-proxy-block", "target": "x"}]}`,
+		expected: policy.ErrEmptyRuleName,
+	}, {
+		name: "with duplicate rule name",
+		data: `{"rules": [
+			{"name": "x", "action": "dns-proxy-block", "target": "x"},
+			{"name": "x", "action": "dns-proxy-block", "target": "y"}
+		]}`,
+		expected: policy.ErrDuplicateRule,
+	}, {
+		name:     "with unknown action",
+		data:     `{"rules": [{"name": "x", "action": "main-command", "target": "ls"}]}`,
+		expected: policy.ErrUnknownAction,
+	}, {
+		name:     "with empty target",
+		data:     `{"rules": [{"name": "x", "action": "dns-proxy-block"}]}`,
+		expected: policy.ErrEmptyTarget,
+	}, {
+		name:     "with invalid IP address",
+		data:     `{"rules": [{"name": "x", "action": "iptables-drop-ip", "target": "x"}]}`,
+		expected: policy.ErrInvalidTarget,
+	}, {
+		name:     "with invalid endpoint",
+		data:     `{"rules": [{"name": "x", "action": "iptables-hijack-dns-to", "target": "x"}]}`,
+		expected: policy.ErrInvalidTarget,
+	}, {
+		name:     "with many keywords",
+		data:     `{"rules": [{"name": "x", "action": "tls-proxy-block", "target": "x,y"}]}`,
+		expected: policy.ErrInvalidTarget,
+	}, {
+		name: "with more than one hijacking rule",
+		data: `{"rules": [
+			{"name": "x", "action": "iptables-hijack-dns-to", "target": "127.0.0.1:53"},
+			{"name": "y", "action": "iptables-hijack-dns-to", "target": "127.0.0.1:5353"}
+		]}`,
+		expected: policy.ErrMultipleHijacking,
+	}}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := policy.Parse([]byte(c.data))
+			if err == nil {
+				t.Fatal("expected an error here")
+			}
+			if c.expected != nil && !errors.Is(err, c.expected) {
+				t.Fatal("not the error we expected", err)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	p, err := policy.Parse([]byte(examplePolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		dnsProxyBlock        flagx.StringArray
+		iptablesResetKeyword flagx.StringArray
+	)
+	fs := flag.NewFlagSet("jafar", flag.ContinueOnError)
+	fs.Var(&dnsProxyBlock, "dns-proxy-block", "")
+	iptablesHijackDNSTo := fs.String("iptables-hijack-dns-to", "", "")
+	fs.Var(&iptablesResetKeyword, "iptables-reset-keyword", "")
+	if err := p.Apply(fs.Set); err != nil {
+		t.Fatal(err)
+	}
+	if len(dnsProxyBlock) != 2 || !dnsProxyBlock.Contains("example.net") {
+		t.Fatal("unexpected dns-proxy-block value")
+	}
+	if *iptablesHijackDNSTo != "127.0.0.1:5353" {
+		t.Fatal("unexpected iptables-hijack-dns-to value")
+	}
+	if !iptablesResetKeyword.Contains("example.com") {
+		t.Fatal("unexpected iptables-reset-keyword value")
+	}
+}
+
+func TestApplyFailure(t *testing.T) {
+	p, err := policy.Parse([]byte(examplePolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := flag.NewFlagSet("jafar", flag.ContinueOnError)
+	if err := p.Apply(fs.Set); err == nil {
+		t.Fatal("expected an error here")
+	}
+}
@@ -0,0 +1,445 @@
+// Package socksproxy contains a censoring SOCKS5 proxy. It implements in
+// userspace the same rules implemented by the iptables package, on the
+// connections passing through the proxy. Therefore, it does not require root
+// privileges, nor Linux, and we can use it in containers and tests by pointing
+// the `--proxy` of an application at it.
+//
+// Because SOCKS5 CONNECT only supports TCP, hijacking DNS only works for
+// DNS over TCP. Also, we only support SOCKS5 without authentication.
+package socksproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/apex/log"
+	"github.com/ooni/probe-engine/atomicx"
+)
+
+// Upstream is the upstream used by the proxy to resolve domain names
+// and to connect. In Jafar, this is the uncensored client.
+type Upstream interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+	LookupHost(ctx context.Context, domain string) ([]string, error)
+}
+
+// CensoringProxy is a censoring SOCKS5 proxy. The meaning of its fields
+// is the same of the fields of iptables.CensoringPolicy.
+type CensoringProxy struct {
+	DropIPs            []string // drop traffic to these IPs
+	DropKeywordsHex    []string // drop flows with these hex keywords
+	DropKeywords       []string // drop flows with these keywords
+	HijackDNSAddress   string   // where to hijack DNS to
+	HijackHTTPSAddress string   // where to hijack HTTPS to
+	HijackHTTPAddress  string   // where to hijack HTTP to
+	ResetIPs           []string // RST traffic to these IPs
+	ResetKeywordsHex   []string // RST flows with these hex keywords
+	ResetKeywords      []string // RST flows with these keywords
+
+	dropKeywords  [][]byte
+	resetKeywords [][]byte
+	upstream      Upstream
+}
+
+// NewCensoringProxy creates a new CensoringProxy instance using
+// the specified upstream. You should set the censorship rules
+// using the public fields before calling Start.
+func NewCensoringProxy(upstream Upstream) *CensoringProxy {
+	return &CensoringProxy{upstream: upstream}
+}
+
+// ErrInvalidHexKeyword indicates that a hex keyword is not valid.
+var ErrInvalidHexKeyword = errors.New("socksproxy: invalid hex keyword")
+
+// parseHexKeyword parses a keyword using the syntax of the iptables
+// --hex-string option, where hex bytes are enclosed in pipes and the
+// rest is ASCII, e.g., `|6f 6f|ni` is equivalent to `ooni`.
+func parseHexKeyword(keyword string) ([]byte, error) {
+	var out []byte
+	parts := strings.Split(keyword, "|")
+	if len(parts)%2 == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidHexKeyword, keyword)
+	}
+	for idx, part := range parts {
+		if idx%2 == 0 {
+			out = append(out, part...)
+			continue
+		}
+		data, err := hex.DecodeString(strings.ReplaceAll(part, " ", ""))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidHexKeyword, keyword)
+		}
+		out = append(out, data...)
+	}
+	if len(out) <= 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidHexKeyword, keyword)
+	}
+	return out, nil
+}
+
+func compileKeywords(keywords, keywordsHex []string) ([][]byte, error) {
+	var out [][]byte
+	for _, keyword := range keywords {
+		out = append(out, []byte(keyword))
+	}
+	for _, keyword := range keywordsHex {
+		data, err := parseHexKeyword(keyword)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, data)
+	}
+	return out, nil
+}
+
+// verdict is what we decide to do with a connection.
+type verdict int
+
+const (
+	verdictPass = verdict(iota)
+	verdictDrop
+	verdictReset
+)
+
+// match tells us what to do with data flowing in a connection. Like
+// in the iptables package, RST rules take precedence.
+func (p *CensoringProxy) match(data []byte) verdict {
+	for _, keyword := range p.resetKeywords {
+		if bytes.Contains(data, keyword) {
+			return verdictReset
+		}
+	}
+	for _, keyword := range p.dropKeywords {
+		if bytes.Contains(data, keyword) {
+			return verdictDrop
+		}
+	}
+	return verdictPass
+}
+
+// matchIP tells us what to do with a connection to ip.
+func (p *CensoringProxy) matchIP(ip string) verdict {
+	for _, entry := range p.ResetIPs {
+		if entry == ip {
+			return verdictReset
+		}
+	}
+	for _, entry := range p.DropIPs {
+		if entry == ip {
+			return verdictDrop
+		}
+	}
+	return verdictPass
+}
+
+// hijack returns the address to connect to for port, or an
+// empty string if we should not hijack such connection.
+func (p *CensoringProxy) hijack(port string) string {
+	switch port {
+	case "53":
+		return p.HijackDNSAddress
+	case "80":
+		return p.HijackHTTPAddress
+	case "443":
+		return p.HijackHTTPSAddress
+	}
+	return ""
+}
+
+// The following constants are defined by RFC1928.
+const (
+	socksVersion          = 5
+	socksNoAuth           = 0
+	socksNoAcceptable     = 0xff
+	socksConnect          = 1
+	socksIPv4             = 1
+	socksDomain           = 3
+	socksIPv6             = 4
+	socksSucceeded        = 0
+	socksFailure          = 1
+	socksUnreachable      = 4
+	socksRefused          = 5
+	socksNotSupported     = 7
+	socksAddrNotSupported = 8
+	socksRequestLength    = 4
+)
+
+var errProtocol = errors.New("socksproxy: protocol error")
+
+// reply sends a SOCKS5 reply with the specified code.
+func reply(conn net.Conn, code byte) error {
+	_, err := conn.Write([]byte{
+		socksVersion, code, 0, socksIPv4, 0, 0, 0, 0, 0, 0,
+	})
+	return err
+}
+
+// negotiate reads the client greeting and selects no authentication.
+func negotiate(conn net.Conn) error {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	if header[0] != socksVersion {
+		return errProtocol
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return err
+	}
+	if bytes.IndexByte(methods, socksNoAuth) < 0 {
+		conn.Write([]byte{socksVersion, socksNoAcceptable})
+		return errProtocol
+	}
+	_, err := conn.Write([]byte{socksVersion, socksNoAuth})
+	return err
+}
+
+// readRequest reads the client request and returns the host
+// and the port the client wants to connect to.
+func readRequest(conn net.Conn) (string, string, error) {
+	header := make([]byte, socksRequestLength)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return "", "", err
+	}
+	if header[0] != socksVersion {
+		return "", "", errProtocol
+	}
+	if header[1] != socksConnect {
+		reply(conn, socksNotSupported)
+		return "", "", errProtocol
+	}
+	var host string
+	switch header[3] {
+	case socksIPv4, socksIPv6:
+		size := net.IPv4len
+		if header[3] == socksIPv6 {
+			size = net.IPv6len
+		}
+		ip := make([]byte, size)
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return "", "", err
+		}
+		host = net.IP(ip).String()
+	case socksDomain:
+		size := make([]byte, 1)
+		if _, err := io.ReadFull(conn, size); err != nil {
+			return "", "", err
+		}
+		domain := make([]byte, size[0])
+		if _, err := io.ReadFull(conn, domain); err != nil {
+			return "", "", err
+		}
+		host = string(domain)
+	default:
+		reply(conn, socksAddrNotSupported)
+		return "", "", errProtocol
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return "", "", err
+	}
+	return host, strconv.Itoa(int(binary.BigEndian.Uint16(port))), nil
+}
+
+// reset closes the connection with a RST segment
+func reset(conn net.Conn) {
+	if tc, ok := conn.(*net.TCPConn); ok {
+		tc.SetLinger(0)
+	}
+	conn.Close()
+}
+
+// blackhole reads and discards all the data sent by the client until
+// the client closes the connection, to emulate dropped packets.
+func blackhole(conn net.Conn) {
+	io.Copy(ioutil.Discard, conn)
+	conn.Close()
+}
+
+// flow is a connection between the client and the server.
+type flow struct {
+	client  net.Conn
+	dropped *atomicx.Int64
+	proxy   *CensoringProxy
+	server  net.Conn
+}
+
+// drop stops forwarding traffic. We close the server connection and
+// we keep the client connection open until the client closes it.
+func (f *flow) drop() {
+	f.dropped.Add(1)
+	f.server.Close()
+}
+
+// reset resets the client connection.
+func (f *flow) reset() {
+	reset(f.client)
+	f.server.Close()
+}
+
+// upload forwards traffic from the client to the server.
+func (f *flow) upload(wg *sync.WaitGroup) {
+	defer wg.Done()
+	data := make([]byte, 1<<18)
+	for {
+		n, err := f.client.Read(data)
+		if err != nil {
+			break
+		}
+		if f.dropped.Load() > 0 {
+			continue
+		}
+		switch f.proxy.match(data[:n]) {
+		case verdictReset:
+			log.Warn("socksproxy: reset flow by policy")
+			f.reset()
+			return
+		case verdictDrop:
+			log.Warn("socksproxy: drop flow by policy")
+			f.drop()
+			continue
+		}
+		if _, err := f.server.Write(data[:n]); err != nil && f.dropped.Load() <= 0 {
+			break
+		}
+	}
+	f.client.Close()
+	f.server.Close()
+}
+
+// download forwards traffic from the server to the client. Like the
+// iptables rules, which are in the JAFAR_OUTPUT chain, we do not look
+// for keywords in this direction.
+func (f *flow) download(wg *sync.WaitGroup) {
+	defer wg.Done()
+	data := make([]byte, 1<<18)
+	for {
+		n, err := f.server.Read(data)
+		if err != nil {
+			break
+		}
+		if _, err := f.client.Write(data[:n]); err != nil {
+			break
+		}
+	}
+	if f.dropped.Load() <= 0 {
+		f.client.Close()
+	}
+	f.server.Close()
+}
+
+// handle implements the SOCKS5 proxy
+func (p *CensoringProxy) handle(clientconn net.Conn) {
+	if err := negotiate(clientconn); err != nil {
+		log.WithError(err).Warn("socksproxy: negotiate failed")
+		clientconn.Close()
+		return
+	}
+	host, port, err := readRequest(clientconn)
+	if err != nil {
+		log.WithError(err).Warn("socksproxy: readRequest failed")
+		clientconn.Close()
+		return
+	}
+	ctx := context.Background()
+	ip := host
+	if net.ParseIP(host) == nil {
+		addrs, err := p.upstream.LookupHost(ctx, host)
+		if err != nil {
+			log.WithError(err).Warn("socksproxy: p.upstream.LookupHost failed")
+			reply(clientconn, socksUnreachable)
+			clientconn.Close()
+			return
+		}
+		ip = addrs[0]
+	}
+	switch p.matchIP(ip) {
+	case verdictReset:
+		log.Warnf("socksproxy: reject connection to %s by policy", ip)
+		reply(clientconn, socksRefused)
+		clientconn.Close()
+		return
+	case verdictDrop:
+		log.Warnf("socksproxy: drop connection to %s by policy", ip)
+		blackhole(clientconn)
+		return
+	}
+	address := net.JoinHostPort(ip, port)
+	if hijacked := p.hijack(port); hijacked != "" {
+		log.Debugf("socksproxy: hijack %s to %s", address, hijacked)
+		address = hijacked
+	}
+	serverconn, err := p.upstream.DialContext(ctx, "tcp", address)
+	if err != nil {
+		log.WithError(err).Warn("socksproxy: p.upstream.DialContext failed")
+		code := byte(socksFailure)
+		if strings.HasSuffix(err.Error(), "connection refused") {
+			code = socksRefused
+		}
+		reply(clientconn, code)
+		clientconn.Close()
+		return
+	}
+	if err := reply(clientconn, socksSucceeded); err != nil {
+		clientconn.Close()
+		serverconn.Close()
+		return
+	}
+	log.Debugf("socksproxy: routing for %s", address)
+	f := &flow{
+		client:  clientconn,
+		dropped: atomicx.NewInt64(),
+		proxy:   p,
+		server:  serverconn,
+	}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go f.upload(&wg)
+	go f.download(&wg)
+	wg.Wait()
+}
+
+func (p *CensoringProxy) run(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil && strings.Contains(
+			err.Error(), "use of closed network connection") {
+			return
+		}
+		if err == nil {
+			// It's difficult to make accept fail, so restructure
+			// the code such that we enter into the happy path
+			go p.handle(conn)
+		}
+	}
+}
+
+// Start starts the censoring proxy.
+func (p *CensoringProxy) Start(address string) (net.Listener, error) {
+	var err error
+	p.dropKeywords, err = compileKeywords(p.DropKeywords, p.DropKeywordsHex)
+	if err != nil {
+		return nil, err
+	}
+	p.resetKeywords, err = compileKeywords(p.ResetKeywords, p.ResetKeywordsHex)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	go p.run(listener)
+	return listener, nil
+}
@@ -0,0 +1,256 @@
+package socksproxy
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ooni/probe-engine/netx"
+)
+
+// localUpstream resolves every domain to 127.0.0.1.
+type localUpstream struct {
+	net.Dialer
+}
+
+func (localUpstream) LookupHost(ctx context.Context, domain string) ([]string, error) {
+	if domain == "nxdomain.example.com" {
+		return nil, errors.New("no such host")
+	}
+	return []string{"127.0.0.1"}, nil
+}
+
+func newproxy(t *testing.T, setup func(p *CensoringProxy)) net.Listener {
+	proxy := NewCensoringProxy(&localUpstream{})
+	setup(proxy)
+	listener, err := proxy.Start("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return listener
+}
+
+func newserver() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("antani"))
+		}))
+}
+
+// fetch fetches URL using the proxy at address.
+func fetch(address, URL string) error {
+	txp := netx.NewHTTPTransport(netx.Config{
+		ProxyURL: &url.URL{Scheme: "socks5", Host: address},
+	})
+	defer txp.CloseIdleConnections()
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := txp.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if string(data) != "antani" {
+		return errors.New("unexpected body")
+	}
+	return nil
+}
+
+func portOf(server *httptest.Server) string {
+	URL, _ := url.Parse(server.URL)
+	return URL.Port()
+}
+
+func TestPass(t *testing.T) {
+	server := newserver()
+	defer server.Close()
+	listener := newproxy(t, func(p *CensoringProxy) {
+		p.ResetKeywords = []string{"nothere"}
+	})
+	defer listener.Close()
+	for _, URL := range []string{
+		server.URL,
+		"http://www.example.com:" + portOf(server),
+	} {
+		if err := fetch(listener.Addr().String(), URL); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestKeywordsOnlyInResponse(t *testing.T) {
+	server := newserver()
+	defer server.Close()
+	listener := newproxy(t, func(p *CensoringProxy) {
+		p.DropKeywords = []string{"antani"}
+		p.ResetKeywordsHex = []string{"|61 6e 74 61 6e 69|"}
+	})
+	defer listener.Close()
+	if err := fetch(listener.Addr().String(), server.URL); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFailures(t *testing.T) {
+	server := newserver()
+	defer server.Close()
+	cases := []struct {
+		name     string
+		setup    func(p *CensoringProxy)
+		URL      string
+		expected string
+	}{{
+		name: "with drop IP",
+		setup: func(p *CensoringProxy) {
+			p.DropIPs = []string{"127.0.0.1"}
+		},
+		expected: "context deadline exceeded",
+	}, {
+		name: "with reset IP",
+		setup: func(p *CensoringProxy) {
+			p.ResetIPs = []string{"127.0.0.1"}
+		},
+		expected: "connection refused",
+	}, {
+		name: "with drop keyword",
+		setup: func(p *CensoringProxy) {
+			p.DropKeywords = []string{"ooni"}
+		},
+		URL:      "/ooni",
+		expected: "context deadline exceeded",
+	}, {
+		name: "with drop hex keyword",
+		setup: func(p *CensoringProxy) {
+			p.DropKeywordsHex = []string{"|6f 6f|ni"}
+		},
+		URL:      "/ooni",
+		expected: "context deadline exceeded",
+	}, {
+		name: "with reset keyword",
+		setup: func(p *CensoringProxy) {
+			p.ResetKeywords = []string{"ooni"}
+		},
+		URL:      "/ooni",
+		expected: "connection_reset",
+	}, {
+		name: "with reset hex keyword",
+		setup: func(p *CensoringProxy) {
+			p.ResetKeywordsHex = []string{"|6f 6f|ni"}
+		},
+		URL:      "/ooni",
+		expected: "connection_reset",
+	}, {
+		name:     "with resolver failure",
+		setup:    func(p *CensoringProxy) {},
+		URL:      "http://nxdomain.example.com/",
+		expected: "socks connect",
+	}}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			listener := newproxy(t, c.setup)
+			defer listener.Close()
+			URL := server.URL + c.URL
+			if strings.HasPrefix(c.URL, "http://") {
+				URL = c.URL
+			}
+			err := fetch(listener.Addr().String(), URL)
+			if err == nil || !strings.Contains(err.Error(), c.expected) {
+				t.Fatal("not the error we expected", err)
+			}
+		})
+	}
+}
+
+func TestHijackHTTP(t *testing.T) {
+	server := newserver()
+	defer server.Close()
+	listener := newproxy(t, func(p *CensoringProxy) {
+		p.HijackHTTPAddress = server.Listener.Addr().String()
+	})
+	defer listener.Close()
+	if err := fetch(listener.Addr().String(), "http://www.example.com/"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStartInvalidHexKeyword(t *testing.T) {
+	for _, keyword := range []string{"|6f 6f", "|zz|", "||"} {
+		proxy := NewCensoringProxy(&localUpstream{})
+		proxy.ResetKeywordsHex = []string{keyword}
+		if _, err := proxy.Start("127.0.0.1:0"); !errors.Is(err, ErrInvalidHexKeyword) {
+			t.Fatal("not the error we expected", err)
+		}
+		proxy = NewCensoringProxy(&localUpstream{})
+		proxy.DropKeywordsHex = []string{keyword}
+		if _, err := proxy.Start("127.0.0.1:0"); !errors.Is(err, ErrInvalidHexKeyword) {
+			t.Fatal("not the error we expected", err)
+		}
+	}
+}
+
+func TestStartInvalidAddress(t *testing.T) {
+	proxy := NewCensoringProxy(&localUpstream{})
+	if _, err := proxy.Start("127.0.0.1"); err == nil {
+		t.Fatal("expected an error here")
+	}
+}
+
+func TestProtocolErrors(t *testing.T) {
+	listener := newproxy(t, func(p *CensoringProxy) {})
+	defer listener.Close()
+	cases := []struct {
+		name     string
+		request  []byte
+		expected []byte
+	}{{
+		name:    "with wrong version",
+		request: []byte{4, 1, 0},
+	}, {
+		name:     "with no acceptable methods",
+		request:  []byte{5, 1, 2},
+		expected: []byte{5, 0xff},
+	}, {
+		name:     "with unsupported command",
+		request:  []byte{5, 1, 0, 5, 2, 0, 1},
+		expected: []byte{5, 0, 5, 7},
+	}, {
+		name:     "with unsupported address type",
+		request:  []byte{5, 1, 0, 5, 1, 0, 2},
+		expected: []byte{5, 0, 5, 8},
+	}}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			conn, err := net.Dial("tcp", listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			if _, err := conn.Write(c.request); err != nil {
+				t.Fatal(err)
+			}
+			conn.SetDeadline(time.Now().Add(time.Second))
+			data, err := ioutil.ReadAll(conn)
+			if err != nil && c.expected != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(string(data), string(c.expected)) {
+				t.Fatal("unexpected response", data)
+			}
+		})
+	}
+}
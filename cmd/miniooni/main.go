@@ -8,6 +8,9 @@ import (
 	"log"
 
 	"github.com/ooni/probe-engine/libminiooni"
+
+	// Link a pure Go SQLite driver for the `sqlite:PATH` sink.
+	_ "modernc.org/sqlite"
 )
 
 func main() {
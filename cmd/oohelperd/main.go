@@ -0,0 +1,48 @@
+// Command oohelperd is the Web Connectivity test helper server.
+//
+// See also internal/oohelperd, which is where we implement the helper.
+package main
+
+import (
+	"flag"
+	"net/http"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/apex/log/handlers/cli"
+	"github.com/ooni/probe-engine/internal/oohelperd"
+	"github.com/ooni/probe-engine/internal/runtimex"
+	"github.com/ooni/probe-engine/netx"
+)
+
+var (
+	address     = flag.String("address", "127.0.0.1:8080", "Address where to listen")
+	resolverURL = flag.String("resolver-url", "", "URL describing the resolver to use")
+	verbose     = flag.Bool("verbose", false, "Run in verbose mode")
+)
+
+func newHandler() oohelperd.Handler {
+	dnsclient, err := netx.NewDNSClient(netx.Config{Logger: log.Log}, *resolverURL)
+	runtimex.PanicOnError(err, "netx.NewDNSClient failed")
+	return oohelperd.NewHandler(netx.Config{
+		BaseResolver: dnsclient.Resolver,
+		Logger:       log.Log,
+	})
+}
+
+func main() {
+	flag.Parse()
+	log.SetLevel(log.InfoLevel)
+	if *verbose {
+		log.SetLevel(log.DebugLevel)
+	}
+	log.SetHandler(cli.Default)
+	server := &http.Server{
+		Addr:              *address,
+		Handler:           newHandler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Infof("oohelperd: listening at %s", *address)
+	err := server.ListenAndServe()
+	runtimex.PanicOnError(err, "server.ListenAndServe failed")
+}
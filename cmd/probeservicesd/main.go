@@ -0,0 +1,71 @@
+// Command probeservicesd is a local stand-in for the OONI probe services.
+//
+// See also internal/probeservicesd, which is where we implement the APIs.
+package main
+
+import (
+	"flag"
+	"net/http"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/apex/log/handlers/cli"
+	"github.com/ooni/probe-engine/internal/probeservicesd"
+	"github.com/ooni/probe-engine/internal/runtimex"
+	"github.com/ooni/probe-engine/model"
+)
+
+var (
+	address       = flag.String("address", "127.0.0.1:8080", "Address where to listen")
+	disableBatch  = flag.Bool("disable-batch", false, "Do not accept several measurements at once")
+	disableGzip   = flag.Bool("disable-gzip", false, "Do not accept gzip request bodies")
+	faultCount    = flag.Int("fault-count", 0, "Number of requests affected by faults (0 means all)")
+	faultDelay    = flag.Duration("fault-delay", 0, "Delay before responding to requests")
+	faultEndpoint = flag.String("fault-endpoint", probeservicesd.AnyEndpoint, "Endpoint affected by faults")
+	faultStatus   = flag.Int("fault-status", 0, "Status code to respond with (0 means process the request)")
+	tokenLifetime = flag.Duration("token-lifetime", probeservicesd.DefaultTokenLifetime, "Lifetime of login tokens")
+	webHelper     = flag.String("web-connectivity-helper", "", "URL of the web_connectivity test helper")
+	verbose       = flag.Bool("verbose", false, "Run in verbose mode")
+)
+
+func newHandler() *probeservicesd.Handler {
+	handler := probeservicesd.NewHandler()
+	handler.SupportsBatch = !*disableBatch
+	handler.SupportsGzip = !*disableGzip
+	handler.TokenLifetime = *tokenLifetime
+	if *webHelper != "" {
+		handler.TestHelpers["web-connectivity"] = []model.Service{{
+			Address: *webHelper,
+			Type:    "https",
+		}}
+	}
+	if *faultDelay > 0 || *faultStatus != 0 {
+		handler.SetFault(*faultEndpoint, &probeservicesd.Fault{
+			Count:      *faultCount,
+			Delay:      *faultDelay,
+			StatusCode: *faultStatus,
+		})
+	}
+	return handler
+}
+
+func main() {
+	flag.Parse()
+	log.SetLevel(log.InfoLevel)
+	if *verbose {
+		log.SetLevel(log.DebugLevel)
+	}
+	log.SetHandler(cli.Default)
+	handler := newHandler()
+	server := &http.Server{
+		Addr: *address,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			log.Debugf("probeservicesd: %s %s", r.Method, r.URL.Path)
+			handler.ServeHTTP(w, r)
+		}),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Infof("probeservicesd: listening at %s", *address)
+	err := server.ListenAndServe()
+	runtimex.PanicOnError(err, "server.ListenAndServe failed")
+}
@@ -152,6 +152,9 @@ func (cb *sessionExperimentCallbacks) OnProgress(percentage float64, message str
 
 // SaveMeasurement saves a measurement on the specified file path.
 func (e *Experiment) SaveMeasurement(measurement *model.Measurement, filePath string) error {
+	if err := e.maybeSignMeasurement(measurement); err != nil {
+		return err
+	}
 	return e.saveMeasurement(
 		measurement, filePath, json.Marshal, os.OpenFile,
 		func(fp *os.File, b []byte) (int, error) {
@@ -160,13 +163,71 @@ func (e *Experiment) SaveMeasurement(measurement *model.Measurement, filePath st
 	)
 }
 
+// SaveMeasurementTo saves a measurement into the specified sink.
+func (e *Experiment) SaveMeasurementTo(
+	sink MeasurementSink, measurement *model.Measurement) error {
+	if err := e.maybeSignMeasurement(measurement); err != nil {
+		return err
+	}
+	return sink.SaveMeasurement(context.Background(), measurement)
+}
+
 // SubmitAndUpdateMeasurement submits a measurement and updates the
-// fields whose value has changed as part of the submission.
+// fields whose value has changed as part of the submission. If the
+// submission fails, we add the measurement to the session's submission
+// queue, so that Session.FlushSubmissionQueue may retry later.
 func (e *Experiment) SubmitAndUpdateMeasurement(measurement *model.Measurement) error {
 	if e.report == nil {
 		return errors.New("Report is not open")
 	}
-	return e.report.SubmitMeasurement(context.Background(), measurement)
+	if err := e.maybeSignMeasurement(measurement); err != nil {
+		return err
+	}
+	err := e.report.SubmitMeasurement(context.Background(), measurement)
+	if err != nil {
+		if qerr := e.session.submitQueue.Add(measurement, err); qerr != nil {
+			e.session.logger.Warnf("experiment: cannot queue measurement: %s", qerr.Error())
+		}
+	}
+	return err
+}
+
+// SubmitAndUpdateMeasurements is like SubmitAndUpdateMeasurement but
+// submits several measurements at once, when the collector supports it,
+// to reduce the number of requests. Returns a slice containing, for each
+// measurement, the error that occurred, like SubmitMeasurements of
+// probeservices.Report, whose documentation also explains why a failed
+// batch may lead to duplicate measurements. We add each measurement we
+// could not submit to the session's submission queue, along with the
+// error that occurred when submitting it.
+func (e *Experiment) SubmitAndUpdateMeasurements(measurements []*model.Measurement) []error {
+	errs := make([]error, len(measurements))
+	if e.report == nil {
+		for idx := range errs {
+			errs[idx] = errors.New("Report is not open")
+		}
+		return errs
+	}
+	var (
+		indexes []int
+		signed  []*model.Measurement
+	)
+	for idx, measurement := range measurements {
+		if errs[idx] = e.maybeSignMeasurement(measurement); errs[idx] == nil {
+			indexes = append(indexes, idx)
+			signed = append(signed, measurement)
+		}
+	}
+	for idx, err := range e.report.SubmitMeasurements(context.Background(), signed) {
+		errs[indexes[idx]] = err
+		if err == nil {
+			continue
+		}
+		if qerr := e.session.submitQueue.Add(signed[idx], err); qerr != nil {
+			e.session.logger.Warnf("experiment: cannot queue measurement: %s", qerr.Error())
+		}
+	}
+	return errs
 }
 
 // CloseReport is an idempotent method that closes an open report
@@ -250,6 +311,16 @@ func (e *Experiment) newReportTemplate() probeservices.ReportTemplate {
 	}
 }
 
+// maybeSignMeasurement signs the measurement if the session has been
+// configured to sign measurements. Because the signature does not cover
+// the fields set by the collector, we can sign before submitting.
+func (e *Experiment) maybeSignMeasurement(measurement *model.Measurement) error {
+	if e.session.signingKey == nil {
+		return nil
+	}
+	return probeservices.SignMeasurement(measurement, e.session.signingKey)
+}
+
 func (e *Experiment) saveMeasurement(
 	measurement *model.Measurement, filePath string,
 	marshal func(v interface{}) ([]byte, error),
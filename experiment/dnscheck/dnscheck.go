@@ -22,6 +22,16 @@
 // By default, we resolve `example.org`. There is an experiment option
 // called TargetDomain allowing you to change that.
 //
+// When the DNSSECValidation option is set, we validate the replies
+// using DNSSEC and we include the result of the validation (i.e.,
+// dnssec_secure, dnssec_insecure or dnssec_bogus) in each query. A bogus
+// reply for a signed domain is strong evidence of DNS tampering.
+//
+// The QueryTypes option contains a comma separated list of additional
+// query types (e.g. `HTTPS,TXT,NS`) to send for the domain after we have
+// resolved its addresses. The corresponding queries, including their
+// answers, appear in the same queries list as the A and AAAA queries.
+//
 // Input URL format
 //
 // To perform DNS over UDP, use `udp://<address_or_domain>[:<port>]`.
@@ -32,6 +42,12 @@
 //
 // For DNS over HTTPS, use `https://<address_or_domain>[:<port>]/<path>`.
 //
+// For DNS over QUIC, use `doq://<address_or_domain>[:<port>]`.
+//
+// For DNS over HTTP/3, use `h3://<address_or_domain>[:<port>]/<path>`.
+// DNS over QUIC and DNS over HTTP/3 fail when we are built with the
+// DISABLE_QUIC tag (see the netx package).
+//
 // When the `<port>` is missing, we use the correct default.
 //
 // Output data format
@@ -63,13 +79,15 @@ import (
 
 const (
 	testName      = "dnscheck"
-	testVersion   = "0.0.1"
+	testVersion   = "0.0.3"
 	defaultDomain = "example.org"
 )
 
 // Config contains the experiment's configuration.
 type Config struct {
-	Domain string `ooni:"domain to resolve using the specified resolver"`
+	DNSSECValidation bool   `ooni:"validate the replies using DNSSEC"`
+	Domain           string `ooni:"domain to resolve using the specified resolver"`
+	QueryTypes       string `ooni:"additional query types to send (e.g. 'HTTPS,TXT')"`
 }
 
 // TestKeys contains the results of the dnscheck experiment.
@@ -136,7 +154,7 @@ func (m Measurer) Run(
 		return fmt.Errorf("%w: %s", ErrInvalidURL, err.Error())
 	}
 	switch URL.Scheme {
-	case "https", "dot", "udp", "tcp":
+	case "https", "dot", "udp", "tcp", "doq", "h3":
 		// all good
 	default:
 		return ErrUnsupportedURLScheme
@@ -173,6 +191,8 @@ func (m Measurer) Run(
 				RejectDNSBogons:  true,     // bogons are errors in this context
 				ResolverURL:      makeResolverURL(URL, addr),
 				DNSTLSServerName: URL.Hostname(), // just the domain/IP for SNI
+				DNSSECValidation: m.Config.DNSSECValidation,
+				DNSQueryTypes:    m.Config.QueryTypes,
 			},
 			Target: fmt.Sprintf("dnslookup://%s", domain), // urlgetter wants a URL
 		})
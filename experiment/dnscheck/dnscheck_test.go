@@ -18,7 +18,7 @@ func TestExperimentNameAndVersion(t *testing.T) {
 		t.Error("unexpected experiment name")
 	}
 
-	if measurer.ExperimentVersion() != "0.0.1" {
+	if measurer.ExperimentVersion() != "0.0.2" {
 		t.Error("unexpected experiment version")
 	}
 }
@@ -137,6 +137,62 @@ func TestDNSCheckValid(t *testing.T) {
 	}
 }
 
+func TestDNSCheckValidWithDNSSEC(t *testing.T) {
+	measurer := NewExperimentMeasurer(Config{DNSSECValidation: true})
+	measurement := model.Measurement{Input: "dot://one.one.one.one:853"}
+	err := measurer.Run(
+		context.Background(),
+		newsession(),
+		&measurement,
+		model.NewPrinterCallbacks(log.Log),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	tk := measurement.TestKeys.(*TestKeys)
+	if len(tk.Lookups) <= 0 {
+		t.Fatal("unexpected value for lookups")
+	}
+	for URL, lookup := range tk.Lookups {
+		var secure bool
+		for _, query := range lookup.Queries {
+			if query.QueryType == "A" && query.DNSSEC == "dnssec_secure" {
+				secure = true
+			}
+		}
+		if !secure {
+			t.Fatalf("%s: expected a secure A query", URL)
+		}
+	}
+}
+
+func TestDNSCheckValidWithQueryTypes(t *testing.T) {
+	measurer := NewExperimentMeasurer(Config{QueryTypes: "NS,TXT"})
+	measurement := model.Measurement{Input: "dot://one.one.one.one:853"}
+	err := measurer.Run(
+		context.Background(),
+		newsession(),
+		&measurement,
+		model.NewPrinterCallbacks(log.Log),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	tk := measurement.TestKeys.(*TestKeys)
+	if len(tk.Lookups) <= 0 {
+		t.Fatal("unexpected value for lookups")
+	}
+	for URL, lookup := range tk.Lookups {
+		seen := make(map[string]bool)
+		for _, query := range lookup.Queries {
+			seen[query.QueryType] = len(query.Answers) > 0
+		}
+		if !seen["NS"] || !seen["TXT"] {
+			t.Fatalf("%s: expected NS and TXT answers", URL)
+		}
+	}
+}
+
 func newsession() model.ExperimentSession {
 	return &mockable.Session{MockableLogger: log.Log}
 }
@@ -0,0 +1,327 @@
+// Package echcheck contains the ECH check experiment.
+//
+// This experiment is not part of the OONI specification. It measures
+// whether we can perform a TLS handshake using an Encrypted ClientHello
+// (ECH) with an endpoint serving the domain in input.
+//
+// Description of the experiment
+//
+// The input is a domain, optionally followed by a port, or a URL, in which
+// case we use its hostname and port (default: 443). We resolve the domain
+// using the resolver described by the ResolverURL option and we select its
+// first address. We also fetch the ECHConfigList contained by the HTTPS
+// record of the domain. You can skip these lookups using the Address
+// option, which must contain an IP address and a port, and the ECHConfig
+// option.
+//
+// Then, we perform three TLS handshakes with the same endpoint, one after
+// the other, (1) using ECH, (2) using the domain as plain SNI and (3) using
+// no SNI and no certificate verification. By comparing their results we
+// classify the ECH handshake like sni_blocking does with its target. When
+// the ECH handshake fails because of possible interference but the plain
+// SNI handshake also fails, we say the interference is not ECH specific.
+//
+// Sending ECH requires building with Go >= 1.23. Otherwise, this experiment
+// refuses to run and fails with ErrECHNotSupported.
+package echcheck
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ooni/probe-engine/experiment/urlgetter"
+	"github.com/ooni/probe-engine/model"
+	"github.com/ooni/probe-engine/netx"
+	"github.com/ooni/probe-engine/netx/archival"
+	"github.com/ooni/probe-engine/netx/dialer"
+	"github.com/ooni/probe-engine/netx/errorx"
+	"github.com/ooni/probe-engine/netx/resolver"
+	"github.com/ooni/probe-engine/netx/trace"
+)
+
+const (
+	testName           = "echcheck"
+	testVersion        = "0.1.0"
+	defaultResolverURL = "doh://cloudflare"
+)
+
+// Config contains the experiment config.
+type Config struct {
+	Address     string `ooni:"endpoint to measure (default: first address of the domain)"`
+	ECHConfig   string `ooni:"base64 ECHConfigList to use (default: the one in the HTTPS record)"`
+	ResolverURL string `ooni:"URL describing the resolver to use (default: doh://cloudflare)"`
+}
+
+// Subresult contains the keys of a single TLS handshake.
+type Subresult struct {
+	urlgetter.TestKeys
+	SNI string `json:"sni"`
+}
+
+// TestKeys contains echcheck test keys.
+type TestKeys struct {
+	Address          string              `json:"address"`
+	Bootstrap        *urlgetter.TestKeys `json:"bootstrap"`
+	BootstrapFailure *string             `json:"bootstrap_failure"`
+	ECH              Subresult           `json:"ech"`
+	ECHConfigSource  string              `json:"ech_config_source"`
+	NoSNI            Subresult           `json:"no_sni"`
+	PlainSNI         Subresult           `json:"plain_sni"`
+	Result           string              `json:"result"`
+}
+
+const (
+	classAnomalyBootstrapFailure        = "anomaly.bootstrap_failure"
+	classAnomalyECHRejected             = "anomaly.ech_rejected"
+	classAnomalyEndpointUnreachable     = "anomaly.endpoint_unreachable"
+	classAnomalyNoECHConfig             = "anomaly.no_ech_config"
+	classAnomalyTimeout                 = "anomaly.timeout"
+	classAnomalyUnexpectedFailure       = "anomaly.unexpected_failure"
+	classInterferenceClosed             = "interference.closed"
+	classInterferenceInvalidCertificate = "interference.invalid_certificate"
+	classInterferenceNotECHSpecific     = "interference.not_ech_specific"
+	classInterferenceReset              = "interference.reset"
+	classInterferenceUnknownAuthority   = "interference.unknown_authority"
+	classSuccessECHAccepted             = "success.ech_accepted"
+)
+
+func (tk *TestKeys) classify() string {
+	if tk.ECH.Failure == nil {
+		return classSuccessECHAccepted
+	}
+	switch *tk.ECH.Failure {
+	case errorx.FailureConnectionRefused:
+		return classAnomalyEndpointUnreachable
+	case errorx.FailureConnectionReset:
+		return tk.interference(classInterferenceReset)
+	case errorx.FailureEOFError:
+		return tk.interference(classInterferenceClosed)
+	case errorx.FailureGenericTimeoutError:
+		if tk.NoSNI.Failure != nil {
+			return classAnomalyEndpointUnreachable
+		}
+		return classAnomalyTimeout
+	case errorx.FailureSSLECHRejected:
+		return classAnomalyECHRejected
+	case errorx.FailureSSLInvalidCertificate:
+		return tk.interference(classInterferenceInvalidCertificate)
+	case errorx.FailureSSLUnknownAuthority:
+		return tk.interference(classInterferenceUnknownAuthority)
+	}
+	return classAnomalyUnexpectedFailure
+}
+
+// interference returns class when the plain SNI handshake succeeded,
+// therefore the ECH handshake failure is specific to ECH. Otherwise
+// it returns classInterferenceNotECHSpecific.
+func (tk *TestKeys) interference(class string) string {
+	if tk.PlainSNI.Failure != nil {
+		return classInterferenceNotECHSpecific
+	}
+	return class
+}
+
+// Measurer performs the measurement.
+type Measurer struct {
+	Config
+}
+
+// ExperimentName implements ExperimentMeasurer.ExperimentName.
+func (m Measurer) ExperimentName() string {
+	return testName
+}
+
+// ExperimentVersion implements ExperimentMeasurer.ExperimentVersion.
+func (m Measurer) ExperimentVersion() string {
+	return testVersion
+}
+
+// The following errors may be returned by this experiment. Of course these
+// errors are in addition to any other errors returned by the low level packages
+// that are used by this experiment to implement its functionality.
+var (
+	ErrECHNotSupported  = errors.New("this build cannot send ECH")
+	ErrInputRequired    = errors.New("this experiment needs input")
+	ErrInvalidECHConfig = errors.New("the ECHConfig option is invalid")
+	ErrInvalidInput     = errors.New("the input is not a valid domain or URL")
+)
+
+// CheckSupported returns ErrECHNotSupported if this build cannot run
+// this experiment, because it cannot send ECH.
+func CheckSupported() error {
+	if !dialer.ECHSupported {
+		return ErrECHNotSupported
+	}
+	return nil
+}
+
+// parseInput returns the domain and the port described by the input,
+// which is either a domain, optionally followed by a port, or a URL
+// (e.g. from the test lists). The default port is 443.
+func parseInput(input model.MeasurementTarget) (string, string, error) {
+	if strings.Contains(string(input), "://") {
+		parsed, err := url.Parse(string(input))
+		if err != nil {
+			return "", "", err
+		}
+		return checkDomainAndPort(parsed.Hostname(), parsed.Port())
+	}
+	domain, port, err := net.SplitHostPort(string(input))
+	if err != nil {
+		domain, port = string(input), "" // e.g. example.com
+	}
+	return checkDomainAndPort(domain, port)
+}
+
+// checkDomainAndPort returns the domain and the port, using the default
+// port when port is empty, or ErrInvalidInput if they are not valid.
+func checkDomainAndPort(domain, port string) (string, string, error) {
+	if port == "" {
+		port = "443"
+	}
+	if domain == "" || strings.ContainsAny(domain, "/[] \t\r\n") {
+		return "", "", fmt.Errorf("%w: invalid domain: %q", ErrInvalidInput, domain)
+	}
+	if value, err := strconv.Atoi(port); err != nil || value <= 0 || value > 65535 {
+		return "", "", fmt.Errorf("%w: invalid port: %q", ErrInvalidInput, port)
+	}
+	return domain, port, nil
+}
+
+// bootstrap looks up the address of the domain, if needed, and the
+// ECHConfigList of the domain, if needed, and saves the results into tk.
+func (m Measurer) bootstrap(
+	ctx context.Context, sess model.ExperimentSession, begin time.Time,
+	tk *TestKeys, domain, port string, list []byte,
+) ([]byte, error) {
+	resolverURL := m.Config.ResolverURL
+	if resolverURL == "" {
+		resolverURL = defaultResolverURL
+	}
+	evsaver := new(trace.Saver)
+	config := netx.Config{Logger: sess.Logger(), ResolveSaver: evsaver}
+	dnsclient, err := netx.NewDNSClient(config, resolverURL)
+	if err != nil {
+		return nil, err
+	}
+	defer dnsclient.CloseIdleConnections()
+	defer func() {
+		tk.Bootstrap = &urlgetter.TestKeys{Queries: archival.NewDNSQueriesList(
+			begin, evsaver.Read(), sess.ASNDatabasePath())}
+	}()
+	if tk.Address == "" {
+		config.BaseResolver = dnsclient.Resolver
+		addrs, err := netx.NewResolver(config).LookupHost(ctx, domain)
+		if err != nil {
+			return nil, err
+		}
+		tk.Address = net.JoinHostPort(addrs[0], port)
+	}
+	if list == nil {
+		tk.ECHConfigSource = "dns"
+		return netx.LookupECHConfigList(ctx, dnsclient.Resolver, domain)
+	}
+	return list, nil
+}
+
+func (m Measurer) measureone(
+	ctx context.Context, sess model.ExperimentSession, begin time.Time,
+	address, sni string, config urlgetter.Config,
+) Subresult {
+	g := urlgetter.Getter{
+		Begin:   begin,
+		Config:  config,
+		Session: sess,
+		Target:  fmt.Sprintf("tlshandshake://%s", address),
+	}
+	// Ignoring the error because g.Get() sets the tk.Failure field
+	// to be the OONI equivalent of the error that occurred.
+	tk, _ := g.Get(ctx)
+	sess.Logger().Debugf("echcheck: %s: %s", address, asString(tk.Failure))
+	return Subresult{SNI: sni, TestKeys: tk}
+}
+
+// Run implements ExperimentMeasurer.Run.
+func (m Measurer) Run(
+	ctx context.Context,
+	sess model.ExperimentSession,
+	measurement *model.Measurement,
+	callbacks model.ExperimentCallbacks,
+) error {
+	if err := CheckSupported(); err != nil {
+		return err
+	}
+	tk := new(TestKeys)
+	measurement.TestKeys = tk
+	urlgetter.RegisterExtensions(measurement)
+	if measurement.Input == "" {
+		return ErrInputRequired
+	}
+	domain, port, err := parseInput(measurement.Input)
+	if err != nil {
+		return err
+	}
+	var list []byte
+	if m.Config.ECHConfig != "" {
+		list, err = base64.StdEncoding.DecodeString(m.Config.ECHConfig)
+		if err != nil || len(list) <= 0 {
+			return ErrInvalidECHConfig
+		}
+		tk.ECHConfigSource = "user"
+	}
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+	begin := measurement.MeasurementStartTimeSaved
+	tk.Address = m.Config.Address
+	if tk.Address == "" || list == nil {
+		list, err = m.bootstrap(ctx, sess, begin, tk, domain, port, list)
+		if err != nil {
+			err = errorx.SafeErrWrapperBuilder{
+				Error:     err,
+				Operation: errorx.ResolveOperation,
+			}.MaybeBuild()
+			tk.BootstrapFailure = archival.NewFailure(err)
+			tk.Result = classAnomalyBootstrapFailure
+			if errors.Is(err, resolver.ErrNoECHConfigList) {
+				tk.Result = classAnomalyNoECHConfig
+			}
+			sess.Logger().Infof("echcheck: result: %s", tk.Result)
+			return nil
+		}
+	}
+	tk.ECH = m.measureone(ctx, sess, begin, tk.Address, domain, urlgetter.Config{
+		ECHConfig:     base64.StdEncoding.EncodeToString(list),
+		TLSServerName: domain,
+	})
+	tk.PlainSNI = m.measureone(ctx, sess, begin, tk.Address, domain, urlgetter.Config{
+		TLSServerName: domain,
+	})
+	// Implementation note: when the TLS server name is an IP address,
+	// crypto/tls does not include the SNI extension in the ClientHello.
+	tk.NoSNI = m.measureone(ctx, sess, begin, tk.Address, "", urlgetter.Config{
+		NoTLSVerify: true,
+	})
+	tk.Result = tk.classify()
+	sess.Logger().Infof("echcheck: result: %s", tk.Result)
+	return nil
+}
+
+// NewExperimentMeasurer creates a new ExperimentMeasurer.
+func NewExperimentMeasurer(config Config) model.ExperimentMeasurer {
+	return Measurer{Config: config}
+}
+
+func asString(failure *string) (result string) {
+	result = "success"
+	if failure != nil {
+		result = *failure
+	}
+	return
+}
@@ -0,0 +1,96 @@
+//go:build go1.24
+// +build go1.24
+
+package echcheck
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/ooni/probe-engine/internal/tlsx"
+	"github.com/ooni/probe-engine/model"
+	"github.com/ooni/probe-engine/netx"
+)
+
+// runWithECHServer runs the experiment against a local TLS server, which
+// uses keys to accept ECH, and returns the test keys.
+func runWithECHServer(
+	t *testing.T, list []byte, keys []tls.EncryptedClientHelloKey) *TestKeys {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{
+		EncryptedClientHelloKeys: keys,
+		MinVersion:               tls.VersionTLS13,
+	}
+	server.StartTLS()
+	defer server.Close()
+	// make sure we trust the certificate of the local server
+	savedCertPool := netx.CertPool
+	defer func() {
+		netx.CertPool = savedCertPool
+	}()
+	netx.CertPool = x509.NewCertPool()
+	netx.CertPool.AddCert(server.Certificate())
+	measurer := NewExperimentMeasurer(Config{
+		Address:   server.Listener.Addr().String(),
+		ECHConfig: base64.StdEncoding.EncodeToString(list),
+	})
+	measurement := &model.Measurement{Input: "https://example.com/"}
+	err := measurer.Run(
+		context.Background(), newsession(), measurement,
+		model.NewPrinterCallbacks(log.Log),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return measurement.TestKeys.(*TestKeys)
+}
+
+func TestUnitMeasurerRunWithECHServer(t *testing.T) {
+	key, err := tlsx.NewECHKey(1, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tk := runWithECHServer(t, key.ConfigList, []tls.EncryptedClientHelloKey{{
+		Config:     key.Config,
+		PrivateKey: key.PrivateKey,
+	}})
+	if tk.Result != classSuccessECHAccepted {
+		t.Fatal("unexpected result", tk.Result)
+	}
+	if tk.ECHConfigSource != "user" || tk.Bootstrap != nil {
+		t.Fatal("we should not have performed the bootstrap")
+	}
+	if len(tk.ECH.TLSHandshakes) != 1 || !tk.ECH.TLSHandshakes[0].ECHAccepted {
+		t.Fatal("expected the server to accept ECH")
+	}
+	if tk.ECH.SNI != "example.com" || tk.PlainSNI.SNI != "example.com" {
+		t.Fatal("unexpected SNI")
+	}
+	if tk.PlainSNI.Failure != nil || tk.NoSNI.Failure != nil {
+		t.Fatal("expected the other handshakes to succeed")
+	}
+	if len(tk.NoSNI.TLSHandshakes) != 1 || tk.NoSNI.TLSHandshakes[0].ECHOffered {
+		t.Fatal("we should not have offered ECH without SNI")
+	}
+}
+
+func TestUnitMeasurerRunWithoutECHServer(t *testing.T) {
+	key, err := tlsx.NewECHKey(1, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tk := runWithECHServer(t, key.ConfigList, nil)
+	if tk.Result != classAnomalyECHRejected {
+		t.Fatal("unexpected result", tk.Result)
+	}
+	if tk.PlainSNI.Failure != nil || tk.NoSNI.Failure != nil {
+		t.Fatal("expected the other handshakes to succeed")
+	}
+}
@@ -0,0 +1,218 @@
+package echcheck
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/ooni/probe-engine/internal/mockable"
+	"github.com/ooni/probe-engine/model"
+	"github.com/ooni/probe-engine/netx/dialer"
+	"github.com/ooni/probe-engine/netx/errorx"
+)
+
+func TestUnitTestKeysClassify(t *testing.T) {
+	asStringPtr := func(s string) *string {
+		return &s
+	}
+	cases := []struct {
+		name     string
+		ech      string
+		plainSNI string
+		noSNI    string
+		expected string
+	}{{
+		name:     "with success",
+		expected: classSuccessECHAccepted,
+	}, {
+		name:     "with connection_refused",
+		ech:      errorx.FailureConnectionRefused,
+		expected: classAnomalyEndpointUnreachable,
+	}, {
+		name:     "with connection_reset",
+		ech:      errorx.FailureConnectionReset,
+		expected: classInterferenceReset,
+	}, {
+		name:     "with connection_reset also for plain SNI",
+		ech:      errorx.FailureConnectionReset,
+		plainSNI: errorx.FailureConnectionReset,
+		expected: classInterferenceNotECHSpecific,
+	}, {
+		name:     "with eof_error",
+		ech:      errorx.FailureEOFError,
+		expected: classInterferenceClosed,
+	}, {
+		name:     "with generic_timeout_error",
+		ech:      errorx.FailureGenericTimeoutError,
+		expected: classAnomalyTimeout,
+	}, {
+		name:     "with generic_timeout_error also for no SNI",
+		ech:      errorx.FailureGenericTimeoutError,
+		plainSNI: errorx.FailureGenericTimeoutError,
+		noSNI:    errorx.FailureGenericTimeoutError,
+		expected: classAnomalyEndpointUnreachable,
+	}, {
+		name:     "with ssl_ech_rejected",
+		ech:      errorx.FailureSSLECHRejected,
+		expected: classAnomalyECHRejected,
+	}, {
+		name:     "with ssl_invalid_certificate",
+		ech:      errorx.FailureSSLInvalidCertificate,
+		expected: classInterferenceInvalidCertificate,
+	}, {
+		name:     "with ssl_unknown_authority",
+		ech:      errorx.FailureSSLUnknownAuthority,
+		expected: classInterferenceUnknownAuthority,
+	}, {
+		name:     "with unknown failure",
+		ech:      "unknown_failure: antani",
+		expected: classAnomalyUnexpectedFailure,
+	}}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tk := new(TestKeys)
+			if c.ech != "" {
+				tk.ECH.Failure = asStringPtr(c.ech)
+			}
+			if c.plainSNI != "" {
+				tk.PlainSNI.Failure = asStringPtr(c.plainSNI)
+			}
+			if c.noSNI != "" {
+				tk.NoSNI.Failure = asStringPtr(c.noSNI)
+			}
+			if tk.classify() != c.expected {
+				t.Fatal("unexpected result")
+			}
+		})
+	}
+}
+
+func TestUnitNewExperimentMeasurer(t *testing.T) {
+	measurer := NewExperimentMeasurer(Config{})
+	if measurer.ExperimentName() != "echcheck" {
+		t.Fatal("unexpected name")
+	}
+	if measurer.ExperimentVersion() != "0.1.0" {
+		t.Fatal("unexpected version")
+	}
+}
+
+func TestUnitParseInput(t *testing.T) {
+	cases := []struct {
+		input  model.MeasurementTarget
+		domain string
+		port   string
+		err    error
+	}{
+		{input: "example.com", domain: "example.com", port: "443"},
+		{input: "example.com:8443", domain: "example.com", port: "8443"},
+		{input: "93.184.216.34:8443", domain: "93.184.216.34", port: "8443"},
+		{input: "[::1]:8443", domain: "::1", port: "8443"},
+		{input: "https://example.com", domain: "example.com", port: "443"},
+		{input: "https://example.com:8443/robots.txt", domain: "example.com", port: "8443"},
+		{input: ":8443", err: ErrInvalidInput},
+		{input: "example.com:", domain: "example.com", port: "443"},
+		{input: "example.com:https", err: ErrInvalidInput},
+		{input: "example.com:65536", err: ErrInvalidInput},
+		{input: "example.com/robots.txt", err: ErrInvalidInput},
+		{input: "https:///robots.txt", err: ErrInvalidInput},
+		{input: "\t", err: ErrInvalidInput},
+	}
+	for _, c := range cases {
+		t.Run(string(c.input), func(t *testing.T) {
+			domain, port, err := parseInput(c.input)
+			if !errors.Is(err, c.err) {
+				t.Fatal("not the error we expected", err)
+			}
+			if domain != c.domain || port != c.port {
+				t.Fatal("unexpected result", domain, port)
+			}
+		})
+	}
+	t.Run("for invalid URL", func(t *testing.T) {
+		if _, _, err := parseInput("https://\t"); err == nil {
+			t.Fatal("expected an error here")
+		}
+	})
+}
+
+func TestUnitCheckSupported(t *testing.T) {
+	err := CheckSupported()
+	if dialer.ECHSupported {
+		if err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	if !errors.Is(err, ErrECHNotSupported) {
+		t.Fatal("not the error we expected", err)
+	}
+	// We must refuse to run rather than producing a measurement.
+	measurement := &model.Measurement{Input: "example.com"}
+	err = NewExperimentMeasurer(Config{}).Run(
+		context.Background(), newsession(), measurement,
+		model.NewPrinterCallbacks(log.Log),
+	)
+	if !errors.Is(err, ErrECHNotSupported) {
+		t.Fatal("not the error we expected", err)
+	}
+	if measurement.TestKeys != nil {
+		t.Fatal("expected no test keys")
+	}
+}
+
+func TestUnitMeasurerRunNoMeasurementInput(t *testing.T) {
+	skipIfECHNotSupported(t)
+	measurer := NewExperimentMeasurer(Config{})
+	err := measurer.Run(
+		context.Background(), newsession(), new(model.Measurement),
+		model.NewPrinterCallbacks(log.Log),
+	)
+	if !errors.Is(err, ErrInputRequired) {
+		t.Fatal("not the error we expected")
+	}
+}
+
+func TestUnitMeasurerRunInvalidECHConfig(t *testing.T) {
+	skipIfECHNotSupported(t)
+	measurer := NewExperimentMeasurer(Config{ECHConfig: "@@@"})
+	err := measurer.Run(
+		context.Background(), newsession(),
+		&model.Measurement{Input: "example.com"},
+		model.NewPrinterCallbacks(log.Log),
+	)
+	if !errors.Is(err, ErrInvalidECHConfig) {
+		t.Fatal("not the error we expected")
+	}
+}
+
+func TestUnitMeasurerRunBootstrapFailure(t *testing.T) {
+	skipIfECHNotSupported(t)
+	measurer := NewExperimentMeasurer(Config{ResolverURL: "antani://"})
+	measurement := &model.Measurement{Input: "example.com"}
+	err := measurer.Run(
+		context.Background(), newsession(), measurement,
+		model.NewPrinterCallbacks(log.Log),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tk := measurement.TestKeys.(*TestKeys)
+	if tk.BootstrapFailure == nil {
+		t.Fatal("expected a bootstrap failure here")
+	}
+	if tk.Result != classAnomalyBootstrapFailure {
+		t.Fatal("unexpected result")
+	}
+}
+
+func skipIfECHNotSupported(t *testing.T) {
+	if !dialer.ECHSupported {
+		t.Skip("this build cannot send ECH")
+	}
+}
+
+func newsession() model.ExperimentSession {
+	return &mockable.Session{MockableLogger: log.Log}
+}
@@ -117,6 +117,9 @@ func (tk *TestKeys) ComputeEndpointStatus(v urlgetter.MultiOutput, dns, tcp **bo
 	}
 	for _, query := range v.TestKeys.Queries {
 		for _, ans := range query.Answers {
+			if ans.AnswerType == "CNAME" {
+				continue // CNAMEs do not have an ASN
+			}
 			if ans.ASN != FacebookASN {
 				tk.FacebookDNSBlocking = &trueValue
 				*dns = &falseValue
@@ -209,6 +209,33 @@ func TestComputeEndpointStatsDNSIsLying(t *testing.T) {
 	}
 }
 
+func TestComputeEndpointStatsCNAMEIsIgnored(t *testing.T) {
+	tk := fbmessenger.TestKeys{}
+	tk.Update(urlgetter.MultiOutput{
+		Input: urlgetter.MultiInput{Target: fbmessenger.ServiceEdge},
+		TestKeys: urlgetter.TestKeys{
+			Queries: []archival.DNSQueryEntry{{
+				Answers: []archival.DNSAnswerEntry{{
+					AnswerType: "CNAME",
+					Hostname:   "star.c10r.facebook.com",
+				}, {
+					ASN:        fbmessenger.FacebookASN,
+					AnswerType: "A",
+				}},
+			}},
+		},
+	})
+	if *tk.FacebookEdgeDNSConsistent != true {
+		t.Fatal("invalid FacebookEdgeDNSConsistent")
+	}
+	if *tk.FacebookEdgeReachable != true {
+		t.Fatal("invalid FacebookEdgeReachable")
+	}
+	if tk.FacebookDNSBlocking != nil { // meaning: not determined yet
+		t.Fatal("invalid FacebookDNSBlocking")
+	}
+}
+
 func newsession(t *testing.T) model.ExperimentSession {
 	sess, err := engine.NewSession(engine.SessionConfig{
 		AssetsDir: "../../testdata",
@@ -1,10 +1,14 @@
 package hhfm_test
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -54,3 +58,70 @@ func (fb FakeBody) Read(p []byte) (int, error) {
 func (fb FakeBody) Close() error {
 	return nil
 }
+
+// FakeHelper is a http-return-json-headers helper. We cannot use
+// net/http for implementing it, because it canonicalizes the header
+// names, so we read the request line and the headers by hand.
+type FakeHelper struct {
+	Listener net.Listener
+}
+
+func NewFakeHelper() (*FakeHelper, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	fh := &FakeHelper{Listener: listener}
+	go fh.serve()
+	return fh, nil
+}
+
+func (fh *FakeHelper) URL() string {
+	return fmt.Sprintf("http://%s/", fh.Listener.Addr().String())
+}
+
+func (fh *FakeHelper) Close() error {
+	return fh.Listener.Close()
+}
+
+func (fh *FakeHelper) serve() {
+	for {
+		conn, err := fh.Listener.Accept()
+		if err != nil {
+			return
+		}
+		go fh.handle(conn)
+	}
+}
+
+func (fh *FakeHelper) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	requestLine, err := reader.ReadString('\n')
+	if err != nil {
+		return
+	}
+	headers := make(map[string][]string)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		if v := strings.SplitN(line, ":", 2); len(v) == 2 {
+			headers[v[0]] = append(headers[v[0]], strings.TrimSpace(v[1]))
+		}
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"headers_dict": headers,
+		"request_line": strings.TrimRight(requestLine, "\r\n"),
+	})
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(conn, "HTTP/1.1 200 OK\r\nContent-Length: %d\r\n"+
+		"Connection: close\r\n\r\n%s", len(data), data)
+}
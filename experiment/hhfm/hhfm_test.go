@@ -20,6 +20,7 @@ import (
 	"github.com/ooni/probe-engine/model"
 	"github.com/ooni/probe-engine/netx/archival"
 	"github.com/ooni/probe-engine/netx/errorx"
+	"github.com/ooni/probe-engine/netx/selfcensor"
 )
 
 func TestNewExperimentMeasurer(t *testing.T) {
@@ -239,6 +240,78 @@ func TestIntegrationCancelledContext(t *testing.T) {
 	}
 }
 
+func TestIntegrationSelfCensor(t *testing.T) {
+	helper, err := NewFakeHelper()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer helper.Close()
+	endpoint := helper.Listener.Addr().String()
+	defer selfcensor.Enable(`{}`)
+	cases := []struct {
+		name     string
+		spec     string
+		expected string
+	}{{
+		name: "without censorship",
+		spec: `{}`,
+	}, {
+		name:     "with the helper refusing connections",
+		spec:     `{"BlockedEndpoints":{"` + endpoint + `":"REJECT"}}`,
+		expected: errorx.FailureConnectionRefused,
+	}, {
+		name:     "with the helper timing out",
+		spec:     `{"BlockedEndpoints":{"` + endpoint + `":"TIMEOUT"}}`,
+		expected: errorx.FailureGenericTimeoutError,
+	}, {
+		name:     "with the request causing a RST",
+		spec:     `{"BlockedFingerprints":{"GeT / HTTP/1.1":"RST"}}`,
+		expected: errorx.FailureConnectionReset,
+	}, {
+		name:     "with a blockpage",
+		spec:     `{"HTTPBlockpages":{"*":"<html>blocked</html>"}}`,
+		expected: errorx.FailureJSONParseError,
+	}}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := selfcensor.Enable(c.spec); err != nil {
+				t.Fatal(err)
+			}
+			measurer := hhfm.NewExperimentMeasurer(hhfm.Config{})
+			sess := &mockable.Session{
+				MockableLogger: log.Log,
+				MockableTestHelpers: map[string][]model.Service{
+					"http-return-json-headers": {{
+						Address: helper.URL(),
+						Type:    "legacy",
+					}},
+				},
+			}
+			measurement := new(model.Measurement)
+			callbacks := model.NewPrinterCallbacks(log.Log)
+			if err := measurer.Run(context.Background(), sess, measurement, callbacks); err != nil {
+				t.Fatal(err)
+			}
+			tk := measurement.TestKeys.(*hhfm.TestKeys)
+			if c.expected == "" {
+				if tk.Failure != nil {
+					t.Fatal("unexpected failure", *tk.Failure)
+				}
+				if diff := cmp.Diff(hhfm.Tampering{HeaderNameDiff: []string{}}, tk.Tampering); diff != "" {
+					t.Fatal(diff)
+				}
+				return
+			}
+			if tk.Failure == nil || *tk.Failure != c.expected {
+				t.Fatal("not the failure we expected", tk.Failure)
+			}
+			if tk.Tampering.Total != true {
+				t.Fatal("invalid Tampering.Total")
+			}
+		})
+	}
+}
+
 func TestNoHelpers(t *testing.T) {
 	measurer := hhfm.NewExperimentMeasurer(hhfm.Config{})
 	ctx := context.Background()
@@ -30,6 +30,10 @@ type Config struct {
 
 	// TestHelperAddress is the address of the test helper.
 	TestHelperAddress string
+
+	// TLSFingerprint is the browser ClientHello we should mimic. When it
+	// is empty, we use the ClientHello of Go's crypto/tls.
+	TLSFingerprint string
 }
 
 // Subresult contains the keys of a single measurement
@@ -130,8 +134,11 @@ func (m *Measurer) measureone(
 	}
 	// perform the measurement
 	g := urlgetter.Getter{
-		Begin:   beginning,
-		Config:  urlgetter.Config{TLSServerName: sni},
+		Begin: beginning,
+		Config: urlgetter.Config{
+			TLSFingerprint: m.config.TLSFingerprint,
+			TLSServerName:  sni,
+		},
 		Session: sess,
 		Target:  fmt.Sprintf("tlshandshake://%s", thaddr),
 	}
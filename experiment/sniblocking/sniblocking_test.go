@@ -2,6 +2,16 @@ package sniblocking
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
@@ -9,7 +19,9 @@ import (
 	"github.com/apex/log"
 	"github.com/ooni/probe-engine/internal/mockable"
 	"github.com/ooni/probe-engine/model"
+	"github.com/ooni/probe-engine/netx"
 	"github.com/ooni/probe-engine/netx/errorx"
+	"github.com/ooni/probe-engine/netx/selfcensor"
 )
 
 const (
@@ -336,6 +348,25 @@ func TestUnitMeasureoneSuccess(t *testing.T) {
 	}
 }
 
+func TestUnitMeasureoneWithTLSFingerprint(t *testing.T) {
+	measurer := &Measurer{config: Config{TLSFingerprint: "chrome"}}
+	result := measurer.measureone(
+		context.Background(),
+		&mockable.Session{MockableLogger: log.Log},
+		time.Now(),
+		"kernel.org",
+		"example.com:443",
+	)
+	if len(result.TLSHandshakes) < 1 {
+		t.Fatal("not the expected TLSHandshakes")
+	}
+	for _, entry := range result.TLSHandshakes {
+		if entry.Fingerprint != "chrome" {
+			t.Fatal("not the expected Fingerprint")
+		}
+	}
+}
+
 func TestUnitMeasureonewithcacheWorks(t *testing.T) {
 	measurer := &Measurer{cache: make(map[string]Subresult)}
 	output := make(chan Subresult, 2)
@@ -425,3 +456,127 @@ func TestUnitMaybeURLToSNI(t *testing.T) {
 func newsession() model.ExperimentSession {
 	return &mockable.Session{MockableLogger: log.Log}
 }
+
+func TestIntegrationSelfCensor(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	expired := newExpiredTLSServer(t)
+	defer expired.Close()
+	savedCertPool := netx.CertPool
+	defer func() {
+		netx.CertPool = savedCertPool
+	}()
+	netx.CertPool = x509.NewCertPool()
+	netx.CertPool.AddCert(server.Certificate())
+	netx.CertPool.AddCert(expired.Certificate())
+	// The test helper is th.example.com, which we resolve to the
+	// server using selfcensor, so that we can also poison it.
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	thaddr := net.JoinHostPort("th.example.com", port)
+	endpoint := net.JoinHostPort("127.0.0.1", port)
+	resolve := `"PoisonSystemDNS":{"th.example.com":["127.0.0.1"]}`
+	defer selfcensor.Enable(`{}`)
+	cases := []struct {
+		name     string
+		spec     string
+		thaddr   string
+		expected string
+	}{{
+		name:     "without censorship",
+		spec:     `{` + resolve + `}`,
+		expected: classSuccessGotServerHello,
+	}, {
+		name:     "with the test helper not resolving",
+		spec:     `{"PoisonSystemDNS":{"th.example.com":["NXDOMAIN"]}}`,
+		expected: classAnomalyTestHelperUnreachable,
+	}, {
+		name:     "with the test helper refusing connections",
+		spec:     `{` + resolve + `,"BlockedEndpoints":{"` + endpoint + `":"REJECT"}}`,
+		expected: classAnomalyTestHelperUnreachable,
+	}, {
+		name:     "with the test helper timing out",
+		spec:     `{` + resolve + `,"BlockedEndpoints":{"` + endpoint + `":"TIMEOUT"}}`,
+		expected: classAnomalyTestHelperUnreachable,
+	}, {
+		name:     "with the SNI timing out",
+		spec:     `{` + resolve + `,"BlockedFingerprints":{"www.example.com":"TIMEOUT"}}`,
+		expected: classAnomalyTimeout,
+	}, {
+		name:     "with the SNI causing a RST",
+		spec:     `{` + resolve + `,"BlockedFingerprints":{"www.example.com":"RST"}}`,
+		expected: classInterferenceReset,
+	}, {
+		name:     "with the SNI causing an EOF",
+		spec:     `{` + resolve + `,"BlockedSNIs":{"www.example.com":"EOF"}}`,
+		expected: classInterferenceClosed,
+	}, {
+		name:     "with the SNI causing a MITM",
+		spec:     `{` + resolve + `,"BlockedSNIs":{"www.example.com":"MITM"}}`,
+		expected: classInterferenceUnknownAuthority,
+	}, {
+		name:     "with the SNI causing an alert",
+		spec:     `{` + resolve + `,"BlockedSNIs":{"www.example.com":"ALERT"}}`,
+		expected: classAnomalyUnexpectedFailure,
+	}, {
+		name:     "with an expired certificate",
+		spec:     `{}`,
+		thaddr:   expired.Listener.Addr().String(),
+		expected: classInterferenceInvalidCertificate,
+	}}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := selfcensor.Enable(c.spec); err != nil {
+				t.Fatal(err)
+			}
+			config := Config{ControlSNI: "example.com", TestHelperAddress: thaddr}
+			if c.thaddr != "" {
+				config.TestHelperAddress = c.thaddr
+			}
+			measurement := &model.Measurement{Input: "www.example.com"}
+			err := NewExperimentMeasurer(config).Run(
+				context.Background(), newsession(), measurement,
+				model.NewPrinterCallbacks(log.Log),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tk := measurement.TestKeys.(*TestKeys)
+			if tk.Result != c.expected {
+				t.Fatal("unexpected result", tk.Result)
+			}
+		})
+	}
+}
+
+// newExpiredTLSServer returns a TLS server for example.com and its
+// subdomains using a self-signed certificate that has expired.
+func newExpiredTLSServer(t *testing.T) *httptest.Server {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "example.com"},
+		DNSNames:              []string{"example.com", "*.example.com"},
+		NotBefore:             time.Now().Add(-2 * time.Hour),
+		NotAfter:              time.Now().Add(-time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(http.NotFoundHandler())
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	}
+	server.StartTLS()
+	return server
+}
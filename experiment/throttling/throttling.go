@@ -0,0 +1,349 @@
+// Package throttling contains the throttling experiment.
+//
+// This experiment is not part of the OONI specification. It measures
+// whether a censor throttles the traffic of a specific domain.
+//
+// Description of the experiment
+//
+// The input is the URL of a payload. We resolve the domain of the URL
+// using the system resolver and we select its first address. You can skip
+// this lookup using the Address option, which must contain an IP address.
+//
+// Then, we download the payload twice from the same address, one download
+// after the other, (1) using the domain of the URL as SNI and Host header
+// and (2) using the ControlDomain option as SNI and Host header. Each
+// download lasts at most MaxRuntime seconds. Like ndt7, we sample the
+// bytes received every 250 millisecond during each download.
+//
+// We compute the speed of each download from its samples, as the median
+// of the speed in each interval, starting from the first sample showing
+// that we received data. This way, the time spent connecting and doing
+// the TLS handshake does not affect the speed. When a download is so fast
+// that we have no such intervals, we use its average speed.
+//
+// If both downloads succeed, we compare their speed. We say that the target
+// domain is throttled when its speed is less than half the speed of the
+// control domain. Because the address is the same, what makes the two
+// downloads different is just the SNI or the Host header.
+package throttling
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/ooni/probe-engine/model"
+	"github.com/ooni/probe-engine/netx"
+	"github.com/ooni/probe-engine/netx/archival"
+	"github.com/ooni/probe-engine/netx/bytecounter"
+	"github.com/ooni/probe-engine/netx/errorx"
+	"github.com/ooni/probe-engine/netx/trace"
+)
+
+const (
+	testName          = "throttling"
+	testVersion       = "0.1.0"
+	defaultMaxRuntime = 10 * time.Second
+	measureInterval   = 250 * time.Millisecond
+	throttledRatio    = 0.5
+)
+
+// Config contains the experiment config.
+type Config struct {
+	Address       string `ooni:"IP address to download from (default: first address of the domain)"`
+	ControlDomain string `ooni:"domain to use as SNI and Host header for the control download"`
+	MaxRuntime    int64  `ooni:"maximum runtime of each download in seconds (default: 10)"`
+}
+
+// Sample is a sample of the bytes received during a download.
+type Sample struct {
+	Elapsed  float64 `json:"elapsed"`
+	Received int64   `json:"received"`
+}
+
+// Download contains the results of a download.
+type Download struct {
+	Domain        string                     `json:"domain"`
+	Elapsed       float64                    `json:"elapsed"`
+	Failure       *string                    `json:"failure"`
+	Received      int64                      `json:"received"`
+	Samples       []Sample                   `json:"samples"`
+	Speed         float64                    `json:"speed"` // kbit/s
+	TCPConnect    []archival.TCPConnectEntry `json:"tcp_connect"`
+	TLSHandshakes []archival.TLSHandshake    `json:"tls_handshakes"`
+}
+
+// TestKeys contains throttling test keys.
+type TestKeys struct {
+	Address   string                   `json:"address"`
+	Control   *Download                `json:"control"`
+	Failure   *string                  `json:"failure"`
+	Queries   []archival.DNSQueryEntry `json:"queries"`
+	Ratio     *float64                 `json:"speed_ratio"`
+	Target    *Download                `json:"target"`
+	Throttled *bool                    `json:"throttled"`
+}
+
+// analyze compares the speed of the two downloads. We cannot say
+// anything when any of the two downloads did not succeed.
+func (tk *TestKeys) analyze() {
+	if tk.Target == nil || tk.Target.Failure != nil || tk.Target.Speed <= 0 {
+		return
+	}
+	if tk.Control == nil || tk.Control.Failure != nil || tk.Control.Speed <= 0 {
+		return
+	}
+	ratio := tk.Target.Speed / tk.Control.Speed
+	throttled := ratio < throttledRatio
+	tk.Ratio = &ratio
+	tk.Throttled = &throttled
+}
+
+// Measurer performs the measurement.
+type Measurer struct {
+	Config
+}
+
+// ExperimentName implements ExperimentMeasurer.ExperimentName.
+func (m Measurer) ExperimentName() string {
+	return testName
+}
+
+// ExperimentVersion implements ExperimentMeasurer.ExperimentVersion.
+func (m Measurer) ExperimentVersion() string {
+	return testVersion
+}
+
+// The following errors may be returned by this experiment. Of course these
+// errors are in addition to any other errors returned by the low level packages
+// that are used by this experiment to implement its functionality.
+var (
+	ErrControlDomainRequired = errors.New("the ControlDomain option is required")
+	ErrInputRequired         = errors.New("this experiment needs input")
+	ErrInvalidAddress        = errors.New("the Address option is not an IP address")
+	ErrUnsupportedInput      = errors.New("input is not an HTTP or HTTPS URL")
+)
+
+var errHTTPRequestFailed = errors.New("http_request_failed")
+
+// parseInput returns the URL described by the input.
+func parseInput(input model.MeasurementTarget) (*url.URL, error) {
+	if input == "" {
+		return nil, ErrInputRequired
+	}
+	URL, err := url.Parse(string(input))
+	if err != nil {
+		return nil, err
+	}
+	if (URL.Scheme != "http" && URL.Scheme != "https") || URL.Hostname() == "" {
+		return nil, ErrUnsupportedInput
+	}
+	return URL, nil
+}
+
+// lookup resolves domain and saves the queries into tk.
+func (m Measurer) lookup(
+	ctx context.Context, sess model.ExperimentSession, begin time.Time,
+	tk *TestKeys, domain string,
+) (string, error) {
+	saver := new(trace.Saver)
+	addrs, err := netx.NewResolver(netx.Config{
+		Logger:       sess.Logger(),
+		ResolveSaver: saver,
+	}).LookupHost(ctx, domain)
+	tk.Queries = archival.NewDNSQueriesList(begin, saver.Read(), sess.ASNDatabasePath())
+	if err != nil {
+		return "", err
+	}
+	return addrs[0], nil
+}
+
+// download downloads the payload at URL from address using domain as
+// the SNI and the Host header. We stop after maxRuntime.
+func (m Measurer) download(
+	ctx context.Context, sess model.ExperimentSession, begin time.Time,
+	URL *url.URL, domain, address string,
+) *Download {
+	out := &Download{Domain: domain}
+	host := domain
+	if port := URL.Port(); port != "" {
+		host = net.JoinHostPort(domain, port)
+	}
+	URL = &url.URL{Scheme: URL.Scheme, Host: host, Path: URL.Path, RawQuery: URL.RawQuery}
+	counter := bytecounter.New()
+	saver := new(trace.Saver)
+	txp := netx.NewHTTPTransport(netx.Config{
+		ByteCounter: counter,
+		DNSCache:    map[string][]string{domain: {address}},
+		DialSaver:   saver,
+		Logger:      sess.Logger(),
+		TLSSaver:    saver,
+	})
+	defer txp.CloseIdleConnections()
+	ctx, cancel := context.WithTimeout(ctx, m.maxRuntime())
+	defer cancel()
+	start := time.Now()
+	done := make(chan interface{})
+	samples := make(chan []Sample)
+	go sample(start, counter, done, samples)
+	received, err := get(ctx, txp, URL)
+	close(done)
+	out.Samples = <-samples
+	out.Elapsed = time.Since(start).Seconds()
+	out.Received = received
+	if errors.Is(err, context.DeadlineExceeded) && received > 0 {
+		err = nil // this is how we stop long downloads
+	}
+	out.Failure = archival.NewFailure(errorx.SafeErrWrapperBuilder{
+		Error:     err,
+		Operation: errorx.TopLevelOperation,
+	}.MaybeBuild())
+	out.Speed = speed(out.Samples)
+	if out.Speed <= 0 && out.Elapsed > 0 {
+		out.Speed = 8 * float64(received) / 1000 / out.Elapsed
+	}
+	events := saver.Read()
+	out.TCPConnect = archival.NewTCPConnectList(begin, events)
+	out.TLSHandshakes = archival.NewTLSHandshakesList(begin, events)
+	sess.Logger().Infof("throttling: %s: %.1f kbit/s (%s)", domain, out.Speed, asString(out.Failure))
+	return out
+}
+
+func (m Measurer) maxRuntime() time.Duration {
+	if m.Config.MaxRuntime > 0 {
+		return time.Duration(m.Config.MaxRuntime) * time.Second
+	}
+	return defaultMaxRuntime
+}
+
+// get fetches URL using txp and returns the number of bytes of
+// the body we have received, even in case of failure.
+func get(ctx context.Context, txp netx.HTTPRoundTripper, URL *url.URL) (int64, error) {
+	req, err := http.NewRequest("GET", URL.String(), nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := txp.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return 0, errHTTPRequestFailed
+	}
+	return io.Copy(ioutil.Discard, resp.Body)
+}
+
+// speed returns the median of the speed in kbit/s of the intervals between
+// the samples, ignoring the intervals before the first sample showing that
+// we received data. Returns zero when there are no such intervals.
+func speed(samples []Sample) float64 {
+	for len(samples) > 0 && samples[0].Received <= 0 {
+		samples = samples[1:]
+	}
+	var speeds []float64
+	for idx := 1; idx < len(samples); idx++ {
+		elapsed := samples[idx].Elapsed - samples[idx-1].Elapsed
+		if elapsed <= 0 {
+			continue
+		}
+		received := samples[idx].Received - samples[idx-1].Received
+		speeds = append(speeds, 8*float64(received)/1000/elapsed)
+	}
+	if len(speeds) <= 0 {
+		return 0
+	}
+	sort.Float64s(speeds)
+	middle := len(speeds) / 2
+	if len(speeds)%2 == 0 {
+		return (speeds[middle-1] + speeds[middle]) / 2
+	}
+	return speeds[middle]
+}
+
+// sample samples the bytes received by counter every measureInterval until
+// done is closed. Then, it takes a final sample and it posts all the samples
+// on the samples channel.
+func sample(start time.Time, counter *bytecounter.Counter,
+	done <-chan interface{}, samples chan<- []Sample) {
+	var out []Sample
+	ticker := time.NewTicker(measureInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			out = append(out, Sample{
+				Elapsed:  now.Sub(start).Seconds(),
+				Received: counter.BytesReceived(),
+			})
+		case <-done:
+			out = append(out, Sample{
+				Elapsed:  time.Since(start).Seconds(),
+				Received: counter.BytesReceived(),
+			})
+			samples <- out
+			return
+		}
+	}
+}
+
+// Run implements ExperimentMeasurer.Run.
+func (m Measurer) Run(
+	ctx context.Context,
+	sess model.ExperimentSession,
+	measurement *model.Measurement,
+	callbacks model.ExperimentCallbacks,
+) error {
+	tk := new(TestKeys)
+	measurement.TestKeys = tk
+	URL, err := parseInput(measurement.Input)
+	if err != nil {
+		return err
+	}
+	if m.Config.ControlDomain == "" {
+		return ErrControlDomainRequired
+	}
+	begin := measurement.MeasurementStartTimeSaved
+	tk.Address = m.Config.Address
+	if tk.Address == "" {
+		tk.Address, err = m.lookup(ctx, sess, begin, tk, URL.Hostname())
+		if err != nil {
+			tk.Failure = archival.NewFailure(errorx.SafeErrWrapperBuilder{
+				Error:     err,
+				Operation: errorx.ResolveOperation,
+			}.MaybeBuild())
+			return nil
+		}
+	}
+	if net.ParseIP(tk.Address) == nil {
+		return ErrInvalidAddress
+	}
+	tk.Target = m.download(ctx, sess, begin, URL, URL.Hostname(), tk.Address)
+	callbacks.OnProgress(0.5, "throttling: target download done")
+	tk.Control = m.download(ctx, sess, begin, URL, m.Config.ControlDomain, tk.Address)
+	callbacks.OnProgress(1, "throttling: control download done")
+	tk.analyze()
+	if tk.Throttled != nil {
+		sess.Logger().Infof("throttling: speed ratio %.2f; throttled: %+v", *tk.Ratio, *tk.Throttled)
+	}
+	return nil
+}
+
+// NewExperimentMeasurer creates a new ExperimentMeasurer.
+func NewExperimentMeasurer(config Config) model.ExperimentMeasurer {
+	return Measurer{Config: config}
+}
+
+func asString(failure *string) (result string) {
+	result = "success"
+	if failure != nil {
+		result = *failure
+	}
+	return
+}
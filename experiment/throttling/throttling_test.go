@@ -0,0 +1,324 @@
+package throttling
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/ooni/probe-engine/internal/mockable"
+	"github.com/ooni/probe-engine/model"
+	"github.com/ooni/probe-engine/netx"
+	"github.com/ooni/probe-engine/netx/dialer"
+)
+
+func TestUnitNewExperimentMeasurer(t *testing.T) {
+	measurer := NewExperimentMeasurer(Config{})
+	if measurer.ExperimentName() != "throttling" {
+		t.Fatal("unexpected name")
+	}
+	if measurer.ExperimentVersion() != "0.1.0" {
+		t.Fatal("unexpected version")
+	}
+}
+
+func TestUnitParseInput(t *testing.T) {
+	t.Run("for empty input", func(t *testing.T) {
+		if _, err := parseInput(""); !errors.Is(err, ErrInputRequired) {
+			t.Fatal("not the error we expected")
+		}
+	})
+	t.Run("for invalid URL", func(t *testing.T) {
+		if _, err := parseInput("\t"); err == nil {
+			t.Fatal("expected an error here")
+		}
+	})
+	t.Run("for unsupported scheme", func(t *testing.T) {
+		if _, err := parseInput("ftp://example.com/"); !errors.Is(err, ErrUnsupportedInput) {
+			t.Fatal("not the error we expected")
+		}
+	})
+	t.Run("for URL", func(t *testing.T) {
+		URL, err := parseInput("https://example.com/payload")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if URL.Hostname() != "example.com" || URL.Path != "/payload" {
+			t.Fatal("unexpected result")
+		}
+	})
+}
+
+func TestUnitTestKeysAnalyze(t *testing.T) {
+	failure := "generic_timeout_error"
+	cases := []struct {
+		name      string
+		target    *Download
+		control   *Download
+		throttled *bool
+	}{{
+		name:    "with failed target download",
+		target:  &Download{Failure: &failure},
+		control: &Download{Speed: 1000},
+	}, {
+		name:    "with failed control download",
+		target:  &Download{Speed: 1000},
+		control: &Download{Failure: &failure},
+	}, {
+		name:    "with missing control download",
+		target:  &Download{Speed: 1000},
+		control: nil,
+	}, {
+		name:      "with similar speeds",
+		target:    &Download{Speed: 900},
+		control:   &Download{Speed: 1000},
+		throttled: new(bool),
+	}, {
+		name:    "with slower target",
+		target:  &Download{Speed: 100},
+		control: &Download{Speed: 1000},
+		throttled: func() *bool {
+			v := true
+			return &v
+		}(),
+	}}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tk := &TestKeys{Target: c.target, Control: c.control}
+			tk.analyze()
+			if c.throttled == nil {
+				if tk.Throttled != nil || tk.Ratio != nil {
+					t.Fatal("expected no result")
+				}
+				return
+			}
+			if tk.Throttled == nil || *tk.Throttled != *c.throttled {
+				t.Fatal("unexpected result")
+			}
+		})
+	}
+}
+
+func TestUnitSpeed(t *testing.T) {
+	cases := []struct {
+		name    string
+		samples []Sample
+		speed   float64
+	}{{
+		name:  "with no samples",
+		speed: 0,
+	}, {
+		name:    "with a single sample",
+		samples: []Sample{{Elapsed: 0.25, Received: 1000}},
+		speed:   0,
+	}, {
+		name: "with no data",
+		samples: []Sample{
+			{Elapsed: 0.25, Received: 0},
+			{Elapsed: 0.5, Received: 0},
+		},
+		speed: 0,
+	}, {
+		name: "with slow connect and handshake",
+		samples: []Sample{
+			{Elapsed: 0.25, Received: 0},
+			{Elapsed: 0.5, Received: 0},
+			{Elapsed: 0.75, Received: 1000},
+			{Elapsed: 1, Received: 2000},
+			{Elapsed: 1.25, Received: 3000},
+		},
+		speed: 32,
+	}, {
+		name: "with an odd number of intervals",
+		samples: []Sample{
+			{Elapsed: 0.25, Received: 1000},
+			{Elapsed: 0.5, Received: 2000},
+			{Elapsed: 0.75, Received: 12000},
+			{Elapsed: 1, Received: 14000},
+		},
+		speed: 64,
+	}, {
+		name: "with an even number of intervals",
+		samples: []Sample{
+			{Elapsed: 0.25, Received: 1000},
+			{Elapsed: 0.5, Received: 2000},
+			{Elapsed: 0.75, Received: 4000},
+			{Elapsed: 1, Received: 7000},
+			{Elapsed: 1.25, Received: 11000},
+		},
+		speed: 80,
+	}}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if v := speed(c.samples); v != c.speed {
+				t.Fatalf("expected %f, got %f", c.speed, v)
+			}
+		})
+	}
+}
+
+func TestUnitMeasurerRunNoMeasurementInput(t *testing.T) {
+	measurer := NewExperimentMeasurer(Config{ControlDomain: "example.org"})
+	err := measurer.Run(
+		context.Background(), newsession(), new(model.Measurement),
+		model.NewPrinterCallbacks(log.Log),
+	)
+	if !errors.Is(err, ErrInputRequired) {
+		t.Fatal("not the error we expected")
+	}
+}
+
+func TestUnitMeasurerRunNoControlDomain(t *testing.T) {
+	measurer := NewExperimentMeasurer(Config{})
+	err := measurer.Run(
+		context.Background(), newsession(),
+		&model.Measurement{Input: "https://example.com/"},
+		model.NewPrinterCallbacks(log.Log),
+	)
+	if !errors.Is(err, ErrControlDomainRequired) {
+		t.Fatal("not the error we expected")
+	}
+}
+
+func TestUnitMeasurerRunInvalidAddress(t *testing.T) {
+	measurer := NewExperimentMeasurer(Config{
+		Address:       "antani",
+		ControlDomain: "example.org",
+	})
+	err := measurer.Run(
+		context.Background(), newsession(),
+		&model.Measurement{Input: "https://example.com/"},
+		model.NewPrinterCallbacks(log.Log),
+	)
+	if !errors.Is(err, ErrInvalidAddress) {
+		t.Fatal("not the error we expected")
+	}
+}
+
+// throttlingForwarder forwards TLS connections to backend. When the
+// ClientHello mentions throttledSNI, it dials the backend using a
+// ShapingDialer, thus emulating a censor throttling such SNI.
+type throttlingForwarder struct {
+	backend      string
+	listener     net.Listener
+	throttledSNI string
+}
+
+func (f *throttlingForwarder) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		go f.forward(conn)
+	}
+}
+
+func (f *throttlingForwarder) forward(conn net.Conn) {
+	defer conn.Close()
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return
+	}
+	hello := make([]byte, binary.BigEndian.Uint16(header[3:]))
+	if _, err := io.ReadFull(conn, hello); err != nil {
+		return
+	}
+	var d dialer.Dialer = new(net.Dialer)
+	if bytes.Contains(hello, []byte(f.throttledSNI)) {
+		d = dialer.ShapingDialer{Dialer: d, Delay: 50 * time.Millisecond}
+	}
+	backend, err := d.DialContext(context.Background(), "tcp", f.backend)
+	if err != nil {
+		return
+	}
+	defer backend.Close()
+	if _, err := backend.Write(append(header, hello...)); err != nil {
+		return
+	}
+	go io.Copy(backend, conn)
+	io.Copy(conn, backend)
+}
+
+func TestUnitMeasurerRunWithThrottledSNI(t *testing.T) {
+	payload := make([]byte, 1<<20)
+	server := httptest.NewTLSServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write(payload)
+		}))
+	defer server.Close()
+	// make sure we trust the certificate of the local server, which
+	// is valid for example.com and *.example.com
+	savedCertPool := netx.CertPool
+	defer func() {
+		netx.CertPool = savedCertPool
+	}()
+	netx.CertPool = x509.NewCertPool()
+	netx.CertPool.AddCert(server.Certificate())
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	forwarder := &throttlingForwarder{
+		backend:      server.Listener.Addr().String(),
+		listener:     listener,
+		throttledSNI: "target.example.com",
+	}
+	go forwarder.serve()
+	URL := &url.URL{
+		Scheme: "https",
+		Host:   net.JoinHostPort("target.example.com", portOf(t, listener)),
+		Path:   "/",
+	}
+	measurer := NewExperimentMeasurer(Config{
+		Address:       "127.0.0.1",
+		ControlDomain: "control.example.com",
+		MaxRuntime:    1,
+	})
+	measurement := &model.Measurement{Input: model.MeasurementTarget(URL.String())}
+	err = measurer.Run(
+		context.Background(), newsession(), measurement,
+		model.NewPrinterCallbacks(log.Log),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tk := measurement.TestKeys.(*TestKeys)
+	if tk.Target.Failure != nil || tk.Control.Failure != nil {
+		t.Fatal("expected both downloads to succeed")
+	}
+	if tk.Control.Received != int64(len(payload)) {
+		t.Fatal("expected to receive the whole control payload")
+	}
+	if tk.Target.Received >= tk.Control.Received {
+		t.Fatal("expected the target download to be interrupted")
+	}
+	if len(tk.Target.Samples) <= 0 || len(tk.Target.TLSHandshakes) != 1 {
+		t.Fatal("unexpected target download results")
+	}
+	if tk.Throttled == nil || *tk.Throttled != true {
+		t.Fatal("expected to see throttling")
+	}
+}
+
+func portOf(t *testing.T, listener net.Listener) string {
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return port
+}
+
+func newsession() model.ExperimentSession {
+	return &mockable.Session{MockableLogger: log.Log}
+}
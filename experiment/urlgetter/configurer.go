@@ -2,6 +2,7 @@ package urlgetter
 
 import (
 	"crypto/tls"
+	"encoding/base64"
 	"errors"
 	"net"
 	"net/url"
@@ -10,6 +11,9 @@ import (
 
 	"github.com/ooni/probe-engine/model"
 	"github.com/ooni/probe-engine/netx"
+	"github.com/ooni/probe-engine/netx/dialer"
+	"github.com/ooni/probe-engine/netx/replay"
+	"github.com/ooni/probe-engine/netx/resolver"
 	"github.com/ooni/probe-engine/netx/trace"
 )
 
@@ -19,6 +23,8 @@ type Configurer struct {
 	Config   Config
 	Logger   model.Logger
 	ProxyURL *url.URL
+	Recorder *replay.Recorder // optional
+	Replayer *replay.Replayer // optional
 	Saver    *trace.Saver
 }
 
@@ -41,10 +47,13 @@ func (c Configurer) NewConfiguration() (Configuration, error) {
 			BogonIsError:        c.Config.RejectDNSBogons,
 			CacheResolutions:    true,
 			ContextByteCounting: true,
+			DNSSECValidation:    c.Config.DNSSECValidation,
 			DialSaver:           c.Saver,
 			HTTPSaver:           c.Saver,
 			Logger:              c.Logger,
 			ReadWriteSaver:      c.Saver,
+			Recorder:            c.Recorder,
+			Replayer:            c.Replayer,
 			ResolveSaver:        c.Saver,
 			TLSSaver:            c.Saver,
 		},
@@ -79,6 +88,14 @@ func (c Configurer) NewConfiguration() (Configuration, error) {
 	}
 	configuration.DNSClient = dnsclient
 	configuration.HTTPConfig.BaseResolver = dnsclient.Resolver
+	// make sure we can send the additional DNS queries
+	qtypes, err := parseDNSQueryTypes(c.Config.DNSQueryTypes)
+	if err != nil {
+		return configuration, err
+	}
+	if _, ok := dnsclient.Resolver.(resolver.RecordsResolver); len(qtypes) > 0 && !ok {
+		return configuration, errors.New("the resolver cannot send DNSQueryTypes queries")
+	}
 	// configure TLS
 	configuration.HTTPConfig.TLSConfig = &tls.Config{
 		NextProtos: []string{"h2", "http/1.1"},
@@ -105,7 +122,44 @@ func (c Configurer) NewConfiguration() (Configuration, error) {
 		return configuration, errors.New("unsupported TLS version")
 	}
 	configuration.HTTPConfig.NoTLSVerify = c.Config.NoTLSVerify
+	// configure the TLS fingerprint
+	if c.Config.TLSFingerprint != "" {
+		if _, found := dialer.TLSFingerprints[c.Config.TLSFingerprint]; !found {
+			return configuration, errors.New("unsupported TLS fingerprint")
+		}
+		configuration.HTTPConfig.TLSFingerprint = c.Config.TLSFingerprint
+	}
+	// configure the Encrypted ClientHello
+	if c.Config.ECHConfig != "" {
+		if c.Config.TLSFingerprint != "" {
+			return configuration, errors.New("cannot use ECHConfig with TLSFingerprint")
+		}
+		list, err := base64.StdEncoding.DecodeString(c.Config.ECHConfig)
+		if err != nil || len(list) <= 0 {
+			return configuration, errors.New("invalid ECHConfig")
+		}
+		configuration.HTTPConfig.ECHConfigList = list
+	}
+	// configure HTTP/3
+	configuration.HTTPConfig.HTTP3Enabled = c.Config.HTTP3Enabled
 	// configure proxy
 	configuration.HTTPConfig.ProxyURL = c.ProxyURL
 	return configuration, nil
 }
+
+// parseDNSQueryTypes parses the comma separated list of DNS
+// query types contained by the Config.DNSQueryTypes field.
+func parseDNSQueryTypes(s string) ([]uint16, error) {
+	var qtypes []uint16
+	if s == "" {
+		return qtypes, nil
+	}
+	for _, name := range strings.Split(s, ",") {
+		qtype, err := resolver.ParseQueryType(name)
+		if err != nil {
+			return nil, err
+		}
+		qtypes = append(qtypes, qtype)
+	}
+	return qtypes, nil
+}
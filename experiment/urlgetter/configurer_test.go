@@ -8,6 +8,7 @@ import (
 
 	"github.com/apex/log"
 	"github.com/ooni/probe-engine/experiment/urlgetter"
+	"github.com/ooni/probe-engine/netx/replay"
 	"github.com/ooni/probe-engine/netx/resolver"
 	"github.com/ooni/probe-engine/netx/trace"
 )
@@ -70,6 +71,28 @@ func TestConfigurerNewConfigurationVanilla(t *testing.T) {
 	}
 }
 
+func TestConfigurerNewConfigurationRecorderAndReplayer(t *testing.T) {
+	recorder := replay.NewRecorder()
+	replayer := replay.NewReplayer(new(replay.Recording))
+	configurer := urlgetter.Configurer{
+		Logger:   log.Log,
+		Recorder: recorder,
+		Replayer: replayer,
+		Saver:    new(trace.Saver),
+	}
+	configuration, err := configurer.NewConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer configuration.CloseIdleConnections()
+	if configuration.HTTPConfig.Recorder != recorder {
+		t.Fatal("not the Recorder we expected")
+	}
+	if configuration.HTTPConfig.Replayer != replayer {
+		t.Fatal("not the Replayer we expected")
+	}
+}
+
 func TestConfigurerNewConfigurationResolverDNSOverHTTPSPowerdns(t *testing.T) {
 	saver := new(trace.Saver)
 	configurer := urlgetter.Configurer{
@@ -521,6 +544,106 @@ func TestConfigurerNewConfigurationNoTLSVerify(t *testing.T) {
 	}
 }
 
+func TestConfigurerNewConfigurationHTTP3Enabled(t *testing.T) {
+	saver := new(trace.Saver)
+	configurer := urlgetter.Configurer{
+		Config: urlgetter.Config{
+			HTTP3Enabled: true,
+		},
+		Logger: log.Log,
+		Saver:  saver,
+	}
+	configuration, err := configurer.NewConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if configuration.HTTPConfig.HTTP3Enabled != true {
+		t.Fatal("not the HTTP3Enabled we expected")
+	}
+}
+
+func TestConfigurerNewConfigurationDNSSECValidation(t *testing.T) {
+	saver := new(trace.Saver)
+	configurer := urlgetter.Configurer{
+		Config: urlgetter.Config{
+			DNSSECValidation: true,
+			ResolverURL:      "udp://8.8.8.8:53",
+		},
+		Logger: log.Log,
+		Saver:  saver,
+	}
+	configuration, err := configurer.NewConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer configuration.CloseIdleConnections()
+	if configuration.HTTPConfig.DNSSECValidation != true {
+		t.Fatal("not the DNSSECValidation we expected")
+	}
+	r, ok := configuration.DNSClient.Resolver.(resolver.DNSSECResolver)
+	if !ok {
+		t.Fatal("not the resolver we expected")
+	}
+	if r.Saver != saver {
+		t.Fatal("not the saver we expected")
+	}
+}
+
+func TestConfigurerNewConfigurationDNSSECValidationSystemResolver(t *testing.T) {
+	configurer := urlgetter.Configurer{
+		Config: urlgetter.Config{
+			DNSSECValidation: true,
+		},
+		Logger: log.Log,
+	}
+	_, err := configurer.NewConfiguration()
+	if err == nil || err.Error() != "the system resolver cannot validate DNSSEC" {
+		t.Fatal("not the error we expected")
+	}
+}
+
+func TestConfigurerNewConfigurationDNSQueryTypes(t *testing.T) {
+	configurer := urlgetter.Configurer{
+		Config: urlgetter.Config{
+			DNSQueryTypes: "HTTPS,TXT",
+			ResolverURL:   "udp://8.8.8.8:53",
+		},
+		Logger: log.Log,
+	}
+	configuration, err := configurer.NewConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	configuration.CloseIdleConnections()
+}
+
+func TestConfigurerNewConfigurationInvalidDNSQueryTypes(t *testing.T) {
+	configurer := urlgetter.Configurer{
+		Config: urlgetter.Config{
+			DNSQueryTypes: "HTTPS,ANTANI",
+			ResolverURL:   "udp://8.8.8.8:53",
+		},
+		Logger: log.Log,
+	}
+	_, err := configurer.NewConfiguration()
+	if err == nil || err.Error() != "resolver: invalid query type: 'ANTANI'" {
+		t.Fatal("not the error we expected")
+	}
+}
+
+func TestConfigurerNewConfigurationDNSQueryTypesSystemResolver(t *testing.T) {
+	configurer := urlgetter.Configurer{
+		Config: urlgetter.Config{
+			DNSQueryTypes: "TXT",
+		},
+		Logger: log.Log,
+	}
+	_, err := configurer.NewConfiguration()
+	if err == nil || err.Error() != "the resolver cannot send DNSQueryTypes queries" {
+		t.Fatal("not the error we expected")
+	}
+}
+
 func TestConfigurerNewConfigurationTLSv1(t *testing.T) {
 	saver := new(trace.Saver)
 	configurer := urlgetter.Configurer{
@@ -699,6 +822,78 @@ func TestConfigurerNewConfigurationTLSvDefault(t *testing.T) {
 	}
 }
 
+func TestConfigurerNewConfigurationTLSFingerprint(t *testing.T) {
+	configurer := urlgetter.Configurer{
+		Config: urlgetter.Config{
+			TLSFingerprint: "firefox",
+		},
+		Logger: log.Log,
+	}
+	configuration, err := configurer.NewConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if configuration.HTTPConfig.TLSFingerprint != "firefox" {
+		t.Fatal("not the TLSFingerprint we expected")
+	}
+}
+
+func TestConfigurerNewConfigurationTLSFingerprintInvalid(t *testing.T) {
+	configurer := urlgetter.Configurer{
+		Config: urlgetter.Config{
+			TLSFingerprint: "netscape",
+		},
+		Logger: log.Log,
+	}
+	_, err := configurer.NewConfiguration()
+	if err == nil || err.Error() != "unsupported TLS fingerprint" {
+		t.Fatal("not the error we expected")
+	}
+}
+
+func TestConfigurerNewConfigurationECHConfig(t *testing.T) {
+	configurer := urlgetter.Configurer{
+		Config: urlgetter.Config{
+			ECHConfig: "AAT+DQAA",
+		},
+		Logger: log.Log,
+	}
+	configuration, err := configurer.NewConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(configuration.HTTPConfig.ECHConfigList) != 6 {
+		t.Fatal("not the ECHConfigList we expected")
+	}
+}
+
+func TestConfigurerNewConfigurationECHConfigInvalid(t *testing.T) {
+	configurer := urlgetter.Configurer{
+		Config: urlgetter.Config{
+			ECHConfig: "@@@",
+		},
+		Logger: log.Log,
+	}
+	_, err := configurer.NewConfiguration()
+	if err == nil || err.Error() != "invalid ECHConfig" {
+		t.Fatal("not the error we expected")
+	}
+}
+
+func TestConfigurerNewConfigurationECHConfigWithTLSFingerprint(t *testing.T) {
+	configurer := urlgetter.Configurer{
+		Config: urlgetter.Config{
+			ECHConfig:      "AAT+DQAA",
+			TLSFingerprint: "firefox",
+		},
+		Logger: log.Log,
+	}
+	_, err := configurer.NewConfiguration()
+	if err == nil || err.Error() != "cannot use ECHConfig with TLSFingerprint" {
+		t.Fatal("not the error we expected")
+	}
+}
+
 func TestConfigurerNewConfigurationTLSvInvalid(t *testing.T) {
 	saver := new(trace.Saver)
 	configurer := urlgetter.Configurer{
@@ -2,11 +2,13 @@ package urlgetter
 
 import (
 	"context"
+	"net/http"
 	"time"
 
 	"github.com/ooni/probe-engine/model"
 	"github.com/ooni/probe-engine/netx/archival"
 	"github.com/ooni/probe-engine/netx/errorx"
+	"github.com/ooni/probe-engine/netx/replay"
 	"github.com/ooni/probe-engine/netx/trace"
 )
 
@@ -24,6 +26,20 @@ type Getter struct {
 	// we will use the default config.
 	Config Config
 
+	// CookieJar is the optional cookie jar to use. If not set, then
+	// every Get uses a new cookie jar. Set this field to share
+	// cookies among several Gets, e.g., when following redirects.
+	CookieJar http.CookieJar
+
+	// Recorder is the optional recorder to use. If set, then we
+	// record the network traffic of every Get using it.
+	Recorder *replay.Recorder
+
+	// Replayer is the optional replayer to use. If set, then every
+	// Get replays the network traffic recorded by it, rather than
+	// using the network, which is useful for testing.
+	Replayer *replay.Replayer
+
 	// Session is the session for this run. This field must
 	// be set otherwise the code will panic.
 	Session model.ExperimentSession
@@ -72,6 +88,9 @@ func (g Getter) Get(ctx context.Context) (TestKeys, error) {
 	tk.TLSHandshakes = append(
 		tk.TLSHandshakes, archival.NewTLSHandshakesList(g.Begin, events)...,
 	)
+	tk.QUICHandshakes = append(
+		tk.QUICHandshakes, archival.NewQUICHandshakesList(g.Begin, events)...,
+	)
 	return tk, err
 }
 
@@ -99,6 +118,8 @@ func (g Getter) get(ctx context.Context, saver *trace.Saver) (TestKeys, error) {
 		Config:   g.Config,
 		Logger:   g.Session.Logger(),
 		ProxyURL: g.Session.ProxyURL(),
+		Recorder: g.Recorder,
+		Replayer: g.Replayer,
 		Saver:    saver,
 	}
 	configuration, err := configurer.NewConfiguration()
@@ -109,6 +130,7 @@ func (g Getter) get(ctx context.Context, saver *trace.Saver) (TestKeys, error) {
 	// run the measurement
 	runner := Runner{
 		Config:     g.Config,
+		CookieJar:  g.CookieJar,
 		HTTPConfig: configuration.HTTPConfig,
 		Target:     g.Target,
 	}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/ooni/probe-engine/model"
+	"github.com/ooni/probe-engine/netx/replay"
 )
 
 // MultiInput is the input for Multi.Run().
@@ -51,6 +52,14 @@ type Multi struct {
 	// zero, or negative, we use a reasonable default.
 	Parallelism int
 
+	// Recorder is the optional recorder passed to every Getter. See
+	// the documentation of Getter.Recorder for more info.
+	Recorder *replay.Recorder
+
+	// Replayer is the optional replayer passed to every Getter. See
+	// the documentation of Getter.Replayer for more info.
+	Replayer *replay.Replayer
+
 	// Session is the session to be used. If this is nil, the Run
 	// method will panic with a nil pointer error.
 	Session model.ExperimentSession
@@ -118,10 +127,12 @@ func (m Multi) source(inputs []MultiInput, inputch chan<- MultiInput) {
 func (m Multi) do(ctx context.Context, in <-chan MultiInput, out chan<- MultiOutput) {
 	for input := range in {
 		g := Getter{
-			Begin:   m.Begin,
-			Config:  input.Config,
-			Session: m.Session,
-			Target:  input.Target,
+			Begin:    m.Begin,
+			Config:   input.Config,
+			Recorder: m.Recorder,
+			Replayer: m.Replayer,
+			Session:  m.Session,
+			Target:   input.Target,
 		}
 		fn := m.Getter
 		if fn == nil {
@@ -28,6 +28,7 @@ var ErrHTTPRequestFailed = &errorx.ErrWrapper{
 // The Runner job is to run a single measurement
 type Runner struct {
 	Config     Config
+	CookieJar  http.CookieJar // optional
 	HTTPConfig netx.Config
 	Target     string
 }
@@ -75,8 +76,11 @@ func (r Runner) httpGet(ctx context.Context, url string) error {
 	// Implementation note: the following cookiejar accepts all cookies
 	// from all domains. As such, would not be safe for usage where cookies
 	// matter, but it's totally fine for performing measurements.
-	jar, err := cookiejar.New(nil)
-	runtimex.PanicOnError(err, "cookiejar.New failed")
+	var jar http.CookieJar = r.CookieJar
+	if jar == nil {
+		jar, err = cookiejar.New(nil)
+		runtimex.PanicOnError(err, "cookiejar.New failed")
+	}
 	httpClient := &http.Client{
 		Jar:       jar,
 		Transport: netx.NewHTTPTransport(r.HTTPConfig),
@@ -105,8 +109,21 @@ func (r Runner) httpGet(ctx context.Context, url string) error {
 }
 
 func (r Runner) dnsLookup(ctx context.Context, hostname string) error {
+	qtypes, err := parseDNSQueryTypes(r.Config.DNSQueryTypes)
+	if err != nil {
+		return err
+	}
 	resolver := netx.NewResolver(r.HTTPConfig)
-	_, err := resolver.LookupHost(ctx, hostname)
+	_, err = resolver.LookupHost(ctx, hostname)
+	for _, qtype := range qtypes {
+		// Implementation note: the results of these queries end up in the
+		// queries list, but their failures do not affect the measurement
+		// result, which only depends on whether we resolved the hostname.
+		_, qerr := netx.LookupRecords(ctx, r.HTTPConfig.BaseResolver, hostname, qtype)
+		if errors.Is(qerr, netx.ErrLookupRecordsNotSupported) {
+			return qerr
+		}
+	}
 	return err
 }
 
@@ -5,13 +5,16 @@ import (
 	"errors"
 	"io"
 	"net/http"
+	"net/http/cookiejar"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
 
 	"github.com/ooni/probe-engine/atomicx"
 	"github.com/ooni/probe-engine/experiment/urlgetter"
 	"github.com/ooni/probe-engine/internal/httpheader"
+	"github.com/ooni/probe-engine/netx"
 )
 
 func TestRunnerWithInvalidURLScheme(t *testing.T) {
@@ -42,6 +45,30 @@ func TestRunnerDNSLookupWithContextCanceled(t *testing.T) {
 	}
 }
 
+func TestRunnerDNSLookupWithInvalidDNSQueryTypes(t *testing.T) {
+	r := urlgetter.Runner{
+		Config: urlgetter.Config{DNSQueryTypes: "ANTANI"},
+		Target: "dnslookup://www.google.com",
+	}
+	err := r.Run(context.Background())
+	if err == nil || err.Error() != "resolver: invalid query type: 'ANTANI'" {
+		t.Fatal("not the error we expected")
+	}
+}
+
+func TestRunnerDNSLookupWithDNSQueryTypesAndSystemResolver(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := urlgetter.Runner{
+		Config: urlgetter.Config{DNSQueryTypes: "TXT"},
+		Target: "dnslookup://www.google.com",
+	}
+	err := r.Run(ctx)
+	if !errors.Is(err, netx.ErrLookupRecordsNotSupported) {
+		t.Fatal("not the error we expected")
+	}
+}
+
 func TestRunnerTLSHandshakeWithContextCanceled(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel()
@@ -162,6 +189,32 @@ func TestRunnerHTTPNoRedirect(t *testing.T) {
 	}
 }
 
+func TestRunnerHTTPWithCookieJar(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "antani", Value: "mascetti"})
+	}))
+	defer server.Close()
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := urlgetter.Runner{
+		CookieJar: jar,
+		Target:    server.URL,
+	}
+	if err := r.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	URL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookies := jar.Cookies(URL)
+	if len(cookies) != 1 || cookies[0].Value != "mascetti" {
+		t.Fatal("the cookie jar was not used")
+	}
+}
+
 func TestRunnerHTTPCannotReadBody(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		hijacker, ok := w.(http.Hijacker)
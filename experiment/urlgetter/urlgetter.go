@@ -13,21 +13,26 @@ import (
 
 const (
 	testName    = "urlgetter"
-	testVersion = "0.0.3"
+	testVersion = "0.0.4"
 )
 
 // Config contains the experiment's configuration.
 type Config struct {
 	DNSCache          string `ooni:"Add 'DOMAIN IP...' to cache"`
 	DNSHTTPHost       string `ooni: Force using specific HTTP Host header for DNS requests`
+	DNSQueryTypes     string `ooni:"Also query these DNS types with dnslookup (e.g. 'HTTPS,TXT')"`
+	DNSSECValidation  bool   `ooni:"Validate DNS replies using DNSSEC"`
 	DNSTLSServerName  string `ooni: Force TLS to using a specific SNI for encrypted DNS requests`
+	ECHConfig         string `ooni:"Send Encrypted ClientHello using this base64 ECHConfigList"`
 	FailOnHTTPError   bool   `ooni:"Fail HTTP request if status code is 400 or above"`
+	HTTP3Enabled      bool   `ooni:"use http3 instead of http/1.1 or http2"`
 	HTTPHost          string `ooni:"Force using specific HTTP Host header"`
 	Method            string `ooni:"Force HTTP method different than GET"`
 	NoFollowRedirects bool   `ooni:"Disable following redirects"`
 	NoTLSVerify       bool   `ooni:"Disable TLS verification"`
 	RejectDNSBogons   bool   `ooni:"Fail DNS lookup if response contains bogons"`
 	ResolverURL       string `ooni:"URL describing the resolver to use"`
+	TLSFingerprint    string `ooni:"Mimic a browser ClientHello (chrome, firefox, ios or randomized)"`
 	TLSServerName     string `ooni:"Force TLS to using a specific SNI in Client Hello"`
 	TLSVersion        string `ooni:"Force specific TLS version (e.g. 'TLSv1.3')"`
 	Tunnel            string `ooni:"Run experiment over a tunnel, e.g. psiphon"`
@@ -44,6 +49,7 @@ type TestKeys struct {
 	Failure         *string                    `json:"failure"`
 	NetworkEvents   []archival.NetworkEvent    `json:"network_events"`
 	Queries         []archival.DNSQueryEntry   `json:"queries"`
+	QUICHandshakes  []archival.TLSHandshake    `json:"quic_handshakes"`
 	Requests        []archival.RequestEntry    `json:"requests"`
 	SOCKSProxy      string                     `json:"socksproxy,omitempty"`
 	TCPConnect      []archival.TCPConnectEntry `json:"tcp_connect"`
@@ -18,7 +18,7 @@ func TestMeasurer(t *testing.T) {
 	if m.ExperimentName() != "urlgetter" {
 		t.Fatal("invalid experiment name")
 	}
-	if m.ExperimentVersion() != "0.0.3" {
+	if m.ExperimentVersion() != "0.0.4" {
 		t.Fatal("invalid experiment version")
 	}
 	measurement := new(model.Measurement)
@@ -48,7 +48,7 @@ func TestMeasurerDNSCache(t *testing.T) {
 	if m.ExperimentName() != "urlgetter" {
 		t.Fatal("invalid experiment name")
 	}
-	if m.ExperimentVersion() != "0.0.3" {
+	if m.ExperimentVersion() != "0.0.4" {
 		t.Fatal("invalid experiment version")
 	}
 	measurement := new(model.Measurement)
@@ -0,0 +1,68 @@
+package webconnectivity
+
+import (
+	"path/filepath"
+
+	"github.com/ooni/probe-engine/internal/blockpages"
+	"github.com/ooni/probe-engine/model"
+	"github.com/ooni/probe-engine/resources"
+)
+
+// BlockpageAnalysisResult contains the results of looking for
+// the fingerprints of known blockpages in the measurement.
+type BlockpageAnalysisResult struct {
+	BlockingFingerprint *string                 `json:"blocking_fingerprint"`
+	Blockpage           *blockpages.Fingerprint `json:"-"`
+}
+
+// BlockpageAnalysis looks for the fingerprints of known blockpages in the
+// DNS answers, in the HTTP headers and in the HTTP bodies of the measurement
+// and returns the first match. Because we know these blockpages, a match
+// means that we have confirmed blocking.
+func BlockpageAnalysis(db *blockpages.DB, tk *TestKeys) (out BlockpageAnalysisResult) {
+	if db == nil {
+		return
+	}
+	defer func() {
+		if out.Blockpage != nil {
+			out.BlockingFingerprint = &out.Blockpage.Name
+		}
+	}()
+	for _, query := range tk.Queries {
+		for _, answer := range query.Answers {
+			for _, ip := range []string{answer.IPv4, answer.IPv6} {
+				if ip == "" {
+					continue
+				}
+				if out.Blockpage = db.MatchIP(ip); out.Blockpage != nil {
+					return
+				}
+			}
+		}
+	}
+	for _, request := range tk.Requests {
+		for key, value := range request.Response.Headers {
+			if out.Blockpage = db.MatchHeader(key, value.Value); out.Blockpage != nil {
+				return
+			}
+		}
+		if out.Blockpage = db.MatchBody(request.Response.Body.Value); out.Blockpage != nil {
+			return
+		}
+	}
+	return
+}
+
+// LoadBlockpagesDB loads the database of the fingerprints of the known
+// blockpages from the assets directory of the session, where we download
+// it along with the other resources. It returns nil if the database is
+// not available.
+func LoadBlockpagesDB(sess model.ExperimentSession) *blockpages.DB {
+	db, err := blockpages.Load(filepath.Join(
+		sess.AssetsDir(), resources.BlockpagesDatabaseName))
+	if err != nil {
+		sess.Logger().Warnf("cannot load blockpages database: %s", err.Error())
+		return nil
+	}
+	return db
+}
@@ -0,0 +1,106 @@
+package webconnectivity_test
+
+import (
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/ooni/probe-engine/experiment/webconnectivity"
+	"github.com/ooni/probe-engine/internal/blockpages"
+	"github.com/ooni/probe-engine/internal/mockable"
+	"github.com/ooni/probe-engine/netx/archival"
+)
+
+func TestBlockpageAnalysis(t *testing.T) {
+	db := webconnectivity.LoadBlockpagesDB(&mockable.Session{
+		MockableAssetsDir: "../../testdata",
+		MockableLogger:    log.Log,
+	})
+	if db == nil {
+		t.Fatal("cannot load the blockpages database")
+	}
+	t.Run("without the database", func(t *testing.T) {
+		out := webconnectivity.BlockpageAnalysis(nil, &webconnectivity.TestKeys{})
+		if out.BlockingFingerprint != nil || out.Blockpage != nil {
+			t.Fatal("unexpected result")
+		}
+	})
+	t.Run("with a DNS fingerprint", func(t *testing.T) {
+		tk := &webconnectivity.TestKeys{}
+		tk.Queries = []archival.DNSQueryEntry{{
+			Answers: []archival.DNSAnswerEntry{{
+				AnswerType: "A", IPv4: "10.10.34.36",
+			}},
+		}}
+		out := webconnectivity.BlockpageAnalysis(db, tk)
+		if out.BlockingFingerprint == nil || *out.BlockingFingerprint != "ir_dns" {
+			t.Fatal("unexpected result")
+		}
+		if out.Blockpage.Type != blockpages.TypeDNS {
+			t.Fatal("unexpected fingerprint type")
+		}
+	})
+	t.Run("with a header fingerprint", func(t *testing.T) {
+		tk := &webconnectivity.TestKeys{
+			Requests: []archival.RequestEntry{{
+				Response: archival.HTTPResponse{
+					Headers: map[string]archival.MaybeBinaryValue{
+						"Location": {Value: "http://warning.or.kr/"},
+					},
+				},
+			}},
+		}
+		out := webconnectivity.BlockpageAnalysis(db, tk)
+		if out.BlockingFingerprint == nil || *out.BlockingFingerprint != "kr_warning" {
+			t.Fatal("unexpected result")
+		}
+	})
+	t.Run("with a body fingerprint", func(t *testing.T) {
+		tk := &webconnectivity.TestKeys{
+			Requests: []archival.RequestEntry{{
+				Response: archival.HTTPResponse{
+					Body: archival.HTTPBody{Value: `<iframe src="http://internet-positif.info/">`},
+				},
+			}},
+		}
+		out := webconnectivity.BlockpageAnalysis(db, tk)
+		if out.BlockingFingerprint == nil || *out.BlockingFingerprint != "id_internetpositif" {
+			t.Fatal("unexpected result")
+		}
+	})
+	t.Run("with a body merely linking the blocklist", func(t *testing.T) {
+		tk := &webconnectivity.TestKeys{
+			Requests: []archival.RequestEntry{{
+				Response: archival.HTTPResponse{
+					Body: archival.HTTPBody{Value: "<a href='http://internet-positif.info'>"},
+				},
+			}},
+		}
+		out := webconnectivity.BlockpageAnalysis(db, tk)
+		if out.BlockingFingerprint != nil || out.Blockpage != nil {
+			t.Fatal("unexpected result")
+		}
+	})
+	t.Run("without any match", func(t *testing.T) {
+		tk := &webconnectivity.TestKeys{
+			Requests: []archival.RequestEntry{{
+				Response: archival.HTTPResponse{
+					Body: archival.HTTPBody{Value: "<html></html>"},
+				},
+			}},
+		}
+		out := webconnectivity.BlockpageAnalysis(db, tk)
+		if out.BlockingFingerprint != nil || out.Blockpage != nil {
+			t.Fatal("unexpected result")
+		}
+	})
+}
+
+func TestLoadBlockpagesDBFailure(t *testing.T) {
+	db := webconnectivity.LoadBlockpagesDB(&mockable.Session{
+		MockableAssetsDir: "/nonexistent",
+		MockableLogger:    log.Log,
+	})
+	if db != nil {
+		t.Fatal("expected a nil database")
+	}
+}
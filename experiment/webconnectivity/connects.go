@@ -6,13 +6,17 @@ import (
 
 	"github.com/ooni/probe-engine/experiment/urlgetter"
 	"github.com/ooni/probe-engine/model"
+	"github.com/ooni/probe-engine/netx/replay"
 )
 
 // ConnectsConfig contains the config for Connects
 type ConnectsConfig struct {
-	Session       model.ExperimentSession
-	TargetURL     *url.URL
-	URLGetterURLs []string
+	Recorder       *replay.Recorder // optional
+	Replayer       *replay.Replayer // optional
+	Session        model.ExperimentSession
+	TLSFingerprint string
+	TargetURL      *url.URL
+	URLGetterURLs  []string
 }
 
 // TODO(bassosimone): we should normalize the timings
@@ -28,18 +32,29 @@ type ConnectsResult struct {
 // check whether the resolved endpoints are reachable.
 func Connects(ctx context.Context, config ConnectsConfig) (out ConnectsResult) {
 	out.AllKeys = []urlgetter.TestKeys{}
-	multi := urlgetter.Multi{Session: config.Session}
+	multi := urlgetter.Multi{
+		Recorder: config.Recorder,
+		Replayer: config.Replayer,
+		Session:  config.Session,
+	}
 	inputs := []urlgetter.MultiInput{}
 	for _, url := range config.URLGetterURLs {
 		inputs = append(inputs, urlgetter.MultiInput{
 			Config: urlgetter.Config{
-				TLSServerName: config.TargetURL.Hostname(),
+				TLSFingerprint: config.TLSFingerprint,
+				TLSServerName:  config.TargetURL.Hostname(),
 			},
 			Target: url,
 		})
 	}
 	outputs := multi.Collect(ctx, inputs, "check", ConnectsNoCallbacks{})
 	for multiout := range outputs {
+		// remember the endpoint of each TLS handshake
+		if parsed, err := url.Parse(multiout.Input.Target); err == nil {
+			for idx := range multiout.TestKeys.TLSHandshakes {
+				multiout.TestKeys.TLSHandshakes[idx].Address = parsed.Host
+			}
+		}
 		out.AllKeys = append(out.AllKeys, multiout.TestKeys)
 		for _, entry := range multiout.TestKeys.TCPConnect {
 			if entry.Status.Success {
@@ -30,6 +30,23 @@ func TestConnectsSuccess(t *testing.T) {
 	}
 }
 
+func TestConnectsWithTLSFingerprint(t *testing.T) {
+	ctx := context.Background()
+	r := webconnectivity.Connects(ctx, webconnectivity.ConnectsConfig{
+		Session:        newsession(t, false),
+		TLSFingerprint: "firefox",
+		TargetURL:      &url.URL{Scheme: "https", Host: "cloudflare-dns.com", Path: "/"},
+		URLGetterURLs:  []string{"tlshandshake://104.16.249.249:443"},
+	})
+	if len(r.AllKeys) != 1 {
+		t.Fatal("unexpected number of TestKeys lists")
+	}
+	handshakes := r.AllKeys[0].TLSHandshakes
+	if len(handshakes) != 1 || handshakes[0].Fingerprint != "firefox" {
+		t.Fatal("not the TLS handshakes we expected")
+	}
+}
+
 func TestConnectsNoInput(t *testing.T) {
 	ctx := context.Background()
 	r := webconnectivity.Connects(ctx, webconnectivity.ConnectsConfig{
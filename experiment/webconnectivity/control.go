@@ -31,6 +31,16 @@ type ControlHTTPRequestResult struct {
 	Title      string            `json:"title"`
 	Headers    map[string]string `json:"headers"`
 	StatusCode int64             `json:"status_code"`
+	Hops       []ControlHTTPHop  `json:"hops,omitempty"`
+}
+
+// ControlHTTPHop is a hop of the redirect chain followed by the
+// control vantage point. Old test helpers do not return hops.
+type ControlHTTPHop struct {
+	Failure    *string `json:"failure"`
+	Location   string  `json:"location,omitempty"`
+	StatusCode int64   `json:"status_code"`
+	URL        string  `json:"url"`
 }
 
 // ControlDNSResult is the result of the DNS lookup
@@ -39,7 +39,13 @@ func DNSAnalysis(URL *url.URL, measurement DNSLookupResult,
 		out.DNSConsistency = &DNSConsistent
 		return
 	}
-	// 2. flip to consistent if the failures are compatible
+	// 2. a reply that failed DNSSEC validation has most likely been forged, so
+	// it is inconsistent regardless of the addresses it contains.
+	if measurement.Failure != nil &&
+		*measurement.Failure == errorx.FailureDNSSECBogusError {
+		return
+	}
+	// 3. flip to consistent if the failures are compatible
 	if measurement.Failure != nil && control.DNS.Failure != nil {
 		switch *control.DNS.Failure {
 		case DNSNameError: // the control returns this on NXDOMAIN error
@@ -50,7 +56,7 @@ func DNSAnalysis(URL *url.URL, measurement DNSLookupResult,
 		}
 		return
 	}
-	// 3. flip to consistent if measurement and control returned IP addresses
+	// 4. flip to consistent if measurement and control returned IP addresses
 	// that belong to the same Autonomous System(s).
 	//
 	// This specific check is present in MK's implementation.
@@ -78,7 +84,7 @@ func DNSAnalysis(URL *url.URL, measurement DNSLookupResult,
 			return
 		}
 	}
-	// 4. when ASN lookup failed (unlikely), check whether
+	// 5. when ASN lookup failed (unlikely), check whether
 	// there is overlap in the returned IP addresses
 	ipmap := make(map[string]int)
 	for ip := range measurement.Addrs {
@@ -94,6 +100,6 @@ func DNSAnalysis(URL *url.URL, measurement DNSLookupResult,
 			return
 		}
 	}
-	// 5. conclude that measurement and control are inconsistent
+	// 6. conclude that measurement and control are inconsistent
 	return
 }
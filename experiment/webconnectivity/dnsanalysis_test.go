@@ -14,6 +14,7 @@ func TestDNSAnalysis(t *testing.T) {
 	measurementFailure := errorx.FailureDNSNXDOMAINError
 	controlFailure := webconnectivity.DNSNameError
 	eofFailure := io.EOF.Error()
+	bogusFailure := errorx.FailureDNSSECBogusError
 	type args struct {
 		URL         *url.URL
 		measurement webconnectivity.DNSLookupResult
@@ -56,6 +57,28 @@ func TestDNSAnalysis(t *testing.T) {
 		wantOut: webconnectivity.DNSAnalysisResult{
 			DNSConsistency: &webconnectivity.DNSInconsistent,
 		},
+	}, {
+		name: "when the DNSSEC validation failed",
+		args: args{
+			URL: &url.URL{
+				Host: "www.example.org",
+			},
+			measurement: webconnectivity.DNSLookupResult{
+				Addrs: map[string]int64{
+					"93.184.216.34": 15133,
+				},
+				Failure: &bogusFailure,
+			},
+			control: webconnectivity.ControlResponse{
+				DNS: webconnectivity.ControlDNSResult{
+					Addrs: []string{"93.184.216.34"},
+					ASNs:  []int64{15133},
+				},
+			},
+		},
+		wantOut: webconnectivity.DNSAnalysisResult{
+			DNSConsistency: &webconnectivity.DNSInconsistent,
+		},
 	}, {
 		name: "when the failures are compatible",
 		args: args{
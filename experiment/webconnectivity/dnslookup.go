@@ -8,12 +8,18 @@ import (
 
 	"github.com/ooni/probe-engine/experiment/urlgetter"
 	"github.com/ooni/probe-engine/model"
+	"github.com/ooni/probe-engine/netx/replay"
 )
 
-// DNSLookupConfig contains settings for the DNS lookup.
+// DNSLookupConfig contains settings for the DNS lookup. When the
+// ResolverURL is empty, we use the system resolver.
 type DNSLookupConfig struct {
-	Session model.ExperimentSession
-	URL     *url.URL
+	DNSSECValidation bool
+	Recorder         *replay.Recorder // optional
+	Replayer         *replay.Replayer // optional
+	ResolverURL      string
+	Session          model.ExperimentSession
+	URL              *url.URL
 }
 
 // DNSLookupResult contains the result of the DNS lookup.
@@ -27,7 +33,16 @@ type DNSLookupResult struct {
 func DNSLookup(ctx context.Context, config DNSLookupConfig) (out DNSLookupResult) {
 	target := fmt.Sprintf("dnslookup://%s", config.URL.Hostname())
 	config.Session.Logger().Infof("%s...", target)
-	result, err := urlgetter.Getter{Session: config.Session, Target: target}.Get(ctx)
+	result, err := urlgetter.Getter{
+		Config: urlgetter.Config{
+			DNSSECValidation: config.DNSSECValidation,
+			ResolverURL:      config.ResolverURL,
+		},
+		Recorder: config.Recorder,
+		Replayer: config.Replayer,
+		Session:  config.Session,
+		Target:   target,
+	}.Get(ctx)
 	out.Addrs = make(map[string]int64)
 	for _, query := range result.Queries {
 		for _, answer := range query.Answers {
@@ -39,6 +39,31 @@ func TestDNSLookup(t *testing.T) {
 	}
 }
 
+func TestDNSLookupWithDNSSEC(t *testing.T) {
+	config := webconnectivity.DNSLookupConfig{
+		DNSSECValidation: true,
+		ResolverURL:      "udp://8.8.8.8:53",
+		Session:          newsession(t, true),
+		URL:              &url.URL{Host: "dns.google"},
+	}
+	out := webconnectivity.DNSLookup(context.Background(), config)
+	if out.Failure != nil {
+		t.Fatal(*out.Failure)
+	}
+	if len(out.Addrs) < 1 {
+		t.Fatal("no addresses?!")
+	}
+	var secure bool
+	for _, query := range out.TestKeys.Queries {
+		if query.QueryType == "A" && query.DNSSEC == "dnssec_secure" {
+			secure = true
+		}
+	}
+	if !secure {
+		t.Fatal("expected a secure A query")
+	}
+}
+
 func TestDNSLookupResult_Addresses(t *testing.T) {
 	type fields struct {
 		Addrs    map[string]int64
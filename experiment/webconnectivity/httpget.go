@@ -2,30 +2,68 @@ package webconnectivity
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/ooni/probe-engine/experiment/urlgetter"
+	"github.com/ooni/probe-engine/internal/runtimex"
 	"github.com/ooni/probe-engine/model"
+	"github.com/ooni/probe-engine/netx/archival"
+	"github.com/ooni/probe-engine/netx/errorx"
+	"github.com/ooni/probe-engine/netx/replay"
 )
 
+// MaxRedirects is the maximum number of requests in a redirect chain. Like
+// Go's net/http package, we stop after 10 consecutive requests.
+const MaxRedirects = 10
+
+// ErrTooManyRedirects indicates we reached MaxRedirects.
+var ErrTooManyRedirects = errors.New("stopped after 10 redirects")
+
 // HTTPGetConfig contains the config for HTTPGet
 type HTTPGetConfig struct {
-	Addresses []string
-	Session   model.ExperimentSession
-	TargetURL *url.URL
+	Addresses      []string
+	Recorder       *replay.Recorder // optional
+	Replayer       *replay.Replayer // optional
+	Session        model.ExperimentSession
+	TLSFingerprint string
+	TargetURL      *url.URL
 }
 
 // TODO(bassosimone): we should normalize the timings
 
 // HTTPGetResult contains the results of HTTPGet
 type HTTPGetResult struct {
+	Hops     []HTTPHop
 	TestKeys urlgetter.TestKeys
 	Failure  *string
 }
 
+// HTTPHop is a hop of the redirect chain followed by the probe. The
+// requests of every hop are in the requests of the test keys.
+type HTTPHop struct {
+	Addresses     []string                   `json:"addresses"`
+	Failure       *string                    `json:"failure"`
+	Location      string                     `json:"location,omitempty"`
+	StatusCode    int64                      `json:"status_code"`
+	TCPConnect    []archival.TCPConnectEntry `json:"tcp_connect"`
+	TLSHandshakes []archival.TLSHandshake    `json:"tls_handshakes"`
+	URL           string                     `json:"url"`
+}
+
 // HTTPGet performs the HTTP/HTTPS part of Web Connectivity.
+//
+// We follow redirects ourselves, one hop at a time, so that we know
+// what happened at each hop. We share the cookies among the hops like
+// a browser would do. We always use the addresses resolved by the
+// probe for the domain of the target URL, while we resolve other
+// domains as part of the corresponding hop.
 func HTTPGet(ctx context.Context, config HTTPGetConfig) (out HTTPGetResult) {
 	addresses := strings.Join(config.Addresses, " ")
 	if addresses == "" {
@@ -33,18 +71,115 @@ func HTTPGet(ctx context.Context, config HTTPGetConfig) (out HTTPGetResult) {
 		// cannot fill the DNS cache...
 		return
 	}
-	target := config.TargetURL.String()
-	config.Session.Logger().Infof("GET %s...", target)
 	domain := config.TargetURL.Hostname()
+	jar, err := cookiejar.New(nil)
+	runtimex.PanicOnError(err, "cookiejar.New failed")
+	begin := time.Now()
+	out.TestKeys.Agent = "redirect"
+	out.TestKeys.DNSCache = []string{fmt.Sprintf("%s %s", domain, addresses)}
+	URL := config.TargetURL
+	for URL != nil {
+		if len(out.Hops) >= MaxRedirects {
+			err := errorx.SafeErrWrapperBuilder{
+				Error:     ErrTooManyRedirects,
+				Operation: errorx.TopLevelOperation,
+			}.MaybeBuild()
+			out.Failure = archival.NewFailure(err)
+			out.TestKeys.Failure = out.Failure
+			out.TestKeys.FailedOperation = archival.NewFailedOperation(err)
+			return
+		}
+		var hop HTTPHop
+		hop, URL = httpGetHop(ctx, config, begin, jar, URL, &out.TestKeys)
+		out.Hops = append(out.Hops, hop)
+		out.Failure = hop.Failure
+	}
+	return
+}
+
+// httpGetHop performs a single hop of HTTPGet. It merges the test keys
+// of the hop into tk and returns the hop as well as the URL of the next
+// hop, which is nil when there is no next hop.
+func httpGetHop(ctx context.Context, config HTTPGetConfig, begin time.Time,
+	jar http.CookieJar, URL *url.URL, tk *urlgetter.TestKeys) (HTTPHop, *url.URL) {
+	target := URL.String()
+	config.Session.Logger().Infof("GET %s...", target)
 	result, err := urlgetter.Getter{
+		Begin: begin,
 		Config: urlgetter.Config{
-			DNSCache: fmt.Sprintf("%s %s", domain, addresses),
+			DNSCache:          tk.DNSCache[0],
+			NoFollowRedirects: true,
+			TLSFingerprint:    config.TLSFingerprint,
 		},
-		Session: config.Session,
-		Target:  target,
+		CookieJar: jar,
+		Recorder:  config.Recorder,
+		Replayer:  config.Replayer,
+		Session:   config.Session,
+		Target:    target,
 	}.Get(ctx)
 	config.Session.Logger().Infof("GET %s... %+v", target, err)
-	out.Failure = result.Failure
-	out.TestKeys = result
-	return
+	// OONI's convention is that the last request appears first
+	tk.Requests = append(result.Requests, tk.Requests...)
+	tk.Queries = append(tk.Queries, result.Queries...)
+	tk.NetworkEvents = append(tk.NetworkEvents, result.NetworkEvents...)
+	tk.TCPConnect = append(tk.TCPConnect, result.TCPConnect...)
+	tk.TLSHandshakes = append(tk.TLSHandshakes, result.TLSHandshakes...)
+	tk.FailedOperation = result.FailedOperation
+	tk.Failure = result.Failure
+	tk.HTTPResponseStatus = result.HTTPResponseStatus
+	tk.HTTPResponseBody = result.HTTPResponseBody
+	tk.HTTPResponseLocations = result.HTTPResponseLocations
+	hop := HTTPHop{
+		Addresses:     httpHopAddresses(config, URL, result.Queries),
+		Failure:       result.Failure,
+		StatusCode:    result.HTTPResponseStatus,
+		TCPConnect:    result.TCPConnect,
+		TLSHandshakes: result.TLSHandshakes,
+		URL:           target,
+	}
+	if result.Failure != nil || !IsHTTPRedirect(result.HTTPResponseStatus) ||
+		len(result.HTTPResponseLocations) < 1 {
+		return hop, nil
+	}
+	next, err := URL.Parse(result.HTTPResponseLocations[0])
+	if err != nil {
+		// Like Go's net/http, we stop here and return the response
+		return hop, nil
+	}
+	hop.Location = next.String()
+	return hop, next
+}
+
+// httpHopAddresses returns the addresses used by a hop.
+func httpHopAddresses(
+	config HTTPGetConfig, URL *url.URL, queries []archival.DNSQueryEntry) []string {
+	if URL.Hostname() == config.TargetURL.Hostname() {
+		return config.Addresses
+	}
+	if net.ParseIP(URL.Hostname()) != nil {
+		return []string{URL.Hostname()}
+	}
+	out := []string{}
+	for _, query := range queries {
+		for _, answer := range query.Answers {
+			if answer.IPv4 != "" {
+				out = append(out, answer.IPv4)
+			}
+			if answer.IPv6 != "" {
+				out = append(out, answer.IPv6)
+			}
+		}
+	}
+	return out
+}
+
+// IsHTTPRedirect returns whether code is an HTTP redirect status
+// code that Go's net/http would follow.
+func IsHTTPRedirect(code int64) bool {
+	switch code {
+	case 301, 302, 303, 307, 308:
+		return true
+	default:
+		return false
+	}
 }
@@ -2,10 +2,14 @@ package webconnectivity_test
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"testing"
 
+	"github.com/apex/log"
 	"github.com/ooni/probe-engine/experiment/webconnectivity"
+	"github.com/ooni/probe-engine/internal/mockable"
 )
 
 func TestHTTPGet(t *testing.T) {
@@ -22,3 +26,82 @@ func TestHTTPGet(t *testing.T) {
 		t.Fatal(*r.Failure)
 	}
 }
+
+func newRedirectServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			http.SetCookie(w, &http.Cookie{Name: "antani", Value: "mascetti"})
+			http.Redirect(w, r, "/next", http.StatusFound)
+		case "/next":
+			if cookie, err := r.Cookie("antani"); err != nil || cookie.Value != "mascetti" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.Write([]byte("<html><title>Hello</title></html>"))
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		}
+	}))
+}
+
+// serverURL returns the URL of server using www.example.com as the
+// domain, because the DNS cache does not work with IP addresses.
+func serverURL(t *testing.T, server *httptest.Server, path string) *url.URL {
+	URL, err := url.Parse(server.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	URL.Host = "www.example.com:" + URL.Port()
+	return URL
+}
+
+func TestHTTPGetHops(t *testing.T) {
+	server := newRedirectServer(t)
+	defer server.Close()
+	URL := serverURL(t, server, "")
+	r := webconnectivity.HTTPGet(context.Background(), webconnectivity.HTTPGetConfig{
+		Addresses: []string{"127.0.0.1"},
+		Session:   &mockable.Session{MockableLogger: log.Log},
+		TargetURL: URL,
+	})
+	if r.Failure != nil {
+		t.Fatal(*r.Failure)
+	}
+	if len(r.Hops) != 2 {
+		t.Fatal("unexpected number of hops")
+	}
+	if r.Hops[0].StatusCode != 302 || r.Hops[0].Location != URL.String()+"/next" {
+		t.Fatal("unexpected first hop")
+	}
+	if r.Hops[1].StatusCode != 200 || r.Hops[1].Location != "" {
+		t.Fatal("unexpected second hop")
+	}
+	if r.Hops[1].URL != URL.String()+"/next" || len(r.Hops[1].TCPConnect) != 1 {
+		t.Fatal("unexpected second hop")
+	}
+	if len(r.Hops[1].Addresses) != 1 || r.Hops[1].Addresses[0] != "127.0.0.1" {
+		t.Fatal("unexpected second hop addresses")
+	}
+	// OONI's convention is that the last request appears first
+	if len(r.TestKeys.Requests) != 2 || r.TestKeys.Requests[0].Response.Code != 200 {
+		t.Fatal("unexpected requests")
+	}
+}
+
+func TestHTTPGetTooManyRedirects(t *testing.T) {
+	server := newRedirectServer(t)
+	defer server.Close()
+	URL := serverURL(t, server, "/loop")
+	r := webconnectivity.HTTPGet(context.Background(), webconnectivity.HTTPGetConfig{
+		Addresses: []string{"127.0.0.1"},
+		Session:   &mockable.Session{MockableLogger: log.Log},
+		TargetURL: URL,
+	})
+	if r.Failure == nil || r.TestKeys.Failure == nil {
+		t.Fatal("expected a failure here")
+	}
+	if len(r.Hops) != webconnectivity.MaxRedirects {
+		t.Fatal("unexpected number of hops")
+	}
+}
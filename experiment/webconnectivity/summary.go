@@ -1,9 +1,11 @@
 package webconnectivity
 
 import (
+	"net/url"
 	"strings"
 
 	"github.com/ooni/probe-engine/experiment/webconnectivity/internal"
+	"github.com/ooni/probe-engine/internal/blockpages"
 	"github.com/ooni/probe-engine/model"
 	"github.com/ooni/probe-engine/netx/errorx"
 )
@@ -36,6 +38,14 @@ const (
 	StatusExperimentHTTP    // ... in the HTTP experiment
 
 	StatusBugNoRequests // this should never happen
+
+	// The following flags are newer than the previous ones. We add new
+	// flags at the end so that the values of the previous flags do not change.
+
+	StatusAnomalySNI       // TLS with the URL's SNI fails with every address
+	StatusExperimentTLS    // ... in the TLS handshakes with every address
+	StatusAnomalyRedirect  // the probe and the control follow different redirects
+	StatusAnomalyBlockpage // we have seen a known blockpage
 )
 
 // Summary contains the Web Connectivity summary.
@@ -58,6 +68,12 @@ type Summary struct {
 	// Status contains zero or more status flags. This is currently
 	// an experimental interface subject to change at any time.
 	Status int64 `json:"x_status"`
+
+	// DivergingHop is the index of the first hop of the redirect chain
+	// where the probe and the control diverge, or nil if they do not
+	// diverge or we cannot compare them. This is currently an
+	// experimental interface subject to change at any time.
+	DivergingHop *int64 `json:"x_diverging_hop"`
 }
 
 // DetermineBlocking returns the value of Summary.Blocking according to
@@ -100,6 +116,9 @@ func Summarize(tk *TestKeys) (out Summary) {
 	defer func() {
 		out.Blocking = DetermineBlocking(out)
 	}()
+	// Independently of what follows, flag the first hop where the
+	// redirect chains of the probe and of the control diverge.
+	summarizeHops(tk, &out)
 	var (
 		accessible   = true
 		inaccessible = false
@@ -119,6 +138,22 @@ func Summarize(tk *TestKeys) (out Summary) {
 		out.Status |= StatusSuccessSecure
 		return
 	}
+	// If we have seen a known blockpage, then we have confirmed blocking
+	// and we don't need to rely on heuristics. This works even when we
+	// could not contact the control.
+	if tk.Blockpage != nil {
+		out.Accessible = &inaccessible
+		out.Status |= StatusAnomalyBlockpage
+		switch tk.Blockpage.Type {
+		case blockpages.TypeDNS:
+			out.BlockingReason = &dns
+			out.Status |= StatusAnomalyDNS
+		default:
+			out.BlockingReason = &httpDiff
+			out.Status |= StatusAnomalyHTTPDiff
+		}
+		return
+	}
 	// If we couldn't contact the control, we cannot do much more here.
 	if tk.ControlFailure != nil {
 		out.Status |= StatusAnomalyControlUnreachable
@@ -146,6 +181,14 @@ func Summarize(tk *TestKeys) (out Summary) {
 		out.Status |= StatusAnomalyDNS | StatusExperimentDNS
 		return
 	}
+	// If DNSSEC validation failed, someone has forged the DNS reply.
+	if tk.DNSExperimentFailure != nil &&
+		*tk.DNSExperimentFailure == errorx.FailureDNSSECBogusError {
+		out.Accessible = &inaccessible
+		out.BlockingReason = &dns
+		out.Status |= StatusAnomalyDNS | StatusExperimentDNS
+		return
+	}
 	// If we tried to connect more than once and never succeded and we were
 	// able to measure DNS consistency, then we can conclude something.
 	if tk.TCPConnectAttempts > 0 && tk.TCPConnectSuccesses <= 0 && tk.DNSConsistency != nil {
@@ -229,6 +272,11 @@ func Summarize(tk *TestKeys) (out Summary) {
 			// We have not been able to classify the error. Could this perhaps be
 			// caused by a programmer's error? Let us be conservative.
 		}
+		// If we performed TLS handshakes with every address, they may tell
+		// us more precisely what has happened. Then, we're done.
+		if summarizeTLS(tk, &out) {
+			return
+		}
 		// So, good that we have classified the error. Yet, how long is the
 		// redirect chain? If it's exactly one and we have determined that we
 		// should not trust the resolver, then let's bet on the DNS. If the
@@ -278,3 +326,127 @@ func Summarize(tk *TestKeys) (out Summary) {
 	out.Accessible = &inaccessible
 	return
 }
+
+// summarizeTLS uses the TLS handshakes with every address, if any, to
+// refine the summary of a failed HTTP measurement. It returns true if
+// it has been able to determine the blocking reason.
+func summarizeTLS(tk *TestKeys, out *Summary) bool {
+	var (
+		inaccessible = false
+		dns          = "dns"
+		httpFailure  = "http-failure"
+		tcpIP        = "tcp_ip"
+	)
+	probe, control := tk.TLSProbe, tk.TLSControl
+	if probe == nil || probe.Attempts <= 0 || probe.Successes > 0 {
+		return false
+	}
+	if control != nil && control.Successes > 0 {
+		// The TLS handshake with the URL's SNI fails with the addresses
+		// resolved by the probe but works with some addresses resolved
+		// only by the control. If the DNS is not trustworthy, then it is
+		// DNS based blocking, otherwise the probe's addresses are blocked.
+		out.Accessible = &inaccessible
+		out.Status &^= StatusAnomalyUnknown
+		out.Status |= StatusExperimentTLS
+		if tk.DNSConsistency != nil && *tk.DNSConsistency == DNSInconsistent {
+			out.BlockingReason = &dns
+			out.Status |= StatusAnomalyDNS
+			return true
+		}
+		out.BlockingReason = &tcpIP
+		out.Status |= StatusAnomalyConnect
+		return true
+	}
+	if probe.Connected > 0 && controlTLSHandshakeSucceeded(tk) {
+		// We can connect to the probe's addresses but the TLS handshake
+		// with the URL's SNI fails with every address, while the control
+		// completed a TLS handshake with the same domain. This smells like
+		// SNI based blocking. We call it http-failure, like MK would do
+		// for a TLS failure.
+		out.Accessible = &inaccessible
+		out.BlockingReason = &httpFailure
+		out.Status &^= StatusAnomalyUnknown
+		out.Status |= StatusAnomalySNI | StatusAnomalyTLSHandshake | StatusExperimentTLS
+		return true
+	}
+	return false
+}
+
+// controlTLSHandshakeSucceeded returns whether the control has completed
+// a TLS handshake using the SNI of the URL, i.e., whether the first hop of
+// its redirect chain is an https URL that did not fail. Old test helpers
+// do not return hops, in which case we check whether the control could
+// fetch the URL, provided that it is an https URL.
+func controlTLSHandshakeSucceeded(tk *TestKeys) bool {
+	hops := tk.Control.HTTPRequest.Hops
+	if len(hops) <= 0 {
+		parsed, err := url.Parse(tk.ControlRequest.HTTPRequest)
+		return err == nil && parsed.Scheme == "https" &&
+			tk.Control.HTTPRequest.Failure == nil
+	}
+	if hops[0].Failure != nil {
+		return false
+	}
+	parsed, err := url.Parse(hops[0].URL)
+	return err == nil && parsed.Scheme == "https"
+}
+
+// summarizeHops compares the redirect chains followed by the probe and
+// by the control and records the first hop where they diverge. We set
+// StatusAnomalyRedirect when the divergence involves a redirect, e.g.,
+// when the probe is redirected to a blockpage.
+func summarizeHops(tk *TestKeys, out *Summary) {
+	probe, control := tk.HTTPHops, tk.Control.HTTPRequest.Hops
+	idx, found := FirstDivergingHop(probe, control)
+	if !found {
+		return
+	}
+	out.DivergingHop = &idx
+	if idx > 0 || (idx < int64(len(probe)) && probe[idx].Location != "") ||
+		(idx < int64(len(control)) && control[idx].Location != "") {
+		out.Status |= StatusAnomalyRedirect
+	}
+}
+
+// FirstDivergingHop returns the index of the first hop where the redirect
+// chain followed by the probe diverges from the one followed by the control
+// and whether we found such a hop. We say that two hops diverge when only one
+// of them failed, when only one of them is a redirect, or when they redirect
+// to different locations. We ignore the query when comparing locations since
+// it often contains random tokens. We cannot say anything when we do not
+// have the hops of either the probe or the control.
+func FirstDivergingHop(probe []HTTPHop, control []ControlHTTPHop) (int64, bool) {
+	if len(probe) <= 0 || len(control) <= 0 {
+		return 0, false
+	}
+	idx := 0
+	for ; idx < len(probe) && idx < len(control); idx++ {
+		p, c := probe[idx], control[idx]
+		if (p.Failure != nil) != (c.Failure != nil) {
+			return int64(idx), true
+		}
+		if (p.Location != "") != (c.Location != "") {
+			return int64(idx), true
+		}
+		if !sameLocation(p.Location, c.Location) {
+			return int64(idx), true
+		}
+	}
+	if len(probe) != len(control) {
+		return int64(idx), true
+	}
+	return 0, false
+}
+
+// sameLocation returns whether two redirect locations are the
+// same except for the query and the fragment.
+func sameLocation(left, right string) bool {
+	leftURL, leftErr := url.Parse(left)
+	rightURL, rightErr := url.Parse(right)
+	if leftErr != nil || rightErr != nil {
+		return left == right
+	}
+	return leftURL.Scheme == rightURL.Scheme && leftURL.Host == rightURL.Host &&
+		leftURL.Path == rightURL.Path
+}
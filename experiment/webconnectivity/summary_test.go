@@ -6,6 +6,7 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/ooni/probe-engine/experiment/webconnectivity"
+	"github.com/ooni/probe-engine/internal/blockpages"
 	"github.com/ooni/probe-engine/netx/archival"
 	"github.com/ooni/probe-engine/netx/errorx"
 )
@@ -20,6 +21,7 @@ func TestSummarize(t *testing.T) {
 		nilstring              *string
 		probeConnectionRefused = errorx.FailureConnectionRefused
 		probeConnectionReset   = errorx.FailureConnectionReset
+		probeDNSSECBogus       = errorx.FailureDNSSECBogusError
 		probeEOFError          = errorx.FailureEOFError
 		probeNXDOMAIN          = errorx.FailureDNSNXDOMAINError
 		probeTimeout           = errorx.FailureGenericTimeoutError
@@ -28,6 +30,7 @@ func TestSummarize(t *testing.T) {
 		probeSSLUnknownAuth    = errorx.FailureSSLUnknownAuthority
 		tcpIP                  = "tcp_ip"
 		trueValue              = true
+		zeroValue              = int64(0)
 	)
 	type args struct {
 		tk *webconnectivity.TestKeys
@@ -101,6 +104,23 @@ func TestSummarize(t *testing.T) {
 			Status: webconnectivity.StatusAnomalyDNS |
 				webconnectivity.StatusExperimentDNS,
 		},
+	}, {
+		name: "with DNSSEC validation failure",
+		args: args{
+			tk: &webconnectivity.TestKeys{
+				DNSExperimentFailure: &probeDNSSECBogus,
+				DNSAnalysisResult: webconnectivity.DNSAnalysisResult{
+					DNSConsistency: &webconnectivity.DNSInconsistent,
+				},
+			},
+		},
+		wantOut: webconnectivity.Summary{
+			BlockingReason: &dns,
+			Blocking:       &dns,
+			Accessible:     &falseValue,
+			Status: webconnectivity.StatusAnomalyDNS |
+				webconnectivity.StatusExperimentDNS,
+		},
 	}, {
 		name: "with TCP total failure and consistent DNS",
 		args: args{
@@ -447,6 +467,298 @@ func TestSummarize(t *testing.T) {
 			Accessible:     &falseValue,
 			Status:         webconnectivity.StatusAnomalyHTTPDiff,
 		},
+	}, {
+		name: "with TLS failing with the probe's addresses and inconsistent DNS",
+		args: args{
+			tk: &webconnectivity.TestKeys{
+				DNSAnalysisResult: webconnectivity.DNSAnalysisResult{
+					DNSConsistency: &webconnectivity.DNSInconsistent,
+				},
+				Requests: []archival.RequestEntry{{
+					Failure: &probeConnectionReset,
+				}, {}},
+				TLSAnalysisResult: webconnectivity.TLSAnalysisResult{
+					TLSControl: &webconnectivity.TLSEndpointsStats{
+						Attempts: 2, Connected: 2, Successes: 2,
+					},
+					TLSProbe: &webconnectivity.TLSEndpointsStats{
+						Attempts: 1, Connected: 0, Successes: 0,
+					},
+				},
+			},
+		},
+		wantOut: webconnectivity.Summary{
+			BlockingReason: &dns,
+			Blocking:       &dns,
+			Accessible:     &falseValue,
+			Status: webconnectivity.StatusAnomalyReadWrite |
+				webconnectivity.StatusExperimentHTTP |
+				webconnectivity.StatusAnomalyDNS |
+				webconnectivity.StatusExperimentTLS,
+		},
+	}, {
+		name: "with TLS failing with the probe's addresses and consistent DNS",
+		args: args{
+			tk: &webconnectivity.TestKeys{
+				DNSAnalysisResult: webconnectivity.DNSAnalysisResult{
+					DNSConsistency: &webconnectivity.DNSConsistent,
+				},
+				Requests: []archival.RequestEntry{{
+					Failure: &genericFailure,
+				}},
+				TLSAnalysisResult: webconnectivity.TLSAnalysisResult{
+					TLSControl: &webconnectivity.TLSEndpointsStats{
+						Attempts: 1, Connected: 1, Successes: 1,
+					},
+					TLSProbe: &webconnectivity.TLSEndpointsStats{
+						Attempts: 2, Connected: 0, Successes: 0,
+					},
+				},
+			},
+		},
+		wantOut: webconnectivity.Summary{
+			BlockingReason: &tcpIP,
+			Blocking:       &tcpIP,
+			Accessible:     &falseValue,
+			Status: webconnectivity.StatusExperimentHTTP |
+				webconnectivity.StatusAnomalyConnect |
+				webconnectivity.StatusExperimentTLS,
+		},
+	}, {
+		name: "with TLS failing with every address after connect",
+		args: args{
+			tk: &webconnectivity.TestKeys{
+				Control: webconnectivity.ControlResponse{
+					HTTPRequest: webconnectivity.ControlHTTPRequestResult{
+						Hops: []webconnectivity.ControlHTTPHop{{
+							StatusCode: 200,
+							URL:        "https://www.example.com/",
+						}},
+					},
+				},
+				DNSAnalysisResult: webconnectivity.DNSAnalysisResult{
+					DNSConsistency: &webconnectivity.DNSConsistent,
+				},
+				Requests: []archival.RequestEntry{{
+					Failure: &genericFailure,
+				}},
+				TLSAnalysisResult: webconnectivity.TLSAnalysisResult{
+					TLSControl: &webconnectivity.TLSEndpointsStats{
+						Attempts: 1, Connected: 1, Successes: 0,
+					},
+					TLSProbe: &webconnectivity.TLSEndpointsStats{
+						Attempts: 2, Connected: 2, Successes: 0,
+					},
+				},
+			},
+		},
+		wantOut: webconnectivity.Summary{
+			BlockingReason: &httpFailure,
+			Blocking:       &httpFailure,
+			Accessible:     &falseValue,
+			Status: webconnectivity.StatusExperimentHTTP |
+				webconnectivity.StatusAnomalyTLSHandshake |
+				webconnectivity.StatusAnomalySNI |
+				webconnectivity.StatusExperimentTLS,
+		},
+	}, {
+		name: "with TLS failing with every address but no TLS evidence from the control",
+		args: args{
+			tk: &webconnectivity.TestKeys{
+				Control: webconnectivity.ControlResponse{
+					HTTPRequest: webconnectivity.ControlHTTPRequestResult{
+						Hops: []webconnectivity.ControlHTTPHop{{
+							StatusCode: 200,
+							URL:        "http://www.example.com/",
+						}},
+					},
+				},
+				DNSAnalysisResult: webconnectivity.DNSAnalysisResult{
+					DNSConsistency: &webconnectivity.DNSConsistent,
+				},
+				Requests: []archival.RequestEntry{{
+					Failure: &genericFailure,
+				}},
+				TLSAnalysisResult: webconnectivity.TLSAnalysisResult{
+					TLSControl: &webconnectivity.TLSEndpointsStats{
+						Attempts: 1, Connected: 1, Successes: 0,
+					},
+					TLSProbe: &webconnectivity.TLSEndpointsStats{
+						Attempts: 2, Connected: 2, Successes: 0,
+					},
+				},
+			},
+		},
+		wantOut: webconnectivity.Summary{
+			Blocking: nilstring,
+			Status:   webconnectivity.StatusExperimentHTTP,
+		},
+	}, {
+		name: "with TLS failing with every address and an old test helper",
+		args: args{
+			tk: &webconnectivity.TestKeys{
+				ControlRequest: webconnectivity.ControlRequest{
+					HTTPRequest: "https://www.example.com/",
+				},
+				Control: webconnectivity.ControlResponse{
+					HTTPRequest: webconnectivity.ControlHTTPRequestResult{
+						StatusCode: 200,
+					},
+				},
+				DNSAnalysisResult: webconnectivity.DNSAnalysisResult{
+					DNSConsistency: &webconnectivity.DNSConsistent,
+				},
+				Requests: []archival.RequestEntry{{
+					Failure: &genericFailure,
+				}},
+				TLSAnalysisResult: webconnectivity.TLSAnalysisResult{
+					TLSControl: &webconnectivity.TLSEndpointsStats{
+						Attempts: 1, Connected: 1, Successes: 0,
+					},
+					TLSProbe: &webconnectivity.TLSEndpointsStats{
+						Attempts: 2, Connected: 2, Successes: 0,
+					},
+				},
+			},
+		},
+		wantOut: webconnectivity.Summary{
+			BlockingReason: &httpFailure,
+			Blocking:       &httpFailure,
+			Accessible:     &falseValue,
+			Status: webconnectivity.StatusExperimentHTTP |
+				webconnectivity.StatusAnomalyTLSHandshake |
+				webconnectivity.StatusAnomalySNI |
+				webconnectivity.StatusExperimentTLS,
+		},
+	}, {
+		name: "with TLS failing with every address and an old test helper using http",
+		args: args{
+			tk: &webconnectivity.TestKeys{
+				ControlRequest: webconnectivity.ControlRequest{
+					HTTPRequest: "http://www.example.com/",
+				},
+				Control: webconnectivity.ControlResponse{
+					HTTPRequest: webconnectivity.ControlHTTPRequestResult{
+						StatusCode: 200,
+					},
+				},
+				DNSAnalysisResult: webconnectivity.DNSAnalysisResult{
+					DNSConsistency: &webconnectivity.DNSConsistent,
+				},
+				Requests: []archival.RequestEntry{{
+					Failure: &genericFailure,
+				}},
+				TLSAnalysisResult: webconnectivity.TLSAnalysisResult{
+					TLSControl: &webconnectivity.TLSEndpointsStats{
+						Attempts: 1, Connected: 1, Successes: 0,
+					},
+					TLSProbe: &webconnectivity.TLSEndpointsStats{
+						Attempts: 2, Connected: 2, Successes: 0,
+					},
+				},
+			},
+		},
+		wantOut: webconnectivity.Summary{
+			Blocking: nilstring,
+			Status:   webconnectivity.StatusExperimentHTTP,
+		},
+	}, {
+		name: "with TLS working with some of the probe's addresses",
+		args: args{
+			tk: &webconnectivity.TestKeys{
+				DNSAnalysisResult: webconnectivity.DNSAnalysisResult{
+					DNSConsistency: &webconnectivity.DNSConsistent,
+				},
+				Requests: []archival.RequestEntry{{
+					Failure: &probeTimeout,
+				}},
+				TLSAnalysisResult: webconnectivity.TLSAnalysisResult{
+					TLSControl: &webconnectivity.TLSEndpointsStats{},
+					TLSProbe: &webconnectivity.TLSEndpointsStats{
+						Attempts: 2, Connected: 2, Successes: 1,
+					},
+				},
+			},
+		},
+		wantOut: webconnectivity.Summary{
+			BlockingReason: &httpFailure,
+			Blocking:       &httpFailure,
+			Accessible:     &falseValue,
+			Status: webconnectivity.StatusExperimentHTTP |
+				webconnectivity.StatusAnomalyUnknown,
+		},
+	}, {
+		name: "with the probe redirected to a blockpage",
+		args: args{
+			tk: &webconnectivity.TestKeys{
+				Control: webconnectivity.ControlResponse{
+					HTTPRequest: webconnectivity.ControlHTTPRequestResult{
+						Hops: []webconnectivity.ControlHTTPHop{{
+							StatusCode: 200,
+							URL:        "http://www.example.com/",
+						}},
+					},
+				},
+				DNSAnalysisResult: webconnectivity.DNSAnalysisResult{
+					DNSConsistency: &webconnectivity.DNSConsistent,
+				},
+				HTTPAnalysisResult: webconnectivity.HTTPAnalysisResult{
+					StatusCodeMatch: &trueValue,
+					TitleMatch:      &falseValue,
+				},
+				HTTPHops: []webconnectivity.HTTPHop{{
+					Location:   "http://blockpage.example.net/",
+					StatusCode: 302,
+					URL:        "http://www.example.com/",
+				}, {
+					StatusCode: 200,
+					URL:        "http://blockpage.example.net/",
+				}},
+				Requests: []archival.RequestEntry{{}, {}},
+			},
+		},
+		wantOut: webconnectivity.Summary{
+			BlockingReason: &httpDiff,
+			Blocking:       &httpDiff,
+			Accessible:     &falseValue,
+			Status: webconnectivity.StatusAnomalyHTTPDiff |
+				webconnectivity.StatusAnomalyRedirect,
+			DivergingHop: &zeroValue,
+		},
+	}, {
+		name: "with a known DNS blockpage",
+		args: args{
+			tk: &webconnectivity.TestKeys{
+				BlockpageAnalysisResult: webconnectivity.BlockpageAnalysisResult{
+					Blockpage: &blockpages.Fingerprint{Type: blockpages.TypeDNS},
+				},
+				ControlFailure: &genericFailure,
+			},
+		},
+		wantOut: webconnectivity.Summary{
+			BlockingReason: &dns,
+			Blocking:       &dns,
+			Accessible:     &falseValue,
+			Status: webconnectivity.StatusAnomalyBlockpage |
+				webconnectivity.StatusAnomalyDNS,
+		},
+	}, {
+		name: "with a known HTTP blockpage",
+		args: args{
+			tk: &webconnectivity.TestKeys{
+				BlockpageAnalysisResult: webconnectivity.BlockpageAnalysisResult{
+					Blockpage: &blockpages.Fingerprint{Type: blockpages.TypeBody},
+				},
+				Requests: []archival.RequestEntry{{}},
+			},
+		},
+		wantOut: webconnectivity.Summary{
+			BlockingReason: &httpDiff,
+			Blocking:       &httpDiff,
+			Accessible:     &falseValue,
+			Status: webconnectivity.StatusAnomalyBlockpage |
+				webconnectivity.StatusAnomalyHTTPDiff,
+		},
 	}}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -457,3 +769,89 @@ func TestSummarize(t *testing.T) {
 		})
 	}
 }
+
+func TestFirstDivergingHop(t *testing.T) {
+	failure := io.EOF.Error()
+	redirect := func(URL, location string) webconnectivity.HTTPHop {
+		return webconnectivity.HTTPHop{Location: location, StatusCode: 302, URL: URL}
+	}
+	controlRedirect := func(URL, location string) webconnectivity.ControlHTTPHop {
+		return webconnectivity.ControlHTTPHop{Location: location, StatusCode: 302, URL: URL}
+	}
+	tests := []struct {
+		name      string
+		probe     []webconnectivity.HTTPHop
+		control   []webconnectivity.ControlHTTPHop
+		wantIdx   int64
+		wantFound bool
+	}{{
+		name: "without control hops",
+		probe: []webconnectivity.HTTPHop{{
+			StatusCode: 200, URL: "http://x.org/",
+		}},
+	}, {
+		name: "with the same chains",
+		probe: []webconnectivity.HTTPHop{
+			redirect("http://x.org/", "https://x.org/?token=1"),
+			{StatusCode: 200, URL: "https://x.org/?token=1"},
+		},
+		control: []webconnectivity.ControlHTTPHop{
+			controlRedirect("http://x.org/", "https://x.org/?token=2"),
+			{StatusCode: 200, URL: "https://x.org/?token=2"},
+		},
+	}, {
+		name: "with different locations",
+		probe: []webconnectivity.HTTPHop{
+			redirect("http://x.org/", "https://x.org/"),
+			redirect("https://x.org/", "http://blockpage.org/"),
+		},
+		control: []webconnectivity.ControlHTTPHop{
+			controlRedirect("http://x.org/", "https://x.org/"),
+			controlRedirect("https://x.org/", "https://www.x.org/"),
+		},
+		wantIdx:   1,
+		wantFound: true,
+	}, {
+		name: "with a failure in the probe",
+		probe: []webconnectivity.HTTPHop{
+			redirect("http://x.org/", "https://x.org/"),
+			{Failure: &failure, URL: "https://x.org/"},
+		},
+		control: []webconnectivity.ControlHTTPHop{
+			controlRedirect("http://x.org/", "https://x.org/"),
+			{StatusCode: 200, URL: "https://x.org/"},
+		},
+		wantIdx:   1,
+		wantFound: true,
+	}, {
+		name: "with the control being redirected",
+		probe: []webconnectivity.HTTPHop{
+			{StatusCode: 200, URL: "http://x.org/"},
+		},
+		control: []webconnectivity.ControlHTTPHop{
+			controlRedirect("http://x.org/", "https://x.org/"),
+			{StatusCode: 200, URL: "https://x.org/"},
+		},
+		wantIdx:   0,
+		wantFound: true,
+	}, {
+		name: "with a longer chain in the probe",
+		probe: []webconnectivity.HTTPHop{
+			redirect("http://x.org/", "https://x.org/"),
+			redirect("https://x.org/", "https://www.x.org/"),
+		},
+		control: []webconnectivity.ControlHTTPHop{
+			controlRedirect("http://x.org/", "https://x.org/"),
+		},
+		wantIdx:   1,
+		wantFound: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idx, found := webconnectivity.FirstDivergingHop(tt.probe, tt.control)
+			if idx != tt.wantIdx || found != tt.wantFound {
+				t.Fatal("unexpected result", idx, found)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package webconnectivity
+
+// TLSEndpointsStats contains statistics about the TLS handshakes
+// performed with a set of endpoints.
+type TLSEndpointsStats struct {
+	Attempts  int // number of endpoints
+	Connected int // endpoints where the TCP connect succeeded
+	Successes int // endpoints where the TLS handshake succeeded
+}
+
+// TLSAnalysisResult contains the results of analysing the TLS
+// handshakes performed by TLSProbe.
+type TLSAnalysisResult struct {
+	TLSControl *TLSEndpointsStats `json:"-"` // addresses only resolved by the control
+	TLSProbe   *TLSEndpointsStats `json:"-"` // addresses resolved by the probe
+}
+
+// TLSAnalysis computes statistics about the TLS handshakes performed
+// by TLSProbe, which Summarize uses to tell apart IP based blocking,
+// SNI based blocking and DNS based blocking.
+func TLSAnalysis(result TLSProbeResult) (out TLSAnalysisResult) {
+	out.TLSControl = newTLSEndpointsStats(result.Control)
+	out.TLSProbe = newTLSEndpointsStats(result.Probe)
+	return
+}
+
+func newTLSEndpointsStats(result ConnectsResult) *TLSEndpointsStats {
+	out := new(TLSEndpointsStats)
+	for _, tk := range result.AllKeys {
+		out.Attempts++
+		for _, entry := range tk.TCPConnect {
+			if entry.Status.Success {
+				out.Connected++
+				break
+			}
+		}
+		if tk.Failure == nil {
+			out.Successes++
+		}
+	}
+	return out
+}
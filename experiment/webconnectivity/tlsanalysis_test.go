@@ -0,0 +1,48 @@
+package webconnectivity_test
+
+import (
+	"io"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-engine/experiment/urlgetter"
+	"github.com/ooni/probe-engine/experiment/webconnectivity"
+	"github.com/ooni/probe-engine/netx/archival"
+)
+
+func TestTLSAnalysis(t *testing.T) {
+	failure := io.EOF.Error()
+	connected := []archival.TCPConnectEntry{{
+		Status: archival.TCPConnectStatus{Success: true},
+	}}
+	refused := []archival.TCPConnectEntry{{
+		Status: archival.TCPConnectStatus{Failure: &failure},
+	}}
+	out := webconnectivity.TLSAnalysis(webconnectivity.TLSProbeResult{
+		Control: webconnectivity.ConnectsResult{
+			AllKeys: []urlgetter.TestKeys{{
+				TCPConnect: connected,
+			}},
+		},
+		Probe: webconnectivity.ConnectsResult{
+			AllKeys: []urlgetter.TestKeys{{
+				Failure:    &failure,
+				TCPConnect: connected,
+			}, {
+				Failure:    &failure,
+				TCPConnect: refused,
+			}},
+		},
+	})
+	expect := webconnectivity.TLSAnalysisResult{
+		TLSControl: &webconnectivity.TLSEndpointsStats{
+			Attempts: 1, Connected: 1, Successes: 1,
+		},
+		TLSProbe: &webconnectivity.TLSEndpointsStats{
+			Attempts: 2, Connected: 1, Successes: 0,
+		},
+	}
+	if diff := cmp.Diff(expect, out); diff != "" {
+		t.Fatal(diff)
+	}
+}
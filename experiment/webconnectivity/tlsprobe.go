@@ -0,0 +1,78 @@
+package webconnectivity
+
+import (
+	"context"
+	"net"
+	"net/url"
+
+	"github.com/ooni/probe-engine/model"
+	"github.com/ooni/probe-engine/netx/replay"
+)
+
+// TLSProbeConfig contains the config for TLSProbe
+type TLSProbeConfig struct {
+	ControlAddresses []string
+	ProbeAddresses   []string
+	ProbeResult      *ConnectsResult
+	Recorder         *replay.Recorder // optional
+	Replayer         *replay.Replayer // optional
+	Session          model.ExperimentSession
+	TLSFingerprint   string
+	TargetURL        *url.URL
+}
+
+// TLSProbeResult contains the results of TLSProbe
+type TLSProbeResult struct {
+	Control ConnectsResult // addresses only resolved by the control
+	Probe   ConnectsResult // addresses resolved by the probe
+}
+
+// TLSProbe performs a TLS handshake using the SNI of the target URL
+// with every address resolved either by the probe or by the control. The
+// target URL should be an https URL, since we use its port. When
+// ProbeResult is not nil, we reuse it rather than performing again the
+// TLS handshakes with the probe's addresses.
+func TLSProbe(ctx context.Context, config TLSProbeConfig) (out TLSProbeResult) {
+	port := NewEndpointPort(config.TargetURL).Port
+	probeAddresses := make(map[string]bool)
+	for _, addr := range config.ProbeAddresses {
+		probeAddresses[addr] = true
+	}
+	if config.ProbeResult != nil {
+		out.Probe = *config.ProbeResult
+	} else {
+		out.Probe = Connects(ctx, ConnectsConfig{
+			Recorder:       config.Recorder,
+			Replayer:       config.Replayer,
+			Session:        config.Session,
+			TLSFingerprint: config.TLSFingerprint,
+			TargetURL:      config.TargetURL,
+			URLGetterURLs:  newTLSProbeURLs(config.ProbeAddresses, port),
+		})
+	}
+	var controlAddresses []string
+	for _, addr := range config.ControlAddresses {
+		if !probeAddresses[addr] {
+			probeAddresses[addr] = true // avoid measuring duplicates
+			controlAddresses = append(controlAddresses, addr)
+		}
+	}
+	out.Control = Connects(ctx, ConnectsConfig{
+		Recorder:       config.Recorder,
+		Replayer:       config.Replayer,
+		Session:        config.Session,
+		TLSFingerprint: config.TLSFingerprint,
+		TargetURL:      config.TargetURL,
+		URLGetterURLs:  newTLSProbeURLs(controlAddresses, port),
+	})
+	return
+}
+
+func newTLSProbeURLs(addrs []string, port string) (out []string) {
+	out = []string{}
+	for _, addr := range addrs {
+		endpoint := net.JoinHostPort(addr, port)
+		out = append(out, (&url.URL{Scheme: "tlshandshake", Host: endpoint}).String())
+	}
+	return
+}
@@ -0,0 +1,49 @@
+package webconnectivity_test
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/ooni/probe-engine/experiment/urlgetter"
+	"github.com/ooni/probe-engine/experiment/webconnectivity"
+)
+
+func TestTLSProbeSuccess(t *testing.T) {
+	ctx := context.Background()
+	r := webconnectivity.TLSProbe(ctx, webconnectivity.TLSProbeConfig{
+		ControlAddresses: []string{"104.16.249.249", "104.16.248.249"},
+		ProbeAddresses:   []string{"104.16.249.249"},
+		Session:          newsession(t, false),
+		TargetURL:        &url.URL{Scheme: "https", Host: "cloudflare-dns.com", Path: "/"},
+	})
+	if len(r.Probe.AllKeys) != 1 || r.Probe.Successes != 1 {
+		t.Fatal("unexpected probe results")
+	}
+	if len(r.Control.AllKeys) != 1 || r.Control.Successes != 1 {
+		t.Fatal("unexpected control results")
+	}
+	if r.Control.AllKeys[0].TLSHandshakes[0].Address != "104.16.248.249:443" {
+		t.Fatal("unexpected control address")
+	}
+}
+
+func TestTLSProbeReusesProbeResult(t *testing.T) {
+	ctx := context.Background()
+	probeResult := &webconnectivity.ConnectsResult{
+		AllKeys: []urlgetter.TestKeys{{}}, Successes: 1, Total: 1,
+	}
+	r := webconnectivity.TLSProbe(ctx, webconnectivity.TLSProbeConfig{
+		ControlAddresses: []string{"104.16.249.249"},
+		ProbeAddresses:   []string{"104.16.249.249"},
+		ProbeResult:      probeResult,
+		Session:          newsession(t, false),
+		TargetURL:        &url.URL{Scheme: "https", Host: "cloudflare-dns.com", Path: "/"},
+	})
+	if r.Probe.Total != 1 || len(r.Probe.AllKeys) != 1 {
+		t.Fatal("did not reuse the probe result")
+	}
+	if len(r.Control.AllKeys) != 0 {
+		t.Fatal("should not have measured again the same address")
+	}
+}
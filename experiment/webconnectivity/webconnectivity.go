@@ -1,6 +1,11 @@
 // Package webconnectivity implements OONI's Web Connectivity experiment.
 //
 // See https://github.com/ooni/spec/blob/master/nettests/ts-017-web-connectivity.md
+//
+// When the TLSAllAddresses option is set and the URL is an https URL, we
+// additionally perform a TLS handshake using the URL's SNI with every address
+// resolved by the probe or by the control, and we use the results to tell
+// apart IP based, SNI based and DNS based blocking (see Summarize).
 package webconnectivity
 
 import (
@@ -15,15 +20,21 @@ import (
 	"github.com/ooni/probe-engine/internal/httpheader"
 	"github.com/ooni/probe-engine/model"
 	"github.com/ooni/probe-engine/netx/archival"
+	"github.com/ooni/probe-engine/netx/replay"
 )
 
 const (
 	testName    = "web_connectivity"
-	testVersion = "0.1.0"
+	testVersion = "0.6.0"
 )
 
 // Config contains the experiment config.
-type Config struct{}
+type Config struct {
+	DNSSECValidation bool   `ooni:"validate the DNS replies using DNSSEC (requires ResolverURL)"`
+	ResolverURL      string `ooni:"URL of the resolver to use instead of the system resolver"`
+	TLSAllAddresses  bool   `ooni:"TLS handshake with every IP address resolved by the probe or by the control (https URLs only)"`
+	TLSFingerprint   string `ooni:"mimic a browser ClientHello (chrome, firefox, ios or randomized)"`
+}
 
 // TestKeys contains webconnectivity test keys.
 type TestKeys struct {
@@ -47,18 +58,28 @@ type TestKeys struct {
 	TCPConnectSuccesses int                        `json:"-"`
 	TCPConnectAttempts  int                        `json:"-"`
 
+	// TLS handshake experiment
+	TLSHandshakes []archival.TLSHandshake `json:"tls_handshakes"`
+	TLSAnalysisResult
+
 	// HTTP experiment
 	Requests              []archival.RequestEntry `json:"requests"`
 	HTTPExperimentFailure *string                 `json:"http_experiment_failure"`
+	HTTPHops              []HTTPHop               `json:"http_hops"`
 	HTTPAnalysisResult
 
+	// Blockpages analysis
+	BlockpageAnalysisResult
+
 	// Top-level analysis
 	Summary
 }
 
 // Measurer performs the measurement.
 type Measurer struct {
-	Config Config
+	Config   Config
+	Recorder *replay.Recorder // optional, for recording network traffic
+	Replayer *replay.Replayer // optional, for testing
 }
 
 // NewExperimentMeasurer creates a new ExperimentMeasurer.
@@ -129,12 +150,19 @@ func (m Measurer) Run(
 		"backend": testhelper,
 	}
 	// 2. perform the DNS lookup step
-	dnsResult := DNSLookup(ctx, DNSLookupConfig{Session: sess, URL: URL})
+	dnsResult := DNSLookup(ctx, DNSLookupConfig{
+		DNSSECValidation: m.Config.DNSSECValidation,
+		Recorder:         m.Recorder,
+		Replayer:         m.Replayer,
+		ResolverURL:      m.Config.ResolverURL,
+		Session:          sess,
+		URL:              URL,
+	})
 	tk.Queries = append(tk.Queries, dnsResult.TestKeys.Queries...)
 	tk.DNSExperimentFailure = dnsResult.Failure
 	epnts := NewEndpoints(URL, dnsResult.Addresses())
 	// 3. perform the control measurement
-	tk.Control, err = Control(ctx, sess, testhelper.Address, ControlRequest{
+	tk.ControlRequest = ControlRequest{
 		HTTPRequest: URL.String(),
 		HTTPRequestHeaders: map[string][]string{
 			"Accept":          {httpheader.Accept()},
@@ -142,7 +170,8 @@ func (m Measurer) Run(
 			"User-Agent":      {httpheader.UserAgent()},
 		},
 		TCPConnect: epnts.Endpoints(),
-	})
+	}
+	tk.Control, err = Control(ctx, sess, testhelper.Address, tk.ControlRequest)
 	tk.ControlFailure = archival.NewFailure(err)
 	// 4. analyze DNS results
 	if tk.ControlFailure == nil {
@@ -152,9 +181,12 @@ func (m Measurer) Run(
 		tk.DNSAnalysisResult.DNSConsistency))
 	// 5. perform TCP/TLS connects
 	connectsResult := Connects(ctx, ConnectsConfig{
-		Session:       sess,
-		TargetURL:     URL,
-		URLGetterURLs: epnts.URLs(),
+		Recorder:       m.Recorder,
+		Replayer:       m.Replayer,
+		Session:        sess,
+		TLSFingerprint: m.Config.TLSFingerprint,
+		TargetURL:      URL,
+		URLGetterURLs:  epnts.URLs(),
 	})
 	sess.Logger().Infof(
 		"TCP/TLS endpoints: %d/%d reachable", connectsResult.Successes, connectsResult.Total)
@@ -163,20 +195,59 @@ func (m Measurer) Run(
 		// sad that we're storing analysis result inside the measurement
 		tk.TCPConnect = append(tk.TCPConnect, ComputeTCPBlocking(
 			tcpkeys.TCPConnect, tk.Control.TCPConnect)...)
+		tk.TLSHandshakes = append(tk.TLSHandshakes, tcpkeys.TLSHandshakes...)
 	}
 	tk.TCPConnectAttempts = connectsResult.Total
 	tk.TCPConnectSuccesses = connectsResult.Successes
-	// 6. perform HTTP/HTTPS measurement
+	// 6. optionally perform TLS handshakes with every address, which only
+	// makes sense for https URLs, since we use the SNI of the URL
+	if m.Config.TLSAllAddresses && URL.Scheme == "https" {
+		tlsResult := TLSProbe(ctx, TLSProbeConfig{
+			ControlAddresses: tk.Control.DNS.Addrs,
+			ProbeAddresses:   dnsResult.Addresses(),
+			ProbeResult:      &connectsResult, // we already have these handshakes
+			Recorder:         m.Recorder,
+			Replayer:         m.Replayer,
+			Session:          sess,
+			TLSFingerprint:   m.Config.TLSFingerprint,
+			TargetURL:        URL,
+		})
+		for _, tlskeys := range tlsResult.Control.AllKeys {
+			tk.TCPConnect = append(tk.TCPConnect, ComputeTCPBlocking(
+				tlskeys.TCPConnect, tk.Control.TCPConnect)...)
+			tk.TLSHandshakes = append(tk.TLSHandshakes, tlskeys.TLSHandshakes...)
+		}
+		// Implementation note: we do not add the connects to the addresses
+		// only resolved by the control to TCPConnectAttempts and
+		// TCPConnectSuccesses, which Summarize uses to decide whether all
+		// the connects to the probe's addresses failed. TLSAnalysis keeps
+		// their counts separate inside tk.TLSControl.
+		tk.TLSAnalysisResult = TLSAnalysis(tlsResult)
+		sess.Logger().Infof("TLS endpoints (probe): %d/%d reachable",
+			tk.TLSProbe.Successes, tk.TLSProbe.Attempts)
+		sess.Logger().Infof("TLS endpoints (control): %d/%d reachable",
+			tk.TLSControl.Successes, tk.TLSControl.Attempts)
+	}
+	// 7. perform HTTP/HTTPS measurement
 	httpResult := HTTPGet(ctx, HTTPGetConfig{
-		Addresses: dnsResult.Addresses(),
-		Session:   sess,
-		TargetURL: URL,
+		Addresses:      dnsResult.Addresses(),
+		Recorder:       m.Recorder,
+		Replayer:       m.Replayer,
+		Session:        sess,
+		TLSFingerprint: m.Config.TLSFingerprint,
+		TargetURL:      URL,
 	})
 	tk.HTTPExperimentFailure = httpResult.Failure
 	tk.Requests = append(tk.Requests, httpResult.TestKeys.Requests...)
-	// 7. compare HTTP measurement to control
+	tk.HTTPHops = httpResult.Hops
+	// 8. compare HTTP measurement to control
 	tk.HTTPAnalysisResult = HTTPAnalysis(httpResult.TestKeys, tk.Control)
 	tk.HTTPAnalysisResult.Log(sess.Logger())
+	// 9. look for the fingerprints of known blockpages
+	tk.BlockpageAnalysisResult = BlockpageAnalysis(LoadBlockpagesDB(sess), tk)
+	if tk.BlockingFingerprint != nil {
+		sess.Logger().Infof("BlockingFingerprint: %s", *tk.BlockingFingerprint)
+	}
 	tk.Summary = Summarize(tk)
 	tk.Summary.Log(sess.Logger())
 	return nil
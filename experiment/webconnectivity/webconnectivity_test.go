@@ -2,17 +2,29 @@ package webconnectivity_test
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/apex/log"
 	"github.com/google/go-cmp/cmp"
 	engine "github.com/ooni/probe-engine"
 	"github.com/ooni/probe-engine/experiment/webconnectivity"
+	"github.com/ooni/probe-engine/internal/mockable"
+	"github.com/ooni/probe-engine/internal/oohelperd"
 	"github.com/ooni/probe-engine/model"
+	"github.com/ooni/probe-engine/netx"
 	"github.com/ooni/probe-engine/netx/archival"
 	"github.com/ooni/probe-engine/netx/errorx"
+	"github.com/ooni/probe-engine/netx/replay"
+	"github.com/ooni/probe-engine/netx/selfcensor"
 )
 
 func TestNewExperimentMeasurer(t *testing.T) {
@@ -20,7 +32,7 @@ func TestNewExperimentMeasurer(t *testing.T) {
 	if measurer.ExperimentName() != "web_connectivity" {
 		t.Fatal("unexpected name")
 	}
-	if measurer.ExperimentVersion() != "0.1.0" {
+	if measurer.ExperimentVersion() != "0.6.0" {
 		t.Fatal("unexpected version")
 	}
 }
@@ -204,6 +216,297 @@ func TestMeasureWithNoAvailableTestHelpers(t *testing.T) {
 	// TODO(bassosimone): write further checks here?
 }
 
+func TestIntegrationSelfCensor(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			_, port, _ := net.SplitHostPort(r.Host)
+			http.Redirect(w, r, "http://blocked.example.com:"+port+"/", http.StatusFound)
+			return
+		}
+		// The body is large enough to be chunked, so the only uncommon
+		// header is X-Backend, which a blockpage does not have.
+		w.Header().Set("X-Backend", "antani")
+		w.Write([]byte("<html><title>Antani</title><body>" +
+			strings.Repeat("antani ", 1024) + "</body></html>"))
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	tlsServer := httptest.NewTLSServer(handler)
+	defer tlsServer.Close()
+	savedCertPool := netx.CertPool
+	defer func() {
+		netx.CertPool = savedCertPool
+	}()
+	netx.CertPool = x509.NewCertPool()
+	netx.CertPool.AddCert(tlsServer.Certificate())
+	// The control is not subject to self censorship, because it does not
+	// use netx, and it uses its own DNS, where geoblocked.example.com is
+	// resolved but cannot be fetched, and nxdomain.example.com does not exist.
+	resolver := fakeControlResolver{
+		"www.example.com":        {"127.0.0.1"},
+		"blocked.example.com":    {"127.0.0.1"},
+		"geoblocked.example.com": {"127.0.0.1"},
+	}
+	dialer := &net.Dialer{}
+	helper := httptest.NewServer(oohelperd.Handler{
+		Dialer:   dialer,
+		Resolver: resolver,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+				hostname, port, err := net.SplitHostPort(address)
+				if err != nil {
+					return nil, err
+				}
+				if hostname == "geoblocked.example.com" {
+					return nil, errors.New("connection refused")
+				}
+				addrs, err := resolver.LookupHost(ctx, hostname)
+				if err != nil {
+					return nil, err
+				}
+				return dialer.DialContext(ctx, network, net.JoinHostPort(addrs[0], port))
+			},
+			TLSClientConfig: &tls.Config{RootCAs: netx.CertPool},
+		},
+	})
+	defer helper.Close()
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, tlsPort, err := net.SplitHostPort(tlsServer.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpURL := "http://www.example.com:" + port + "/"
+	httpsURL := "https://www.example.com:" + tlsPort + "/"
+	endpoint := net.JoinHostPort("127.0.0.1", port)
+	resolve := `"PoisonSystemDNS":{"www.example.com":["127.0.0.1"],` +
+		`"geoblocked.example.com":["127.0.0.1"],"blocked.example.com":["NXDOMAIN"],` +
+		`"nxdomain.example.com":["NXDOMAIN"]}`
+	defer selfcensor.Enable(`{}`)
+	cases := []struct {
+		name     string
+		input    string
+		spec     string
+		config   webconnectivity.Config
+		helper   string
+		status   int64
+		blocking interface{}
+	}{{
+		name:     "with an http URL",
+		input:    httpURL,
+		spec:     `{` + resolve + `}`,
+		status:   webconnectivity.StatusSuccessCleartext,
+		blocking: false,
+	}, {
+		name:     "with an https URL",
+		input:    httpsURL,
+		spec:     `{` + resolve + `}`,
+		status:   webconnectivity.StatusSuccessSecure,
+		blocking: false,
+	}, {
+		name:  "with a known blockpage",
+		input: httpURL,
+		spec: `{` + resolve + `,"HTTPBlockpages":{"www.example.com:` + port +
+			`":"<iframe src=\"http://10.10.34.34\"></iframe>"}}`,
+		status:   webconnectivity.StatusAnomalyBlockpage | webconnectivity.StatusAnomalyHTTPDiff,
+		blocking: "http-diff",
+	}, {
+		name:   "with the control unreachable",
+		input:  httpURL,
+		spec:   `{` + resolve + `}`,
+		helper: "http://127.0.0.1:1/",
+		status: webconnectivity.StatusAnomalyControlUnreachable,
+	}, {
+		name:     "with a domain that does not exist",
+		input:    "http://nxdomain.example.com:" + port + "/",
+		spec:     `{` + resolve + `}`,
+		status:   webconnectivity.StatusSuccessNXDOMAIN | webconnectivity.StatusExperimentDNS,
+		blocking: false,
+	}, {
+		name:     "with NXDOMAIN injection",
+		input:    httpURL,
+		spec:     `{"PoisonSystemDNS":{"www.example.com":["NXDOMAIN"]}}`,
+		status:   webconnectivity.StatusAnomalyDNS | webconnectivity.StatusExperimentDNS,
+		blocking: "dns",
+	}, {
+		name:  "with the endpoint being blocked",
+		input: httpURL,
+		spec:  `{` + resolve + `,"BlockedEndpoints":{"` + endpoint + `":"REJECT"}}`,
+		status: webconnectivity.StatusAnomalyConnect |
+			webconnectivity.StatusExperimentConnect,
+		blocking: "tcp_ip",
+	}, {
+		name:  "with DNS injection and the endpoint being unreachable",
+		input: httpURL,
+		spec:  `{"PoisonSystemDNS":{"www.example.com":["127.0.0.2"]}}`,
+		status: webconnectivity.StatusAnomalyConnect |
+			webconnectivity.StatusExperimentConnect | webconnectivity.StatusAnomalyDNS,
+		blocking: "dns",
+	}, {
+		name:   "with the control failing for HTTP",
+		input:  "http://geoblocked.example.com:" + port + "/",
+		spec:   `{` + resolve + `}`,
+		status: webconnectivity.StatusAnomalyControlFailure,
+	}, {
+		name:  "with the HTTP request causing a RST",
+		input: httpURL,
+		spec:  `{` + resolve + `,"BlockedFingerprints":{"www.example.com:` + port + `":"RST"}}`,
+		status: webconnectivity.StatusExperimentHTTP |
+			webconnectivity.StatusAnomalyReadWrite,
+		blocking: "http-failure",
+	}, {
+		name:  "with the HTTP request timing out",
+		input: httpURL,
+		spec:  `{` + resolve + `,"BlockedFingerprints":{"www.example.com:` + port + `":"TIMEOUT"}}`,
+		status: webconnectivity.StatusExperimentHTTP |
+			webconnectivity.StatusAnomalyUnknown,
+		blocking: "http-failure",
+	}, {
+		name:  "with a redirect to a blocked domain",
+		input: "http://www.example.com:" + port + "/redirect",
+		spec:  `{` + resolve + `}`,
+		status: webconnectivity.StatusExperimentHTTP | webconnectivity.StatusAnomalyDNS |
+			webconnectivity.StatusAnomalyRedirect,
+		blocking: "dns",
+	}, {
+		name:  "with a TLS MITM",
+		input: httpsURL,
+		spec:  `{` + resolve + `,"BlockedSNIs":{"www.example.com":"MITM"}}`,
+		status: webconnectivity.StatusExperimentHTTP |
+			webconnectivity.StatusAnomalyTLSHandshake,
+		blocking: "http-failure",
+	}, {
+		name:   "with a TLS MITM and TLS handshakes with every address",
+		input:  httpsURL,
+		spec:   `{` + resolve + `,"BlockedSNIs":{"www.example.com":"MITM"}}`,
+		config: webconnectivity.Config{TLSAllAddresses: true},
+		status: webconnectivity.StatusExperimentHTTP | webconnectivity.StatusAnomalySNI |
+			webconnectivity.StatusAnomalyTLSHandshake | webconnectivity.StatusExperimentTLS,
+		blocking: "http-failure",
+	}, {
+		name:     "with an unknown blockpage",
+		input:    httpURL,
+		spec:     `{` + resolve + `,"HTTPBlockpages":{"www.example.com:` + port + `":"<html>blocked</html>"}}`,
+		status:   webconnectivity.StatusAnomalyHTTPDiff,
+		blocking: "http-diff",
+	}}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := selfcensor.Enable(c.spec); err != nil {
+				t.Fatal(err)
+			}
+			helperURL := helper.URL
+			if c.helper != "" {
+				helperURL = c.helper
+			}
+			sess := &mockable.Session{
+				MockableAssetsDir:  "../../testdata",
+				MockableHTTPClient: http.DefaultClient,
+				MockableLogger:     log.Log,
+				MockableTestHelpers: map[string][]model.Service{
+					"web-connectivity": {{Address: helperURL, Type: "https"}},
+				},
+			}
+			measurement := &model.Measurement{Input: model.MeasurementTarget(c.input)}
+			measurer := webconnectivity.NewExperimentMeasurer(c.config)
+			err := measurer.Run(context.Background(), sess, measurement,
+				model.NewPrinterCallbacks(log.Log))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tk := measurement.TestKeys.(*webconnectivity.TestKeys)
+			if tk.Summary.Status != c.status {
+				t.Fatalf("unexpected status: %d", tk.Summary.Status)
+			}
+			blocking := tk.Summary.Blocking
+			if reason, ok := blocking.(*string); ok {
+				if reason == nil {
+					blocking = nil
+				} else {
+					blocking = *reason
+				}
+			}
+			if blocking != c.blocking {
+				t.Fatalf("unexpected blocking: %+v", blocking)
+			}
+		})
+	}
+}
+
+// TestReplayDNSBlockpage replays a capture of a network where the DNS
+// resolves www.example.com to 10.10.34.34, which serves the blockpage
+// used in Iran, and uses the control response stored alongside it.
+func TestReplayDNSBlockpage(t *testing.T) {
+	control, err := ioutil.ReadFile("../../testdata/webconnectivity-dns-blockpage-control.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	helper := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(control)
+	}))
+	defer helper.Close()
+	replayer, err := replay.ReadFile("../../testdata/webconnectivity-dns-blockpage.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess := &mockable.Session{
+		MockableAssetsDir:  "../../testdata",
+		MockableHTTPClient: http.DefaultClient,
+		MockableLogger:     log.Log,
+		MockableTestHelpers: map[string][]model.Service{
+			"web-connectivity": {{Address: helper.URL, Type: "https"}},
+		},
+	}
+	measurement := &model.Measurement{Input: "http://www.example.com/"}
+	measurer := webconnectivity.Measurer{Replayer: replayer}
+	err = measurer.Run(context.Background(), sess, measurement,
+		model.NewPrinterCallbacks(log.Log))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tk := measurement.TestKeys.(*webconnectivity.TestKeys)
+	if tk.DNSConsistency == nil || *tk.DNSConsistency != webconnectivity.DNSInconsistent {
+		t.Fatal("unexpected DNSConsistency")
+	}
+	if tk.BlockingFingerprint == nil || *tk.BlockingFingerprint != "ir_dns" {
+		t.Fatal("unexpected BlockingFingerprint")
+	}
+	if len(tk.Requests) != 1 || tk.Requests[0].Failure != nil ||
+		!strings.Contains(tk.Requests[0].Response.Body.Value, "10.10.34.34") {
+		t.Fatal("unexpected Requests")
+	}
+	var status int64 = webconnectivity.StatusAnomalyBlockpage | webconnectivity.StatusAnomalyDNS
+	if tk.Summary.Status != status {
+		t.Fatalf("unexpected status: %d", tk.Summary.Status)
+	}
+	if reason, ok := tk.Summary.Blocking.(*string); !ok || reason == nil || *reason != "dns" {
+		t.Fatal("unexpected blocking")
+	}
+}
+
+// fakeControlResolver is the resolver used by the control in
+// TestIntegrationSelfCensor. It maps domains to their addresses.
+type fakeControlResolver map[string][]string
+
+func (r fakeControlResolver) LookupHost(ctx context.Context, hostname string) ([]string, error) {
+	addrs, found := r[hostname]
+	if !found {
+		return nil, errors.New("no such host")
+	}
+	return addrs, nil
+}
+
+func (r fakeControlResolver) Network() string {
+	return "fake"
+}
+
+func (r fakeControlResolver) Address() string {
+	return ""
+}
+
 func newsession(t *testing.T, lookupBackends bool) model.ExperimentSession {
 	sess, err := engine.NewSession(engine.SessionConfig{
 		AssetsDir: "../../testdata",
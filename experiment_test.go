@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -13,8 +14,11 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/apex/log"
 	"github.com/ooni/probe-engine/experiment/example"
+	"github.com/ooni/probe-engine/internal/probeservicesd"
 	"github.com/ooni/probe-engine/model"
+	"github.com/ooni/probe-engine/probeservices"
 )
 
 func TestCreateAll(t *testing.T) {
@@ -22,6 +26,9 @@ func TestCreateAll(t *testing.T) {
 	defer sess.Close()
 	for _, name := range AllExperiments() {
 		builder, err := sess.NewExperimentBuilder(name)
+		if errors.Is(err, ErrExperimentNotSupported) {
+			continue // e.g., echcheck with Go < 1.23
+		}
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -603,6 +610,209 @@ func TestSubmitAndUpdateMeasurementWithClosedReport(t *testing.T) {
 	}
 }
 
+// newExperimentWithLocalProbeServices returns an example experiment using
+// the probe services at URL, whose report is already open. To avoid using
+// the network, we pretend that we already know the location.
+func newExperimentWithLocalProbeServices(t *testing.T, URL string) (*Session, *Experiment) {
+	sess, err := NewSession(SessionConfig{
+		AssetsDir: "testdata",
+		AvailableProbeServices: []model.Service{{
+			Address: URL,
+			Type:    "https",
+		}},
+		Logger:          log.Log,
+		SoftwareName:    "ooniprobe-engine",
+		SoftwareVersion: "0.0.1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess.location = &model.LocationInfo{ASN: 30722, CountryCode: "IT"}
+	if err := sess.MaybeLookupBackends(); err != nil {
+		t.Fatal(err)
+	}
+	builder, err := sess.NewExperimentBuilder("example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := builder.NewExperiment()
+	if err := exp.OpenReport(); err != nil {
+		t.Fatal(err)
+	}
+	return sess, exp
+}
+
+func TestSubmitAndUpdateMeasurementQueuesOnFailure(t *testing.T) {
+	handler := probeservicesd.NewHandler()
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	sess, exp := newExperimentWithLocalProbeServices(t, server.URL)
+	defer sess.Close()
+	defer exp.CloseReport()
+	sess.submitQueue.BaseDelay = 0 // retry immediately
+	handler.SetFault(probeservicesd.SubmitEndpoint, &probeservicesd.Fault{
+		Count:      1,
+		StatusCode: 500,
+	})
+	if err := exp.SubmitAndUpdateMeasurement(exp.newMeasurement("xx")); err == nil {
+		t.Fatal("expected an error here")
+	}
+	if stats := sess.SubmissionQueueStats(); stats.Pending != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	stats, err := sess.FlushSubmissionQueue(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Pending != 0 || stats.Submitted != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if len(handler.Measurements()) != 1 {
+		t.Fatal("unexpected number of measurements")
+	}
+}
+
+func TestSubmitAndUpdateMeasurements(t *testing.T) {
+	submit := func(supportsExtensions bool) float64 {
+		handler := probeservicesd.NewHandler()
+		handler.SupportsBatch = supportsExtensions
+		handler.SupportsGzip = supportsExtensions
+		server := httptest.NewServer(handler)
+		defer server.Close()
+		sess, exp := newExperimentWithLocalProbeServices(t, server.URL)
+		defer sess.Close()
+		defer exp.CloseReport()
+		before := exp.KibiBytesSent()
+		var measurements []*model.Measurement
+		for idx := 0; idx < 16; idx++ {
+			measurements = append(measurements, exp.newMeasurement(fmt.Sprintf("%d", idx)))
+		}
+		for _, err := range exp.SubmitAndUpdateMeasurements(measurements) {
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if len(handler.Measurements()) != 16 {
+			t.Fatal("unexpected number of measurements")
+		}
+		return exp.KibiBytesSent() - before
+	}
+	plain, compressed := submit(false), submit(true)
+	if plain <= 0 || compressed <= 0 || compressed >= plain/4 {
+		t.Fatal("unexpected bytes sent", plain, compressed)
+	}
+}
+
+func TestSubmitAndUpdateMeasurementsQueuesOnFailure(t *testing.T) {
+	handler := probeservicesd.NewHandler()
+	handler.SupportsBatch = false
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	sess, exp := newExperimentWithLocalProbeServices(t, server.URL)
+	defer sess.Close()
+	defer exp.CloseReport()
+	measurements := []*model.Measurement{exp.newMeasurement("a"), exp.newMeasurement("b")}
+	handler.SetFault(probeservicesd.SubmitEndpoint, &probeservicesd.Fault{
+		Count:      1,
+		StatusCode: 500,
+	})
+	for _, err := range exp.SubmitAndUpdateMeasurements(measurements) {
+		if err == nil {
+			t.Fatal("expected an error here")
+		}
+	}
+	if stats := sess.SubmissionQueueStats(); stats.Pending != 2 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestSubmitAndUpdateMeasurementsQueuesOnlyFailedMeasurements(t *testing.T) {
+	handler := probeservicesd.NewHandler()
+	handler.SupportsBatch = false
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	sess, exp := newExperimentWithLocalProbeServices(t, server.URL)
+	defer sess.Close()
+	defer exp.CloseReport()
+	measurements := []*model.Measurement{
+		exp.newMeasurement("a"), exp.newMeasurement("b"), exp.newMeasurement("c"),
+	}
+	// The collector rejects the first measurement and then fails.
+	handler.SetFault(probeservicesd.SubmitEndpoint, &probeservicesd.Fault{
+		Count:      1,
+		StatusCode: 400,
+	})
+	errs := exp.SubmitAndUpdateMeasurements(measurements)
+	if errs[0] == nil || errs[1] != nil || errs[2] != nil {
+		t.Fatal("unexpected errors", errs)
+	}
+	if stats := sess.SubmissionQueueStats(); stats.Pending != 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	measurements = []*model.Measurement{exp.newMeasurement("d"), exp.newMeasurement("e")}
+	handler.SetFault(probeservicesd.SubmitEndpoint, &probeservicesd.Fault{
+		Count:      1,
+		StatusCode: 500,
+	})
+	errs = exp.SubmitAndUpdateMeasurements(measurements)
+	if errs[0] == nil || !errors.Is(errs[1], probeservices.ErrSubmissionSkipped) {
+		t.Fatal("unexpected errors", errs)
+	}
+	if stats := sess.SubmissionQueueStats(); stats.Pending != 2 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestSubmitAndSaveSignedMeasurement(t *testing.T) {
+	handler := probeservicesd.NewHandler()
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	sess, exp := newExperimentWithLocalProbeServices(t, server.URL)
+	defer sess.Close()
+	defer exp.CloseReport()
+	key, err := probeservices.NewStateFile(sess.kvStore).SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess.signingKey = key
+	measurement := exp.newMeasurement("a")
+	if err := exp.SubmitAndUpdateMeasurement(measurement); err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "ooniprobe-engine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "report.jsonl")
+	if err := exp.SaveMeasurement(measurement, filename); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, data := range [][]byte{handler.Measurements()[0], saved} {
+		publicKey, err := probeservices.VerifyMeasurement(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(publicKey, sess.SigningPublicKey()) {
+			t.Fatal("unexpected public key")
+		}
+	}
+}
+
+func TestSubmitAndUpdateMeasurementsWithClosedReport(t *testing.T) {
+	sess := newSessionForTestingNoLookups(t)
+	defer sess.Close()
+	exp := NewExperiment(sess, new(antaniMeasurer))
+	errs := exp.SubmitAndUpdateMeasurements([]*model.Measurement{exp.newMeasurement("a")})
+	if len(errs) != 1 || errs[0] == nil {
+		t.Fatal("expected an error here")
+	}
+}
+
 func TestMeasureLookupLocationFailure(t *testing.T) {
 	sess := newSessionForTestingNoLookups(t)
 	defer sess.Close()
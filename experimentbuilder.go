@@ -35,6 +35,7 @@ type ExperimentBuilder struct {
 	config        interface{}
 	inputPolicy   InputPolicy
 	interruptible bool
+	unsupported   error
 }
 
 // Interruptible tells you whether this is an interruptible experiment. This kind
@@ -154,12 +155,20 @@ func canonicalizeExperimentName(name string) string {
 	return name
 }
 
+// ErrExperimentNotSupported indicates that this build of the engine
+// cannot run an experiment, e.g., because of the Go version.
+var ErrExperimentNotSupported = errors.New("experiment not supported by this build")
+
 func newExperimentBuilder(session *Session, name string) (*ExperimentBuilder, error) {
 	factory, _ := experimentsByName[canonicalizeExperimentName(name)]
 	if factory == nil {
 		return nil, fmt.Errorf("no such experiment: %s", name)
 	}
 	builder := factory(session)
+	if builder.unsupported != nil {
+		return nil, fmt.Errorf("%w: %s: %s", ErrExperimentNotSupported, name,
+			builder.unsupported.Error())
+	}
 	builder.callbacks = model.NewPrinterCallbacks(session.Logger())
 	return builder, nil
 }
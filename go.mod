@@ -40,6 +40,7 @@ require (
 	github.com/hashicorp/golang-lru v0.5.4 // indirect
 	github.com/iancoleman/strcase v0.1.2
 	github.com/juju/ratelimit v1.0.2-0.20191002062651-f60b32039441 // indirect
+	github.com/lucas-clemente/quic-go v0.18.1
 	github.com/marusama/semaphore v0.0.0-20171214154724-565ffd8e868a // indirect
 	github.com/miekg/dns v1.1.31
 	github.com/montanaflynn/stats v0.6.3
@@ -49,7 +50,7 @@ require (
 	github.com/pion/stun v0.3.5
 	github.com/redjack/marionette v0.0.0-20180818172807-360dd8f58226 // indirect
 	github.com/refraction-networking/gotapdance v0.0.0-20190909202946-3a6e1938ad70 // indirect
-	github.com/refraction-networking/utls v0.0.0-20200729012536-186025ac7b77 // indirect
+	github.com/refraction-networking/utls v0.0.0-20200729012536-186025ac7b77
 	github.com/rogpeppe/go-internal v1.6.2
 	github.com/ryanuber/go-glob v0.0.0-20170128012129-256dc444b735 // indirect
 	github.com/sergeyfrolov/bsbuffer v0.0.0-20180903213811-94e85abb8507 // indirect
@@ -62,4 +63,5 @@ require (
 	go.uber.org/multierr v1.1.1-0.20180122172545-ddea229ff1df // indirect
 	go.uber.org/zap v1.9.2-0.20180814183419-67bc79d13d15 // indirect
 	golang.org/x/net v0.0.0-20200927032502-5d4f70055728
+	modernc.org/sqlite v1.7.4
 )
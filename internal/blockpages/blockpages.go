@@ -0,0 +1,117 @@
+// Package blockpages contains the database of the fingerprints of the
+// known blockpages. We download this database as a resource (see the
+// resources package) and we use it to confirm blocking.
+package blockpages
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"regexp"
+	"strings"
+)
+
+const (
+	// TypeBody is the type of fingerprints matching the HTTP body.
+	TypeBody = "body"
+
+	// TypeDNS is the type of fingerprints matching a resolved IP.
+	TypeDNS = "dns"
+
+	// TypeHeader is the type of fingerprints matching an HTTP header.
+	TypeHeader = "header"
+)
+
+// Fingerprint is the fingerprint of a known blockpage. For body and
+// header fingerprints, Pattern is a regular expression. For header
+// fingerprints, Header is the name of the header. For DNS fingerprints,
+// Pattern is the IP address returned by the censor's resolver.
+type Fingerprint struct {
+	CountryCode string `json:"cc,omitempty"`
+	Header      string `json:"header,omitempty"`
+	Name        string `json:"name"`
+	Pattern     string `json:"pattern"`
+	Type        string `json:"type"`
+
+	regexp *regexp.Regexp
+}
+
+// DB is the database of the fingerprints.
+type DB struct {
+	Fingerprints []*Fingerprint `json:"fingerprints"`
+	Version      int64          `json:"version"`
+}
+
+// Load loads the database from the specified path.
+func Load(path string) (*DB, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse parses the database from its JSON serialization. We ignore
+// fingerprints of unknown types, so that we can add new types to
+// the database without breaking older probes.
+func Parse(data []byte) (*DB, error) {
+	var db DB
+	if err := json.Unmarshal(data, &db); err != nil {
+		return nil, err
+	}
+	var fingerprints []*Fingerprint
+	for _, fp := range db.Fingerprints {
+		switch fp.Type {
+		case TypeBody, TypeHeader:
+			re, err := regexp.Compile(fp.Pattern)
+			if err != nil {
+				return nil, err
+			}
+			fp.regexp = re
+		case TypeDNS:
+			if ip := net.ParseIP(fp.Pattern); ip != nil {
+				fp.Pattern = ip.String() // canonical form
+			}
+		default:
+			continue
+		}
+		fingerprints = append(fingerprints, fp)
+	}
+	db.Fingerprints = fingerprints
+	return &db, nil
+}
+
+// MatchBody returns the first fingerprint matching body or nil.
+func (db *DB) MatchBody(body string) *Fingerprint {
+	for _, fp := range db.Fingerprints {
+		if fp.Type == TypeBody && fp.regexp.MatchString(body) {
+			return fp
+		}
+	}
+	return nil
+}
+
+// MatchHeader returns the first fingerprint matching the header
+// with the specified name and value or nil.
+func (db *DB) MatchHeader(name, value string) *Fingerprint {
+	for _, fp := range db.Fingerprints {
+		if fp.Type == TypeHeader && strings.EqualFold(fp.Header, name) &&
+			fp.regexp.MatchString(value) {
+			return fp
+		}
+	}
+	return nil
+}
+
+// MatchIP returns the first fingerprint matching the IP address or nil.
+func (db *DB) MatchIP(address string) *Fingerprint {
+	if ip := net.ParseIP(address); ip != nil {
+		address = ip.String() // canonical form
+	}
+	for _, fp := range db.Fingerprints {
+		if fp.Type == TypeDNS && fp.Pattern == address {
+			return fp
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package blockpages_test
+
+import (
+	"testing"
+
+	"github.com/ooni/probe-engine/internal/blockpages"
+)
+
+func TestLoad(t *testing.T) {
+	db, err := blockpages.Load("../../testdata/blockpages.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.Version <= 0 || len(db.Fingerprints) <= 0 {
+		t.Fatal("unexpected database")
+	}
+	if fp := db.MatchIP("10.10.34.35"); fp == nil || fp.Name != "ir_dns" {
+		t.Fatal("cannot match IP address")
+	}
+	if fp := db.MatchHeader("location", "http://warning.rt.ru/?id=17"); fp == nil || fp.Name != "ru_rostelecom" {
+		t.Fatal("cannot match header")
+	}
+	body := `<html><iframe src="http://10.10.34.34?type=Invalid Site"></iframe></html>`
+	if fp := db.MatchBody(body); fp == nil || fp.Name != "ir_iframe" {
+		t.Fatal("cannot match body")
+	}
+	body = `<html><meta http-equiv="refresh" content="0;url=http://internetpositif.id/"></html>`
+	if fp := db.MatchBody(body); fp == nil || fp.Name != "id_internetpositif" {
+		t.Fatal("cannot match body")
+	}
+	// Pages that merely link a blocklist website are not blockpages.
+	if db.MatchBody(`<a href="http://internet-positif.info/">check</a>`) != nil {
+		t.Fatal("unexpected match")
+	}
+	if db.MatchIP("8.8.8.8") != nil || db.MatchBody("<html></html>") != nil {
+		t.Fatal("unexpected match")
+	}
+	if db.MatchHeader("Server", "nginx") != nil {
+		t.Fatal("unexpected match")
+	}
+}
+
+func TestLoadNonexistentFile(t *testing.T) {
+	if _, err := blockpages.Load("/nonexistent"); err == nil {
+		t.Fatal("expected an error here")
+	}
+}
+
+func TestParse(t *testing.T) {
+	t.Run("with invalid JSON", func(t *testing.T) {
+		if _, err := blockpages.Parse([]byte("{")); err == nil {
+			t.Fatal("expected an error here")
+		}
+	})
+	t.Run("with invalid regexp", func(t *testing.T) {
+		data := []byte(`{"fingerprints":[{"name":"x","type":"body","pattern":"("}]}`)
+		if _, err := blockpages.Parse(data); err == nil {
+			t.Fatal("expected an error here")
+		}
+	})
+	t.Run("with unknown type", func(t *testing.T) {
+		data := []byte(`{"fingerprints":[{"name":"x","type":"tls","pattern":"("}]}`)
+		db, err := blockpages.Parse(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(db.Fingerprints) != 0 {
+			t.Fatal("expected to skip the unknown fingerprint")
+		}
+	})
+	t.Run("with non canonical IPv6 address", func(t *testing.T) {
+		data := []byte(`{"fingerprints":[{"name":"x","type":"dns","pattern":"2001:DB8::0:1"}]}`)
+		db, err := blockpages.Parse(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if db.MatchIP("2001:db8::1") == nil {
+			t.Fatal("expected a match")
+		}
+	})
+}
@@ -3,6 +3,7 @@ package httpx
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -23,6 +24,11 @@ type Client struct {
 	// BaseURL is the base URL of the API.
 	BaseURL string
 
+	// GzipRequestBody indicates whether to gzip the body of the requests
+	// created by NewRequestWithJSONBody. Only use it with servers that
+	// support gzip request bodies.
+	GzipRequestBody bool
+
 	// HTTPClient is the real http client to use.
 	HTTPClient *http.Client
 
@@ -50,6 +56,12 @@ func (c Client) NewRequestWithJSONBody(
 		return nil, err
 	}
 	c.Logger.Debugf("httpx: request body: %d bytes", len(data))
+	if c.GzipRequestBody {
+		if data, err = gzipData(data); err != nil {
+			return nil, err
+		}
+		c.Logger.Debugf("httpx: gzipped request body: %d bytes", len(data))
+	}
 	request, err := c.NewRequest(
 		ctx, method, resourcePath, query, bytes.NewReader(data))
 	if err != nil {
@@ -58,9 +70,39 @@ func (c Client) NewRequestWithJSONBody(
 	if body != nil {
 		request.Header.Set("Content-Type", "application/json")
 	}
+	if c.GzipRequestBody {
+		request.Header.Set("Content-Encoding", "gzip")
+	}
 	return request, nil
 }
 
+func gzipData(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// StatusError indicates that the server responded with a status
+// code indicating failure, i.e., a status code >= 400.
+type StatusError struct {
+	// Status is the response status, e.g., "404 Not Found".
+	Status string
+
+	// StatusCode is the response status code, e.g., 404.
+	StatusCode int
+}
+
+// Error implements error.Error.
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("httpx: request failed: %s", e.Status)
+}
+
 // NewRequest creates a new request.
 func (c Client) NewRequest(ctx context.Context, method, resourcePath string,
 	query url.Values, body io.Reader) (*http.Request, error) {
@@ -99,7 +141,7 @@ func (c Client) Do(request *http.Request) ([]byte, error) {
 	}
 	defer response.Body.Close()
 	if response.StatusCode >= 400 {
-		return nil, fmt.Errorf("httpx: request failed: %s", response.Status)
+		return nil, &StatusError{Status: response.Status, StatusCode: response.StatusCode}
 	}
 	return ioutil.ReadAll(response.Body)
 }
@@ -1,9 +1,11 @@
 package httpx_test
 
 import (
+	"compress/gzip"
 	"context"
 	"errors"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strings"
@@ -51,6 +53,31 @@ func TestNewRequestWithJSONBodyNewRequestFailure(t *testing.T) {
 	}
 }
 
+func TestNewRequestWithJSONBodyGzip(t *testing.T) {
+	client := newClient()
+	client.GzipRequestBody = true
+	req, err := client.NewRequestWithJSONBody(
+		context.Background(), "POST", "/", nil, []string{"antani"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatal("expected gzip content encoding")
+	}
+	reader, err := gzip.NewReader(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `["antani"]` {
+		t.Fatal("unexpected body", string(data))
+	}
+}
+
 func TestNewRequestWithQuery(t *testing.T) {
 	client := newClient()
 	q := url.Values{}
@@ -176,6 +203,10 @@ func TestClientDoJSONResponseNotSuccessful(t *testing.T) {
 	if err == nil || !strings.HasPrefix(err.Error(), "httpx: request failed") {
 		t.Fatal("not the error we expected")
 	}
+	var statusErr *httpx.StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != 401 {
+		t.Fatal("not the error we expected")
+	}
 }
 
 func TestClientDoJSONResponseReadingBodyError(t *testing.T) {
@@ -20,6 +20,7 @@ import (
 // Session allows to mock sessions.
 type Session struct {
 	MockableASNDatabasePath      string
+	MockableAssetsDir            string
 	MockableCABundlePath         string
 	MockableTestHelpers          map[string][]model.Service
 	MockableHTTPClient           *http.Client
@@ -48,6 +49,11 @@ func (sess *Session) ASNDatabasePath() string {
 	return sess.MockableASNDatabasePath
 }
 
+// AssetsDir implements ExperimentSession.AssetsDir
+func (sess *Session) AssetsDir() string {
+	return sess.MockableAssetsDir
+}
+
 // CABundlePath implements ExperimentSession.CABundlePath
 func (sess *Session) CABundlePath() string {
 	return sess.MockableCABundlePath
@@ -0,0 +1,62 @@
+package oohelperd
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/ooni/probe-engine/netx"
+	"github.com/ooni/probe-engine/netx/resolver"
+)
+
+// ErrBogonEndpoint indicates that we refused to connect to an endpoint
+// because its address is private, loopback, link-local, etc.
+var ErrBogonEndpoint = errors.New("oohelperd: refusing to connect to a bogon")
+
+// bogonDialer is a dialer that refuses to connect to bogons, such that
+// probes cannot use the helper to reach its private network.
+//
+// Implementation note: we resolve the domain ourselves and we connect to
+// the addresses we checked, otherwise an attacker controlling the domain
+// could return a different address when the dialer resolves it.
+type bogonDialer struct {
+	Dialer   netx.Dialer
+	Resolver netx.Resolver
+}
+
+// DialContext implements netx.Dialer.DialContext.
+func (d bogonDialer) DialContext(
+	ctx context.Context, network, address string) (net.Conn, error) {
+	hostname, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	addrs := []string{hostname}
+	if net.ParseIP(hostname) == nil {
+		addrs, err = d.Resolver.LookupHost(ctx, hostname)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(addrs) <= 0 {
+		return nil, ErrBogonEndpoint // nothing we could safely connect to
+	}
+	for _, addr := range addrs {
+		if resolver.IsBogon(addr) {
+			return nil, ErrBogonEndpoint
+		}
+	}
+	var firstErr error
+	for _, addr := range addrs {
+		conn, err := d.Dialer.DialContext(ctx, network, net.JoinHostPort(addr, port))
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, firstErr
+}
+
+var _ netx.Dialer = bogonDialer{}
@@ -0,0 +1,38 @@
+package oohelperd
+
+import (
+	"context"
+	"net"
+	"net/url"
+
+	"github.com/ooni/probe-engine/experiment/webconnectivity"
+	"github.com/ooni/probe-engine/netx/archival"
+	"github.com/ooni/probe-engine/netx/errorx"
+)
+
+// dnsLookup resolves the domain of the given URL.
+func (h Handler) dnsLookup(ctx context.Context, URL string) webconnectivity.ControlDNSResult {
+	out := webconnectivity.ControlDNSResult{Addrs: []string{}}
+	parsed, err := url.Parse(URL)
+	if err != nil {
+		out.Failure = archival.NewFailure(errorx.SafeErrWrapperBuilder{
+			Error:     err,
+			Operation: errorx.TopLevelOperation,
+		}.MaybeBuild())
+		return out
+	}
+	hostname := parsed.Hostname()
+	if net.ParseIP(hostname) != nil {
+		out.Addrs = append(out.Addrs, hostname)
+		return out
+	}
+	addrs, err := h.Resolver.LookupHost(ctx, hostname)
+	out.Failure = archival.NewFailure(err)
+	if out.Failure != nil && *out.Failure == errorx.FailureDNSNXDOMAINError {
+		// The probe expects this failure string on NXDOMAIN
+		failure := webconnectivity.DNSNameError
+		out.Failure = &failure
+	}
+	out.Addrs = append(out.Addrs, addrs...)
+	return out
+}
@@ -0,0 +1,101 @@
+package oohelperd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"regexp"
+
+	"github.com/ooni/probe-engine/experiment/webconnectivity"
+	"github.com/ooni/probe-engine/internal/runtimex"
+	"github.com/ooni/probe-engine/netx/archival"
+	"github.com/ooni/probe-engine/netx/errorx"
+)
+
+// titleRegexp extracts the title of a webpage like MK does.
+var titleRegexp = regexp.MustCompile(`(?i)<title>([^<]{1,128})</title>`)
+
+// httpGet fetches the URL in creq using the headers in creq and
+// following redirects, like the probe does.
+func (h Handler) httpGet(
+	ctx context.Context, creq webconnectivity.ControlRequest) webconnectivity.ControlHTTPRequestResult {
+	var out webconnectivity.ControlHTTPRequestResult
+	req, err := http.NewRequest("GET", creq.HTTPRequest, nil)
+	if err != nil {
+		out.Failure = archival.NewFailure(errorx.SafeErrWrapperBuilder{
+			Error:     err,
+			Operation: errorx.TopLevelOperation,
+		}.MaybeBuild())
+		return out
+	}
+	req = req.WithContext(ctx)
+	for key, values := range creq.HTTPRequestHeaders {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	// Implementation note: like in urlgetter, this cookiejar accepts all
+	// cookies from all domains, which is fine for measuring.
+	jar, err := cookiejar.New(nil)
+	runtimex.PanicOnError(err, "cookiejar.New failed")
+	// Implementation note: we record each hop of the redirect chain as
+	// well, so that the probe can compare it to its own chain.
+	clnt := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			out.Hops = append(out.Hops, webconnectivity.ControlHTTPHop{
+				Location:   req.URL.String(),
+				StatusCode: int64(req.Response.StatusCode),
+				URL:        via[len(via)-1].URL.String(),
+			})
+			if len(via) >= webconnectivity.MaxRedirects {
+				return webconnectivity.ErrTooManyRedirects
+			}
+			return nil
+		},
+		Jar:       jar,
+		Transport: h.Transport,
+	}
+	// Implementation note: we must not close the idle connections of the
+	// client here, because h.Transport is shared by all the requests.
+	resp, err := clnt.Do(req)
+	if err != nil {
+		out.Failure = archival.NewFailure(err)
+		if !errors.Is(err, webconnectivity.ErrTooManyRedirects) {
+			out.Hops = append(out.Hops, webconnectivity.ControlHTTPHop{
+				Failure: out.Failure,
+				URL:     nextHopURL(creq.HTTPRequest, out.Hops),
+			})
+		}
+		return out
+	}
+	defer resp.Body.Close()
+	out.Headers = make(map[string]string)
+	for key := range resp.Header {
+		out.Headers[key] = resp.Header.Get(key)
+	}
+	out.StatusCode = int64(resp.StatusCode)
+	reader := io.LimitReader(resp.Body, h.maxAcceptableBody())
+	data, err := ioutil.ReadAll(reader)
+	out.BodyLength = int64(len(data))
+	out.Failure = archival.NewFailure(err)
+	if v := titleRegexp.FindSubmatch(data); len(v) >= 2 {
+		out.Title = string(v[1])
+	}
+	out.Hops = append(out.Hops, webconnectivity.ControlHTTPHop{
+		Failure:    out.Failure,
+		StatusCode: out.StatusCode,
+		URL:        resp.Request.URL.String(),
+	})
+	return out
+}
+
+// nextHopURL returns the URL of the hop following hops.
+func nextHopURL(URL string, hops []webconnectivity.ControlHTTPHop) string {
+	if len(hops) > 0 {
+		return hops[len(hops)-1].Location
+	}
+	return URL
+}
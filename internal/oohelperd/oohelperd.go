@@ -0,0 +1,150 @@
+// Package oohelperd implements the Web Connectivity test helper, i.e. the
+// server that webconnectivity.Control talks to. Given a ControlRequest, the
+// helper resolves the domain of the URL, connects to the TCP endpoints listed
+// by the probe and fetches the URL, and returns a ControlResponse.
+package oohelperd
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ooni/probe-engine/experiment/webconnectivity"
+	"github.com/ooni/probe-engine/internal/httpheader"
+	"github.com/ooni/probe-engine/netx"
+)
+
+const (
+	// DefaultMaxAcceptableBody is the default value of
+	// Handler.MaxAcceptableBody.
+	DefaultMaxAcceptableBody = 1 << 24
+
+	// DefaultMaxEndpoints is the default value of Handler.MaxEndpoints.
+	DefaultMaxEndpoints = 32
+
+	// DefaultTimeout is the default value of Handler.Timeout.
+	DefaultTimeout = 30 * time.Second
+)
+
+// Handler implements the Web Connectivity test helper API.
+type Handler struct {
+	// Dialer is the dialer used to connect to the TCP endpoints.
+	Dialer netx.Dialer
+
+	// MaxAcceptableBody is the maximum size of both the body of
+	// the request and the body of the fetched webpage.
+	MaxAcceptableBody int64
+
+	// MaxEndpoints is the maximum number of TCP endpoints we
+	// connect to for each request. We ignore the others.
+	MaxEndpoints int
+
+	// Resolver is the resolver used to resolve the domain.
+	Resolver netx.Resolver
+
+	// Timeout is the maximum time for measuring a request.
+	Timeout time.Duration
+
+	// Transport is the HTTP transport used to fetch the URL.
+	Transport netx.HTTPRoundTripper
+}
+
+// NewHandler creates a new Handler using netx and the given config to
+// create the resolver, the dialer, and the HTTP transport. The dialer
+// used for the TCP connects and by the HTTP transport refuses to connect
+// to private, loopback, link-local, etc. addresses, both when the probe
+// asks us to connect to them and when the domain resolves to them.
+func NewHandler(config netx.Config) Handler {
+	if config.FullResolver == nil {
+		config.FullResolver = netx.NewResolver(config)
+	}
+	if config.Dialer == nil {
+		config.Dialer = netx.NewDialer(config)
+	}
+	config.Dialer = bogonDialer{Dialer: config.Dialer, Resolver: config.FullResolver}
+	return Handler{
+		Dialer:            config.Dialer,
+		MaxAcceptableBody: DefaultMaxAcceptableBody,
+		MaxEndpoints:      DefaultMaxEndpoints,
+		Resolver:          config.FullResolver,
+		Timeout:           DefaultTimeout,
+		Transport:         netx.NewHTTPTransport(config),
+	}
+}
+
+// ServeHTTP implements http.Handler.ServeHTTP.
+func (h Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Server", httpheader.UserAgent())
+	if req.Method != "POST" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	data, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, h.maxAcceptableBody()))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var creq webconnectivity.ControlRequest
+	if err := json.Unmarshal(data, &creq); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	cresp := h.Measure(req.Context(), creq)
+	data, err = json.Marshal(cresp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// Measure performs the measurement described by creq. We run the DNS
+// lookup, the TCP connects and the HTTP request in parallel.
+func (h Handler) Measure(
+	ctx context.Context, creq webconnectivity.ControlRequest) webconnectivity.ControlResponse {
+	timeout := DefaultTimeout
+	if h.Timeout > 0 {
+		timeout = h.Timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var (
+		cresp webconnectivity.ControlResponse
+		wg    sync.WaitGroup
+	)
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		cresp.DNS = h.dnsLookup(ctx, creq.HTTPRequest)
+	}()
+	go func() {
+		defer wg.Done()
+		cresp.TCPConnect = h.tcpConnects(ctx, creq.TCPConnect)
+	}()
+	go func() {
+		defer wg.Done()
+		cresp.HTTPRequest = h.httpGet(ctx, creq)
+	}()
+	wg.Wait()
+	return cresp
+}
+
+func (h Handler) maxEndpoints() int {
+	if h.MaxEndpoints > 0 {
+		return h.MaxEndpoints
+	}
+	return DefaultMaxEndpoints
+}
+
+func (h Handler) maxAcceptableBody() int64 {
+	if h.MaxAcceptableBody > 0 {
+		return h.MaxAcceptableBody
+	}
+	return DefaultMaxAcceptableBody
+}
+
+var _ http.Handler = Handler{}
@@ -0,0 +1,244 @@
+package oohelperd_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-engine/experiment/webconnectivity"
+	"github.com/ooni/probe-engine/internal/mockable"
+	"github.com/ooni/probe-engine/internal/oohelperd"
+	"github.com/ooni/probe-engine/netx"
+)
+
+type nxdomainResolver struct{}
+
+func (nxdomainResolver) LookupHost(ctx context.Context, hostname string) ([]string, error) {
+	return nil, &net.DNSError{Err: "no such host", Name: hostname}
+}
+
+func (nxdomainResolver) Network() string {
+	return "fake"
+}
+
+func (nxdomainResolver) Address() string {
+	return ""
+}
+
+// newHandlerAllowingBogons is like oohelperd.NewHandler except that
+// it allows connecting to bogons, such that we can use local servers.
+func newHandlerAllowingBogons(config netx.Config) oohelperd.Handler {
+	handler := oohelperd.NewHandler(config)
+	handler.Dialer = netx.NewDialer(config)
+	handler.Transport = netx.NewHTTPTransport(config)
+	return handler
+}
+
+func TestUnitHandlerWithControl(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("User-Agent") != "antani/1.0" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("X-Antani", "mascetti")
+			w.Write([]byte("<HTML><TITLE>Hello, world</TITLE></HTML>"))
+		}))
+	defer target.Close()
+	helper := httptest.NewServer(newHandlerAllowingBogons(netx.Config{Logger: log.Log}))
+	defer helper.Close()
+	// find a closed port by closing a listener
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := listener.Addr().String()
+	listener.Close()
+	sess := &mockable.Session{
+		MockableHTTPClient: http.DefaultClient,
+		MockableLogger:     log.Log,
+	}
+	cresp, err := webconnectivity.Control(
+		context.Background(), sess, helper.URL, webconnectivity.ControlRequest{
+			HTTPRequest: target.URL,
+			HTTPRequestHeaders: map[string][]string{
+				"User-Agent": {"antani/1.0"},
+			},
+			TCPConnect: []string{target.Listener.Addr().String(), closed},
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cresp.DNS.Failure != nil || len(cresp.DNS.Addrs) != 1 || cresp.DNS.Addrs[0] != "127.0.0.1" {
+		t.Fatal("unexpected DNS result")
+	}
+	if len(cresp.TCPConnect) != 2 {
+		t.Fatal("unexpected number of TCP connect results")
+	}
+	if r := cresp.TCPConnect[target.Listener.Addr().String()]; !r.Status || r.Failure != nil {
+		t.Fatal("unexpected TCP connect result for target")
+	}
+	if r := cresp.TCPConnect[closed]; r.Status || r.Failure == nil || *r.Failure != "connection_refused" {
+		t.Fatal("unexpected TCP connect result for closed port")
+	}
+	if cresp.HTTPRequest.Failure != nil || cresp.HTTPRequest.StatusCode != 200 {
+		t.Fatal("unexpected HTTP result")
+	}
+	if cresp.HTTPRequest.Title != "Hello, world" {
+		t.Fatal("unexpected title")
+	}
+	if cresp.HTTPRequest.BodyLength != 40 {
+		t.Fatal("unexpected body length")
+	}
+	if cresp.HTTPRequest.Headers["X-Antani"] != "mascetti" {
+		t.Fatal("unexpected headers")
+	}
+}
+
+func TestUnitHandlerMeasureRedirects(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/" {
+				http.Redirect(w, r, "/next", http.StatusFound)
+				return
+			}
+			w.Write([]byte("<HTML><TITLE>Hello, world</TITLE></HTML>"))
+		}))
+	defer target.Close()
+	handler := newHandlerAllowingBogons(netx.Config{Logger: log.Log})
+	cresp := handler.Measure(context.Background(), webconnectivity.ControlRequest{
+		HTTPRequest: target.URL,
+	})
+	expect := []webconnectivity.ControlHTTPHop{{
+		Location:   target.URL + "/next",
+		StatusCode: 302,
+		URL:        target.URL,
+	}, {
+		StatusCode: 200,
+		URL:        target.URL + "/next",
+	}}
+	if diff := cmp.Diff(expect, cresp.HTTPRequest.Hops); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestUnitHandlerRefusesBogons(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("<HTML><TITLE>Hello, world</TITLE></HTML>"))
+		}))
+	defer target.Close()
+	handler := oohelperd.NewHandler(netx.Config{Logger: log.Log})
+	_, port, err := net.SplitHostPort(target.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, URL := range []string{
+		target.URL, // bogon address
+		"http://" + net.JoinHostPort("localhost", port) + "/", // resolves to bogons
+	} {
+		cresp := handler.Measure(context.Background(), webconnectivity.ControlRequest{
+			HTTPRequest: URL,
+			TCPConnect:  []string{target.Listener.Addr().String()},
+		})
+		failure := oohelperd.ErrBogonEndpoint.Error()
+		r := cresp.TCPConnect[target.Listener.Addr().String()]
+		if r.Status || r.Failure == nil || !strings.HasSuffix(*r.Failure, failure) {
+			t.Fatal("unexpected TCP connect result", r.Failure)
+		}
+		if f := cresp.HTTPRequest.Failure; f == nil || !strings.HasSuffix(*f, failure) {
+			t.Fatal("unexpected HTTP result", f)
+		}
+	}
+}
+
+func TestUnitHandlerMaxEndpoints(t *testing.T) {
+	handler := newHandlerAllowingBogons(netx.Config{BaseResolver: nxdomainResolver{}})
+	handler.MaxEndpoints = 2
+	cresp := handler.Measure(context.Background(), webconnectivity.ControlRequest{
+		HTTPRequest: "http://www.example.com/",
+		TCPConnect: []string{
+			"127.0.0.1:1", "127.0.0.1:1", "127.0.0.1:2", "127.0.0.1:3",
+		},
+	})
+	if len(cresp.TCPConnect) != 2 {
+		t.Fatal("unexpected number of TCP connect results")
+	}
+	for _, endpoint := range []string{"127.0.0.1:1", "127.0.0.1:2"} {
+		if _, found := cresp.TCPConnect[endpoint]; !found {
+			t.Fatal("missing endpoint", endpoint)
+		}
+	}
+}
+
+func TestUnitHandlerMeasureNXDOMAIN(t *testing.T) {
+	handler := oohelperd.NewHandler(netx.Config{BaseResolver: nxdomainResolver{}})
+	cresp := handler.Measure(context.Background(), webconnectivity.ControlRequest{
+		HTTPRequest: "http://www.example.com/",
+	})
+	if cresp.DNS.Failure == nil || *cresp.DNS.Failure != webconnectivity.DNSNameError {
+		t.Fatal("unexpected DNS failure")
+	}
+	if cresp.DNS.Addrs == nil || len(cresp.DNS.Addrs) != 0 {
+		t.Fatal("expected empty, non-nil addrs")
+	}
+	if cresp.HTTPRequest.Failure == nil || cresp.HTTPRequest.StatusCode != 0 {
+		t.Fatal("expected the HTTP request to fail")
+	}
+}
+
+func TestUnitHandlerMeasureInvalidURL(t *testing.T) {
+	handler := oohelperd.NewHandler(netx.Config{BaseResolver: nxdomainResolver{}})
+	cresp := handler.Measure(context.Background(), webconnectivity.ControlRequest{
+		HTTPRequest: "\t",
+	})
+	if cresp.DNS.Failure == nil || cresp.HTTPRequest.Failure == nil {
+		t.Fatal("expected failures here")
+	}
+}
+
+func TestUnitHandlerBadRequests(t *testing.T) {
+	helper := httptest.NewServer(oohelperd.NewHandler(netx.Config{}))
+	defer helper.Close()
+	t.Run("with GET", func(t *testing.T) {
+		resp, err := http.Get(helper.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatal("unexpected status code")
+		}
+	})
+	t.Run("with invalid JSON", func(t *testing.T) {
+		resp, err := http.Post(helper.URL, "application/json", strings.NewReader("{"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatal("unexpected status code")
+		}
+	})
+	t.Run("with too large body", func(t *testing.T) {
+		handler := oohelperd.NewHandler(netx.Config{})
+		handler.MaxAcceptableBody = 4
+		server := httptest.NewServer(handler)
+		defer server.Close()
+		resp, err := http.Post(server.URL, "application/json", strings.NewReader("{}    "))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatal("unexpected status code")
+		}
+	})
+}
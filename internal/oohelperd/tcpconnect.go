@@ -0,0 +1,50 @@
+package oohelperd
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ooni/probe-engine/experiment/webconnectivity"
+	"github.com/ooni/probe-engine/netx/archival"
+)
+
+// tcpConnects connects in parallel to the given TCP endpoints. We only
+// connect to the first h.MaxEndpoints distinct endpoints, such that a
+// single request cannot make us connect to too many endpoints.
+func (h Handler) tcpConnects(
+	ctx context.Context, endpoints []string) map[string]webconnectivity.ControlTCPConnectResult {
+	var (
+		distinct []string
+		mu       sync.Mutex
+		out      = make(map[string]webconnectivity.ControlTCPConnectResult)
+		wg       sync.WaitGroup
+	)
+	for _, endpoint := range endpoints {
+		if _, found := out[endpoint]; found {
+			continue // we already measured this endpoint
+		}
+		if len(distinct) >= h.maxEndpoints() {
+			break
+		}
+		out[endpoint] = webconnectivity.ControlTCPConnectResult{}
+		distinct = append(distinct, endpoint)
+	}
+	for _, endpoint := range distinct {
+		wg.Add(1)
+		go func(endpoint string) {
+			defer wg.Done()
+			conn, err := h.Dialer.DialContext(ctx, "tcp", endpoint)
+			if conn != nil {
+				conn.Close()
+			}
+			mu.Lock()
+			out[endpoint] = webconnectivity.ControlTCPConnectResult{
+				Failure: archival.NewFailure(err),
+				Status:  err == nil,
+			}
+			mu.Unlock()
+		}(endpoint)
+	}
+	wg.Wait()
+	return out
+}
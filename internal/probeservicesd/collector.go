@@ -0,0 +1,143 @@
+package probeservicesd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ooni/probe-engine/probeservices"
+)
+
+type openReportResponse struct {
+	ID                 string   `json:"report_id"`
+	SupportedEncodings []string `json:"supported_encodings,omitempty"`
+	SupportedFormats   []string `json:"supported_formats"`
+	SupportsBatch      bool     `json:"supports_batch,omitempty"`
+}
+
+func (h *Handler) openReport(w http.ResponseWriter, req *http.Request) {
+	var rt probeservices.ReportTemplate
+	if !h.readJSON(w, req, &rt) {
+		return
+	}
+	if rt.DataFormatVersion != probeservices.DefaultDataFormatVersion ||
+		rt.Format != probeservices.DefaultFormat || rt.TestName == "" ||
+		rt.ProbeCC == "" || !strings.HasPrefix(rt.ProbeASN, "AS") {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	// Like the real collector, we encode the report metadata into
+	// the report ID, e.g. 20201016T153512Z_ndt_IT_30722_n1_<random>.
+	reportID := newID(fmt.Sprintf("%s_%s_%s_%s_n1",
+		time.Now().UTC().Format("20060102T150405Z"),
+		strings.ReplaceAll(rt.TestName, "_", ""), rt.ProbeCC,
+		strings.TrimPrefix(rt.ProbeASN, "AS")))
+	h.mu.Lock()
+	h.reports[reportID] = rt
+	h.mu.Unlock()
+	response := openReportResponse{
+		ID:               reportID,
+		SupportedFormats: []string{probeservices.DefaultFormat},
+		SupportsBatch:    h.SupportsBatch,
+	}
+	if h.SupportsGzip {
+		response.SupportedEncodings = []string{"gzip"}
+	}
+	h.writeJSON(w, response)
+}
+
+type submitRequest struct {
+	Content json.RawMessage `json:"content"`
+	Format  string          `json:"format"`
+}
+
+type submitResponse struct {
+	ID string `json:"measurement_id"`
+}
+
+func (h *Handler) submit(w http.ResponseWriter, req *http.Request, reportID string) {
+	var sreq submitRequest
+	if !h.readJSON(w, req, &sreq) {
+		return
+	}
+	var content struct {
+		ReportID string `json:"report_id"`
+	}
+	if sreq.Format != probeservices.DefaultFormat ||
+		json.Unmarshal(sreq.Content, &content) != nil ||
+		content.ReportID != reportID {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	h.mu.Lock()
+	_, found := h.reports[reportID]
+	if found {
+		h.measurements = append(h.measurements, sreq.Content)
+	}
+	h.mu.Unlock()
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	h.writeJSON(w, submitResponse{ID: newID(
+		time.Now().UTC().Format("20060102150405.000000"))})
+}
+
+type submitBatchRequest struct {
+	Content []json.RawMessage `json:"content"`
+	Format  string            `json:"format"`
+}
+
+type submitBatchResponse struct {
+	IDs []string `json:"measurement_ids"`
+}
+
+func (h *Handler) submitBatch(w http.ResponseWriter, req *http.Request, reportID string) {
+	var sreq submitBatchRequest
+	if !h.readJSON(w, req, &sreq) {
+		return
+	}
+	if sreq.Format != probeservices.DefaultFormat || len(sreq.Content) <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	for _, entry := range sreq.Content {
+		var content struct {
+			ReportID string `json:"report_id"`
+		}
+		if json.Unmarshal(entry, &content) != nil || content.ReportID != reportID {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	h.mu.Lock()
+	_, found := h.reports[reportID]
+	if found {
+		h.measurements = append(h.measurements, sreq.Content...)
+	}
+	h.mu.Unlock()
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	var response submitBatchResponse
+	for range sreq.Content {
+		response.IDs = append(response.IDs, newID(
+			time.Now().UTC().Format("20060102150405.000000")))
+	}
+	h.writeJSON(w, response)
+}
+
+func (h *Handler) closeReport(w http.ResponseWriter, req *http.Request, reportID string) {
+	h.mu.Lock()
+	_, found := h.reports[reportID]
+	delete(h.reports, reportID)
+	h.mu.Unlock()
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	h.writeJSON(w, struct{}{})
+}
@@ -0,0 +1,131 @@
+package probeservicesd
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ooni/probe-engine/model"
+	"github.com/ooni/probe-engine/probeservices"
+)
+
+type registerRequest struct {
+	probeservices.Metadata
+	Password string `json:"password"`
+}
+
+type registerResponse struct {
+	ClientID string `json:"client_id"`
+}
+
+func (h *Handler) register(w http.ResponseWriter, req *http.Request) {
+	var rreq registerRequest
+	if !h.readJSON(w, req, &rreq) {
+		return
+	}
+	if !rreq.Metadata.Valid() || rreq.Password == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	clientID := newID("client")
+	h.mu.Lock()
+	h.clients[clientID] = rreq.Password
+	h.mu.Unlock()
+	h.writeJSON(w, registerResponse{ClientID: clientID})
+}
+
+func (h *Handler) login(w http.ResponseWriter, req *http.Request) {
+	var creds probeservices.LoginCredentials
+	if !h.readJSON(w, req, &creds) {
+		return
+	}
+	lifetime := DefaultTokenLifetime
+	if h.TokenLifetime > 0 {
+		lifetime = h.TokenLifetime
+	}
+	auth := probeservices.LoginAuth{
+		Expire: time.Now().Add(lifetime),
+		Token:  newID("token"),
+	}
+	h.mu.Lock()
+	password, found := h.clients[creds.ClientID]
+	if found && password == creds.Password {
+		h.tokens[auth.Token] = auth.Expire
+	}
+	h.mu.Unlock()
+	if !found || password != creds.Password {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	h.writeJSON(w, auth)
+}
+
+// authorized returns whether req contains a valid token. When the
+// token is not valid, it writes the error response.
+func (h *Handler) authorized(w http.ResponseWriter, req *http.Request) bool {
+	token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	h.mu.Lock()
+	expire, found := h.tokens[token]
+	h.mu.Unlock()
+	if !found || time.Now().After(expire) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+func (h *Handler) psiphonConfig(w http.ResponseWriter, req *http.Request) {
+	if !h.authorized(w, req) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(h.PsiphonConfig)
+}
+
+func (h *Handler) torTargets(w http.ResponseWriter, req *http.Request) {
+	if !h.authorized(w, req) {
+		return
+	}
+	h.writeJSON(w, h.TorTargets)
+}
+
+type urlListResponse struct {
+	Results []model.URLInfo `json:"results"`
+}
+
+func (h *Handler) urlList(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	var limit int64
+	if value := query.Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	categories := make(map[string]bool)
+	if value := query.Get("category_codes"); value != "" {
+		for _, category := range strings.Split(value, ",") {
+			categories[category] = true
+		}
+	}
+	// Like the real backend, we return global URLs (i.e., the ones
+	// whose country code is XX) along with country specific ones.
+	countryCode := query.Get("country_code")
+	response := urlListResponse{Results: []model.URLInfo{}}
+	for _, entry := range h.URLs {
+		if limit > 0 && int64(len(response.Results)) >= limit {
+			break
+		}
+		if len(categories) > 0 && !categories[entry.CategoryCode] {
+			continue
+		}
+		if countryCode != "" && entry.CountryCode != "XX" && entry.CountryCode != countryCode {
+			continue
+		}
+		response.Results = append(response.Results, entry)
+	}
+	h.writeJSON(w, response)
+}
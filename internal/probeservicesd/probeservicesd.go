@@ -0,0 +1,309 @@
+// Package probeservicesd implements an in-process stand-in for the OONI
+// probe services, i.e. the APIs that probeservices.Client talks to: the
+// bouncer, the collector, and the orchestra APIs for registering, logging
+// in, and fetching the psiphon config, the tor targets and the test lists.
+//
+// We do not aim to be a faithful reimplementation of the backend. Rather,
+// we want to run miniooni and the integration tests without internet, and
+// to check how the code behaves when the probe services misbehave. To this
+// end, you can inject faults, i.e. slow responses and error responses, and
+// you can expire the tokens that have been issued.
+package probeservicesd
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ooni/probe-engine/internal/httpheader"
+	"github.com/ooni/probe-engine/internal/randx"
+	"github.com/ooni/probe-engine/model"
+	"github.com/ooni/probe-engine/probeservices"
+)
+
+const (
+	// DefaultMaxAcceptableBody is the default value of
+	// Handler.MaxAcceptableBody.
+	DefaultMaxAcceptableBody = 1 << 24
+
+	// DefaultTokenLifetime is the default value of
+	// Handler.TokenLifetime.
+	DefaultTokenLifetime = time.Hour
+)
+
+// The following are the names of the endpoints we implement. We use
+// them as keys when configuring faults. The AnyEndpoint key matches any
+// endpoint for which we have not configured a more specific fault.
+const (
+	AnyEndpoint           = "*"
+	BatchEndpoint         = "/report/{report_id}/batch"
+	BouncerEndpoint       = "/api/v1/test-helpers"
+	CloseReportEndpoint   = "/report/{report_id}/close"
+	LoginEndpoint         = "/api/v1/login"
+	OpenReportEndpoint    = "/report"
+	PsiphonConfigEndpoint = "/api/v1/test-list/psiphon-config"
+	RegisterEndpoint      = "/api/v1/register"
+	SubmitEndpoint        = "/report/{report_id}"
+	TorTargetsEndpoint    = "/api/v1/test-list/tor-targets"
+	URLListEndpoint       = "/api/v1/test-list/urls"
+)
+
+// Fault is a fault that we inject when serving a request.
+type Fault struct {
+	// Count is the number of requests affected by this fault. When
+	// zero, the fault affects all the requests.
+	Count int
+
+	// Delay is the delay before we start processing the request.
+	Delay time.Duration
+
+	// StatusCode is the status code we respond with instead of
+	// processing the request. When zero, we process the request.
+	StatusCode int
+}
+
+// Handler implements the probe services API. The zero value is invalid;
+// please use NewHandler to construct a new instance. You may change the
+// public fields after construction, but not while serving requests.
+type Handler struct {
+	// MaxAcceptableBody is the maximum size of the body of requests.
+	MaxAcceptableBody int64
+
+	// PsiphonConfig is the psiphon config returned to logged in clients.
+	PsiphonConfig []byte
+
+	// SupportsBatch indicates whether the collector accepts several
+	// measurements at once.
+	SupportsBatch bool
+
+	// SupportsGzip indicates whether we accept gzip request bodies.
+	SupportsGzip bool
+
+	// TestHelpers contains the test helpers returned by the bouncer.
+	TestHelpers map[string][]model.Service
+
+	// TokenLifetime is the lifetime of the tokens we issue on login.
+	TokenLifetime time.Duration
+
+	// TorTargets contains the targets returned to logged in clients.
+	TorTargets map[string]model.TorTarget
+
+	// URLs contains the test list. We filter it using the country code,
+	// the categories and the limit specified by the client.
+	URLs []model.URLInfo
+
+	clients      map[string]string // client ID => password
+	faults       map[string]*Fault
+	measurements []json.RawMessage
+	mu           sync.Mutex
+	reports      map[string]probeservices.ReportTemplate
+	tokens       map[string]time.Time // token => expiry
+}
+
+// NewHandler creates a new Handler with a small test list, a single
+// tor target, an empty psiphon config and no test helpers. The collector
+// accepts gzip request bodies and several measurements at once.
+func NewHandler() *Handler {
+	return &Handler{
+		MaxAcceptableBody: DefaultMaxAcceptableBody,
+		PsiphonConfig:     []byte("{}"),
+		SupportsBatch:     true,
+		SupportsGzip:      true,
+		TestHelpers:       map[string][]model.Service{},
+		TokenLifetime:     DefaultTokenLifetime,
+		TorTargets: map[string]model.TorTarget{
+			"127.0.0.1:9050": {
+				Address:  "127.0.0.1:9050",
+				Name:     "localhost",
+				Protocol: "or_port",
+			},
+		},
+		URLs: []model.URLInfo{{
+			CategoryCode: "NEWS",
+			CountryCode:  "XX",
+			URL:          "https://www.example.com/",
+		}, {
+			CategoryCode: "SRCH",
+			CountryCode:  "XX",
+			URL:          "https://www.example.org/",
+		}},
+		clients: make(map[string]string),
+		faults:  make(map[string]*Fault),
+		reports: make(map[string]probeservices.ReportTemplate),
+		tokens:  make(map[string]time.Time),
+	}
+}
+
+// SetFault configures the fault to inject when serving requests
+// for the specified endpoint. A nil fault clears the fault.
+func (h *Handler) SetFault(endpoint string, fault *Fault) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if fault == nil {
+		delete(h.faults, endpoint)
+		return
+	}
+	copied := *fault
+	h.faults[endpoint] = &copied
+}
+
+// ExpireTokens expires all the tokens we have issued so far. Clients using
+// them will see 401 responses until they login again.
+func (h *Handler) ExpireTokens() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.tokens = make(map[string]time.Time)
+}
+
+// Measurements returns the measurements submitted so far.
+func (h *Handler) Measurements() []json.RawMessage {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]json.RawMessage{}, h.measurements...)
+}
+
+// ServeHTTP implements http.Handler.ServeHTTP.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Server", httpheader.UserAgent())
+	endpoint, reportID := route(req.URL.Path)
+	if fault := h.nextFault(endpoint); fault != nil {
+		select {
+		case <-time.After(fault.Delay):
+		case <-req.Context().Done():
+			return
+		}
+		if fault.StatusCode != 0 {
+			w.WriteHeader(fault.StatusCode)
+			return
+		}
+	}
+	switch {
+	case endpoint == BouncerEndpoint && req.Method == "GET":
+		h.writeJSON(w, h.TestHelpers)
+	case endpoint == RegisterEndpoint && req.Method == "POST":
+		h.register(w, req)
+	case endpoint == LoginEndpoint && req.Method == "POST":
+		h.login(w, req)
+	case endpoint == PsiphonConfigEndpoint && req.Method == "GET":
+		h.psiphonConfig(w, req)
+	case endpoint == TorTargetsEndpoint && req.Method == "GET":
+		h.torTargets(w, req)
+	case endpoint == URLListEndpoint && req.Method == "GET":
+		h.urlList(w, req)
+	case endpoint == OpenReportEndpoint && req.Method == "POST":
+		h.openReport(w, req)
+	case endpoint == SubmitEndpoint && req.Method == "POST":
+		h.submit(w, req, reportID)
+	case endpoint == CloseReportEndpoint && req.Method == "POST":
+		h.closeReport(w, req, reportID)
+	case endpoint == BatchEndpoint && req.Method == "POST" && h.SupportsBatch:
+		h.submitBatch(w, req, reportID)
+	case endpoint == "":
+		w.WriteHeader(http.StatusNotFound)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// route returns the endpoint name corresponding to path, or an empty
+// string, along with the report ID, if the path contains it.
+func route(path string) (endpoint, reportID string) {
+	switch path {
+	case BouncerEndpoint, LoginEndpoint, OpenReportEndpoint,
+		PsiphonConfigEndpoint, RegisterEndpoint, TorTargetsEndpoint,
+		URLListEndpoint:
+		return path, ""
+	}
+	if !strings.HasPrefix(path, "/report/") {
+		return "", ""
+	}
+	parts := strings.Split(strings.TrimPrefix(path, "/report/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] != "":
+		return SubmitEndpoint, parts[0]
+	case len(parts) == 2 && parts[0] != "" && parts[1] == "close":
+		return CloseReportEndpoint, parts[0]
+	case len(parts) == 2 && parts[0] != "" && parts[1] == "batch":
+		return BatchEndpoint, parts[0]
+	default:
+		return "", ""
+	}
+}
+
+// nextFault returns the fault to inject for endpoint, if any.
+func (h *Handler) nextFault(endpoint string) *Fault {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := endpoint
+	fault := h.faults[key]
+	if fault == nil {
+		key = AnyEndpoint
+		fault = h.faults[key]
+	}
+	if fault == nil {
+		return nil
+	}
+	copied := *fault
+	if fault.Count > 0 {
+		if fault.Count--; fault.Count <= 0 {
+			delete(h.faults, key)
+		}
+	}
+	return &copied
+}
+
+// readJSON reads the JSON body of req into v. On failure, it writes
+// the error response and returns false.
+func (h *Handler) readJSON(w http.ResponseWriter, req *http.Request, v interface{}) bool {
+	maxAcceptableBody := int64(DefaultMaxAcceptableBody)
+	if h.MaxAcceptableBody > 0 {
+		maxAcceptableBody = h.MaxAcceptableBody
+	}
+	var reader io.Reader = http.MaxBytesReader(w, req.Body, maxAcceptableBody)
+	switch req.Header.Get("Content-Encoding") {
+	case "":
+	case "gzip":
+		if !h.SupportsGzip {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return false
+		}
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return false
+		}
+		// Also limit the size of the uncompressed body
+		reader = io.LimitReader(gzipReader, maxAcceptableBody)
+	default:
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return false
+	}
+	if err := json.NewDecoder(reader).Decode(v); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// writeJSON writes v as a JSON response.
+func (h *Handler) writeJSON(w http.ResponseWriter, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// newID returns a new random identifier with the given prefix.
+func newID(prefix string) string {
+	return fmt.Sprintf("%s_%s", prefix, randx.Letters(16))
+}
+
+var _ http.Handler = &Handler{}
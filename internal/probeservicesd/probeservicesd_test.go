@@ -0,0 +1,375 @@
+package probeservicesd_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/ooni/probe-engine/internal/mockable"
+	"github.com/ooni/probe-engine/internal/probeservicesd"
+	"github.com/ooni/probe-engine/model"
+	"github.com/ooni/probe-engine/probeservices"
+	"github.com/ooni/probe-engine/probeservices/testorchestra"
+)
+
+func newclient(t *testing.T, URL string) *probeservices.Client {
+	client, err := probeservices.NewClient(
+		&mockable.Session{
+			MockableHTTPClient: http.DefaultClient,
+			MockableLogger:     log.Log,
+		},
+		model.Service{Address: URL, Type: "https"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func newserver() (*probeservicesd.Handler, *httptest.Server) {
+	handler := probeservicesd.NewHandler()
+	return handler, httptest.NewServer(handler)
+}
+
+func login(t *testing.T, client *probeservices.Client) {
+	ctx := context.Background()
+	if err := client.MaybeRegister(ctx, testorchestra.MetadataFixture()); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.MaybeLogin(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOrchestra(t *testing.T) {
+	handler, server := newserver()
+	defer server.Close()
+	client := newclient(t, server.URL)
+	ctx := context.Background()
+	if _, err := client.FetchPsiphonConfig(ctx); err != probeservices.ErrNotRegistered {
+		t.Fatal("not the error we expected", err)
+	}
+	login(t, client)
+	if client.RegisterCalls.Load() != 1 || client.LoginCalls.Load() != 1 {
+		t.Fatal("unexpected number of calls")
+	}
+	config, err := client.FetchPsiphonConfig(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(config) != "{}" {
+		t.Fatal("unexpected psiphon config", string(config))
+	}
+	targets, err := client.FetchTorTargets(ctx, "IT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != len(handler.TorTargets) {
+		t.Fatal("unexpected tor targets", targets)
+	}
+	helpers, err := client.GetTestHelpers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(helpers) != 0 {
+		t.Fatal("unexpected test helpers", helpers)
+	}
+}
+
+func TestURLList(t *testing.T) {
+	handler, server := newserver()
+	defer server.Close()
+	handler.URLs = append(handler.URLs, model.URLInfo{
+		CategoryCode: "NEWS",
+		CountryCode:  "IT",
+		URL:          "https://www.example.it/",
+	})
+	client := newclient(t, server.URL)
+	cases := []struct {
+		name     string
+		config   model.URLListConfig
+		expected int
+	}{{
+		name:     "with no filters",
+		expected: 3,
+	}, {
+		name:     "with country code",
+		config:   model.URLListConfig{CountryCode: "DE"},
+		expected: 2,
+	}, {
+		name:     "with categories",
+		config:   model.URLListConfig{Categories: []string{"NEWS"}},
+		expected: 2,
+	}, {
+		name:     "with limit",
+		config:   model.URLListConfig{Limit: 1},
+		expected: 1,
+	}}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			urls, err := client.FetchURLList(context.Background(), c.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(urls) != c.expected {
+				t.Fatal("unexpected number of URLs", urls)
+			}
+		})
+	}
+}
+
+func TestCollector(t *testing.T) {
+	handler, server := newserver()
+	defer server.Close()
+	client := newclient(t, server.URL)
+	ctx := context.Background()
+	submitter := probeservices.NewSubmitter(client)
+	for _, testName := range []string{"web_connectivity", "web_connectivity", "ndt"} {
+		measurement := &model.Measurement{
+			DataFormatVersion: probeservices.DefaultDataFormatVersion,
+			ProbeASN:          "AS30722",
+			ProbeCC:           "IT",
+			TestName:          testName,
+		}
+		if err := submitter.Submit(ctx, measurement); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(measurement.ReportID, "_"+strings.ReplaceAll(testName, "_", "")+"_IT_30722_n1_") {
+			t.Fatal("unexpected report ID", measurement.ReportID)
+		}
+		if measurement.OOID == "" {
+			t.Fatal("missing measurement ID")
+		}
+	}
+	if err := submitter.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	measurements := handler.Measurements()
+	if len(measurements) != 3 {
+		t.Fatal("unexpected number of measurements")
+	}
+	var measurement model.Measurement
+	if err := json.Unmarshal(measurements[2], &measurement); err != nil {
+		t.Fatal(err)
+	}
+	if measurement.TestName != "ndt" {
+		t.Fatal("unexpected measurement", measurement)
+	}
+	// the report is now closed, so we cannot submit anymore
+	resp, err := http.Post(server.URL+"/report/"+measurement.ReportID, "application/json",
+		strings.NewReader(`{"format":"json","content":{"report_id":"`+measurement.ReportID+`"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 404 {
+		t.Fatal("unexpected status code", resp.StatusCode)
+	}
+}
+
+func TestFaults(t *testing.T) {
+	handler, server := newserver()
+	defer server.Close()
+	client := newclient(t, server.URL)
+	handler.SetFault(probeservicesd.BouncerEndpoint, &probeservicesd.Fault{
+		Count:      2,
+		StatusCode: 500,
+	})
+	for idx := 0; idx < 2; idx++ {
+		if _, err := client.GetTestHelpers(context.Background()); err == nil ||
+			!strings.HasSuffix(err.Error(), "500 Internal Server Error") {
+			t.Fatal("not the error we expected", err)
+		}
+	}
+	if _, err := client.GetTestHelpers(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	handler.SetFault(probeservicesd.AnyEndpoint, &probeservicesd.Fault{
+		Delay: time.Second,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := client.GetTestHelpers(ctx); err == nil ||
+		!strings.HasSuffix(err.Error(), "context deadline exceeded") {
+		t.Fatal("not the error we expected", err)
+	}
+	handler.SetFault(probeservicesd.AnyEndpoint, nil)
+	if _, err := client.GetTestHelpers(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExpiredTokens(t *testing.T) {
+	handler, server := newserver()
+	defer server.Close()
+	client := newclient(t, server.URL)
+	login(t, client)
+	handler.ExpireTokens()
+	if _, err := client.FetchTorTargets(context.Background(), "IT"); err == nil ||
+		!strings.HasSuffix(err.Error(), "401 Unauthorized") {
+		t.Fatal("not the error we expected", err)
+	}
+}
+
+func TestShortTokenLifetime(t *testing.T) {
+	handler, server := newserver()
+	defer server.Close()
+	handler.TokenLifetime = time.Second
+	client := newclient(t, server.URL)
+	login(t, client)
+	// The client considers tokens expiring within 30 seconds as expired
+	// already, so here we're not going to be logged in.
+	if _, err := client.FetchTorTargets(context.Background(), "IT"); err != probeservices.ErrNotLoggedIn {
+		t.Fatal("not the error we expected", err)
+	}
+}
+
+func TestInvalidRequests(t *testing.T) {
+	_, server := newserver()
+	defer server.Close()
+	cases := []struct {
+		method   string
+		path     string
+		body     string
+		expected int
+	}{
+		{"GET", "/api/v1/nonexistent", "", 404},
+		{"GET", "/report//close", "", 404},
+		{"GET", "/api/v1/login", "", 405},
+		{"POST", "/api/v1/login", "{", 400},
+		{"POST", "/api/v1/login", `{"username":"x","password":"y"}`, 401},
+		{"POST", "/api/v1/register", `{}`, 400},
+		{"GET", "/api/v1/test-list/urls?limit=x", "", 400},
+		{"GET", "/api/v1/test-list/psiphon-config", "", 401},
+		{"POST", "/report", `{"format":"json"}`, 400},
+		{"POST", "/report/xo", `{"format":"json","content":{"report_id":"xo"}}`, 404},
+		{"POST", "/report/xo", `{"format":"json","content":{"report_id":"xy"}}`, 400},
+		{"POST", "/report/xo/close", `{}`, 404},
+	}
+	for _, c := range cases {
+		req, err := http.NewRequest(c.method, server.URL+c.path, strings.NewReader(c.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != c.expected {
+			t.Fatal("unexpected status code", c.method, c.path, resp.StatusCode)
+		}
+	}
+}
+
+func TestRequestEncodings(t *testing.T) {
+	handler, server := newserver()
+	defer server.Close()
+	var gzipped bytes.Buffer
+	writer := gzip.NewWriter(&gzipped)
+	writer.Write([]byte(`{"username":"x","password":"y"}`))
+	writer.Close()
+	cases := []struct {
+		name         string
+		body         []byte
+		encoding     string
+		supportsGzip bool
+		expected     int
+	}{{
+		name:         "with gzip body",
+		body:         gzipped.Bytes(),
+		encoding:     "gzip",
+		supportsGzip: true,
+		expected:     401, // i.e., we parsed the credentials
+	}, {
+		name:     "with gzip body and no gzip support",
+		body:     gzipped.Bytes(),
+		encoding: "gzip",
+		expected: 415,
+	}, {
+		name:         "with invalid gzip body",
+		body:         []byte("{}"),
+		encoding:     "gzip",
+		supportsGzip: true,
+		expected:     400,
+	}, {
+		name:         "with unsupported encoding",
+		body:         []byte("{}"),
+		encoding:     "br",
+		supportsGzip: true,
+		expected:     415,
+	}}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			handler.SupportsGzip = c.supportsGzip
+			req, err := http.NewRequest("POST", server.URL+"/api/v1/login", bytes.NewReader(c.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Encoding", c.encoding)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != c.expected {
+				t.Fatal("unexpected status code", resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestBatch(t *testing.T) {
+	handler, server := newserver()
+	defer server.Close()
+	client := newclient(t, server.URL)
+	var ms []*model.Measurement
+	for _, input := range []string{"a", "b"} {
+		ms = append(ms, &model.Measurement{
+			DataFormatVersion: probeservices.DefaultDataFormatVersion,
+			Input:             model.MeasurementTarget(input),
+			ProbeASN:          "AS30722",
+			ProbeCC:           "IT",
+			TestName:          "example",
+		})
+	}
+	report, err := client.OpenReport(context.Background(), probeservices.NewReportTemplate(ms[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, err := range report.SubmitMeasurements(context.Background(), ms) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(handler.Measurements()) != 2 {
+		t.Fatal("unexpected number of measurements")
+	}
+	cases := []struct {
+		path     string
+		body     string
+		expected int
+	}{
+		{"/report/" + report.ID + "/batch", `{"format":"json","content":[]}`, 400},
+		{"/report/" + report.ID + "/batch", `{"format":"json","content":[{"report_id":"x"}]}`, 400},
+		{"/report/xo/batch", `{"format":"json","content":[{"report_id":"xo"}]}`, 404},
+		{"/report/xo/batch", `{`, 400},
+	}
+	for _, c := range cases {
+		resp, err := http.Post(server.URL+c.path, "application/json", strings.NewReader(c.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != c.expected {
+			t.Fatal("unexpected status code", c.path, resp.StatusCode)
+		}
+	}
+}
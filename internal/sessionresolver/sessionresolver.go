@@ -1,62 +1,191 @@
 // Package sessionresolver contains the resolver used by the session. This
-// resolver uses Powerdns DoH by default and falls back on the system
-// provided resolver if Powerdns DoH is not working.
+// resolver uses a list of resolvers, which by default contains Powerdns DoH
+// and the system provided resolver. We try the resolvers one after the
+// other, starting with the one that performed best in the past. Optionally,
+// we can instead send queries to all resolvers at the same time and use
+// the first successful answer.
+//
+// We keep statistics about the success rate and the latency of each
+// resolver and, when a key-value store is configured, we persist them when
+// we close the resolver, so that the next session starts by using the
+// best-performing resolver.
 package sessionresolver
 
 import (
 	"context"
+	"sort"
+	"sync"
 	"time"
 
-	"github.com/ooni/probe-engine/atomicx"
-	"github.com/ooni/probe-engine/internal/runtimex"
+	"github.com/ooni/probe-engine/model"
 	"github.com/ooni/probe-engine/netx"
+	"github.com/ooni/probe-engine/netx/resolver"
 )
 
+// DefaultURLs contains the URLs of the resolvers that we use by
+// default, in order of preference. See netx.NewDNSClient for the
+// format of each URL.
+var DefaultURLs = []string{"doh://powerdns", "system:///"}
+
+// Config contains the settings of the session resolver.
+type Config struct {
+	// HTTPConfig is the config used to create the DNS clients.
+	HTTPConfig netx.Config
+
+	// KVStore is the optional store where we persist the stats.
+	KVStore model.KeyValueStore
+
+	// Race indicates that we should query all the resolvers at the
+	// same time rather than trying them one after the other.
+	Race bool
+
+	// URLs contains the URLs of the resolvers to use, in order of
+	// preference. When it is empty, we use DefaultURLs.
+	URLs []string
+}
+
 // Resolver is the session resolver.
 type Resolver struct {
-	Primary         netx.DNSClient
-	PrimaryFailure  *atomicx.Int64
-	Fallback        netx.DNSClient
-	FallbackFailure *atomicx.Int64
+	entries []*entry
+	kvstore model.KeyValueStore
+	mu      sync.Mutex
+	race    bool
+}
+
+type entry struct {
+	client netx.DNSClient
+	stats  Stats
+	url    string
 }
 
 // New creates a new session resolver.
-func New(config netx.Config) *Resolver {
-	primary, err := netx.NewDNSClient(config, "doh://powerdns")
-	runtimex.PanicOnError(err, "cannot create powerdns resolver")
-	fallback, err := netx.NewDNSClient(config, "system:///")
-	runtimex.PanicOnError(err, "cannot create system resolver")
-	return &Resolver{
-		Primary:         primary,
-		PrimaryFailure:  atomicx.NewInt64(),
-		Fallback:        fallback,
-		FallbackFailure: atomicx.NewInt64(),
+func New(config Config) (*Resolver, error) {
+	if len(config.URLs) <= 0 {
+		config.URLs = DefaultURLs
 	}
+	r := &Resolver{kvstore: config.KVStore, race: config.Race}
+	state := r.loadState()
+	for _, URL := range config.URLs {
+		client, err := netx.NewDNSClient(config.HTTPConfig, URL)
+		if err != nil {
+			r.CloseIdleConnections()
+			return nil, err
+		}
+		r.entries = append(r.entries, &entry{
+			client: client,
+			stats:  state[URL],
+			url:    URL,
+		})
+	}
+	return r, nil
 }
 
 // CloseIdleConnections closes the idle connections, if any
 func (r *Resolver) CloseIdleConnections() {
-	r.Primary.CloseIdleConnections()
-	r.Fallback.CloseIdleConnections()
+	for _, e := range r.entries {
+		e.client.CloseIdleConnections()
+	}
+}
+
+// Close saves the stats into the key-value store, if any, and closes
+// the idle connections. We save the stats here, rather than after each
+// lookup, to avoid writing into the key-value store all the time.
+func (r *Resolver) Close() {
+	r.saveState()
+	r.CloseIdleConnections()
+}
+
+// Stats returns a copy of the stats of each resolver, indexed by URL.
+func (r *Resolver) Stats() map[string]Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make(map[string]Stats)
+	for _, e := range r.entries {
+		out[e.url] = e.stats
+	}
+	return out
+}
+
+// URLs returns the URLs of the resolvers in the order in which we
+// would currently use them, i.e., the best-performing one first.
+func (r *Resolver) URLs() (out []string) {
+	for _, e := range r.sorted() {
+		out = append(out, e.url)
+	}
+	return
+}
+
+// sorted returns the entries sorted by decreasing score. Since we
+// use a stable sort, resolvers with equal scores remain in the
+// order in which they have been configured.
+func (r *Resolver) sorted() []*entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]*entry, len(r.entries))
+	copy(out, r.entries)
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].stats.Score() > out[j].stats.Score()
+	})
+	return out
+}
+
+// update updates the stats of the given entry.
+func (r *Resolver) update(e *entry, err error, elapsed time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e.stats.update(err, elapsed)
 }
 
 // LookupHost implements Resolver.LookupHost
 func (r *Resolver) LookupHost(ctx context.Context, hostname string) ([]string, error) {
+	if r.race {
+		return r.lookupHostRace(ctx, hostname)
+	}
 	// Algorithm similar to Firefox TRR2 mode. See:
 	// https://wiki.mozilla.org/Trusted_Recursive_Resolver#DNS-over-HTTPS_Prefs_in_Firefox
 	// We use a higher timeout than Firefox's timeout (1.5s) to be on the safe side
-	// and therefore see to use DoH more often.
-	trr2, cancel := context.WithTimeout(ctx, 4*time.Second)
-	defer cancel()
-	addrs, err := r.Primary.LookupHost(trr2, hostname)
-	if err != nil {
-		r.PrimaryFailure.Add(1)
-		addrs, err = r.Fallback.LookupHost(ctx, hostname)
-		if err != nil {
-			r.FallbackFailure.Add(1)
+	// and therefore see to use DoH more often. The last resolver we try is not
+	// subject to this timeout, because it is our last chance.
+	var err error
+	entries := r.sorted()
+	for idx, e := range entries {
+		lookupctx, cancel := ctx, func() {}
+		if idx < len(entries)-1 {
+			lookupctx, cancel = context.WithTimeout(ctx, 4*time.Second)
+		}
+		var addrs []string
+		start := time.Now()
+		addrs, err = e.client.LookupHost(lookupctx, hostname)
+		elapsed := time.Since(start)
+		cancel()
+		if ctx.Err() != nil {
+			return nil, err // the failure is not the resolver's fault
+		}
+		r.update(e, err, elapsed)
+		if err == nil {
+			return addrs, nil
+		}
+	}
+	return nil, err
+}
+
+func (r *Resolver) lookupHostRace(ctx context.Context, hostname string) ([]string, error) {
+	entries := r.sorted()
+	var race resolver.RaceResolver
+	for _, e := range entries {
+		race.Resolvers = append(race.Resolvers, e.client)
+	}
+	result := race.Race(ctx, hostname)
+	if ctx.Err() == nil {
+		for idx, attempt := range result.Attempts {
+			// A lookup that failed because another resolver won does
+			// not tell us anything about the resolver's performance.
+			if !attempt.Canceled {
+				r.update(entries[idx], attempt.Err, attempt.Duration)
+			}
 		}
 	}
-	return addrs, err
+	return result.Addresses(), result.Err()
 }
 
 // Network implements Resolver.Network
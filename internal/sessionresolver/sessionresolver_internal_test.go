@@ -0,0 +1,183 @@
+package sessionresolver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/ooni/probe-engine/internal/kvstore"
+	"github.com/ooni/probe-engine/netx"
+)
+
+type fakeResolver struct {
+	addrs []string
+	delay time.Duration
+	err   error
+}
+
+func (r fakeResolver) LookupHost(ctx context.Context, hostname string) ([]string, error) {
+	select {
+	case <-time.After(r.delay):
+		return r.addrs, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (r fakeResolver) Network() string {
+	return "fake"
+}
+
+func (r fakeResolver) Address() string {
+	return ""
+}
+
+func newFakeEntry(URL string, reso fakeResolver) *entry {
+	return &entry{client: netx.DNSClient{Resolver: reso}, url: URL}
+}
+
+func TestUnitSerialFallbackAndPersist(t *testing.T) {
+	store := kvstore.NewMemoryKeyValueStore()
+	r := &Resolver{
+		entries: []*entry{
+			newFakeEntry("first", fakeResolver{err: io.EOF}),
+			newFakeEntry("second", fakeResolver{addrs: []string{"8.8.8.8"}}),
+		},
+		kvstore: store,
+	}
+	addrs, err := r.LookupHost(context.Background(), "dns.google")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 1 || addrs[0] != "8.8.8.8" {
+		t.Fatal("not the addrs we expected")
+	}
+	stats := r.Stats()
+	if stats["first"].Samples != 1 || stats["first"].SuccessRate != 0 {
+		t.Fatal("not the stats we expected for first")
+	}
+	if stats["second"].Samples != 1 || stats["second"].SuccessRate != 1 {
+		t.Fatal("not the stats we expected for second")
+	}
+	if URLs := r.URLs(); URLs[0] != "second" || URLs[1] != "first" {
+		t.Fatal("expected the working resolver to come first")
+	}
+	if _, err := store.Get(stateKey); err == nil {
+		t.Fatal("expected to save the state only when closing")
+	}
+	r.Close()
+	data, err := store.Get(stateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state map[string]Stats
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.Fatal(err)
+	}
+	if state["second"] != stats["second"] || state["first"] != stats["first"] {
+		t.Fatal("not the state we expected")
+	}
+}
+
+func TestUnitSerialAllFail(t *testing.T) {
+	expected := errors.New("mocked error")
+	r := &Resolver{
+		entries: []*entry{
+			newFakeEntry("first", fakeResolver{err: io.EOF}),
+			newFakeEntry("second", fakeResolver{err: expected}),
+		},
+	}
+	addrs, err := r.LookupHost(context.Background(), "dns.google")
+	if !errors.Is(err, expected) {
+		t.Fatal("not the error we expected")
+	}
+	if addrs != nil {
+		t.Fatal("expected nil addrs here")
+	}
+}
+
+func TestUnitSerialCancelledContext(t *testing.T) {
+	r := &Resolver{
+		entries: []*entry{
+			newFakeEntry("first", fakeResolver{delay: time.Minute}),
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	addrs, err := r.LookupHost(ctx, "dns.google")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatal("not the error we expected")
+	}
+	if addrs != nil {
+		t.Fatal("expected nil addrs here")
+	}
+	if r.Stats()["first"].Samples != 0 {
+		t.Fatal("should not update the stats when the context is done")
+	}
+}
+
+func TestUnitRaceFastestWins(t *testing.T) {
+	r := &Resolver{
+		entries: []*entry{
+			newFakeEntry("slow", fakeResolver{addrs: []string{"1.1.1.1"}, delay: time.Minute}),
+			newFakeEntry("fast", fakeResolver{addrs: []string{"8.8.8.8"}}),
+		},
+		race: true,
+	}
+	addrs, err := r.LookupHost(context.Background(), "dns.google")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 1 || addrs[0] != "8.8.8.8" {
+		t.Fatal("not the addrs we expected")
+	}
+	stats := r.Stats()
+	if stats["slow"].Samples != 0 {
+		t.Fatal("should not update the stats of the canceled resolver")
+	}
+	if stats["fast"].Samples != 1 || stats["fast"].SuccessRate != 1 {
+		t.Fatal("not the stats we expected for fast")
+	}
+}
+
+func TestUnitRaceAllFail(t *testing.T) {
+	expected := errors.New("mocked error")
+	r := &Resolver{
+		entries: []*entry{
+			newFakeEntry("first", fakeResolver{err: expected}),
+			newFakeEntry("second", fakeResolver{err: io.EOF}),
+		},
+		race: true,
+	}
+	addrs, err := r.LookupHost(context.Background(), "dns.google")
+	if !errors.Is(err, expected) {
+		t.Fatal("not the error we expected")
+	}
+	if addrs != nil {
+		t.Fatal("expected nil addrs here")
+	}
+	for URL, stats := range r.Stats() {
+		if stats.Samples != 1 || stats.SuccessRate != 0 {
+			t.Fatalf("not the stats we expected for %s", URL)
+		}
+	}
+}
+
+func TestUnitStatsUpdate(t *testing.T) {
+	var stats Stats
+	stats.update(nil, 2*time.Second)
+	if stats.Samples != 1 || stats.SuccessRate != 1 || stats.Latency != 2 {
+		t.Fatal("unexpected stats after first update")
+	}
+	stats.update(io.EOF, time.Second)
+	if stats.Samples != 2 || stats.SuccessRate != 0.75 || stats.Latency != 2 {
+		t.Fatal("unexpected stats after second update")
+	}
+	stats.update(nil, time.Second)
+	if stats.Samples != 3 || stats.Latency != 1.75 {
+		t.Fatal("unexpected stats after third update")
+	}
+}
@@ -5,15 +5,18 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/ooni/probe-engine/internal/kvstore"
 	"github.com/ooni/probe-engine/internal/sessionresolver"
-	"github.com/ooni/probe-engine/netx"
 )
 
 func TestIntegration(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping test in short mode")
 	}
-	reso := sessionresolver.New(netx.Config{})
+	reso, err := sessionresolver.New(sessionresolver.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
 	defer reso.CloseIdleConnections()
 	if reso.Network() != "sessionresolver" {
 		t.Fatal("unexpected Network")
@@ -28,7 +31,84 @@ func TestIntegration(t *testing.T) {
 	if addrs != nil {
 		t.Fatal("expected nil addrs here")
 	}
-	if reso.PrimaryFailure.Load() != 1 || reso.FallbackFailure.Load() != 1 {
-		t.Fatal("not the counters we expected to see here")
+	stats := reso.Stats()
+	for _, URL := range sessionresolver.DefaultURLs {
+		if stats[URL].Samples != 1 || stats[URL].SuccessRate != 0 {
+			t.Fatal("not the stats we expected to see here")
+		}
+	}
+}
+
+func TestUnitNewInvalidURL(t *testing.T) {
+	reso, err := sessionresolver.New(sessionresolver.Config{
+		URLs: []string{"system:///", "\t\t\t"},
+	})
+	if err == nil || !strings.HasSuffix(err.Error(), "invalid control character in URL") {
+		t.Fatal("not the error we expected")
+	}
+	if reso != nil {
+		t.Fatal("expected nil resolver here")
+	}
+}
+
+func TestUnitNewLoadsState(t *testing.T) {
+	store := kvstore.NewMemoryKeyValueStore()
+	err := store.Set("sessionresolver.state", []byte(`{
+		"doh://powerdns": {"latency": 0, "samples": 3, "success_rate": 0},
+		"doh://google": {"latency": 0.1, "samples": 3, "success_rate": 1}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reso, err := sessionresolver.New(sessionresolver.Config{
+		KVStore: store,
+		URLs:    []string{"doh://powerdns", "system:///", "doh://google"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reso.CloseIdleConnections()
+	URLs := reso.URLs()
+	expected := []string{"doh://google", "system:///", "doh://powerdns"}
+	if len(URLs) != len(expected) {
+		t.Fatal("unexpected number of URLs")
+	}
+	for idx := range URLs {
+		if URLs[idx] != expected[idx] {
+			t.Fatal("not the order we expected")
+		}
+	}
+}
+
+func TestUnitNewWithInvalidState(t *testing.T) {
+	store := kvstore.NewMemoryKeyValueStore()
+	if err := store.Set("sessionresolver.state", []byte(`[]`)); err != nil {
+		t.Fatal(err)
+	}
+	reso, err := sessionresolver.New(sessionresolver.Config{KVStore: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reso.CloseIdleConnections()
+	for _, stats := range reso.Stats() {
+		if stats.Samples != 0 {
+			t.Fatal("expected empty stats")
+		}
+	}
+}
+
+func TestUnitStatsScore(t *testing.T) {
+	unknown := sessionresolver.Stats{}
+	fast := sessionresolver.Stats{Latency: 0.1, Samples: 10, SuccessRate: 1}
+	slow := sessionresolver.Stats{Latency: 2, Samples: 10, SuccessRate: 1}
+	broken := sessionresolver.Stats{Samples: 10, SuccessRate: 0}
+	if !(fast.Score() > unknown.Score()) {
+		t.Fatal("fast should be better than unknown")
+	}
+	if !(unknown.Score() > slow.Score()) {
+		t.Fatal("unknown should be better than slow")
+	}
+	if !(slow.Score() > broken.Score()) {
+		t.Fatal("slow should be better than broken")
 	}
 }
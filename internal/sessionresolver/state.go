@@ -0,0 +1,91 @@
+package sessionresolver
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// stateKey is the key used to persist the stats into the key-value store.
+const stateKey = "sessionresolver.state"
+
+// ewmaAlpha is the weight of a new sample in the moving averages. With
+// this value, the last few lookups dominate and we quickly adapt to a
+// resolver that starts or stops working.
+const ewmaAlpha = 0.25
+
+// unknownScore is the score of a resolver we have never used. It is the
+// score of a resolver that always works and takes one second to answer,
+// such that we try unknown resolvers before the ones that do not work.
+const unknownScore = 0.5
+
+// Stats contains statistics about a resolver.
+type Stats struct {
+	// Latency is the moving average of the time, in seconds, that
+	// the resolver took to perform a successful lookup.
+	Latency float64 `json:"latency"`
+
+	// Samples is the number of lookups we have performed.
+	Samples int64 `json:"samples"`
+
+	// SuccessRate is the moving average of the lookup results,
+	// where a success counts as one and a failure as zero.
+	SuccessRate float64 `json:"success_rate"`
+}
+
+// Score returns the score of the resolver. The higher the score, the
+// better the resolver. We give a higher score to resolvers that work most
+// of the times and, among them, to the ones that answer faster.
+func (s Stats) Score() float64 {
+	if s.Samples <= 0 {
+		return unknownScore
+	}
+	return s.SuccessRate / (1 + s.Latency)
+}
+
+func (s *Stats) update(err error, elapsed time.Duration) {
+	var success float64
+	if err == nil {
+		success = 1
+		s.Latency = ewma(s.Latency, elapsed.Seconds(), s.Latency <= 0)
+	}
+	s.SuccessRate = ewma(s.SuccessRate, success, s.Samples <= 0)
+	s.Samples++
+}
+
+func ewma(avg, sample float64, first bool) float64 {
+	if first {
+		return sample
+	}
+	return ewmaAlpha*sample + (1-ewmaAlpha)*avg
+}
+
+// loadState loads the stats from the key-value store. On failure, for
+// example the first time we run, we just return empty stats.
+func (r *Resolver) loadState() map[string]Stats {
+	state := make(map[string]Stats)
+	if r.kvstore == nil {
+		return state
+	}
+	data, err := r.kvstore.Get(stateKey)
+	if err != nil {
+		return state
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return make(map[string]Stats)
+	}
+	return state
+}
+
+// saveState saves the stats into the key-value store. Saving is
+// best effort: the worst that may happen when it fails is that the
+// next session will not use the best-performing resolver first.
+func (r *Resolver) saveState() {
+	if r.kvstore == nil {
+		return
+	}
+	data, err := json.Marshal(r.Stats())
+	if err != nil {
+		return
+	}
+	r.kvstore.Set(stateKey, data)
+}
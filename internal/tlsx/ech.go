@@ -0,0 +1,65 @@
+//go:build go1.20
+// +build go1.20
+
+package tlsx
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+)
+
+// ECHKey is an Encrypted ClientHello key suitable for running
+// ECH-capable TLS servers (e.g. in tests or in test helpers).
+type ECHKey struct {
+	// Config is the serialized ECHConfig.
+	Config []byte
+
+	// ConfigList is the serialized ECHConfigList containing Config,
+	// which is what clients need in order to send ECH.
+	ConfigList []byte
+
+	// PrivateKey is the X25519 private key.
+	PrivateKey []byte
+}
+
+// NewECHKey generates a new ECHKey using DHKEM(X25519, HKDF-SHA256),
+// HKDF-SHA256 and AES-128-GCM. The publicName argument is the name that
+// the client uses as SNI for the outer ClientHello.
+func NewECHKey(configID uint8, publicName string) (*ECHKey, error) {
+	if len(publicName) <= 0 || len(publicName) > 255 {
+		return nil, errors.New("tlsx: invalid ECH public name")
+	}
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	publicKey := key.PublicKey().Bytes()
+	var contents []byte
+	contents = append(contents, configID)
+	contents = appendUint16(contents, 0x0020) // DHKEM(X25519, HKDF-SHA256)
+	contents = appendUint16(contents, uint16(len(publicKey)))
+	contents = append(contents, publicKey...)
+	contents = appendUint16(contents, 4)      // length of cipher suites
+	contents = appendUint16(contents, 0x0001) // HKDF-SHA256
+	contents = appendUint16(contents, 0x0001) // AES-128-GCM
+	contents = append(contents, 0)            // maximum name length
+	contents = append(contents, uint8(len(publicName)))
+	contents = append(contents, publicName...)
+	contents = appendUint16(contents, 0) // no extensions
+	var config []byte
+	config = appendUint16(config, 0xfe0d) // ECH version
+	config = appendUint16(config, uint16(len(contents)))
+	config = append(config, contents...)
+	var list []byte
+	list = appendUint16(list, uint16(len(config)))
+	list = append(list, config...)
+	return &ECHKey{Config: config, ConfigList: list, PrivateKey: key.Bytes()}, nil
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	var buf [2]byte
+	binary.BigEndian.PutUint16(buf[:], v)
+	return append(b, buf[:]...)
+}
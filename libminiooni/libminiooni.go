@@ -15,7 +15,9 @@
 package libminiooni
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
@@ -35,6 +37,7 @@ import (
 	"github.com/ooni/probe-engine/internal/humanizex"
 	"github.com/ooni/probe-engine/model"
 	"github.com/ooni/probe-engine/netx/selfcensor"
+	"github.com/ooni/probe-engine/probeservices"
 	"github.com/pborman/getopt/v2"
 )
 
@@ -53,6 +56,9 @@ type Options struct {
 	Proxy            string
 	ReportFile       string
 	SelfCensorSpec   string
+	SignMeasurements bool
+	Sinks            []string
+	SubmitBatchSize  int
 	TorArgs          []string
 	TorBinary        string
 	Tunnel           string
@@ -62,6 +68,10 @@ type Options struct {
 const (
 	softwareName    = "miniooni"
 	softwareVersion = engine.Version
+
+	// submissionQueueFlushTimeout is the maximum time we spend trying
+	// to submit the measurements we previously failed to submit.
+	submissionQueueFlushTimeout = 30 * time.Second
 )
 
 var (
@@ -97,7 +107,7 @@ func init() {
 		"Disable including ASN information into the report",
 	)
 	getopt.FlagLong(
-		&globalOptions.NoJSON, "no-json", 'N', "Disable writing to disk",
+		&globalOptions.NoJSON, "no-json", 'N', "Disable writing the report file",
 	)
 	getopt.FlagLong(
 		&globalOptions.NoCollector, "no-collector", 'n', "Don't use a collector",
@@ -117,6 +127,19 @@ func init() {
 		&globalOptions.SelfCensorSpec, "self-censor-spec", 0,
 		"Enable and configure self censorship", "JSON",
 	)
+	getopt.FlagLong(
+		&globalOptions.SignMeasurements, "sign-measurements", 0,
+		"Sign measurements using this probe's key",
+	)
+	getopt.FlagLong(
+		&globalOptions.Sinks, "sink", 0,
+		"Also save measurements into the specified sink (e.g. `gzipdir:PATH`, `sqlite:PATH`, `webhook:URL`)",
+		"SPEC",
+	)
+	getopt.FlagLong(
+		&globalOptions.SubmitBatchSize, "submit-batch-size", 0,
+		"Submit measurements N at a time rather than one at a time", "N",
+	)
 	getopt.FlagLong(
 		&globalOptions.TorArgs, "tor-args", 0,
 		"Extra args for tor binary (may be specified multiple times)",
@@ -149,14 +172,53 @@ func fatalIfFalse(cond bool, msg string) {
 // options and uses a global state. Use MainWithConfiguration if you want to avoid
 // using any global state and relying on command line options.
 //
+// Running `miniooni verify FILE` verifies the signatures of the measurements
+// inside FILE rather than running an experiment (see MainVerify).
+//
 // This function will panic in case of a fatal error. It is up to you that
 // integrate this function to either handle the panic of ignore it.
 func Main() {
 	getopt.Parse()
+	if getopt.NArgs() > 0 && getopt.Arg(0) == "verify" {
+		fatalIfFalse(getopt.NArgs() == 2, "Missing report file name")
+		MainVerify(getopt.Arg(1))
+		return
+	}
 	fatalIfFalse(len(getopt.Args()) == 1, "Missing experiment name")
 	MainWithConfiguration(getopt.Arg(0), globalOptions)
 }
 
+// MainVerify verifies the signature of each measurement inside the
+// specified report file, which contains a measurement per line, and logs
+// the public key that signed each measurement. Note that it is up to
+// you to decide whether you trust such keys.
+//
+// This function will panic if any measurement is not correctly signed.
+func MainVerify(reportFile string) {
+	content, err := ioutil.ReadFile(reportFile)
+	fatalOnError(err, "cannot read report file")
+	failures := verifyMeasurements(content)
+	fatalIfFalse(failures == 0, "some measurements are not correctly signed")
+}
+
+// verifyMeasurements verifies the measurements inside content and
+// returns the number of measurements that failed verification.
+func verifyMeasurements(content []byte) (failures int) {
+	for idx, line := range bytes.Split(content, []byte("\n")) {
+		if len(line) <= 0 {
+			continue // e.g. the newline at the end of the file
+		}
+		key, err := probeservices.VerifyMeasurement(line)
+		if err != nil {
+			log.WithError(err).Warnf("line %d: verification failed", idx+1)
+			failures++
+			continue
+		}
+		log.Infof("line %d: signed by %s", idx+1, base64.StdEncoding.EncodeToString(key))
+	}
+	return
+}
+
 func split(s string) (string, string, error) {
 	v := strings.SplitN(s, "=", 2)
 	if len(v) != 2 {
@@ -295,11 +357,12 @@ func MainWithConfiguration(experimentName string, currentOptions Options) {
 			IncludeASN:     currentOptions.NoGeoIP == false,
 			IncludeCountry: true,
 		},
-		ProxyURL:        proxyURL,
-		SoftwareName:    softwareName,
-		SoftwareVersion: softwareVersion,
-		TorArgs:         currentOptions.TorArgs,
-		TorBinary:       currentOptions.TorBinary,
+		ProxyURL:         proxyURL,
+		SignMeasurements: currentOptions.SignMeasurements,
+		SoftwareName:     softwareName,
+		SoftwareVersion:  softwareVersion,
+		TorArgs:          currentOptions.TorArgs,
+		TorBinary:        currentOptions.TorBinary,
 	}
 	if currentOptions.ProbeServicesURL != "" {
 		config.AvailableProbeServices = []model.Service{{
@@ -318,6 +381,9 @@ func MainWithConfiguration(experimentName string, currentOptions Options) {
 		)
 	}()
 	log.Infof("miniooni temporary directory: %s", sess.TempDir())
+	if key := sess.SigningPublicKey(); key != nil {
+		log.Infof("signing measurements with key: %s", base64.StdEncoding.EncodeToString(key))
+	}
 
 	err = sess.MaybeStartTunnel(context.Background(), currentOptions.Tunnel)
 	fatalOnError(err, "cannot start session tunnel")
@@ -337,6 +403,19 @@ func MainWithConfiguration(experimentName string, currentOptions Options) {
 	log.Infof("- resolver's network: %s (%s)", sess.ResolverNetworkName(),
 		sess.ResolverASNString())
 
+	if !currentOptions.NoCollector && !currentOptions.NoBouncer &&
+		sess.SubmissionQueueStats().Pending > 0 {
+		log.Info("Submitting previously queued measurements; please be patient...")
+		ctx, cancel := context.WithTimeout(context.Background(), submissionQueueFlushTimeout)
+		stats, err := sess.FlushSubmissionQueue(ctx)
+		cancel()
+		warnOnError(err, "cannot submit queued measurements")
+		if err == nil {
+			log.Infof("submission queue: pending=%d submitted=%d failed=%d dropped=%d",
+				stats.Pending, stats.Submitted, stats.Failed, stats.Dropped)
+		}
+	}
+
 	builder, err := sess.NewExperimentBuilder(experimentName)
 	fatalOnError(err, "cannot create experiment builder")
 
@@ -398,6 +477,51 @@ func MainWithConfiguration(experimentName string, currentOptions Options) {
 		log.Infof("Report ID: %s", experiment.ReportID())
 	}
 
+	var sinks []engine.MeasurementSink
+	if !currentOptions.NoJSON {
+		sink, err := engine.NewJSONLMeasurementSink(currentOptions.ReportFile)
+		fatalOnError(err, "cannot open report file")
+		sinks = append(sinks, sink)
+	}
+	for _, spec := range currentOptions.Sinks {
+		sink, err := engine.NewMeasurementSink(spec, sess.DefaultHTTPClient())
+		fatalOnError(err, "cannot create measurement sink")
+		sinks = append(sinks, sink)
+	}
+	defer func() {
+		for _, sink := range sinks {
+			warnOnError(sink.Close(), "cannot close measurement sink")
+		}
+	}()
+
+	// We submit and save the pending measurements every time we have
+	// SubmitBatchSize of them as well as when we are done.
+	var pending []*model.Measurement
+	flush := func() {
+		if len(pending) <= 0 {
+			return
+		}
+		if !currentOptions.NoCollector {
+			log.Infof("submitting %d measurement(s) to OONI collector; please be patient...",
+				len(pending))
+			for _, err := range experiment.SubmitAndUpdateMeasurements(pending) {
+				warnOnError(err, "submitting measurement failed")
+			}
+		}
+		// Note: must be after submission because submission modifies
+		// the measurement to include the report ID.
+		if len(sinks) > 0 {
+			log.Infof("saving %d measurement(s)", len(pending))
+		}
+		for _, measurement := range pending {
+			for _, sink := range sinks {
+				err := experiment.SaveMeasurementTo(sink, measurement)
+				warnOnError(err, "saving measurement failed")
+			}
+		}
+		pending = nil
+	}
+
 	inputCount := len(currentOptions.Inputs)
 	inputCounter := 0
 	for _, input := range currentOptions.Inputs {
@@ -409,17 +533,10 @@ func MainWithConfiguration(experimentName string, currentOptions Options) {
 		warnOnError(err, "measurement failed")
 		measurement.AddAnnotations(annotations)
 		measurement.Options = currentOptions.ExtraOptions
-		if !currentOptions.NoCollector {
-			log.Infof("submitting measurement to OONI collector; please be patient...")
-			err := experiment.SubmitAndUpdateMeasurement(measurement)
-			warnOnError(err, "submitting measurement failed")
-		}
-		if !currentOptions.NoJSON {
-			// Note: must be after submission because submission modifies
-			// the measurement to include the report ID.
-			log.Infof("saving measurement to disk")
-			err := experiment.SaveMeasurement(measurement, currentOptions.ReportFile)
-			warnOnError(err, "saving measurement failed")
+		pending = append(pending, measurement)
+		if len(pending) >= currentOptions.SubmitBatchSize {
+			flush()
 		}
 	}
+	flush()
 }
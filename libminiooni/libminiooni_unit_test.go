@@ -1,9 +1,15 @@
 package libminiooni
 
 import (
+	"bytes"
+	"encoding/json"
 	"io/ioutil"
 	"os"
 	"testing"
+
+	"github.com/ooni/probe-engine/internal/kvstore"
+	"github.com/ooni/probe-engine/model"
+	"github.com/ooni/probe-engine/probeservices"
 )
 
 func TestFileInputFailWithOtherInputs(t *testing.T) {
@@ -66,3 +72,29 @@ func TestInputFile(t *testing.T) {
 		t.Errorf("expected second input to be %v got %v", input2, opts.Inputs[1])
 	}
 }
+
+func TestVerifyMeasurements(t *testing.T) {
+	key, err := probeservices.NewStateFile(kvstore.NewMemoryKeyValueStore()).SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var content bytes.Buffer
+	for _, probeCC := range []string{"IT", "DE"} {
+		measurement := &model.Measurement{ProbeCC: probeCC, TestName: "example"}
+		if err := probeservices.SignMeasurement(measurement, key); err != nil {
+			t.Fatal(err)
+		}
+		if probeCC == "DE" {
+			measurement.ProbeCC = "IT" // tamper with the measurement
+		}
+		data, err := json.Marshal(measurement)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content.Write(append(data, '\n'))
+	}
+	content.WriteString(`{"test_name":"example"}` + "\n")
+	if failures := verifyMeasurements(content.Bytes()); failures != 2 {
+		t.Fatal("unexpected number of failures", failures)
+	}
+}
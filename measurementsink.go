@@ -0,0 +1,358 @@
+package engine
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ooni/probe-engine/model"
+)
+
+// MeasurementSink receives measurements, e.g., to save them on disk or
+// to forward them to a data pipeline. Use Experiment.SaveMeasurementTo to
+// save a measurement into a sink, so that we sign the measurement first
+// when the session is configured to sign measurements.
+type MeasurementSink interface {
+	// SaveMeasurement saves the measurement.
+	SaveMeasurement(ctx context.Context, measurement *model.Measurement) error
+
+	// Close releases the resources used by the sink.
+	Close() error
+}
+
+// ErrUnknownMeasurementSink indicates that the measurement sink
+// specification passed to NewMeasurementSink is invalid.
+var ErrUnknownMeasurementSink = errors.New("unknown measurement sink")
+
+// NewMeasurementSink creates a measurement sink from a specification
+// having the `<kind>:<argument>` format. We support these kinds:
+//
+// - `jsonl:<path>` appends measurements to the JSONL file at path;
+//
+// - `gzipdir:<path>` writes measurements into gzip compressed JSONL
+// files inside the directory at path, rotating them by size;
+//
+// - `sqlite:<path>` inserts measurements into the SQLite database at
+// path (see SQLiteMeasurementSink for caveats);
+//
+// - `webhook:<URL>` POSTs each measurement to URL using client, which
+// should be the session's client so that we honour the proxy.
+func NewMeasurementSink(spec string, client *http.Client) (MeasurementSink, error) {
+	v := strings.SplitN(spec, ":", 2)
+	if len(v) != 2 || v[1] == "" {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMeasurementSink, spec)
+	}
+	// Implementation note: we must not return typed nil pointers
+	// wrapped into a MeasurementSink when a constructor fails.
+	var (
+		sink MeasurementSink
+		err  error
+	)
+	switch kind, argument := v[0], v[1]; kind {
+	case "jsonl":
+		sink, err = NewJSONLMeasurementSink(argument)
+	case "gzipdir":
+		sink, err = NewGzipDirMeasurementSink(argument)
+	case "sqlite":
+		sink, err = newSQLiteMeasurementSinkFromPath(argument)
+	case "webhook":
+		sink, err = NewWebhookMeasurementSink(argument, client)
+	default:
+		err = fmt.Errorf("%w: %s", ErrUnknownMeasurementSink, spec)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sink, nil
+}
+
+// JSONLMeasurementSink appends measurements to a JSONL file. This is
+// the same format used by Experiment.SaveMeasurement.
+type JSONLMeasurementSink struct {
+	filep *os.File
+	mu    sync.Mutex
+}
+
+// NewJSONLMeasurementSink creates a new JSONLMeasurementSink that
+// appends to the specified file, creating it if needed.
+func NewJSONLMeasurementSink(filePath string) (*JSONLMeasurementSink, error) {
+	filep, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONLMeasurementSink{filep: filep}, nil
+}
+
+// SaveMeasurement implements MeasurementSink.SaveMeasurement.
+func (s *JSONLMeasurementSink) SaveMeasurement(
+	ctx context.Context, measurement *model.Measurement) error {
+	data, err := json.Marshal(measurement)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.filep.Write(data)
+	return err
+}
+
+// Close implements MeasurementSink.Close.
+func (s *JSONLMeasurementSink) Close() error {
+	return s.filep.Close()
+}
+
+// DefaultGzipDirMaxFileSize is the default value of
+// GzipDirMeasurementSink.MaxFileSize.
+const DefaultGzipDirMaxFileSize = 16 << 20
+
+// GzipDirMeasurementSink writes measurements into gzip compressed JSONL
+// files inside a directory. We start a new file when the current file
+// contains more than MaxFileSize uncompressed bytes, as well as every time
+// we create a new sink. Files are named after their creation time, such
+// that their lexicographic order is also their chronological order. We
+// flush after each measurement, hence one can read all the measurements
+// in the current file even if we were not able to close it.
+type GzipDirMeasurementSink struct {
+	// MaxFileSize is the maximum uncompressed size of a file.
+	MaxFileSize int64
+
+	dir     string
+	filep   *os.File
+	mu      sync.Mutex
+	seq     int64
+	size    int64
+	timeNow func() time.Time
+	writer  *gzip.Writer
+}
+
+// NewGzipDirMeasurementSink creates a new GzipDirMeasurementSink that
+// writes inside the specified directory, creating it if needed.
+func NewGzipDirMeasurementSink(dir string) (*GzipDirMeasurementSink, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &GzipDirMeasurementSink{
+		MaxFileSize: DefaultGzipDirMaxFileSize,
+		dir:         dir,
+		timeNow:     time.Now,
+	}, nil
+}
+
+// SaveMeasurement implements MeasurementSink.SaveMeasurement.
+func (s *GzipDirMeasurementSink) SaveMeasurement(
+	ctx context.Context, measurement *model.Measurement) error {
+	data, err := json.Marshal(measurement)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.writer != nil && s.size >= s.MaxFileSize {
+		if err := s.close(); err != nil {
+			return err
+		}
+	}
+	if s.writer == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+	if _, err := s.writer.Write(data); err != nil {
+		return err
+	}
+	s.size += int64(len(data))
+	return s.writer.Flush()
+}
+
+func (s *GzipDirMeasurementSink) open() error {
+	s.seq++
+	name := fmt.Sprintf("measurements-%s-%06d.jsonl.gz",
+		s.timeNow().UTC().Format("20060102T150405Z"), s.seq)
+	filep, err := os.OpenFile(filepath.Join(s.dir, name),
+		os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	s.filep, s.size, s.writer = filep, 0, gzip.NewWriter(filep)
+	return nil
+}
+
+func (s *GzipDirMeasurementSink) close() error {
+	err := s.writer.Close()
+	if cerr := s.filep.Close(); err == nil {
+		err = cerr
+	}
+	s.filep, s.writer = nil, nil
+	return err
+}
+
+// Close implements MeasurementSink.Close.
+func (s *GzipDirMeasurementSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.writer == nil {
+		return nil
+	}
+	return s.close()
+}
+
+// SQLiteDriverName is the name of the database/sql driver that
+// NewMeasurementSink uses to open SQLite databases.
+const SQLiteDriverName = "sqlite"
+
+// SQLiteMeasurementSink inserts measurements into the `measurements`
+// table of a SQLite database, which we create if needed.
+//
+// Implementation note: this package does not link any SQLite driver,
+// so that we do not force a driver onto mobile apps. Binaries that want
+// to use this sink should link a driver registering itself as
+// SQLiteDriverName using a blank import. We use modernc.org/sqlite in
+// cmd/miniooni because it is pure Go and hence does not need cgo.
+type SQLiteMeasurementSink struct {
+	db *sql.DB
+}
+
+// sqliteCreateTable is the statement that creates the table. Besides the
+// measurement, we also save the fields one is most likely to query.
+const sqliteCreateTable = `CREATE TABLE IF NOT EXISTS measurements (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	report_id TEXT NOT NULL,
+	test_name TEXT NOT NULL,
+	input TEXT NOT NULL,
+	measurement_start_time TEXT NOT NULL,
+	probe_asn TEXT NOT NULL,
+	probe_cc TEXT NOT NULL,
+	measurement TEXT NOT NULL
+)`
+
+// sqliteInsert is the statement that inserts a measurement.
+const sqliteInsert = `INSERT INTO measurements (
+	report_id, test_name, input, measurement_start_time,
+	probe_asn, probe_cc, measurement
+) VALUES (?, ?, ?, ?, ?, ?, ?)`
+
+// NewSQLiteMeasurementSink creates a new SQLiteMeasurementSink using
+// the specified database, which the sink will close when done.
+func NewSQLiteMeasurementSink(db *sql.DB) (*SQLiteMeasurementSink, error) {
+	if _, err := db.Exec(sqliteCreateTable); err != nil {
+		return nil, err
+	}
+	return &SQLiteMeasurementSink{db: db}, nil
+}
+
+// newSQLiteMeasurementSinkFromPath opens the SQLite database at
+// path and creates a new SQLiteMeasurementSink using it.
+func newSQLiteMeasurementSinkFromPath(path string) (MeasurementSink, error) {
+	db, err := sql.Open(SQLiteDriverName, path)
+	if err != nil {
+		return nil, err
+	}
+	sink, err := NewSQLiteMeasurementSink(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return sink, nil
+}
+
+// SaveMeasurement implements MeasurementSink.SaveMeasurement.
+func (s *SQLiteMeasurementSink) SaveMeasurement(
+	ctx context.Context, measurement *model.Measurement) error {
+	data, err := json.Marshal(measurement)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, sqliteInsert, measurement.ReportID,
+		measurement.TestName, string(measurement.Input),
+		measurement.MeasurementStartTime, measurement.ProbeASN,
+		measurement.ProbeCC, string(data))
+	return err
+}
+
+// Close implements MeasurementSink.Close.
+func (s *SQLiteMeasurementSink) Close() error {
+	return s.db.Close()
+}
+
+// DefaultWebhookTimeout is the default value of
+// WebhookMeasurementSink.Timeout.
+const DefaultWebhookTimeout = 30 * time.Second
+
+// WebhookMeasurementSink POSTs each measurement as a JSON document to
+// a webhook. We consider any 2xx status code a success.
+type WebhookMeasurementSink struct {
+	// HTTPClient is the HTTP client to use.
+	HTTPClient *http.Client
+
+	// Timeout is the timeout of each request.
+	Timeout time.Duration
+
+	// URL is the webhook URL.
+	URL string
+}
+
+// NewWebhookMeasurementSink creates a new WebhookMeasurementSink
+// POSTing to the specified http or https URL using client.
+func NewWebhookMeasurementSink(
+	URL string, client *http.Client) (*WebhookMeasurementSink, error) {
+	if !strings.HasPrefix(URL, "http://") && !strings.HasPrefix(URL, "https://") {
+		return nil, fmt.Errorf("%w: webhook:%s", ErrUnknownMeasurementSink, URL)
+	}
+	return &WebhookMeasurementSink{
+		HTTPClient: client,
+		Timeout:    DefaultWebhookTimeout,
+		URL:        URL,
+	}, nil
+}
+
+// SaveMeasurement implements MeasurementSink.SaveMeasurement.
+func (s *WebhookMeasurementSink) SaveMeasurement(
+	ctx context.Context, measurement *model.Measurement) error {
+	data, err := json.Marshal(measurement)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+	request, err := http.NewRequest("POST", s.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := s.HTTPClient.Do(request.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, response.Body) // allow connection reuse
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("webhook: request failed: %s", response.Status)
+	}
+	return nil
+}
+
+// Close implements MeasurementSink.Close.
+func (s *WebhookMeasurementSink) Close() error {
+	return nil
+}
+
+var (
+	_ MeasurementSink = &JSONLMeasurementSink{}
+	_ MeasurementSink = &GzipDirMeasurementSink{}
+	_ MeasurementSink = &SQLiteMeasurementSink{}
+	_ MeasurementSink = &WebhookMeasurementSink{}
+)
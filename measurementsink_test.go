@@ -0,0 +1,334 @@
+package engine
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ooni/probe-engine/model"
+	"github.com/ooni/probe-engine/probeservices"
+)
+
+func newSinkMeasurement(input string) *model.Measurement {
+	return &model.Measurement{
+		Input:    model.MeasurementTarget(input),
+		ProbeASN: "AS30722",
+		ProbeCC:  "IT",
+		ReportID: "20201016T153512Z_example_IT_30722_n1_xxx",
+		TestName: "example",
+	}
+}
+
+func newSinkTempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "ooniprobe-engine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// readSinkMeasurements returns the inputs of the JSONL measurements in data.
+func readSinkMeasurements(t *testing.T, data []byte) (inputs []string) {
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		var measurement model.Measurement
+		if err := json.Unmarshal(scanner.Bytes(), &measurement); err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, string(measurement.Input))
+	}
+	return
+}
+
+func TestNewMeasurementSink(t *testing.T) {
+	dir := newSinkTempDir(t)
+	defer os.RemoveAll(dir)
+	cases := []struct {
+		spec string
+		err  bool
+	}{
+		{spec: "jsonl:" + filepath.Join(dir, "report.jsonl")},
+		{spec: "gzipdir:" + filepath.Join(dir, "reports")},
+		{spec: "webhook:http://127.0.0.1/"},
+		{spec: "sqlite:" + filepath.Join(dir, "report.sqlite3"), err: true}, // no driver
+		{spec: "webhook:ftp://127.0.0.1/", err: true},
+		{spec: "jsonl:" + filepath.Join(dir, "nonexistent", "report.jsonl"), err: true},
+		{spec: "jsonl", err: true},
+		{spec: "jsonl:", err: true},
+		{spec: "csv:report.csv", err: true},
+	}
+	for _, c := range cases {
+		sink, err := NewMeasurementSink(c.spec, http.DefaultClient)
+		if (err != nil) != c.err {
+			t.Fatal("unexpected result", c.spec, err)
+		}
+		if sink != nil {
+			sink.Close()
+		}
+	}
+}
+
+func TestJSONLMeasurementSink(t *testing.T) {
+	dir := newSinkTempDir(t)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "report.jsonl")
+	for _, input := range []string{"a", "b"} {
+		// a new sink must append to the existing file
+		sink, err := NewJSONLMeasurementSink(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sink.SaveMeasurement(context.Background(), newSinkMeasurement(input)); err != nil {
+			t.Fatal(err)
+		}
+		if err := sink.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inputs := readSinkMeasurements(t, data); strings.Join(inputs, ",") != "a,b" {
+		t.Fatal("unexpected inputs", inputs)
+	}
+}
+
+func TestGzipDirMeasurementSink(t *testing.T) {
+	dir := newSinkTempDir(t)
+	defer os.RemoveAll(dir)
+	sink, err := NewGzipDirMeasurementSink(filepath.Join(dir, "reports"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.MaxFileSize = 1 // i.e., one measurement per file
+	for _, input := range []string{"a", "b", "c"} {
+		if err := sink.SaveMeasurement(context.Background(), newSinkMeasurement(input)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err) // must be idempotent
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "reports", "*.jsonl.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var inputs []string
+	for _, name := range files {
+		filep, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader, err := gzip.NewReader(filep)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		filep.Close()
+		inputs = append(inputs, readSinkMeasurements(t, data)...)
+	}
+	if len(files) != 3 || strings.Join(inputs, ",") != "a,b,c" {
+		t.Fatal("unexpected files or inputs", files, inputs)
+	}
+}
+
+func TestWebhookMeasurementSink(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		inputs []string
+		status = 204
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var measurement model.Measurement
+		data, _ := ioutil.ReadAll(r.Body)
+		if r.Method != "POST" || r.Header.Get("Content-Type") != "application/json" ||
+			json.Unmarshal(data, &measurement) != nil {
+			w.WriteHeader(400)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if status == 204 {
+			inputs = append(inputs, string(measurement.Input))
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	client := &http.Client{}
+	sink, err := NewWebhookMeasurementSink(server.URL, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sink.HTTPClient != client {
+		t.Fatal("not using the client we passed")
+	}
+	defer sink.Close()
+	if err := sink.SaveMeasurement(context.Background(), newSinkMeasurement("a")); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	if strings.Join(inputs, ",") != "a" {
+		t.Fatal("unexpected inputs", inputs)
+	}
+	mu.Unlock()
+	sink.URL = server.URL + "/\t" // invalid URL
+	if err := sink.SaveMeasurement(context.Background(), newSinkMeasurement("b")); err == nil {
+		t.Fatal("expected an error here")
+	}
+	mu.Lock()
+	status = 404
+	mu.Unlock()
+	sink.URL = server.URL
+	if err := sink.SaveMeasurement(context.Background(), newSinkMeasurement("b")); err == nil ||
+		!strings.HasSuffix(err.Error(), "404 Not Found") {
+		t.Fatal("not the error we expected", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := sink.SaveMeasurement(ctx, newSinkMeasurement("b")); err == nil {
+		t.Fatal("expected an error here")
+	}
+}
+
+// sqlSinkDriver is a database/sql driver recording the statements
+// executed by SQLiteMeasurementSink, since we do not link SQLite.
+type sqlSinkDriver struct {
+	args [][]driver.Value
+	err  error
+	mu   sync.Mutex
+}
+
+func (d *sqlSinkDriver) Open(name string) (driver.Conn, error) {
+	return &sqlSinkConn{driver: d}, nil
+}
+
+type sqlSinkConn struct {
+	driver *sqlSinkDriver
+}
+
+func (c *sqlSinkConn) Prepare(query string) (driver.Stmt, error) {
+	return &sqlSinkStmt{conn: c, query: query}, nil
+}
+
+func (c *sqlSinkConn) Close() error {
+	return nil
+}
+
+func (c *sqlSinkConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not implemented")
+}
+
+type sqlSinkStmt struct {
+	conn  *sqlSinkConn
+	query string
+}
+
+func (s *sqlSinkStmt) Close() error {
+	return nil
+}
+
+func (s *sqlSinkStmt) NumInput() int {
+	return -1
+}
+
+func (s *sqlSinkStmt) Exec(args []driver.Value) (driver.Result, error) {
+	d := s.conn.driver
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return nil, d.err
+	}
+	if strings.HasPrefix(s.query, "INSERT") {
+		d.args = append(d.args, args)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *sqlSinkStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, errors.New("not implemented")
+}
+
+var sqlSinkDriverInstance = &sqlSinkDriver{}
+
+func init() {
+	sql.Register("sqlsinktest", sqlSinkDriverInstance)
+}
+
+func TestSQLiteMeasurementSink(t *testing.T) {
+	db, err := sql.Open("sqlsinktest", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink, err := NewSQLiteMeasurementSink(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	if err := sink.SaveMeasurement(context.Background(), newSinkMeasurement("a")); err != nil {
+		t.Fatal(err)
+	}
+	d := sqlSinkDriverInstance
+	if len(d.args) != 1 || d.args[0][0] != "20201016T153512Z_example_IT_30722_n1_xxx" ||
+		d.args[0][2] != "a" || !strings.Contains(d.args[0][6].(string), `"input":"a"`) {
+		t.Fatal("unexpected arguments", d.args)
+	}
+	expected := errors.New("mocked error")
+	d.err = expected
+	defer func() { d.err = nil }()
+	if err := sink.SaveMeasurement(context.Background(), newSinkMeasurement("b")); !errors.Is(err, expected) {
+		t.Fatal("not the error we expected", err)
+	}
+	if _, err := NewSQLiteMeasurementSink(db); !errors.Is(err, expected) {
+		t.Fatal("not the error we expected", err)
+	}
+}
+
+func TestSaveMeasurementToSignsMeasurement(t *testing.T) {
+	sess := newSessionForTestingNoLookups(t)
+	defer sess.Close()
+	key, err := probeservices.NewStateFile(sess.kvStore).SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess.signingKey = key
+	dir := newSinkTempDir(t)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "report.jsonl")
+	sink, err := NewJSONLMeasurementSink(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := NewExperiment(sess, new(antaniMeasurer))
+	if err := exp.SaveMeasurementTo(sink, exp.newMeasurement("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := probeservices.VerifyMeasurement(data); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -20,6 +20,7 @@ type ExperimentOrchestraClient interface {
 // ExperimentSession is the experiment's view of a session.
 type ExperimentSession interface {
 	ASNDatabasePath() string
+	AssetsDir() string
 	GetTestHelpersByName(name string) ([]Service, bool)
 	DefaultHTTPClient() *http.Client
 	Logger() Logger
@@ -16,6 +16,22 @@ func (t MeasurementTarget) MarshalJSON() ([]byte, error) {
 	return json.Marshal(string(t))
 }
 
+// MeasurementSignature is a detached signature of a measurement. We sign
+// the canonical JSON serialization of the measurement, as defined by the
+// JSON Canonicalization Scheme (RFC 8785), excluding the signature and the
+// fields stamped by the OONI collector (i.e., ooid and report_id). The
+// probeservices package contains the code to sign and verify measurements.
+type MeasurementSignature struct {
+	// Algorithm is the signature algorithm. We only support ed25519.
+	Algorithm string `json:"algorithm"`
+
+	// PublicKey is the public key of the probe.
+	PublicKey []byte `json:"public_key"`
+
+	// Value is the signature.
+	Value []byte `json:"value"`
+}
+
 // Measurement is a OONI measurement.
 //
 // This structure is compatible with the definition of the base data format in
@@ -81,6 +97,9 @@ type Measurement struct {
 	// ResolverNetworkName is the network name of the resolver.
 	ResolverNetworkName string `json:"resolver_network_name"`
 
+	// Signature is the optional signature of the measurement.
+	Signature *MeasurementSignature `json:"signature,omitempty"`
+
 	// SoftwareName contains the software name
 	SoftwareName string `json:"software_name"`
 
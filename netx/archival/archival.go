@@ -16,9 +16,11 @@ import (
 	"time"
 	"unicode/utf8"
 
+	"github.com/miekg/dns"
 	"github.com/ooni/probe-engine/geolocate"
 	"github.com/ooni/probe-engine/model"
 	"github.com/ooni/probe-engine/netx/errorx"
+	"github.com/ooni/probe-engine/netx/resolver"
 	"github.com/ooni/probe-engine/netx/trace"
 )
 
@@ -363,40 +365,128 @@ func newRequestList(begin time.Time, events []trace.Event) []RequestEntry {
 	return out
 }
 
-// DNSAnswerEntry is the answer to a DNS query
+// DNSAnswerEntry is the answer to a DNS query. The Data field contains
+// the presentation format of the answers that are neither addresses
+// nor hostnames (e.g. TXT, MX, HTTPS).
 type DNSAnswerEntry struct {
 	ASN        int64   `json:"asn,omitempty"`
 	ASOrgName  string  `json:"as_org_name,omitempty"`
 	AnswerType string  `json:"answer_type"`
+	Data       string  `json:"data,omitempty"`
 	Hostname   string  `json:"hostname,omitempty"`
 	IPv4       string  `json:"ipv4,omitempty"`
 	IPv6       string  `json:"ipv6,omitempty"`
 	TTL        *uint32 `json:"ttl"`
 }
 
-// DNSQueryEntry is a DNS query with possibly an answer
+// DNSQueryEntry is a DNS query with possibly an answer. The Rcode,
+// AuthenticatedData and Truncated fields are only set when we have
+// seen the actual DNS reply sent by the resolver. The DNSSEC field is
+// only set when we have validated the reply using DNSSEC. DNSSECChain
+// is true for the DS and DNSKEY queries we sent to build the DNSSEC chain
+// of trust, rather than to resolve the measured domain. The Race field
+// is only set when the resolver took part in a race of resolvers.
 type DNSQueryEntry struct {
-	Answers          []DNSAnswerEntry `json:"answers"`
-	DialID           int64            `json:"dial_id,omitempty"`
-	Engine           string           `json:"engine"`
-	Failure          *string          `json:"failure"`
-	Hostname         string           `json:"hostname"`
-	QueryType        string           `json:"query_type"`
-	ResolverHostname *string          `json:"resolver_hostname"`
-	ResolverPort     *string          `json:"resolver_port"`
-	ResolverAddress  string           `json:"resolver_address"`
-	T                float64          `json:"t"`
-	TransactionID    int64            `json:"transaction_id,omitempty"`
+	Answers           []DNSAnswerEntry `json:"answers"`
+	AuthenticatedData bool             `json:"authenticated_data,omitempty"`
+	DNSSEC            string           `json:"dnssec,omitempty"`
+	DNSSECChain       bool             `json:"dnssec_chain,omitempty"`
+	DialID            int64            `json:"dial_id,omitempty"`
+	Engine            string           `json:"engine"`
+	Failure           *string          `json:"failure"`
+	Hostname          string           `json:"hostname"`
+	QueryType         string           `json:"query_type"`
+	Race              *DNSRaceEntry    `json:"race,omitempty"`
+	Rcode             string           `json:"rcode,omitempty"`
+	ResolverHostname  *string          `json:"resolver_hostname"`
+	ResolverPort      *string          `json:"resolver_port"`
+	ResolverAddress   string           `json:"resolver_address"`
+	T                 float64          `json:"t"`
+	TransactionID     int64            `json:"transaction_id,omitempty"`
+	Truncated         bool             `json:"truncated,omitempty"`
+}
+
+// DNSRaceEntry describes the race of resolvers that a DNS query was
+// part of. Duration is the time in seconds until we have got a winner or
+// all the resolvers have failed. Winner is true when the query was sent
+// by the resolver that won the race.
+type DNSRaceEntry struct {
+	Duration float64 `json:"duration"`
+	Winner   bool    `json:"winner"`
 }
 
 type dnsQueryType string
 
-// NewDNSQueriesList returns a list of DNS queries.
+// NewDNSQueriesList returns a list of DNS queries. When we have seen
+// the DNS messages exchanged with a resolver (i.e., the dns_round_trip_done
+// events), we decode the actual replies, thus including CNAMEs, TTLs, the
+// rcode and the AD and TC bits. Otherwise, for example with the system
+// resolver, we guess the A and AAAA queries from the resolved addresses.
+// When we have validated a reply using DNSSEC (i.e., there is a matching
+// dnssec_validate_done event), we also include the validation status,
+// and we tag the queries sent to build the chain of trust (i.e., there
+// is a matching dnssec_chain_query event). When a resolver took part
+// in a race (i.e., there are matching resolve_race_attempt and
+// resolve_race_done events), we also include the duration of the race
+// and whether the resolver won it.
 func NewDNSQueriesList(begin time.Time, events []trace.Event, dbpath string) []DNSQueryEntry {
-	// TODO(bassosimone): add support for CNAME lookups.
+	decoded := make(map[string]bool)
+	dnssec := make(map[string]string)
+	chain := make(map[string]bool)
+	racers := make(map[string]bool)
+	for _, ev := range events {
+		if ev.Name == "dnssec_validate_done" {
+			dnssec[string(ev.DNSQuery)] = ev.DNSSECStatus
+			continue
+		}
+		if ev.Name == "dnssec_chain_query" {
+			chain[string(ev.DNSQuery)] = true
+			continue
+		}
+		if ev.Name != "dns_round_trip_done" {
+			continue
+		}
+		if query, err := unpackDNSQuery(ev.DNSQuery); err == nil {
+			decoded[dnsResolutionKey(ev, query.hostname)] = true
+		}
+	}
 	var out []DNSQueryEntry
 	for _, ev := range events {
-		if ev.Name != "resolve_done" {
+		if ev.Name == "resolve_race_attempt" {
+			racers[dnsResolutionKey(ev, ev.Hostname)] = true
+			continue
+		}
+		if ev.Name == "resolve_race_done" {
+			// All the attempts terminate before the race is done, hence
+			// we have already seen all the queries that were part of it.
+			for idx := range out {
+				key := dnsResolutionKey(trace.Event{
+					Proto: out[idx].Engine, Address: out[idx].ResolverAddress,
+				}, out[idx].Hostname)
+				if out[idx].Race != nil || !racers[key] {
+					continue
+				}
+				out[idx].Race = &DNSRaceEntry{
+					Duration: ev.Duration.Seconds(),
+					Winner:   key == dnsResolutionKey(ev, ev.Hostname),
+				}
+			}
+			for key := range racers {
+				if strings.HasSuffix(key, " "+ev.Hostname) {
+					delete(racers, key) // allow racing again for hostname
+				}
+			}
+			continue
+		}
+		if ev.Name == "dns_round_trip_done" {
+			if entry, err := newDNSQueryEntryFromRoundTrip(begin, ev, dbpath); err == nil {
+				entry.DNSSEC = dnssec[string(ev.DNSQuery)]
+				entry.DNSSECChain = chain[string(ev.DNSQuery)]
+				out = append(out, entry)
+			}
+			continue
+		}
+		if ev.Name != "resolve_done" || decoded[dnsResolutionKey(ev, ev.Hostname)] {
 			continue
 		}
 		for _, qtype := range []dnsQueryType{"A", "AAAA"} {
@@ -423,6 +513,100 @@ func NewDNSQueriesList(begin time.Time, events []trace.Event, dbpath string) []D
 	return out
 }
 
+// dnsResolutionKey returns the key identifying the resolution of
+// hostname performed by the resolver that emitted the given event.
+func dnsResolutionKey(ev trace.Event, hostname string) string {
+	return ev.Proto + " " + ev.Address + " " + hostname
+}
+
+type dnsQuestion struct {
+	hostname string
+	qtype    uint16
+}
+
+// unpackDNSQuery returns the question contained by the given query.
+func unpackDNSQuery(data []byte) (dnsQuestion, error) {
+	query := new(dns.Msg)
+	if err := query.Unpack(data); err != nil {
+		return dnsQuestion{}, err
+	}
+	if len(query.Question) != 1 {
+		return dnsQuestion{}, errors.New("archival: expected a single question")
+	}
+	return dnsQuestion{
+		hostname: strings.TrimSuffix(query.Question[0].Name, "."),
+		qtype:    query.Question[0].Qtype,
+	}, nil
+}
+
+// newDNSQueryEntryFromRoundTrip creates a new DNSQueryEntry using the
+// query and the reply saved by a dns_round_trip_done event.
+func newDNSQueryEntryFromRoundTrip(
+	begin time.Time, ev trace.Event, dbpath string) (DNSQueryEntry, error) {
+	question, err := unpackDNSQuery(ev.DNSQuery)
+	if err != nil {
+		return DNSQueryEntry{}, err
+	}
+	entry := DNSQueryEntry{
+		Engine:          ev.Proto,
+		Failure:         NewFailure(ev.Err),
+		Hostname:        question.hostname,
+		QueryType:       resolver.QueryTypeString(question.qtype),
+		ResolverAddress: ev.Address,
+		T:               ev.Time.Sub(begin).Seconds(),
+	}
+	if ev.Err != nil || ev.DNSReply == nil {
+		return entry, nil
+	}
+	reply := new(dns.Msg)
+	if err := reply.Unpack(ev.DNSReply); err != nil {
+		entry.Failure = NewFailure(err)
+		return entry, nil
+	}
+	entry.AuthenticatedData = reply.AuthenticatedData
+	entry.Rcode = dns.RcodeToString[reply.Rcode]
+	entry.Truncated = reply.Truncated
+	if reply.Rcode == dns.RcodeNameError {
+		// Be consistent with what the resolver returns in this case. For
+		// other rcodes, the Rcode field tells what happened.
+		failure := errorx.FailureDNSNXDOMAINError
+		entry.Failure = &failure
+	}
+	for _, rr := range reply.Answer {
+		var answer DNSAnswerEntry
+		switch v := rr.(type) {
+		case *dns.A:
+			answer = dnsQueryType("A").makeanswerentry(v.A.String(), dbpath)
+		case *dns.AAAA:
+			answer = dnsQueryType("AAAA").makeanswerentry(v.AAAA.String(), dbpath)
+		case *dns.CNAME:
+			answer = DNSAnswerEntry{
+				AnswerType: "CNAME",
+				Hostname:   strings.TrimSuffix(v.Target, "."),
+			}
+		case *dns.NS:
+			answer = DNSAnswerEntry{
+				AnswerType: "NS",
+				Hostname:   strings.TrimSuffix(v.Ns, "."),
+			}
+		default:
+			// Only include the records we asked for, so that, e.g., we
+			// do not include the RRSIGs returned along with an A record.
+			if rr.Header().Rrtype != question.qtype {
+				continue
+			}
+			answer = DNSAnswerEntry{
+				AnswerType: resolver.QueryTypeString(rr.Header().Rrtype),
+				Data:       strings.TrimPrefix(rr.String(), rr.Header().String()),
+			}
+		}
+		ttl := rr.Header().Ttl
+		answer.TTL = &ttl
+		entry.Answers = append(entry.Answers, answer)
+	}
+	return entry, nil
+}
+
 func (qtype dnsQueryType) ipoftype(addr string) bool {
 	switch qtype {
 	case "A":
@@ -503,6 +687,16 @@ func NewNetworkEventsList(begin time.Time, events []trace.Event) []NetworkEvent
 			})
 			continue
 		}
+		if ev.Name == errorx.ReadFromOperation || ev.Name == errorx.WriteToOperation {
+			out = append(out, NetworkEvent{
+				Address:   ev.Address,
+				Failure:   NewFailure(ev.Err),
+				Operation: ev.Name,
+				NumBytes:  int64(ev.NumBytes),
+				T:         ev.Time.Sub(begin).Seconds(),
+			})
+			continue
+		}
 		out = append(out, NetworkEvent{
 			Failure:   NewFailure(ev.Err),
 			Operation: ev.Name,
@@ -512,11 +706,19 @@ func NewNetworkEventsList(begin time.Time, events []trace.Event) []NetworkEvent
 	return out
 }
 
-// TLSHandshake contains TLS handshake data
+// TLSHandshake contains TLS handshake data. The Fingerprint field is
+// empty when we used the crypto/tls ClientHello, otherwise it contains
+// the name of the ClientHello fingerprint we used (e.g. "chrome"). The
+// ECHOffered field tells whether we sent an Encrypted ClientHello and
+// the ECHAccepted field tells whether the server accepted it.
 type TLSHandshake struct {
+	Address            string             `json:"address,omitempty"`
 	CipherSuite        string             `json:"cipher_suite"`
 	ConnID             int64              `json:"conn_id,omitempty"`
+	ECHAccepted        bool               `json:"ech_accepted,omitempty"`
+	ECHOffered         bool               `json:"ech_offered,omitempty"`
 	Failure            *string            `json:"failure"`
+	Fingerprint        string             `json:"fingerprint,omitempty"`
 	NegotiatedProtocol string             `json:"negotiated_protocol"`
 	NoTLSVerify        bool               `json:"no_tls_verify"`
 	PeerCertificates   []MaybeBinaryValue `json:"peer_certificates"`
@@ -534,6 +736,33 @@ func NewTLSHandshakesList(begin time.Time, events []trace.Event) []TLSHandshake
 			continue
 		}
 		out = append(out, TLSHandshake{
+			CipherSuite:        ev.TLSCipherSuite,
+			ECHAccepted:        ev.TLSECHAccepted,
+			ECHOffered:         ev.TLSECHOffered,
+			Failure:            NewFailure(ev.Err),
+			Fingerprint:        ev.TLSFingerprint,
+			NegotiatedProtocol: ev.TLSNegotiatedProto,
+			NoTLSVerify:        ev.NoTLSVerify,
+			PeerCertificates:   makePeerCerts(ev.TLSPeerCerts),
+			ServerName:         ev.TLSServerName,
+			T:                  ev.Time.Sub(begin).Seconds(),
+			TLSVersion:         ev.TLSVersion,
+		})
+	}
+	return out
+}
+
+// NewQUICHandshakesList creates a new list of QUIC handshakes. We
+// use the TLSHandshake data format, since QUIC uses TLS 1.3 for its
+// handshake, and we additionally include the remote address.
+func NewQUICHandshakesList(begin time.Time, events []trace.Event) []TLSHandshake {
+	var out []TLSHandshake
+	for _, ev := range events {
+		if ev.Name != "quic_handshake_done" {
+			continue
+		}
+		out = append(out, TLSHandshake{
+			Address:            ev.Address,
 			CipherSuite:        ev.TLSCipherSuite,
 			Failure:            NewFailure(ev.Err),
 			NegotiatedProtocol: ev.TLSNegotiatedProto,
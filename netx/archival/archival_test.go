@@ -13,6 +13,7 @@ import (
 	"github.com/apex/log"
 	"github.com/google/go-cmp/cmp"
 	"github.com/gorilla/websocket"
+	"github.com/miekg/dns"
 	"github.com/ooni/probe-engine/model"
 	"github.com/ooni/probe-engine/netx/archival"
 	"github.com/ooni/probe-engine/netx/errorx"
@@ -427,6 +428,342 @@ func TestNewDNSQueriesList(t *testing.T) {
 	}
 }
 
+func newDNSMessages(t *testing.T, qtype uint16, rcode int, answers ...string) ([]byte, []byte) {
+	query := new(dns.Msg)
+	query.SetQuestion("www.example.com.", qtype)
+	querydata, err := query.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply := new(dns.Msg)
+	reply.SetRcode(query, rcode)
+	reply.AuthenticatedData = true
+	reply.Truncated = rcode == dns.RcodeNameError
+	for _, answer := range answers {
+		rr, err := dns.NewRR(answer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reply.Answer = append(reply.Answer, rr)
+	}
+	replydata, err := reply.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return querydata, replydata
+}
+
+func TestNewDNSQueriesListWithReplies(t *testing.T) {
+	begin := time.Now()
+	queryA, replyA := newDNSMessages(t, dns.TypeA, dns.RcodeSuccess,
+		"www.example.com. 300 IN CNAME example.com.",
+		"example.com. 17 IN A 93.184.216.34")
+	queryAAAA, replyAAAA := newDNSMessages(t, dns.TypeAAAA, dns.RcodeNameError)
+	var (
+		ttlCNAME uint32 = 300
+		ttlA     uint32 = 17
+	)
+	nxdomain := errorx.FailureDNSNXDOMAINError
+	events := []trace.Event{{
+		Address:  "8.8.8.8:53",
+		DNSQuery: queryA,
+		DNSReply: replyA,
+		Name:     "dns_round_trip_done",
+		Proto:    "udp",
+		Time:     begin.Add(10 * time.Millisecond),
+	}, {
+		Address:  "8.8.8.8:53",
+		DNSQuery: queryAAAA,
+		DNSReply: replyAAAA,
+		Name:     "dns_round_trip_done",
+		Proto:    "udp",
+		Time:     begin.Add(20 * time.Millisecond),
+	}, {
+		Address:  "8.8.8.8:53",
+		DNSQuery: queryAAAA,
+		Err:      io.EOF,
+		Name:     "dns_round_trip_done",
+		Proto:    "udp",
+		Time:     begin.Add(30 * time.Millisecond),
+	}, {
+		Address:  "8.8.8.8:53",
+		DNSQuery: []byte{0x00},
+		Name:     "dns_round_trip_done",
+		Proto:    "udp",
+		Time:     begin.Add(35 * time.Millisecond),
+	}, {
+		Address:   "8.8.8.8:53",
+		Addresses: []string{"93.184.216.34"},
+		Hostname:  "www.example.com",
+		Name:      "resolve_done",
+		Proto:     "udp",
+		Time:      begin.Add(40 * time.Millisecond),
+	}, {
+		Addresses: []string{"93.184.216.34"},
+		Hostname:  "www.example.com",
+		Name:      "resolve_done",
+		Proto:     "system",
+		Time:      begin.Add(50 * time.Millisecond),
+	}}
+	want := []archival.DNSQueryEntry{{
+		Answers: []archival.DNSAnswerEntry{{
+			AnswerType: "CNAME",
+			Hostname:   "example.com",
+			TTL:        &ttlCNAME,
+		}, {
+			AnswerType: "A",
+			IPv4:       "93.184.216.34",
+			TTL:        &ttlA,
+		}},
+		AuthenticatedData: true,
+		Engine:            "udp",
+		Hostname:          "www.example.com",
+		QueryType:         "A",
+		Rcode:             "NOERROR",
+		ResolverAddress:   "8.8.8.8:53",
+		T:                 0.01,
+	}, {
+		AuthenticatedData: true,
+		Engine:            "udp",
+		Failure:           &nxdomain,
+		Hostname:          "www.example.com",
+		QueryType:         "AAAA",
+		Rcode:             "NXDOMAIN",
+		ResolverAddress:   "8.8.8.8:53",
+		T:                 0.02,
+		Truncated:         true,
+	}, {
+		Engine:          "udp",
+		Failure:         archival.NewFailure(io.EOF),
+		Hostname:        "www.example.com",
+		QueryType:       "AAAA",
+		ResolverAddress: "8.8.8.8:53",
+		T:               0.03,
+	}, {
+		Answers: []archival.DNSAnswerEntry{{
+			AnswerType: "A",
+			IPv4:       "93.184.216.34",
+		}},
+		Engine:    "system",
+		Hostname:  "www.example.com",
+		QueryType: "A",
+		T:         0.05,
+	}}
+	got := archival.NewDNSQueriesList(begin, events, "")
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestNewDNSQueriesListWithDNSSEC(t *testing.T) {
+	begin := time.Now()
+	queryA, replyA := newDNSMessages(t, dns.TypeA, dns.RcodeSuccess,
+		"www.example.com. 17 IN A 93.184.216.34")
+	queryAAAA, replyAAAA := newDNSMessages(t, dns.TypeAAAA, dns.RcodeSuccess)
+	queryDS, replyDS := newDNSMessages(t, dns.TypeDS, dns.RcodeSuccess)
+	events := []trace.Event{{
+		Address:  "8.8.8.8:53",
+		DNSQuery: queryA,
+		DNSReply: replyA,
+		Name:     "dns_round_trip_done",
+		Proto:    "udp",
+		Time:     begin.Add(10 * time.Millisecond),
+	}, {
+		Address:      "8.8.8.8:53",
+		DNSQuery:     queryA,
+		DNSReply:     replyA,
+		DNSSECStatus: "dnssec_bogus",
+		Hostname:     "www.example.com",
+		Name:         "dnssec_validate_done",
+		Proto:        "udp",
+		Time:         begin.Add(20 * time.Millisecond),
+	}, {
+		Address:  "8.8.8.8:53",
+		DNSQuery: queryAAAA,
+		DNSReply: replyAAAA,
+		Name:     "dns_round_trip_done",
+		Proto:    "udp",
+		Time:     begin.Add(30 * time.Millisecond),
+	}, {
+		Address:      "8.8.8.8:53",
+		DNSQuery:     queryAAAA,
+		DNSReply:     replyAAAA,
+		DNSSECStatus: "dnssec_secure",
+		Hostname:     "www.example.com",
+		Name:         "dnssec_validate_done",
+		Proto:        "udp",
+		Time:         begin.Add(40 * time.Millisecond),
+	}, {
+		Address:  "8.8.8.8:53",
+		DNSQuery: queryDS,
+		DNSReply: replyDS,
+		Name:     "dns_round_trip_done",
+		Proto:    "udp",
+		Time:     begin.Add(50 * time.Millisecond),
+	}, {
+		Address:  "8.8.8.8:53",
+		DNSQuery: queryDS,
+		Hostname: "www.example.com",
+		Name:     "dnssec_chain_query",
+		Proto:    "udp",
+		Time:     begin.Add(50 * time.Millisecond),
+	}}
+	got := archival.NewDNSQueriesList(begin, events, "")
+	if len(got) != 3 {
+		t.Fatal("unexpected number of entries")
+	}
+	if got[0].QueryType != "A" || got[0].DNSSEC != "dnssec_bogus" || got[0].DNSSECChain {
+		t.Fatal("unexpected first entry")
+	}
+	if got[1].QueryType != "AAAA" || got[1].DNSSEC != "dnssec_secure" || got[1].DNSSECChain {
+		t.Fatal("unexpected second entry")
+	}
+	if got[2].QueryType != "DS" || got[2].DNSSEC != "" || !got[2].DNSSECChain {
+		t.Fatal("unexpected third entry")
+	}
+}
+
+func TestNewDNSQueriesListWithRace(t *testing.T) {
+	begin := time.Now()
+	queryA, replyA := newDNSMessages(t, dns.TypeA, dns.RcodeSuccess,
+		"www.example.com. 60 IN A 93.184.216.34")
+	events := []trace.Event{{
+		Address:  "8.8.8.8:53",
+		DNSQuery: queryA,
+		DNSReply: replyA,
+		Name:     "dns_round_trip_done",
+		Proto:    "udp",
+		Time:     begin.Add(10 * time.Millisecond),
+	}, {
+		Address:  "8.8.8.8:53",
+		Hostname: "www.example.com",
+		Name:     "resolve_race_attempt",
+		Proto:    "udp",
+		Time:     begin.Add(10 * time.Millisecond),
+	}, {
+		Address:  "1.1.1.1:53",
+		DNSQuery: queryA,
+		Err:      context.Canceled,
+		Name:     "dns_round_trip_done",
+		Proto:    "udp",
+		Time:     begin.Add(11 * time.Millisecond),
+	}, {
+		Address:  "1.1.1.1:53",
+		Err:      context.Canceled,
+		Hostname: "www.example.com",
+		Name:     "resolve_race_attempt",
+		Proto:    "udp",
+		Time:     begin.Add(11 * time.Millisecond),
+	}, {
+		Address:   "8.8.8.8:53",
+		Addresses: []string{"93.184.216.34"},
+		Duration:  10 * time.Millisecond,
+		Hostname:  "www.example.com",
+		Name:      "resolve_race_done",
+		Proto:     "udp",
+		Time:      begin.Add(10 * time.Millisecond),
+	}, {
+		Address:  "8.8.4.4:53",
+		DNSQuery: queryA,
+		DNSReply: replyA,
+		Name:     "dns_round_trip_done",
+		Proto:    "udp",
+		Time:     begin.Add(20 * time.Millisecond),
+	}}
+	got := archival.NewDNSQueriesList(begin, events, "")
+	if len(got) != 3 {
+		t.Fatal("unexpected number of entries")
+	}
+	if got[0].Race == nil || !got[0].Race.Winner || got[0].Race.Duration != 0.01 {
+		t.Fatal("unexpected first entry", got[0].Race)
+	}
+	if got[1].Race == nil || got[1].Race.Winner || got[1].Race.Duration != 0.01 {
+		t.Fatal("unexpected second entry", got[1].Race)
+	}
+	if got[2].Race != nil {
+		t.Fatal("unexpected third entry", got[2].Race)
+	}
+}
+
+func TestNewDNSQueriesListWithOtherTypes(t *testing.T) {
+	begin := time.Now()
+	queryTXT, replyTXT := newDNSMessages(t, dns.TypeTXT, dns.RcodeSuccess,
+		"www.example.com. 300 IN CNAME example.com.",
+		"example.com. 60 IN TXT \"v=spf1 -all\"",
+		"example.com. 60 IN RRSIG TXT 13 2 60 20210101000000 20200101000000 1 example.com. AAAA")
+	queryNS, replyNS := newDNSMessages(t, dns.TypeNS, dns.RcodeSuccess,
+		"www.example.com. 60 IN NS a.iana-servers.net.")
+	queryHTTPS, _ := newDNSMessages(t, 65, dns.RcodeSuccess)
+	var (
+		ttlCNAME uint32 = 300
+		ttl      uint32 = 60
+	)
+	events := []trace.Event{{
+		Address:  "8.8.8.8:53",
+		DNSQuery: queryTXT,
+		DNSReply: replyTXT,
+		Name:     "dns_round_trip_done",
+		Proto:    "udp",
+		Time:     begin.Add(10 * time.Millisecond),
+	}, {
+		Address:  "8.8.8.8:53",
+		DNSQuery: queryNS,
+		DNSReply: replyNS,
+		Name:     "dns_round_trip_done",
+		Proto:    "udp",
+		Time:     begin.Add(20 * time.Millisecond),
+	}, {
+		Address:  "8.8.8.8:53",
+		DNSQuery: queryHTTPS,
+		Err:      io.EOF,
+		Name:     "dns_round_trip_done",
+		Proto:    "udp",
+		Time:     begin.Add(30 * time.Millisecond),
+	}}
+	want := []archival.DNSQueryEntry{{
+		Answers: []archival.DNSAnswerEntry{{
+			AnswerType: "CNAME",
+			Hostname:   "example.com",
+			TTL:        &ttlCNAME,
+		}, {
+			AnswerType: "TXT",
+			Data:       "\"v=spf1 -all\"",
+			TTL:        &ttl,
+		}},
+		AuthenticatedData: true,
+		Engine:            "udp",
+		Hostname:          "www.example.com",
+		QueryType:         "TXT",
+		Rcode:             "NOERROR",
+		ResolverAddress:   "8.8.8.8:53",
+		T:                 0.01,
+	}, {
+		Answers: []archival.DNSAnswerEntry{{
+			AnswerType: "NS",
+			Hostname:   "a.iana-servers.net",
+			TTL:        &ttl,
+		}},
+		AuthenticatedData: true,
+		Engine:            "udp",
+		Hostname:          "www.example.com",
+		QueryType:         "NS",
+		Rcode:             "NOERROR",
+		ResolverAddress:   "8.8.8.8:53",
+		T:                 0.02,
+	}, {
+		Engine:          "udp",
+		Failure:         archival.NewFailure(io.EOF),
+		Hostname:        "www.example.com",
+		QueryType:       "HTTPS",
+		ResolverAddress: "8.8.8.8:53",
+		T:               0.03,
+	}}
+	got := archival.NewDNSQueriesList(begin, events, "")
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
 func TestNewNetworkEventsList(t *testing.T) {
 	begin := time.Now()
 	type args struct {
@@ -491,6 +828,41 @@ func TestNewNetworkEventsList(t *testing.T) {
 			Operation: errorx.CloseOperation,
 			T:         0.017,
 		}},
+	}, {
+		name: "udp run",
+		args: args{
+			begin: begin,
+			events: []trace.Event{{
+				Name:     errorx.WriteToOperation,
+				Address:  "8.8.8.8:443",
+				NumBytes: 1252,
+				Time:     begin.Add(3 * time.Millisecond),
+			}, {
+				Name:     errorx.ReadFromOperation,
+				Address:  "8.8.8.8:443",
+				NumBytes: 1252,
+				Time:     begin.Add(9 * time.Millisecond),
+			}, {
+				Name: errorx.ReadFromOperation,
+				Err:  context.Canceled,
+				Time: begin.Add(12 * time.Millisecond),
+			}},
+		},
+		want: []archival.NetworkEvent{{
+			Address:   "8.8.8.8:443",
+			NumBytes:  1252,
+			Operation: errorx.WriteToOperation,
+			T:         0.003,
+		}, {
+			Address:   "8.8.8.8:443",
+			NumBytes:  1252,
+			Operation: errorx.ReadFromOperation,
+			T:         0.009,
+		}, {
+			Failure:   archival.NewFailure(context.Canceled),
+			Operation: errorx.ReadFromOperation,
+			T:         0.012,
+		}},
 	}}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -556,6 +928,28 @@ func TestNewTLSHandshakesList(t *testing.T) {
 			T:          0.055,
 			TLSVersion: "TLSv1.3",
 		}},
+	}, {
+		name: "run with fingerprint",
+		args: args{
+			begin: begin,
+			events: []trace.Event{{
+				Name:               "tls_handshake_done",
+				TLSCipherSuite:     "SUITE",
+				TLSFingerprint:     "chrome",
+				TLSNegotiatedProto: "http/1.1",
+				TLSServerName:      "x.org",
+				TLSVersion:         "TLSv1.3",
+				Time:               begin.Add(55 * time.Millisecond),
+			}},
+		},
+		want: []archival.TLSHandshake{{
+			CipherSuite:        "SUITE",
+			Fingerprint:        "chrome",
+			NegotiatedProtocol: "http/1.1",
+			ServerName:         "x.org",
+			T:                  0.055,
+			TLSVersion:         "TLSv1.3",
+		}},
 	}}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -566,6 +960,74 @@ func TestNewTLSHandshakesList(t *testing.T) {
 	}
 }
 
+func TestNewQUICHandshakesList(t *testing.T) {
+	begin := time.Now()
+	type args struct {
+		begin  time.Time
+		events []trace.Event
+	}
+	tests := []struct {
+		name string
+		args args
+		want []archival.TLSHandshake
+	}{{
+		name: "empty run",
+		args: args{
+			begin:  begin,
+			events: nil,
+		},
+		want: nil,
+	}, {
+		name: "realistic run",
+		args: args{
+			begin: begin,
+			events: []trace.Event{{
+				Name:          "quic_handshake_start",
+				Address:       "8.8.8.8:443",
+				TLSServerName: "dns.google",
+				Time:          begin.Add(10 * time.Millisecond),
+			}, {
+				Name:               "tls_handshake_done",
+				TLSNegotiatedProto: "h2",
+				Time:               begin.Add(20 * time.Millisecond),
+			}, {
+				Name:               "quic_handshake_done",
+				Address:            "8.8.8.8:443",
+				Err:                io.EOF,
+				NoTLSVerify:        true,
+				TLSCipherSuite:     "SUITE",
+				TLSNegotiatedProto: "h3-29",
+				TLSPeerCerts: []*x509.Certificate{{
+					Raw: []byte("deadbeef"),
+				}},
+				TLSServerName: "dns.google",
+				TLSVersion:    "TLSv1.3",
+				Time:          begin.Add(55 * time.Millisecond),
+			}},
+		},
+		want: []archival.TLSHandshake{{
+			Address:            "8.8.8.8:443",
+			CipherSuite:        "SUITE",
+			Failure:            archival.NewFailure(io.EOF),
+			NegotiatedProtocol: "h3-29",
+			NoTLSVerify:        true,
+			PeerCertificates: []archival.MaybeBinaryValue{{
+				Value: "deadbeef",
+			}},
+			ServerName: "dns.google",
+			T:          0.055,
+			TLSVersion: "TLSv1.3",
+		}},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := archival.NewQUICHandshakesList(tt.args.begin, tt.args.events); !reflect.DeepEqual(got, tt.want) {
+				t.Error(cmp.Diff(got, tt.want))
+			}
+		})
+	}
+}
+
 func TestExtSpec_AddTo(t *testing.T) {
 	m := new(model.Measurement)
 	archival.ExtDNS.AddTo(m)
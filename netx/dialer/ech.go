@@ -0,0 +1,26 @@
+//go:build go1.23
+// +build go1.23
+
+package dialer
+
+import "crypto/tls"
+
+// ECHSupported indicates whether this build can send an Encrypted ClientHello.
+const ECHSupported = true
+
+// setECHConfigList configures config to send an Encrypted ClientHello
+// using the given serialized ECHConfigList.
+func setECHConfigList(config *tls.Config, list []byte) error {
+	config.EncryptedClientHelloConfigList = list
+	return nil
+}
+
+// echOffered returns whether config is configured to send ECH.
+func echOffered(config *tls.Config) bool {
+	return len(config.EncryptedClientHelloConfigList) > 0
+}
+
+// echAccepted returns whether the server accepted our ECH.
+func echAccepted(state tls.ConnectionState) bool {
+	return state.ECHAccepted
+}
@@ -0,0 +1,25 @@
+//go:build !go1.23
+// +build !go1.23
+
+package dialer
+
+import "crypto/tls"
+
+// ECHSupported indicates whether this build can send an Encrypted ClientHello.
+const ECHSupported = false
+
+// setECHConfigList fails because crypto/tls only supports
+// sending an Encrypted ClientHello since Go 1.23.
+func setECHConfigList(config *tls.Config, list []byte) error {
+	return ErrECHNotSupported
+}
+
+// echOffered returns whether config is configured to send ECH.
+func echOffered(config *tls.Config) bool {
+	return false
+}
+
+// echAccepted returns whether the server accepted our ECH.
+func echAccepted(state tls.ConnectionState) bool {
+	return false
+}
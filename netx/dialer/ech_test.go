@@ -0,0 +1,115 @@
+//go:build go1.24
+// +build go1.24
+
+package dialer_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ooni/probe-engine/internal/tlsx"
+	"github.com/ooni/probe-engine/netx/dialer"
+	"github.com/ooni/probe-engine/netx/trace"
+)
+
+func newECHServer(t *testing.T, keys []tls.EncryptedClientHelloKey) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{
+		EncryptedClientHelloKeys: keys,
+		MinVersion:               tls.VersionTLS13,
+	}
+	server.StartTLS()
+	return server
+}
+
+func newECHDialer(server *httptest.Server, list []byte, saver *trace.Saver) dialer.TLSDialer {
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	return dialer.TLSDialer{
+		Config:        &tls.Config{RootCAs: pool, ServerName: "example.com"},
+		Dialer:        new(net.Dialer),
+		ECHConfigList: list,
+		TLSHandshaker: dialer.SaverTLSHandshaker{
+			TLSHandshaker: dialer.SystemTLSHandshaker{},
+			Saver:         saver,
+		},
+	}
+}
+
+func TestUnitTLSDialerECHAccepted(t *testing.T) {
+	key, err := tlsx.NewECHKey(1, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newECHServer(t, []tls.EncryptedClientHelloKey{{
+		Config:     key.Config,
+		PrivateKey: key.PrivateKey,
+	}})
+	defer server.Close()
+	saver := new(trace.Saver)
+	d := newECHDialer(server, key.ConfigList, saver)
+	conn, err := d.DialTLSContext(
+		context.Background(), "tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !conn.(*tls.Conn).ConnectionState().ECHAccepted {
+		t.Fatal("expected the server to accept ECH")
+	}
+	conn.Close()
+	ev := saver.Read()
+	if len(ev) != 2 {
+		t.Fatal("unexpected number of events")
+	}
+	if !ev[0].TLSECHOffered || ev[0].TLSECHAccepted {
+		t.Fatal("unexpected start event")
+	}
+	if !ev[1].TLSECHOffered || !ev[1].TLSECHAccepted {
+		t.Fatal("unexpected done event")
+	}
+}
+
+func TestUnitTLSDialerECHRejected(t *testing.T) {
+	key, err := tlsx.NewECHKey(1, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newECHServer(t, nil)
+	defer server.Close()
+	saver := new(trace.Saver)
+	d := newECHDialer(server, key.ConfigList, saver)
+	conn, err := d.DialTLSContext(
+		context.Background(), "tcp", server.Listener.Addr().String())
+	var rejectionErr *tls.ECHRejectionError
+	if !errors.As(err, &rejectionErr) {
+		t.Fatal("not the error we expected", err)
+	}
+	if conn != nil {
+		t.Fatal("expected nil conn here")
+	}
+	ev := saver.Read()
+	if len(ev) != 2 || !ev[1].TLSECHOffered || ev[1].TLSECHAccepted {
+		t.Fatal("unexpected events")
+	}
+}
+
+func TestUnitTLSDialerECHInvalidConfigList(t *testing.T) {
+	server := newECHServer(t, nil)
+	defer server.Close()
+	d := newECHDialer(server, []byte{0x00, 0x04, 0xfe, 0x0d, 0x00, 0x00}, new(trace.Saver))
+	conn, err := d.DialTLSContext(
+		context.Background(), "tcp", server.Listener.Addr().String())
+	if err == nil {
+		t.Fatal("expected an error here")
+	}
+	if conn != nil {
+		t.Fatal("expected nil conn here")
+	}
+}
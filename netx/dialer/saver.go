@@ -35,10 +35,13 @@ func (d SaverDialer) DialContext(ctx context.Context, network, address string) (
 	return conn, err
 }
 
-// SaverTLSHandshaker saves events occurring during the handshake
+// SaverTLSHandshaker saves events occurring during the handshake. The
+// Fingerprint field is the name of the fingerprint used by the underlying
+// UTLSHandshaker, if any, which we include in the events.
 type SaverTLSHandshaker struct {
 	TLSHandshaker
-	Saver *trace.Saver
+	Fingerprint string
+	Saver       *trace.Saver
 }
 
 // Handshake implements TLSHandshaker.Handshake
@@ -47,11 +50,13 @@ func (h SaverTLSHandshaker) Handshake(
 ) (net.Conn, tls.ConnectionState, error) {
 	start := time.Now()
 	h.Saver.Write(trace.Event{
-		Name:          "tls_handshake_start",
-		NoTLSVerify:   config.InsecureSkipVerify,
-		TLSNextProtos: config.NextProtos,
-		TLSServerName: config.ServerName,
-		Time:          start,
+		Name:           "tls_handshake_start",
+		NoTLSVerify:    config.InsecureSkipVerify,
+		TLSECHOffered:  echOffered(config),
+		TLSFingerprint: h.Fingerprint,
+		TLSNextProtos:  config.NextProtos,
+		TLSServerName:  config.ServerName,
+		Time:           start,
 	})
 	tlsconn, state, err := h.TLSHandshaker.Handshake(ctx, conn, config)
 	stop := time.Now()
@@ -61,6 +66,9 @@ func (h SaverTLSHandshaker) Handshake(
 		Name:               "tls_handshake_done",
 		NoTLSVerify:        config.InsecureSkipVerify,
 		TLSCipherSuite:     tlsx.CipherSuiteString(state.CipherSuite),
+		TLSECHAccepted:     echAccepted(state),
+		TLSECHOffered:      echOffered(config),
+		TLSFingerprint:     h.Fingerprint,
 		TLSNegotiatedProto: state.NegotiatedProtocol,
 		TLSNextProtos:      config.NextProtos,
 		TLSPeerCerts:       peerCerts(state, err),
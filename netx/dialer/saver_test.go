@@ -369,3 +369,36 @@ func TestIntegrationSaverTLSHandshakerNoTLSVerify(t *testing.T) {
 		}
 	}
 }
+
+func TestIntegrationSaverTLSHandshakerWithFingerprint(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+	saver := &trace.Saver{}
+	tlsdlr := dialer.TLSDialer{
+		Config: &tls.Config{NextProtos: []string{"http/1.1"}},
+		Dialer: new(net.Dialer),
+		TLSHandshaker: dialer.SaverTLSHandshaker{
+			TLSHandshaker: dialer.UTLSHandshaker{Fingerprint: "firefox"},
+			Fingerprint:   "firefox",
+			Saver:         saver,
+		},
+	}
+	conn, err := tlsdlr.DialTLSContext(context.Background(), "tcp", "www.google.com:443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	ev := saver.Read()
+	if len(ev) != 2 {
+		t.Fatal("unexpected number of events")
+	}
+	for _, e := range ev {
+		if e.TLSFingerprint != "firefox" {
+			t.Fatal("unexpected TLSFingerprint")
+		}
+	}
+	if ev[1].TLSNegotiatedProto != "http/1.1" {
+		t.Fatal("unexpected TLSNegotiatedProto")
+	}
+}
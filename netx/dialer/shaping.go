@@ -0,0 +1,51 @@
+package dialer
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// ShapingDialer ensures we don't use too much bandwidth
+// when using integration tests at GitHub. To select
+// the implementation with shaping use `-tags shaping`.
+//
+// You can also set Delay to make every Read and Write sleep for
+// Delay regardless of build tags. This is useful to emulate
+// throttling in tests, e.g., only for specific connections.
+type ShapingDialer struct {
+	Dialer
+	Delay time.Duration
+}
+
+// DialContext implements Dialer.DialContext
+func (d ShapingDialer) DialContext(
+	ctx context.Context, network, address string) (net.Conn, error) {
+	conn, err := d.Dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	delay := d.Delay
+	if delay <= 0 {
+		delay = defaultShapingDelay
+	}
+	if delay <= 0 {
+		return conn, nil
+	}
+	return &shapingConn{Conn: conn, delay: delay}, nil
+}
+
+type shapingConn struct {
+	net.Conn
+	delay time.Duration
+}
+
+func (c shapingConn) Read(p []byte) (int, error) {
+	time.Sleep(c.delay)
+	return c.Conn.Read(p)
+}
+
+func (c shapingConn) Write(p []byte) (int, error) {
+	time.Sleep(c.delay)
+	return c.Conn.Write(p)
+}
@@ -1,9 +1,11 @@
 package dialer_test
 
 import (
+	"context"
 	"net"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/ooni/probe-engine/netx"
 	"github.com/ooni/probe-engine/netx/dialer"
@@ -25,3 +27,31 @@ func TestIntegration(t *testing.T) {
 	}
 	resp.Body.Close()
 }
+
+func TestUnitShapingDialerWithDelay(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			conn.Write([]byte("antani"))
+			conn.Close()
+		}
+	}()
+	d := dialer.ShapingDialer{Dialer: new(net.Dialer), Delay: 100 * time.Millisecond}
+	conn, err := d.DialContext(context.Background(), "tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	before := time.Now()
+	if _, err := conn.Read(make([]byte, 16)); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(before) < 100*time.Millisecond {
+		t.Fatal("did not delay the read")
+	}
+}
@@ -3,6 +3,7 @@ package dialer
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"net"
 	"time"
 
@@ -102,10 +103,18 @@ func (h EmitterTLSHandshaker) Handshake(
 	return tlsconn, state, err
 }
 
-// TLSDialer is the TLS dialer
+// ErrECHNotSupported indicates that we have been asked to send an
+// Encrypted ClientHello but this build does not support ECH.
+var ErrECHNotSupported = errors.New("dialer: ECH not supported by this build")
+
+// TLSDialer is the TLS dialer. When ECHConfigList is not empty, we use
+// such serialized ECHConfigList (e.g., the one contained by the HTTPS
+// record of the domain) to send an Encrypted ClientHello. Sending ECH
+// requires building with Go >= 1.23 and does not work with uTLS.
 type TLSDialer struct {
 	Config        *tls.Config
 	Dialer        Dialer
+	ECHConfigList []byte
 	TLSHandshaker TLSHandshaker
 }
 
@@ -132,6 +141,12 @@ func (d TLSDialer) DialTLSContext(ctx context.Context, network, address string)
 	if config.ServerName == "" {
 		config.ServerName = host
 	}
+	if len(d.ECHConfigList) > 0 {
+		if err := setECHConfigList(config, d.ECHConfigList); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
 	tlsconn, _, err := d.TLSHandshaker.Handshake(ctx, conn, config)
 	if err != nil {
 		conn.Close()
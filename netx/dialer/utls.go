@@ -0,0 +1,94 @@
+package dialer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+// TLSFingerprints maps the names of the supported TLS fingerprints to
+// the corresponding uTLS ClientHello parrots.
+var TLSFingerprints = map[string]*utls.ClientHelloID{
+	"chrome":     &utls.HelloChrome_Auto,
+	"firefox":    &utls.HelloFirefox_Auto,
+	"ios":        &utls.HelloIOS_Auto,
+	"randomized": &utls.HelloRandomized,
+}
+
+// ErrUnknownTLSFingerprint indicates that we do not know the
+// TLS fingerprint that we have been asked to use.
+var ErrUnknownTLSFingerprint = errors.New("dialer: unknown TLS fingerprint")
+
+// UTLSHandshaker is a TLSHandshaker using uTLS to send a ClientHello
+// that looks like the one of the browser selected by Fingerprint (see
+// TLSFingerprints for the supported values).
+//
+// The ALPN protocols of the ClientHello are the ones in the config rather
+// than the ones of the browser. This allows the caller to avoid negotiating
+// h2, which net/http only supports when the connection is a *tls.Conn.
+type UTLSHandshaker struct {
+	Fingerprint string
+}
+
+// Handshake implements Handshaker.Handshake
+func (h UTLSHandshaker) Handshake(
+	ctx context.Context, conn net.Conn, config *tls.Config,
+) (net.Conn, tls.ConnectionState, error) {
+	clientHelloID, found := TLSFingerprints[h.Fingerprint]
+	if !found {
+		return nil, tls.ConnectionState{}, ErrUnknownTLSFingerprint
+	}
+	uconfig := &utls.Config{
+		RootCAs:            config.RootCAs,
+		NextProtos:         config.NextProtos,
+		ServerName:         config.ServerName,
+		InsecureSkipVerify: config.InsecureSkipVerify,
+		MinVersion:         config.MinVersion,
+		MaxVersion:         config.MaxVersion,
+	}
+	uconn := utls.UClient(conn, uconfig, *clientHelloID)
+	if err := uconn.BuildHandshakeState(); err != nil {
+		return nil, tls.ConnectionState{}, err
+	}
+	if len(config.NextProtos) > 0 {
+		// Implementation note: applying the preset may have changed the
+		// NextProtos of the config, which uTLS uses to check the ALPN
+		// protocol selected by the server, so we restore them.
+		uconfig.NextProtos = config.NextProtos
+		for _, ext := range uconn.Extensions {
+			if alpn, ok := ext.(*utls.ALPNExtension); ok {
+				alpn.AlpnProtocols = config.NextProtos
+			}
+		}
+		if err := uconn.MarshalClientHello(); err != nil {
+			return nil, tls.ConnectionState{}, err
+		}
+	}
+	if err := uconn.Handshake(); err != nil {
+		return nil, tls.ConnectionState{}, err
+	}
+	return uconn, newConnectionState(uconn.ConnectionState()), nil
+}
+
+// newConnectionState converts the uTLS connection state into
+// the equivalent crypto/tls connection state.
+func newConnectionState(s utls.ConnectionState) tls.ConnectionState {
+	return tls.ConnectionState{
+		Version:                     s.Version,
+		HandshakeComplete:           s.HandshakeComplete,
+		DidResume:                   s.DidResume,
+		CipherSuite:                 s.CipherSuite,
+		NegotiatedProtocol:          s.NegotiatedProtocol,
+		NegotiatedProtocolIsMutual:  s.NegotiatedProtocolIsMutual,
+		ServerName:                  s.ServerName,
+		PeerCertificates:            s.PeerCertificates,
+		VerifiedChains:              s.VerifiedChains,
+		SignedCertificateTimestamps: s.SignedCertificateTimestamps,
+		OCSPResponse:                s.OCSPResponse,
+	}
+}
+
+var _ TLSHandshaker = UTLSHandshaker{}
@@ -0,0 +1,76 @@
+package dialer_test
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ooni/probe-engine/netx/dialer"
+)
+
+func TestUnitUTLSHandshakerUnknownFingerprint(t *testing.T) {
+	h := dialer.UTLSHandshaker{Fingerprint: "antani"}
+	conn, _, err := h.Handshake(context.Background(), dialer.EOFConn{}, &tls.Config{
+		ServerName: "x.org",
+	})
+	if !errors.Is(err, dialer.ErrUnknownTLSFingerprint) {
+		t.Fatal("not the error that we expected")
+	}
+	if conn != nil {
+		t.Fatal("expected nil con here")
+	}
+}
+
+func TestUnitUTLSHandshakerEOFError(t *testing.T) {
+	h := dialer.UTLSHandshaker{Fingerprint: "chrome"}
+	conn, _, err := h.Handshake(context.Background(), dialer.EOFConn{}, &tls.Config{
+		ServerName: "x.org",
+	})
+	if !errors.Is(err, io.EOF) {
+		t.Fatal("not the error that we expected")
+	}
+	if conn != nil {
+		t.Fatal("expected nil con here")
+	}
+}
+
+func TestUnitUTLSHandshakerHonoursNextProtos(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {}))
+	server.EnableHTTP2 = true
+	server.TLS = &tls.Config{NextProtos: []string{"h2", "http/1.1"}}
+	server.StartTLS()
+	defer server.Close()
+	for name := range dialer.TLSFingerprints {
+		t.Run(name, func(t *testing.T) {
+			tcpconn, err := net.Dial("tcp", server.Listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tcpconn.Close()
+			h := dialer.UTLSHandshaker{Fingerprint: name}
+			conn, state, err := h.Handshake(context.Background(), tcpconn, &tls.Config{
+				InsecureSkipVerify: true,
+				NextProtos:         []string{"http/1.1"},
+				ServerName:         "example.com",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if conn == nil {
+				t.Fatal("expected non-nil conn here")
+			}
+			if state.NegotiatedProtocol != "http/1.1" {
+				t.Fatal("not the protocol we expected")
+			}
+			if len(state.PeerCertificates) <= 0 {
+				t.Fatal("expected some peer certificates")
+			}
+		})
+	}
+}
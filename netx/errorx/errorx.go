@@ -22,6 +22,9 @@ const (
 	// FailureDNSNXDOMAINError means we got NXDOMAIN in DNS reply.
 	FailureDNSNXDOMAINError = "dns_nxdomain_error"
 
+	// FailureDNSSECBogusError means the DNS reply failed DNSSEC validation.
+	FailureDNSSECBogusError = "dns_dnssec_bogus_error"
+
 	// FailureEOFError means we got unexpected EOF on connection.
 	FailureEOFError = "eof_error"
 
@@ -41,6 +44,10 @@ const (
 	// sort of errors causing it to be invalid.
 	FailureSSLInvalidCertificate = "ssl_invalid_certificate"
 
+	// FailureSSLECHRejected means the server did not accept the
+	// Encrypted ClientHello we sent during the TLS handshake.
+	FailureSSLECHRejected = "ssl_ech_rejected"
+
 	// FailureJSONParseError indicates that we couldn't parse a JSON
 	FailureJSONParseError = "json_parse_error"
 )
@@ -55,6 +62,9 @@ const (
 	// TLSHandshakeOperation is the TLS handshake
 	TLSHandshakeOperation = "tls_handshake"
 
+	// QUICHandshakeOperation is the QUIC handshake
+	QUICHandshakeOperation = "quic_handshake"
+
 	// HTTPRoundTripOperation is the HTTP round trip
 	HTTPRoundTripOperation = "http_round_trip"
 
@@ -67,6 +77,12 @@ const (
 	// WriteOperation is when we write to a socket
 	WriteOperation = "write"
 
+	// ReadFromOperation is when we read from an UDP socket
+	ReadFromOperation = "read_from"
+
+	// WriteToOperation is when we write to an UDP socket
+	WriteToOperation = "write_to"
+
 	// UnknownOperation is when we cannot determine the operation
 	UnknownOperation = "unknown"
 
@@ -80,6 +96,10 @@ const (
 // to tell this library to return an error when a bogon is found.
 var ErrDNSBogon = errors.New("dns: detected bogon address")
 
+// ErrDNSSECBogus indicates that a DNS reply failed DNSSEC validation
+// and hence has most likely been forged.
+var ErrDNSSECBogus = errors.New("dns: DNSSEC validation failed")
+
 // ErrWrapper is our error wrapper for Go errors. The key objective of
 // this structure is to properly set Failure, which is also returned by
 // the Error() method, so be one of the OONI defined strings.
@@ -104,6 +124,7 @@ type ErrWrapper struct {
 	// - ResolveOperation: resolving a domain name failed
 	// - ConnectOperation: connecting to an IP failed
 	// - TLSHandshakeOperation: TLS handshaking failed
+	// - QUICHandshakeOperation: QUIC handshaking failed
 	// - HTTPRoundTripOperation: other errors during round trip
 	//
 	// Because a network connection doesn't necessarily know
@@ -113,6 +134,8 @@ type ErrWrapper struct {
 	// - CloseOperation: CLOSE failed
 	// - ReadOperation: READ failed
 	// - WriteOperation: WRITE failed
+	// - ReadFromOperation: READ_FROM failed
+	// - WriteToOperation: WRITE_TO failed
 	//
 	// If an ErrWrapper referring to a major operation is wrapping
 	// another ErrWrapper and such ErrWrapper already refers to
@@ -186,6 +209,9 @@ func toFailureString(err error) string {
 	if errors.Is(err, ErrDNSBogon) {
 		return FailureDNSBogonError // not in MK
 	}
+	if errors.Is(err, ErrDNSSECBogus) {
+		return FailureDNSSECBogusError // not in MK
+	}
 	if errors.Is(err, context.Canceled) {
 		return FailureInterrupted
 	}
@@ -232,12 +258,25 @@ func toFailureString(err error) string {
 	if strings.HasSuffix(s, "TLS handshake timeout") {
 		return FailureGenericTimeoutError
 	}
+	if strings.HasSuffix(s, "no recent network activity") {
+		// This is the idle timeout error returned by quic-go
+		return FailureGenericTimeoutError
+	}
+	if strings.HasSuffix(s, "handshake did not complete in time") {
+		// This is the handshake timeout error returned by quic-go
+		return FailureGenericTimeoutError
+	}
 	if strings.HasSuffix(s, "no such host") {
 		// This is dns_lookup_error in MK but such error is used as a
 		// generic "hey, the lookup failed" error. Instead, this error
 		// that we return here is significantly more specific.
 		return FailureDNSNXDOMAINError
 	}
+	if strings.HasSuffix(s, "tls: server rejected ECH") {
+		// This is the error returned by crypto/tls when the server does
+		// not accept our ECH, which is not in MK.
+		return FailureSSLECHRejected
+	}
 
 	formatted := fmt.Sprintf("unknown_failure: %s", s)
 	return Scrub(formatted) // scrub IP addresses in the error
@@ -260,6 +299,9 @@ func toOperationString(err error, operation string) string {
 		if errwrapper.Operation == TLSHandshakeOperation {
 			return errwrapper.Operation
 		}
+		if errwrapper.Operation == QUICHandshakeOperation {
+			return errwrapper.Operation
+		}
 		// FALLTHROUGH
 	}
 	return operation
@@ -53,6 +53,11 @@ func TestToFailureString(t *testing.T) {
 			t.Fatal("unexpected result")
 		}
 	})
+	t.Run("for ErrDNSSECBogus", func(t *testing.T) {
+		if toFailureString(ErrDNSSECBogus) != FailureDNSSECBogusError {
+			t.Fatal("unexpected result")
+		}
+	})
 	t.Run("for context.Canceled", func(t *testing.T) {
 		if toFailureString(context.Canceled) != FailureInterrupted {
 			t.Fatal("unexpected result")
@@ -129,6 +134,18 @@ func TestToFailureString(t *testing.T) {
 			t.Fatal("unexpected results")
 		}
 	})
+	t.Run("for QUIC idle timeout error", func(t *testing.T) {
+		err := errors.New("timeout: no recent network activity")
+		if toFailureString(err) != FailureGenericTimeoutError {
+			t.Fatal("unexpected results")
+		}
+	})
+	t.Run("for QUIC handshake timeout error", func(t *testing.T) {
+		err := errors.New("timeout: handshake did not complete in time")
+		if toFailureString(err) != FailureGenericTimeoutError {
+			t.Fatal("unexpected results")
+		}
+	})
 	t.Run("for no such host", func(t *testing.T) {
 		if toFailureString(&net.DNSError{
 			Err: "no such host",
@@ -136,6 +153,11 @@ func TestToFailureString(t *testing.T) {
 			t.Fatal("unexpected results")
 		}
 	})
+	t.Run("for ECH rejected", func(t *testing.T) {
+		if toFailureString(errors.New("tls: server rejected ECH")) != FailureSSLECHRejected {
+			t.Fatal("unexpected results")
+		}
+	})
 	t.Run("for errors including IPv4 address", func(t *testing.T) {
 		input := errors.New("read tcp 10.0.2.15:56948->93.184.216.34:443: use of closed network connection")
 		expected := "unknown_failure: read tcp [scrubbed]->[scrubbed]: use of closed network connection"
@@ -187,6 +209,14 @@ func TestUnitToOperationString(t *testing.T) {
 			t.Fatal("unexpected result")
 		}
 	})
+	t.Run("for quic_handshake", func(t *testing.T) {
+		// You're doing HTTP/3 and the QUIC handshake fails. You want
+		// to know about a QUIC handshake error.
+		err := &ErrWrapper{Operation: QUICHandshakeOperation}
+		if toOperationString(err, HTTPRoundTripOperation) != QUICHandshakeOperation {
+			t.Fatal("unexpected result")
+		}
+	})
 	t.Run("for minor operation", func(t *testing.T) {
 		// You just noticed that TLS handshake failed and you
 		// have a child error telling you that read failed. Here
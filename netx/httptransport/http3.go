@@ -0,0 +1,48 @@
+//go:build !DISABLE_QUIC
+// +build !DISABLE_QUIC
+
+package httptransport
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/http3"
+)
+
+// QUICDialer is the definition of a QUIC dialer assumed by this package.
+type QUICDialer interface {
+	DialContext(ctx context.Context, network, address string,
+		tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlySession, error)
+}
+
+// HTTP3Transport is a transport using HTTP/3 on top of QUIC.
+type HTTP3Transport struct {
+	http3.RoundTripper
+}
+
+// CloseIdleConnections closes all the connections opened by this transport.
+func (t *HTTP3Transport) CloseIdleConnections() {
+	t.RoundTripper.Close()
+}
+
+// NewHTTP3Transport creates a new HTTP3Transport instance using the
+// specified QUIC dialer and TLS config.
+func NewHTTP3Transport(dialer QUICDialer, tlsConfig *tls.Config) *HTTP3Transport {
+	return &HTTP3Transport{RoundTripper: http3.RoundTripper{
+		// See the comment in NewSystemTransport.
+		DisableCompression: true,
+		Dial: func(network, address string, tlsCfg *tls.Config,
+			cfg *quic.Config) (quic.EarlySession, error) {
+			// Implementation note: quic-go does not pass us the context
+			// of the request here, hence we use a background one.
+			return dialer.DialContext(context.Background(), network, address, tlsCfg, cfg)
+		},
+		TLSClientConfig: tlsConfig,
+	}}
+}
+
+var _ RoundTripper = &HTTP3Transport{}
+var _ http.RoundTripper = &HTTP3Transport{}
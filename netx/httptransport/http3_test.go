@@ -0,0 +1,38 @@
+//go:build !DISABLE_QUIC
+// +build !DISABLE_QUIC
+
+package httptransport_test
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/ooni/probe-engine/netx/httptransport"
+)
+
+type fakeQUICDialer struct {
+	err error
+}
+
+func (d fakeQUICDialer) DialContext(ctx context.Context, network, address string,
+	tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlySession, error) {
+	return nil, d.err
+}
+
+func TestHTTP3TransportUsesDialer(t *testing.T) {
+	expected := errors.New("mocked error")
+	txp := httptransport.NewHTTP3Transport(fakeQUICDialer{err: expected}, &tls.Config{})
+	client := &http.Client{Transport: txp}
+	resp, err := client.Get("https://www.google.com")
+	if !errors.Is(err, expected) {
+		t.Fatal("not the error we expected", err)
+	}
+	if resp != nil {
+		t.Fatal("not the response we expected")
+	}
+	client.CloseIdleConnections()
+}
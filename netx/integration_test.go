@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/apex/log"
+	"github.com/miekg/dns"
 	"github.com/ooni/probe-engine/netx"
 	"github.com/ooni/probe-engine/netx/bytecounter"
 	"github.com/ooni/probe-engine/netx/errorx"
@@ -91,3 +92,26 @@ func TestIntegrationBogonResolutionNotBroken(t *testing.T) {
 		t.Fatal("address was not returned")
 	}
 }
+
+func TestIntegrationLookupRecords(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+	saver := &trace.Saver{}
+	dnsclient, err := netx.NewDNSClient(
+		netx.Config{ResolveSaver: saver}, "dot://dns.google")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dnsclient.CloseIdleConnections()
+	records, err := dnsclient.LookupRecords(context.Background(), "google.com", dns.TypeMX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) <= 0 {
+		t.Fatal("expected some records")
+	}
+	if ev := saver.Read(); len(ev) != 2 {
+		t.Fatal("expected a query and a reply event")
+	}
+}
@@ -11,7 +11,8 @@
 // By default, this library uses the system resolver. In addition, it
 // is possible to configure alternative DNS transports and remote
 // servers. We support DNS over UDP, DNS over TCP, DNS over TLS (DoT),
-// and DNS over HTTPS (DoH). When using an alternative transport, we
+// DNS over HTTPS (DoH), DNS over QUIC (DoQ), and DNS over HTTP/3 (DoH3).
+// When using an alternative transport, we
 // are also able to intercept and save DNS messages, as well as any
 // other interaction with the remote server (e.g., the result of the
 // TLS handshake for DoT and DoH).
@@ -30,11 +31,14 @@ import (
 	"net/http"
 	"net/url"
 
+	"github.com/miekg/dns"
 	"github.com/ooni/probe-engine/internal/runtimex"
 	"github.com/ooni/probe-engine/netx/bytecounter"
 	"github.com/ooni/probe-engine/netx/dialer"
+	"github.com/ooni/probe-engine/netx/errorx"
 	"github.com/ooni/probe-engine/netx/gocertifi"
 	"github.com/ooni/probe-engine/netx/httptransport"
+	"github.com/ooni/probe-engine/netx/replay"
 	"github.com/ooni/probe-engine/netx/resolver"
 	"github.com/ooni/probe-engine/netx/selfcensor"
 	"github.com/ooni/probe-engine/netx/trace"
@@ -81,18 +85,25 @@ type Config struct {
 	CacheResolutions    bool                 // default: no caching
 	ContextByteCounting bool                 // default: no implicit byte counting
 	DNSCache            map[string][]string  // default: cache is empty
+	DNSSECValidation    bool                 // default: no DNSSEC validation
 	DialSaver           *trace.Saver         // default: not saving dials
 	Dialer              Dialer               // default: dialer.DNSDialer
+	ECHConfigList       []byte               // default: do not send ECH
 	FullResolver        Resolver             // default: base resolver + goodies
+	HTTP3Enabled        bool                 // default: disabled
 	HTTPSaver           *trace.Saver         // default: not saving HTTP
 	Logger              Logger               // default: no logging
 	NoTLSVerify         bool                 // default: perform TLS verify
 	ProxyURL            *url.URL             // default: no proxy
 	ReadWriteSaver      *trace.Saver         // default: not saving read/write
+	Recorder            *replay.Recorder     // default: not recording
+	Replayer            *replay.Replayer     // default: not replaying
 	ResolveSaver        *trace.Saver         // default: not saving resolves
 	TLSConfig           *tls.Config          // default: attempt using h2
 	TLSDialer           TLSDialer            // default: dialer.TLSDialer
+	TLSFingerprint      string               // default: use crypto/tls
 	TLSSaver            *trace.Saver         // defaukt: not saving TLS
+	TTLCache            *resolver.TTLCache   // default: no TTL cache
 }
 
 type tlsHandshaker interface {
@@ -114,7 +125,16 @@ func NewResolver(config Config) Resolver {
 	if config.BaseResolver == nil {
 		config.BaseResolver = resolver.SystemResolver{}
 	}
+	if config.Replayer != nil {
+		config.BaseResolver = replay.PlaybackResolver{Replayer: config.Replayer}
+	}
 	var r Resolver = config.BaseResolver
+	if config.Recorder != nil {
+		r = replay.RecordingResolver{Resolver: r, Recorder: config.Recorder}
+	}
+	if config.TTLCache != nil {
+		r = resolver.TTLCacheResolver{Resolver: r, Cache: config.TTLCache}
+	}
 	if config.CacheResolutions {
 		r = &resolver.CacheResolver{Resolver: r}
 	}
@@ -145,6 +165,12 @@ func NewDialer(config Config) Dialer {
 		config.FullResolver = NewResolver(config)
 	}
 	var d Dialer = selfcensor.SystemDialer{}
+	if config.Replayer != nil {
+		d = replay.PlaybackDialer{Replayer: config.Replayer}
+	}
+	if config.Recorder != nil {
+		d = replay.RecordingDialer{Dialer: d, Recorder: config.Recorder}
+	}
 	d = dialer.TimeoutDialer{Dialer: d}
 	d = dialer.ErrorWrapperDialer{Dialer: d}
 	if config.Logger != nil {
@@ -165,19 +191,36 @@ func NewDialer(config Config) Dialer {
 	return d
 }
 
-// NewTLSDialer creates a new TLSDialer from the specified config
+// NewTLSDialer creates a new TLSDialer from the specified config. When
+// config.TLSFingerprint is not empty, we use uTLS to send a ClientHello
+// using such fingerprint (see dialer.TLSFingerprints). Otherwise, when
+// config.ECHConfigList is not empty, we send an Encrypted ClientHello
+// using such ECHConfigList (see LookupECHConfigList).
 func NewTLSDialer(config Config) TLSDialer {
 	if config.Dialer == nil {
 		config.Dialer = NewDialer(config)
 	}
 	var h tlsHandshaker = dialer.SystemTLSHandshaker{}
+	if config.TLSFingerprint != "" {
+		h = dialer.UTLSHandshaker{Fingerprint: config.TLSFingerprint}
+	}
+	if config.Replayer != nil {
+		h = replay.PlaybackTLSHandshaker{Replayer: config.Replayer}
+	}
+	if config.Recorder != nil {
+		h = replay.RecordingTLSHandshaker{TLSHandshaker: h, Recorder: config.Recorder}
+	}
 	h = dialer.TimeoutTLSHandshaker{TLSHandshaker: h}
 	h = dialer.ErrorWrapperTLSHandshaker{TLSHandshaker: h}
 	if config.Logger != nil {
 		h = dialer.LoggingTLSHandshaker{Logger: config.Logger, TLSHandshaker: h}
 	}
 	if config.TLSSaver != nil {
-		h = dialer.SaverTLSHandshaker{TLSHandshaker: h, Saver: config.TLSSaver}
+		h = dialer.SaverTLSHandshaker{
+			TLSHandshaker: h,
+			Fingerprint:   config.TLSFingerprint,
+			Saver:         config.TLSSaver,
+		}
 	}
 	if config.TLSConfig == nil {
 		config.TLSConfig = &tls.Config{NextProtos: []string{"h2", "http/1.1"}}
@@ -187,21 +230,37 @@ func NewTLSDialer(config Config) TLSDialer {
 	return dialer.TLSDialer{
 		Config:        config.TLSConfig,
 		Dialer:        config.Dialer,
+		ECHConfigList: config.ECHConfigList,
 		TLSHandshaker: h,
 	}
 }
 
 // NewHTTPTransport creates a new HTTPRoundTripper. You can further extend the returned
 // HTTPRoundTripper before wrapping it into an http.Client.
+//
+// When config.HTTP3Enabled is true, we use HTTP/3 on top of QUIC. In such
+// case, we ignore config.ProxyURL. If we are built with the DISABLE_QUIC
+// tag, the returned HTTPRoundTripper fails with ErrQUICNotSupported.
+//
+// When config.TLSFingerprint is not empty, we only use HTTP/1.1, because
+// net/http cannot use h2 unless the connection is a *tls.Conn. For the
+// same reason, we only use HTTP/1.1 when recording or replaying.
 func NewHTTPTransport(config Config) HTTPRoundTripper {
-	if config.Dialer == nil {
-		config.Dialer = NewDialer(config)
-	}
-	if config.TLSDialer == nil {
-		config.TLSDialer = NewTLSDialer(config)
-	}
 	var txp HTTPRoundTripper
-	txp = httptransport.NewSystemTransport(config.Dialer, config.TLSDialer)
+	if config.HTTP3Enabled {
+		txp = newHTTP3Transport(config)
+	} else {
+		if config.Dialer == nil {
+			config.Dialer = NewDialer(config)
+		}
+		if config.TLSDialer == nil {
+			if config.TLSFingerprint != "" || config.Recorder != nil || config.Replayer != nil {
+				config.TLSConfig = newHTTP11TLSConfig(config)
+			}
+			config.TLSDialer = NewTLSDialer(config)
+		}
+		txp = httptransport.NewSystemTransport(config.Dialer, config.TLSDialer)
+	}
 	if config.ByteCounter != nil {
 		txp = httptransport.ByteCountingTransport{
 			Counter: config.ByteCounter, RoundTripper: txp}
@@ -223,6 +282,17 @@ func NewHTTPTransport(config Config) HTTPRoundTripper {
 	return txp
 }
 
+// newHTTP11TLSConfig returns a copy of the TLS config that
+// only allows us to negotiate HTTP/1.1 using ALPN.
+func newHTTP11TLSConfig(config Config) *tls.Config {
+	tlsConfig := new(tls.Config)
+	if config.TLSConfig != nil {
+		tlsConfig = config.TLSConfig.Clone()
+	}
+	tlsConfig.NextProtos = []string{"http/1.1"}
+	return tlsConfig
+}
+
 // DNSClient is a DNS client. It wraps a Resolver and it possibly
 // also wraps an HTTP client, but only when we're using DoH.
 type DNSClient struct {
@@ -235,6 +305,79 @@ func (c DNSClient) CloseIdleConnections() {
 	if c.httpClient != nil {
 		c.httpClient.CloseIdleConnections()
 	}
+	if race, ok := c.Resolver.(resolver.RaceResolver); ok {
+		race.CloseIdleConnections()
+	}
+}
+
+// LookupRecords returns the records of type qtype (e.g. dns.TypeTXT)
+// for domain. See the LookupRecords function for more information.
+func (c DNSClient) LookupRecords(
+	ctx context.Context, domain string, qtype uint16) ([]dns.RR, error) {
+	return LookupRecords(ctx, c.Resolver, domain, qtype)
+}
+
+// ErrQUICNotSupported indicates that we cannot use QUIC because we
+// have been built with the DISABLE_QUIC tag. We need such tag to build
+// using Go >= 1.15, because our QUIC library does not support it.
+var ErrQUICNotSupported = errors.New("netx: built without QUIC support")
+
+// ErrLookupRecordsNotSupported indicates that a resolver is not
+// able to look up records of arbitrary type.
+var ErrLookupRecordsNotSupported = errors.New("netx: resolver cannot look up records")
+
+// LookupRecords uses r to look up the records of type qtype for domain.
+// This operation requires r to be the Resolver of a DNSClient that sends
+// its own DNS queries. Hence, it fails with ErrLookupRecordsNotSupported
+// when using the system resolver or racing several resolvers. Any other
+// error is wrapped like the ones returned by NewResolver's resolvers.
+//
+// If config.ResolveSaver was not nil when creating the DNSClient, the
+// DNS round trips are saved like the ones performed by LookupHost.
+func LookupRecords(
+	ctx context.Context, r Resolver, domain string, qtype uint16) ([]dns.RR, error) {
+	rr, ok := r.(resolver.RecordsResolver)
+	if !ok {
+		return nil, ErrLookupRecordsNotSupported
+	}
+	records, err := rr.LookupRecords(ctx, domain, qtype)
+	err = errorx.SafeErrWrapperBuilder{
+		Error:     err,
+		Operation: errorx.ResolveOperation,
+	}.MaybeBuild()
+	return records, err
+}
+
+// LookupECHConfigList uses r to look up the HTTPS records of domain and
+// returns the first ECHConfigList they contain, which you can use as the
+// ECHConfigList of Config. See LookupRecords for the requirements on r.
+func LookupECHConfigList(ctx context.Context, r Resolver, domain string) ([]byte, error) {
+	records, err := LookupRecords(ctx, r, domain, resolver.TypeHTTPS)
+	if err != nil {
+		return nil, err
+	}
+	return resolver.ECHConfigList(records)
+}
+
+// NewDNSClientRace creates a new DNS client that sends each query to all
+// the resolvers described by URLs at the same time and returns the first
+// successful answer. See NewDNSClient for the format of each URL.
+//
+// If config.ResolveSaver is not nil, we will also save the events
+// describing the race, which include the winner and the time taken by
+// each resolver to complete the lookup. The archival DNS queries
+// include the duration of the race and whether they won it.
+func NewDNSClientRace(config Config, URLs []string) (DNSClient, error) {
+	race := resolver.RaceResolver{Saver: config.ResolveSaver}
+	for _, URL := range URLs {
+		c, err := NewDNSClient(config, URL)
+		if err != nil {
+			race.CloseIdleConnections()
+			return DNSClient{}, err
+		}
+		race.Resolvers = append(race.Resolvers, c)
+	}
+	return DNSClient{Resolver: race}, nil
 }
 
 // NewDNSClient creates a new DNS client. The config argument is used to
@@ -250,6 +393,15 @@ func (c DNSClient) CloseIdleConnections() {
 // - if the URL starts with `udp://`, then we create a client using
 // a resolver that uses the specified UDP endpoint.
 //
+// - if the URL starts with `doq://`, then we create a DNS over QUIC
+// client using the specified endpoint (the default port is 853).
+//
+// - if the URL starts with `h3://`, then we create a DNS over HTTP/3
+// client using the URL obtained by replacing `h3` with `https`.
+//
+// We fail with ErrQUICNotSupported when creating a DNS over QUIC or DNS
+// over HTTP/3 client if we are built with the DISABLE_QUIC tag.
+//
 // We return error if the URL does not parse or the URL scheme does not
 // fall into one of the cases described above.
 //
@@ -259,6 +411,17 @@ func NewDNSClient(config Config, URL string) (DNSClient, error) {
 	return NewDNSClientWithOverrides(config, URL, "", "")
 }
 
+// newResolverForTransport creates the resolver using the given
+// transport, which validates DNSSEC when the config says so.
+func newResolverForTransport(config Config, txp resolver.RoundTripper) Resolver {
+	if config.DNSSECValidation {
+		r := resolver.NewDNSSECResolver(txp)
+		r.Saver = config.ResolveSaver
+		return r
+	}
+	return resolver.NewSerialResolver(txp)
+}
+
 // NewDNSClientWithOverrides creates a new DNS client, similar to NewDNSClient,
 // with the option to override the default Hostname and SNI.
 func NewDNSClientWithOverrides(config Config, URL, hostOverride, SNIOverride string) (DNSClient, error) {
@@ -282,6 +445,9 @@ func NewDNSClientWithOverrides(config Config, URL, hostOverride, SNIOverride str
 	}
 	switch resolverURL.Scheme {
 	case "system":
+		if config.DNSSECValidation {
+			return c, errors.New("the system resolver cannot validate DNSSEC")
+		}
 		c.Resolver = resolver.SystemResolver{}
 		return c, nil
 	case "https":
@@ -294,7 +460,7 @@ func NewDNSClientWithOverrides(config Config, URL, hostOverride, SNIOverride str
 				Saver:        config.ResolveSaver,
 			}
 		}
-		c.Resolver = resolver.NewSerialResolver(txp)
+		c.Resolver = newResolverForTransport(config, txp)
 		return c, nil
 	case "udp":
 		dialer := NewDialer(config)
@@ -305,7 +471,7 @@ func NewDNSClientWithOverrides(config Config, URL, hostOverride, SNIOverride str
 				Saver:        config.ResolveSaver,
 			}
 		}
-		c.Resolver = resolver.NewSerialResolver(txp)
+		c.Resolver = newResolverForTransport(config, txp)
 		return c, nil
 	case "dot":
 		tlsDialer := NewTLSDialer(config)
@@ -321,7 +487,7 @@ func NewDNSClientWithOverrides(config Config, URL, hostOverride, SNIOverride str
 				Saver:        config.ResolveSaver,
 			}
 		}
-		c.Resolver = resolver.NewSerialResolver(txp)
+		c.Resolver = newResolverForTransport(config, txp)
 		return c, nil
 	case "tcp":
 		dialer := NewDialer(config)
@@ -333,7 +499,41 @@ func NewDNSClientWithOverrides(config Config, URL, hostOverride, SNIOverride str
 				Saver:        config.ResolveSaver,
 			}
 		}
-		c.Resolver = resolver.NewSerialResolver(txp)
+		c.Resolver = newResolverForTransport(config, txp)
+		return c, nil
+	case "doq":
+		endpoint, err := makeEndpointForDoT(resolverURL)
+		if err != nil {
+			return c, err
+		}
+		txp, err := newDNSOverQUIC(config, endpoint)
+		if err != nil {
+			return c, err
+		}
+		if config.ResolveSaver != nil {
+			txp = resolver.SaverDNSTransport{
+				RoundTripper: txp,
+				Saver:        config.ResolveSaver,
+			}
+		}
+		c.Resolver = newResolverForTransport(config, txp)
+		return c, nil
+	case "h3":
+		if !quicSupported {
+			return c, ErrQUICNotSupported
+		}
+		resolverURL.Scheme = "https"
+		config.HTTP3Enabled = true
+		c.httpClient = &http.Client{Transport: NewHTTPTransport(config)}
+		var txp resolver.RoundTripper = resolver.NewDNSOverHTTP3WithHostOverride(
+			c.httpClient, resolverURL.String(), hostOverride)
+		if config.ResolveSaver != nil {
+			txp = resolver.SaverDNSTransport{
+				RoundTripper: txp,
+				Saver:        config.ResolveSaver,
+			}
+		}
+		c.Resolver = newResolverForTransport(config, txp)
 		return c, nil
 	default:
 		return c, errors.New("unsupported resolver scheme")
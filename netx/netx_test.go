@@ -1,16 +1,20 @@
 package netx_test
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 
 	"github.com/apex/log"
+	"github.com/miekg/dns"
 	"github.com/ooni/probe-engine/netx"
 	"github.com/ooni/probe-engine/netx/bytecounter"
 	"github.com/ooni/probe-engine/netx/dialer"
+	"github.com/ooni/probe-engine/netx/errorx"
 	"github.com/ooni/probe-engine/netx/httptransport"
 	"github.com/ooni/probe-engine/netx/resolver"
 	"github.com/ooni/probe-engine/netx/selfcensor"
@@ -209,6 +213,36 @@ func TestNewResolverWithPrefilledReadonlyCache(t *testing.T) {
 	}
 }
 
+func TestNewResolverWithTTLCache(t *testing.T) {
+	cache := new(resolver.TTLCache)
+	r := netx.NewResolver(netx.Config{
+		TTLCache: cache,
+	})
+	ir, ok := r.(resolver.IDNAResolver)
+	if !ok {
+		t.Fatal("not the resolver we expected")
+	}
+	ar, ok := ir.Resolver.(resolver.AddressResolver)
+	if !ok {
+		t.Fatal("not the resolver we expected")
+	}
+	ewr, ok := ar.Resolver.(resolver.ErrorWrapperResolver)
+	if !ok {
+		t.Fatal("not the resolver we expected")
+	}
+	tr, ok := ewr.Resolver.(resolver.TTLCacheResolver)
+	if !ok {
+		t.Fatal("not the resolver we expected")
+	}
+	if tr.Cache != cache {
+		t.Fatal("not the cache we expected")
+	}
+	_, ok = tr.Resolver.(resolver.SystemResolver)
+	if !ok {
+		t.Fatal("not the resolver we expected")
+	}
+}
+
 func TestNewDialerVanilla(t *testing.T) {
 	d := netx.NewDialer(netx.Config{})
 	sd, ok := d.(dialer.ShapingDialer)
@@ -666,6 +700,40 @@ func TestNewTLSDialerWithSaver(t *testing.T) {
 	}
 }
 
+func TestNewTLSDialerWithTLSFingerprint(t *testing.T) {
+	saver := new(trace.Saver)
+	td := netx.NewTLSDialer(netx.Config{
+		TLSFingerprint: "chrome",
+		TLSSaver:       saver,
+	})
+	rtd, ok := td.(dialer.TLSDialer)
+	if !ok {
+		t.Fatal("not the TLSDialer we expected")
+	}
+	sth, ok := rtd.TLSHandshaker.(dialer.SaverTLSHandshaker)
+	if !ok {
+		t.Fatal("not the TLSHandshaker we expected")
+	}
+	if sth.Fingerprint != "chrome" {
+		t.Fatal("not the Fingerprint we expected")
+	}
+	ewth, ok := sth.TLSHandshaker.(dialer.ErrorWrapperTLSHandshaker)
+	if !ok {
+		t.Fatal("not the TLSHandshaker we expected")
+	}
+	tth, ok := ewth.TLSHandshaker.(dialer.TimeoutTLSHandshaker)
+	if !ok {
+		t.Fatal("not the TLSHandshaker we expected")
+	}
+	uth, ok := tth.TLSHandshaker.(dialer.UTLSHandshaker)
+	if !ok {
+		t.Fatal("not the TLSHandshaker we expected")
+	}
+	if uth.Fingerprint != "chrome" {
+		t.Fatal("not the Fingerprint we expected")
+	}
+}
+
 func TestNewTLSDialerWithNoTLSVerifyAndConfig(t *testing.T) {
 	td := netx.NewTLSDialer(netx.Config{
 		TLSConfig:   new(tls.Config),
@@ -803,6 +871,41 @@ func TestNewWithTLSDialer(t *testing.T) {
 	}
 }
 
+func TestNewWithTLSFingerprintUsesHTTP11(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {}))
+	server.EnableHTTP2 = true
+	server.TLS = &tls.Config{NextProtos: []string{"h2", "http/1.1"}}
+	server.StartTLS()
+	defer server.Close()
+	saver := new(trace.Saver)
+	txp := netx.NewHTTPTransport(netx.Config{
+		NoTLSVerify:    true,
+		TLSConfig:      &tls.Config{NextProtos: []string{"h2", "http/1.1"}},
+		TLSFingerprint: "chrome",
+		TLSSaver:       saver,
+	})
+	client := &http.Client{Transport: txp}
+	defer client.CloseIdleConnections()
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.ProtoMajor != 1 {
+		t.Fatal("expected HTTP/1.1")
+	}
+	var found bool
+	for _, ev := range saver.Read() {
+		if ev.Name == "tls_handshake_done" {
+			found = ev.TLSFingerprint == "chrome" && ev.TLSNegotiatedProto == "http/1.1"
+		}
+	}
+	if !found {
+		t.Fatal("did not find the expected TLS handshake event")
+	}
+}
+
 func TestNewWithByteCounter(t *testing.T) {
 	counter := bytecounter.New()
 	txp := netx.NewHTTPTransport(netx.Config{
@@ -886,6 +989,40 @@ func TestNewWithSaver(t *testing.T) {
 	}
 }
 
+func TestNewDNSClientRace(t *testing.T) {
+	saver := new(trace.Saver)
+	dnsclient, err := netx.NewDNSClientRace(netx.Config{ResolveSaver: saver},
+		[]string{"doh://google", "udp://8.8.8.8:53", "system:///"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	race, ok := dnsclient.Resolver.(resolver.RaceResolver)
+	if !ok {
+		t.Fatal("not the resolver we expected")
+	}
+	if race.Saver != saver {
+		t.Fatal("not the saver we expected")
+	}
+	if len(race.Resolvers) != 3 {
+		t.Fatal("not the number of resolvers we expected")
+	}
+	if race.Resolvers[0].Network() != "doh" || race.Resolvers[1].Network() != "udp" {
+		t.Fatal("not the resolvers we expected")
+	}
+	dnsclient.CloseIdleConnections()
+}
+
+func TestNewDNSClientRaceInvalidURL(t *testing.T) {
+	dnsclient, err := netx.NewDNSClientRace(
+		netx.Config{}, []string{"doh://google", "\t\t\t"})
+	if err == nil || !strings.HasSuffix(err.Error(), "invalid control character in URL") {
+		t.Fatal("not the error we expected")
+	}
+	if dnsclient.Resolver != nil {
+		t.Fatal("expected nil resolver here")
+	}
+}
+
 func TestNewDNSClientInvalidURL(t *testing.T) {
 	dnsclient, err := netx.NewDNSClient(netx.Config{}, "\t\t\t")
 	if err == nil || !strings.HasSuffix(err.Error(), "invalid control character in URL") {
@@ -920,6 +1057,44 @@ func TestNewDNSClientSystemResolver(t *testing.T) {
 	dnsclient.CloseIdleConnections()
 }
 
+func TestNewDNSClientSystemResolverLookupRecords(t *testing.T) {
+	dnsclient, err := netx.NewDNSClient(
+		netx.Config{}, "system:///")
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := dnsclient.LookupRecords(context.Background(), "x.org", dns.TypeTXT)
+	if !errors.Is(err, netx.ErrLookupRecordsNotSupported) {
+		t.Fatal("not the error we expected")
+	}
+	if records != nil {
+		t.Fatal("expected nil records here")
+	}
+	dnsclient.CloseIdleConnections()
+}
+
+func TestNewDNSClientLookupRecordsWrapsErrors(t *testing.T) {
+	expected := errors.New("mocked error")
+	dnsclient, err := netx.NewDNSClient(netx.Config{
+		Dialer: netx.FakeDialer{Err: expected},
+	}, "dot://8.8.8.8:853")
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := dnsclient.LookupRecords(context.Background(), "x.org", dns.TypeTXT)
+	if !errors.Is(err, expected) {
+		t.Fatal("not the error we expected")
+	}
+	var errWrapper *errorx.ErrWrapper
+	if !errors.As(err, &errWrapper) {
+		t.Fatal("the error has not been wrapped")
+	}
+	if records != nil {
+		t.Fatal("expected nil records here")
+	}
+	dnsclient.CloseIdleConnections()
+}
+
 func TestNewDNSClientEmpty(t *testing.T) {
 	dnsclient, err := netx.NewDNSClient(
 		netx.Config{}, "")
@@ -1038,6 +1213,43 @@ func TestNewDNSClientUDPDNSSaver(t *testing.T) {
 	dnsclient.CloseIdleConnections()
 }
 
+func TestNewDNSClientUDPDNSSECValidation(t *testing.T) {
+	saver := new(trace.Saver)
+	dnsclient, err := netx.NewDNSClient(netx.Config{
+		DNSSECValidation: true,
+		ResolveSaver:     saver,
+	}, "udp://8.8.8.8:53")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, ok := dnsclient.Resolver.(resolver.DNSSECResolver)
+	if !ok {
+		t.Fatal("not the resolver we expected")
+	}
+	if r.Saver != saver {
+		t.Fatal("not the saver we expected")
+	}
+	txp, ok := r.Transport().(resolver.SaverDNSTransport)
+	if !ok {
+		t.Fatal("not the transport we expected")
+	}
+	if _, ok := txp.RoundTripper.(resolver.DNSOverUDP); !ok {
+		t.Fatal("not the transport we expected")
+	}
+	dnsclient.CloseIdleConnections()
+}
+
+func TestNewDNSClientSystemResolverDNSSECValidation(t *testing.T) {
+	dnsclient, err := netx.NewDNSClient(
+		netx.Config{DNSSECValidation: true}, "system:///")
+	if err == nil || err.Error() != "the system resolver cannot validate DNSSEC" {
+		t.Fatal("not the error we expected")
+	}
+	if dnsclient.Resolver != nil {
+		t.Fatal("expected nil resolver here")
+	}
+}
+
 func TestNewDNSClientTCP(t *testing.T) {
 	dnsclient, err := netx.NewDNSClient(
 		netx.Config{}, "tcp://8.8.8.8:53")
@@ -0,0 +1,36 @@
+//go:build DISABLE_QUIC
+// +build DISABLE_QUIC
+
+package netx
+
+import (
+	"net/http"
+
+	"github.com/ooni/probe-engine/netx/resolver"
+)
+
+// quicSupported indicates whether we have been built with QUIC support.
+const quicSupported = false
+
+// quicNotSupportedTransport is the transport that NewHTTPTransport uses
+// for HTTP/3 when we are built without QUIC support.
+type quicNotSupportedTransport struct{}
+
+// RoundTrip implements HTTPRoundTripper.RoundTrip.
+func (quicNotSupportedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, ErrQUICNotSupported
+}
+
+// CloseIdleConnections implements HTTPRoundTripper.CloseIdleConnections.
+func (quicNotSupportedTransport) CloseIdleConnections() {}
+
+// newHTTP3Transport returns a transport that always fails, because
+// we have been built with the DISABLE_QUIC tag.
+func newHTTP3Transport(config Config) HTTPRoundTripper {
+	return quicNotSupportedTransport{}
+}
+
+// newDNSOverQUIC fails because we have been built with the DISABLE_QUIC tag.
+func newDNSOverQUIC(config Config, endpoint string) (resolver.RoundTripper, error) {
+	return nil, ErrQUICNotSupported
+}
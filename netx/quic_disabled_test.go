@@ -0,0 +1,34 @@
+//go:build DISABLE_QUIC
+// +build DISABLE_QUIC
+
+package netx_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/ooni/probe-engine/netx"
+)
+
+func TestNewDNSClientWithoutQUIC(t *testing.T) {
+	for _, URL := range []string{"doq://dns.adguard.com", "h3://dns.google/dns-query"} {
+		_, err := netx.NewDNSClient(netx.Config{}, URL)
+		if !errors.Is(err, netx.ErrQUICNotSupported) {
+			t.Fatal("not the error we expected", URL, err)
+		}
+	}
+}
+
+func TestNewWithHTTP3EnabledWithoutQUIC(t *testing.T) {
+	txp := netx.NewHTTPTransport(netx.Config{HTTP3Enabled: true})
+	client := &http.Client{Transport: txp}
+	resp, err := client.Get("https://www.google.com")
+	if !errors.Is(err, netx.ErrQUICNotSupported) {
+		t.Fatal("not the error we expected", err)
+	}
+	if resp != nil {
+		t.Fatal("not the response we expected")
+	}
+	client.CloseIdleConnections()
+}
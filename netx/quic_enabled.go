@@ -0,0 +1,65 @@
+//go:build !DISABLE_QUIC
+// +build !DISABLE_QUIC
+
+package netx
+
+import (
+	"context"
+	"crypto/tls"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/ooni/probe-engine/netx/httptransport"
+	"github.com/ooni/probe-engine/netx/quicdialer"
+	"github.com/ooni/probe-engine/netx/resolver"
+)
+
+// quicSupported indicates whether we have been built with QUIC support.
+const quicSupported = true
+
+// QUICDialer is the definition of a QUIC dialer assumed by this package.
+type QUICDialer interface {
+	DialContext(ctx context.Context, network, address string,
+		tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlySession, error)
+}
+
+// NewQUICDialer creates a new QUICDialer from the specified config
+func NewQUICDialer(config Config) QUICDialer {
+	if config.FullResolver == nil {
+		config.FullResolver = NewResolver(config)
+	}
+	var d QUICDialer = quicdialer.SystemDialer{Saver: config.ReadWriteSaver}
+	d = quicdialer.ErrorWrapperDialer{ContextDialer: d}
+	if config.Logger != nil {
+		d = quicdialer.LoggingDialer{ContextDialer: d, Logger: config.Logger}
+	}
+	if config.TLSSaver != nil {
+		d = quicdialer.HandshakeSaver{ContextDialer: d, Saver: config.TLSSaver}
+	}
+	d = quicdialer.DNSDialer{Resolver: config.FullResolver, Dialer: d}
+	return d
+}
+
+// newQUICTLSConfig returns the TLS config to use with QUIC. Like we do
+// in NewTLSDialer, we always use our own CA and we honour NoTLSVerify.
+func newQUICTLSConfig(config Config) *tls.Config {
+	tlsConfig := new(tls.Config)
+	if config.TLSConfig != nil {
+		tlsConfig = config.TLSConfig.Clone()
+	}
+	tlsConfig.RootCAs = CertPool // always use our own CA
+	tlsConfig.InsecureSkipVerify = config.NoTLSVerify
+	return tlsConfig
+}
+
+// newHTTP3Transport creates the HTTP/3 transport used by NewHTTPTransport.
+func newHTTP3Transport(config Config) HTTPRoundTripper {
+	return httptransport.NewHTTP3Transport(
+		NewQUICDialer(config), newQUICTLSConfig(config))
+}
+
+// newDNSOverQUIC creates the DNS over QUIC transport used by NewDNSClient.
+func newDNSOverQUIC(config Config, endpoint string) (resolver.RoundTripper, error) {
+	qdialer := NewQUICDialer(config)
+	return resolver.NewDNSOverQUIC(
+		qdialer.DialContext, endpoint, newQUICTLSConfig(config)), nil
+}
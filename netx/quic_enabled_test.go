@@ -0,0 +1,203 @@
+//go:build !DISABLE_QUIC
+// +build !DISABLE_QUIC
+
+package netx_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/ooni/probe-engine/netx"
+	"github.com/ooni/probe-engine/netx/httptransport"
+	"github.com/ooni/probe-engine/netx/quicdialer"
+	"github.com/ooni/probe-engine/netx/resolver"
+	"github.com/ooni/probe-engine/netx/trace"
+)
+
+func TestNewDNSClientDoQ(t *testing.T) {
+	dnsclient, err := netx.NewDNSClient(
+		netx.Config{}, "doq://dns.adguard.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, ok := dnsclient.Resolver.(resolver.SerialResolver)
+	if !ok {
+		t.Fatal("not the resolver we expected")
+	}
+	txp, ok := r.Transport().(resolver.DNSOverQUIC)
+	if !ok {
+		t.Fatal("not the transport we expected")
+	}
+	if txp.Network() != "doq" {
+		t.Fatal("not the Network we expected")
+	}
+	if txp.Address() != "dns.adguard.com:853" {
+		t.Fatal("expected default port to be added")
+	}
+	dnsclient.CloseIdleConnections()
+}
+
+func TestNewDNSClientDoQDNSSaver(t *testing.T) {
+	saver := new(trace.Saver)
+	dnsclient, err := netx.NewDNSClient(
+		netx.Config{ResolveSaver: saver}, "doq://dns.adguard.com:784")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, ok := dnsclient.Resolver.(resolver.SerialResolver)
+	if !ok {
+		t.Fatal("not the resolver we expected")
+	}
+	txp, ok := r.Transport().(resolver.SaverDNSTransport)
+	if !ok {
+		t.Fatal("not the transport we expected")
+	}
+	doquic, ok := txp.RoundTripper.(resolver.DNSOverQUIC)
+	if !ok {
+		t.Fatal("not the transport we expected")
+	}
+	if doquic.Address() != "dns.adguard.com:784" {
+		t.Fatal("not the Address we expected")
+	}
+	dnsclient.CloseIdleConnections()
+}
+
+func TestNewDNSClientBadDoQEndpoint(t *testing.T) {
+	_, err := netx.NewDNSClient(
+		netx.Config{}, "doq://bad:endpoint:853")
+	if err == nil || !strings.Contains(err.Error(), "too many colons in address") {
+		t.Fatal("expected error with bad endpoint")
+	}
+}
+
+func TestNewDNSClientH3(t *testing.T) {
+	dnsclient, err := netx.NewDNSClient(
+		netx.Config{}, "h3://dns.google/dns-query")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, ok := dnsclient.Resolver.(resolver.SerialResolver)
+	if !ok {
+		t.Fatal("not the resolver we expected")
+	}
+	txp, ok := r.Transport().(resolver.DNSOverHTTP3)
+	if !ok {
+		t.Fatal("not the transport we expected")
+	}
+	if txp.Address() != "https://dns.google/dns-query" {
+		t.Fatal("not the URL we expected")
+	}
+	dnsclient.CloseIdleConnections()
+}
+
+func TestNewDNSClientH3DNSSaver(t *testing.T) {
+	saver := new(trace.Saver)
+	dnsclient, err := netx.NewDNSClientWithOverrides(
+		netx.Config{ResolveSaver: saver}, "h3://8.8.8.8/dns-query",
+		"dns.google", "dns.google")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, ok := dnsclient.Resolver.(resolver.SerialResolver)
+	if !ok {
+		t.Fatal("not the resolver we expected")
+	}
+	txp, ok := r.Transport().(resolver.SaverDNSTransport)
+	if !ok {
+		t.Fatal("not the transport we expected")
+	}
+	doh3, ok := txp.RoundTripper.(resolver.DNSOverHTTP3)
+	if !ok {
+		t.Fatal("not the transport we expected")
+	}
+	if doh3.HostOverride != "dns.google" {
+		t.Fatal("not the HostOverride we expected")
+	}
+	dnsclient.CloseIdleConnections()
+}
+
+func TestNewQUICDialerVanilla(t *testing.T) {
+	d := netx.NewQUICDialer(netx.Config{})
+	dnsd, ok := d.(quicdialer.DNSDialer)
+	if !ok {
+		t.Fatal("not the dialer we expected")
+	}
+	if _, ok := dnsd.Resolver.(resolver.IDNAResolver); !ok {
+		t.Fatal("not the resolver we expected")
+	}
+	ewd, ok := dnsd.Dialer.(quicdialer.ErrorWrapperDialer)
+	if !ok {
+		t.Fatal("not the dialer we expected")
+	}
+	sd, ok := ewd.ContextDialer.(quicdialer.SystemDialer)
+	if !ok {
+		t.Fatal("not the dialer we expected")
+	}
+	if sd.Saver != nil {
+		t.Fatal("not the saver we expected")
+	}
+}
+
+func TestNewQUICDialerWithLoggerAndSavers(t *testing.T) {
+	rwsaver, tlssaver := new(trace.Saver), new(trace.Saver)
+	d := netx.NewQUICDialer(netx.Config{
+		Logger:         log.Log,
+		ReadWriteSaver: rwsaver,
+		TLSSaver:       tlssaver,
+	})
+	dnsd, ok := d.(quicdialer.DNSDialer)
+	if !ok {
+		t.Fatal("not the dialer we expected")
+	}
+	hsd, ok := dnsd.Dialer.(quicdialer.HandshakeSaver)
+	if !ok {
+		t.Fatal("not the dialer we expected")
+	}
+	if hsd.Saver != tlssaver {
+		t.Fatal("not the saver we expected")
+	}
+	ld, ok := hsd.ContextDialer.(quicdialer.LoggingDialer)
+	if !ok {
+		t.Fatal("not the dialer we expected")
+	}
+	if ld.Logger != log.Log {
+		t.Fatal("not the logger we expected")
+	}
+	ewd, ok := ld.ContextDialer.(quicdialer.ErrorWrapperDialer)
+	if !ok {
+		t.Fatal("not the dialer we expected")
+	}
+	sd, ok := ewd.ContextDialer.(quicdialer.SystemDialer)
+	if !ok {
+		t.Fatal("not the dialer we expected")
+	}
+	if sd.Saver != rwsaver {
+		t.Fatal("not the saver we expected")
+	}
+}
+
+func TestNewWithHTTP3Enabled(t *testing.T) {
+	txp := netx.NewHTTPTransport(netx.Config{
+		HTTP3Enabled: true,
+		NoTLSVerify:  true,
+	})
+	uatxp, ok := txp.(httptransport.UserAgentTransport)
+	if !ok {
+		t.Fatal("not the transport we expected")
+	}
+	h3txp, ok := uatxp.RoundTripper.(*httptransport.HTTP3Transport)
+	if !ok {
+		t.Fatal("not the transport we expected")
+	}
+	if h3txp.DisableCompression != true {
+		t.Fatal("expected compression to be disabled")
+	}
+	if h3txp.TLSClientConfig.RootCAs != netx.CertPool {
+		t.Fatal("not the CA pool we expected")
+	}
+	if h3txp.TLSClientConfig.InsecureSkipVerify != true {
+		t.Fatal("expected InsecureSkipVerify to be true")
+	}
+	txp.CloseIdleConnections()
+}
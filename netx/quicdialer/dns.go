@@ -0,0 +1,86 @@
+//go:build !DISABLE_QUIC
+// +build !DISABLE_QUIC
+
+package quicdialer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/ooni/probe-engine/legacy/netx/dialid"
+	"github.com/ooni/probe-engine/netx/errorx"
+)
+
+// DNSDialer is a dialer that uses the configured Resolver to resolve a
+// domain name to IP addresses, and the configured Dialer to connect.
+type DNSDialer struct {
+	Dialer   ContextDialer
+	Resolver Resolver
+}
+
+// DialContext implements ContextDialer.DialContext
+func (d DNSDialer) DialContext(ctx context.Context, network, address string,
+	tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlySession, error) {
+	onlyhost, onlyport, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	// We are going to dial IP addresses, so we need to make sure the
+	// SNI is set to the original domain, otherwise quic-go would use
+	// the IP address as the SNI, which is not what we want.
+	if tlsCfg == nil {
+		tlsCfg = new(tls.Config)
+	} else {
+		tlsCfg = tlsCfg.Clone()
+	}
+	if tlsCfg.ServerName == "" {
+		tlsCfg.ServerName = onlyhost
+	}
+	ctx = dialid.WithDialID(ctx) // important to create before lookupHost
+	var addrs []string
+	addrs, err = d.LookupHost(ctx, onlyhost)
+	if err != nil {
+		return nil, err
+	}
+	var errorslist []error
+	for _, addr := range addrs {
+		target := net.JoinHostPort(addr, onlyport)
+		sess, err := d.Dialer.DialContext(ctx, network, target, tlsCfg, cfg)
+		if err == nil {
+			return sess, nil
+		}
+		errorslist = append(errorslist, err)
+	}
+	return nil, reduceErrors(errorslist)
+}
+
+// reduceErrors is like dialer.reduceErrors. We prefer errors that
+// we know how to classify over the unknown ones.
+func reduceErrors(errorslist []error) error {
+	if len(errorslist) == 0 {
+		return nil
+	}
+	for _, err := range errorslist {
+		var wrapper *errorx.ErrWrapper
+		if errors.As(err, &wrapper) && !strings.HasPrefix(
+			err.Error(), "unknown_failure",
+		) {
+			return err
+		}
+	}
+	return errorslist[0]
+}
+
+// LookupHost implements Resolver.LookupHost
+func (d DNSDialer) LookupHost(ctx context.Context, hostname string) ([]string, error) {
+	if net.ParseIP(hostname) != nil {
+		return []string{hostname}, nil
+	}
+	return d.Resolver.LookupHost(ctx, hostname)
+}
+
+var _ ContextDialer = DNSDialer{}
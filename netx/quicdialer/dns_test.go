@@ -0,0 +1,123 @@
+//go:build !DISABLE_QUIC
+// +build !DISABLE_QUIC
+
+package quicdialer_test
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"testing"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/ooni/probe-engine/netx/quicdialer"
+)
+
+type MockableResolver struct {
+	Addresses []string
+	Err       error
+}
+
+func (r MockableResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	return r.Addresses, r.Err
+}
+
+type MockableDialer struct {
+	Addresses []string
+	Err       error
+	TLSConfig *tls.Config
+}
+
+func (d *MockableDialer) DialContext(ctx context.Context, network, address string,
+	tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlySession, error) {
+	d.Addresses = append(d.Addresses, address)
+	d.TLSConfig = tlsCfg
+	return nil, d.Err
+}
+
+func TestUnitDNSDialerNoPort(t *testing.T) {
+	dialer := quicdialer.DNSDialer{
+		Dialer: quicdialer.SystemDialer{}, Resolver: MockableResolver{}}
+	sess, err := dialer.DialContext(
+		context.Background(), "udp", "dns.google", &tls.Config{}, &quic.Config{})
+	if err == nil {
+		t.Fatal("expected an error here")
+	}
+	if sess != nil {
+		t.Fatal("expected a nil sess here")
+	}
+}
+
+func TestUnitDNSDialerLookupHostAddress(t *testing.T) {
+	dialer := quicdialer.DNSDialer{Resolver: MockableResolver{
+		Err: errors.New("mocked error"),
+	}}
+	addrs, err := dialer.LookupHost(context.Background(), "1.1.1.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 1 || addrs[0] != "1.1.1.1" {
+		t.Fatal("not the result we expected")
+	}
+}
+
+func TestUnitDNSDialerLookupHostFailure(t *testing.T) {
+	expected := errors.New("mocked error")
+	dialer := quicdialer.DNSDialer{
+		Dialer: quicdialer.SystemDialer{}, Resolver: MockableResolver{Err: expected}}
+	sess, err := dialer.DialContext(
+		context.Background(), "udp", "dns.google:853", &tls.Config{}, &quic.Config{})
+	if !errors.Is(err, expected) {
+		t.Fatal("not the error we expected")
+	}
+	if sess != nil {
+		t.Fatal("expected nil sess")
+	}
+}
+
+func TestUnitDNSDialerDialForManyIPFails(t *testing.T) {
+	expected := errors.New("mocked error")
+	child := &MockableDialer{Err: expected}
+	dialer := quicdialer.DNSDialer{Dialer: child, Resolver: MockableResolver{
+		Addresses: []string{"1.1.1.1", "8.8.8.8"},
+	}}
+	sess, err := dialer.DialContext(
+		context.Background(), "udp", "dot.dns:853", nil, &quic.Config{})
+	if !errors.Is(err, expected) {
+		t.Fatal("not the error we expected")
+	}
+	if sess != nil {
+		t.Fatal("expected nil sess")
+	}
+	if len(child.Addresses) != 2 || child.Addresses[0] != "1.1.1.1:853" ||
+		child.Addresses[1] != "8.8.8.8:853" {
+		t.Fatal("not the addresses we expected")
+	}
+}
+
+func TestUnitDNSDialerSetsServerName(t *testing.T) {
+	child := &MockableDialer{Err: errors.New("mocked error")}
+	dialer := quicdialer.DNSDialer{Dialer: child, Resolver: MockableResolver{
+		Addresses: []string{"1.1.1.1"},
+	}}
+	config := &tls.Config{}
+	dialer.DialContext(context.Background(), "udp", "dot.dns:853", config, &quic.Config{})
+	if child.TLSConfig.ServerName != "dot.dns" {
+		t.Fatal("not the ServerName we expected")
+	}
+	if config.ServerName != "" {
+		t.Fatal("the original config should not have been modified")
+	}
+}
+
+func TestUnitDNSDialerHonoursServerName(t *testing.T) {
+	child := &MockableDialer{Err: errors.New("mocked error")}
+	dialer := quicdialer.DNSDialer{Dialer: child, Resolver: MockableResolver{
+		Addresses: []string{"1.1.1.1"},
+	}}
+	config := &tls.Config{ServerName: "antani.dns"}
+	dialer.DialContext(context.Background(), "udp", "dot.dns:853", config, &quic.Config{})
+	if child.TLSConfig.ServerName != "antani.dns" {
+		t.Fatal("not the ServerName we expected")
+	}
+}
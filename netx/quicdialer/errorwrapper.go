@@ -0,0 +1,36 @@
+//go:build !DISABLE_QUIC
+// +build !DISABLE_QUIC
+
+package quicdialer
+
+import (
+	"context"
+	"crypto/tls"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/ooni/probe-engine/legacy/netx/dialid"
+	"github.com/ooni/probe-engine/netx/errorx"
+)
+
+// ErrorWrapperDialer is a dialer that performs quic err wrapping
+type ErrorWrapperDialer struct {
+	ContextDialer
+}
+
+// DialContext implements ContextDialer.DialContext
+func (d ErrorWrapperDialer) DialContext(ctx context.Context, network, address string,
+	tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlySession, error) {
+	dialID := dialid.ContextDialID(ctx)
+	sess, err := d.ContextDialer.DialContext(ctx, network, address, tlsCfg, cfg)
+	err = errorx.SafeErrWrapperBuilder{
+		DialID:    dialID,
+		Error:     err,
+		Operation: errorx.QUICHandshakeOperation,
+	}.MaybeBuild()
+	if err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+var _ ContextDialer = ErrorWrapperDialer{}
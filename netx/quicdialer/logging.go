@@ -0,0 +1,31 @@
+//go:build !DISABLE_QUIC
+// +build !DISABLE_QUIC
+
+package quicdialer
+
+import (
+	"context"
+	"crypto/tls"
+	"time"
+
+	"github.com/lucas-clemente/quic-go"
+)
+
+// LoggingDialer is a ContextDialer with logging
+type LoggingDialer struct {
+	ContextDialer
+	Logger Logger
+}
+
+// DialContext implements ContextDialer.DialContext
+func (d LoggingDialer) DialContext(ctx context.Context, network, address string,
+	tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlySession, error) {
+	d.Logger.Debugf("quic %s/%s...", address, network)
+	start := time.Now()
+	sess, err := d.ContextDialer.DialContext(ctx, network, address, tlsCfg, cfg)
+	stop := time.Now()
+	d.Logger.Debugf("quic %s/%s... %+v in %s", address, network, err, stop.Sub(start))
+	return sess, err
+}
+
+var _ ContextDialer = LoggingDialer{}
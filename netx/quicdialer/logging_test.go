@@ -0,0 +1,31 @@
+//go:build !DISABLE_QUIC
+// +build !DISABLE_QUIC
+
+package quicdialer_test
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/lucas-clemente/quic-go"
+	"github.com/ooni/probe-engine/netx/quicdialer"
+)
+
+func TestUnitLoggingDialerFailure(t *testing.T) {
+	d := quicdialer.LoggingDialer{
+		ContextDialer: &MockableDialer{Err: errors.New("mocked error")},
+		Logger:        log.Log,
+	}
+	sess, err := d.DialContext(
+		context.Background(), "udp", "www.google.com:443",
+		&tls.Config{}, &quic.Config{})
+	if err == nil {
+		t.Fatal("expected an error here")
+	}
+	if sess != nil {
+		t.Fatal("expected a nil sess here")
+	}
+}
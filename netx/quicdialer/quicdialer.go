@@ -0,0 +1,102 @@
+//go:build !DISABLE_QUIC
+// +build !DISABLE_QUIC
+
+// Package quicdialer contains code to establish QUIC sessions.
+//
+// The design of this package mirrors the one of the dialer package. We
+// have a SystemDialer that performs the actual work and we have decorators
+// adding extra functionality on top of a basic dialer.
+package quicdialer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"strconv"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/ooni/probe-engine/netx/trace"
+)
+
+// ContextDialer is a dialer for QUIC using Context.
+type ContextDialer interface {
+	// DialContext establishes a new QUIC session with the given
+	// address using the given TLS and QUIC configs.
+	DialContext(ctx context.Context, network, address string,
+		tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlySession, error)
+}
+
+// Resolver is the interface we expect from a resolver
+type Resolver interface {
+	LookupHost(ctx context.Context, hostname string) (addrs []string, err error)
+}
+
+// Logger is the logger assumed by this package
+type Logger interface {
+	Debugf(format string, v ...interface{})
+	Debug(message string)
+}
+
+// ErrInvalidIP indicates that the address passed to SystemDialer
+// does not contain a valid IP address.
+var ErrInvalidIP = errors.New("quicdialer: invalid IP representation")
+
+// SystemDialer is the basic dialer for QUIC. It expects the address
+// to contain an IP address and a port. Use DNSDialer to wrap this
+// dialer and be able to dial domain names.
+type SystemDialer struct {
+	// Saver is the optional saver for the read_from and write_to
+	// events occurring on the underlying UDP socket.
+	Saver *trace.Saver
+}
+
+// DialContext implements ContextDialer.DialContext
+func (d SystemDialer) DialContext(ctx context.Context, network string,
+	address string, tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlySession, error) {
+	onlyhost, onlyport, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(onlyport)
+	if err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(onlyhost)
+	if ip == nil {
+		return nil, ErrInvalidIP
+	}
+	udpConn, err := net.ListenUDP(network, &net.UDPAddr{})
+	if err != nil {
+		return nil, err
+	}
+	var pconn net.PacketConn = udpConn
+	if d.Saver != nil {
+		pconn = saverUDPConn{PacketConn: udpConn, saver: d.Saver}
+	}
+	udpAddr := &net.UDPAddr{IP: ip, Port: port}
+	sess, err := quic.DialEarlyContext(ctx, pconn, udpAddr, address, tlsCfg, cfg)
+	if err != nil {
+		udpConn.Close()
+		return nil, err
+	}
+	return sessionWithConn{EarlySession: sess, conn: udpConn}, nil
+}
+
+// sessionWithConn is a session that owns the underlying UDP conn. We need
+// this wrapper because quic-go does not close a net.PacketConn it did not
+// create itself, hence we would otherwise leak the UDP socket.
+type sessionWithConn struct {
+	quic.EarlySession
+	conn net.PacketConn
+}
+
+// CloseWithError implements quic.Session.CloseWithError
+func (s sessionWithConn) CloseWithError(code quic.ErrorCode, reason string) error {
+	err := s.EarlySession.CloseWithError(code, reason)
+	s.conn.Close()
+	return err
+}
+
+var _ ContextDialer = SystemDialer{}
+var _ quic.EarlySession = sessionWithConn{}
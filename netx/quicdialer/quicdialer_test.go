@@ -0,0 +1,72 @@
+//go:build !DISABLE_QUIC
+// +build !DISABLE_QUIC
+
+package quicdialer_test
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"testing"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/ooni/probe-engine/netx/quicdialer"
+)
+
+func TestUnitSystemDialerNoPort(t *testing.T) {
+	sess, err := quicdialer.SystemDialer{}.DialContext(
+		context.Background(), "udp", "1.1.1.1", &tls.Config{}, &quic.Config{})
+	if err == nil {
+		t.Fatal("expected an error here")
+	}
+	if sess != nil {
+		t.Fatal("expected a nil sess here")
+	}
+}
+
+func TestUnitSystemDialerInvalidPort(t *testing.T) {
+	sess, err := quicdialer.SystemDialer{}.DialContext(
+		context.Background(), "udp", "1.1.1.1:antani", &tls.Config{}, &quic.Config{})
+	if err == nil {
+		t.Fatal("expected an error here")
+	}
+	if sess != nil {
+		t.Fatal("expected a nil sess here")
+	}
+}
+
+func TestUnitSystemDialerInvalidIP(t *testing.T) {
+	sess, err := quicdialer.SystemDialer{}.DialContext(
+		context.Background(), "udp", "dns.google:853", &tls.Config{}, &quic.Config{})
+	if !errors.Is(err, quicdialer.ErrInvalidIP) {
+		t.Fatal("not the error we expected")
+	}
+	if sess != nil {
+		t.Fatal("expected a nil sess here")
+	}
+}
+
+func TestUnitSystemDialerInvalidNetwork(t *testing.T) {
+	sess, err := quicdialer.SystemDialer{}.DialContext(
+		context.Background(), "antani", "1.1.1.1:853", &tls.Config{}, &quic.Config{})
+	if err == nil {
+		t.Fatal("expected an error here")
+	}
+	if sess != nil {
+		t.Fatal("expected a nil sess here")
+	}
+}
+
+func TestUnitSystemDialerCancelledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel() // fail immediately
+	sess, err := quicdialer.SystemDialer{}.DialContext(
+		ctx, "udp", "1.1.1.1:853", &tls.Config{ServerName: "one.one.one.one"},
+		&quic.Config{})
+	if err == nil {
+		t.Fatal("expected an error here")
+	}
+	if sess != nil {
+		t.Fatal("expected a nil sess here")
+	}
+}
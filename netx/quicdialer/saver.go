@@ -0,0 +1,115 @@
+//go:build !DISABLE_QUIC
+// +build !DISABLE_QUIC
+
+package quicdialer
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/ooni/probe-engine/internal/tlsx"
+	"github.com/ooni/probe-engine/netx/errorx"
+	"github.com/ooni/probe-engine/netx/trace"
+)
+
+// HandshakeSaver saves events occurring during the QUIC handshake
+type HandshakeSaver struct {
+	ContextDialer
+	Saver *trace.Saver
+}
+
+// DialContext implements ContextDialer.DialContext
+func (h HandshakeSaver) DialContext(ctx context.Context, network, address string,
+	tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlySession, error) {
+	start := time.Now()
+	h.Saver.Write(trace.Event{
+		Address:       address,
+		Name:          "quic_handshake_start",
+		NoTLSVerify:   tlsCfg.InsecureSkipVerify,
+		Proto:         network,
+		TLSNextProtos: tlsCfg.NextProtos,
+		TLSServerName: tlsCfg.ServerName,
+		Time:          start,
+	})
+	sess, err := h.ContextDialer.DialContext(ctx, network, address, tlsCfg, cfg)
+	stop := time.Now()
+	if err != nil {
+		h.Saver.Write(trace.Event{
+			Address:       address,
+			Duration:      stop.Sub(start),
+			Err:           err,
+			Name:          "quic_handshake_done",
+			NoTLSVerify:   tlsCfg.InsecureSkipVerify,
+			Proto:         network,
+			TLSNextProtos: tlsCfg.NextProtos,
+			TLSServerName: tlsCfg.ServerName,
+			Time:          stop,
+		})
+		return nil, err
+	}
+	state := sess.ConnectionState()
+	h.Saver.Write(trace.Event{
+		Address:            address,
+		Duration:           stop.Sub(start),
+		Name:               "quic_handshake_done",
+		NoTLSVerify:        tlsCfg.InsecureSkipVerify,
+		Proto:              network,
+		TLSCipherSuite:     tlsx.CipherSuiteString(state.CipherSuite),
+		TLSNegotiatedProto: state.NegotiatedProtocol,
+		TLSNextProtos:      tlsCfg.NextProtos,
+		TLSPeerCerts:       state.PeerCertificates,
+		TLSServerName:      tlsCfg.ServerName,
+		TLSVersion:         tlsx.VersionString(state.Version),
+		Time:               stop,
+	})
+	return sess, nil
+}
+
+// saverUDPConn is a net.PacketConn that saves read_from and write_to
+// events. We deliberately do not embed *net.UDPConn, because otherwise
+// quic-go would notice it can use more efficient methods to read and
+// write datagrams and would therefore bypass our wrappers.
+type saverUDPConn struct {
+	net.PacketConn
+	saver *trace.Saver
+}
+
+func (c saverUDPConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	start := time.Now()
+	count, addr, err := c.PacketConn.ReadFrom(p)
+	stop := time.Now()
+	var address string
+	if addr != nil {
+		address = addr.String()
+	}
+	c.saver.Write(trace.Event{
+		Address:  address,
+		Duration: stop.Sub(start),
+		Err:      err,
+		NumBytes: count,
+		Name:     errorx.ReadFromOperation,
+		Time:     stop,
+	})
+	return count, addr, err
+}
+
+func (c saverUDPConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	start := time.Now()
+	count, err := c.PacketConn.WriteTo(p, addr)
+	stop := time.Now()
+	c.saver.Write(trace.Event{
+		Address:  addr.String(),
+		Duration: stop.Sub(start),
+		Err:      err,
+		NumBytes: count,
+		Name:     errorx.WriteToOperation,
+		Time:     stop,
+	})
+	return count, err
+}
+
+var _ ContextDialer = HandshakeSaver{}
+var _ net.PacketConn = saverUDPConn{}
@@ -0,0 +1,151 @@
+//go:build !DISABLE_QUIC
+// +build !DISABLE_QUIC
+
+package quicdialer_test
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"testing"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/ooni/probe-engine/netx/errorx"
+	"github.com/ooni/probe-engine/netx/quicdialer"
+	"github.com/ooni/probe-engine/netx/trace"
+)
+
+type MockableSession struct {
+	quic.EarlySession
+	State quic.ConnectionState
+}
+
+func (s MockableSession) ConnectionState() quic.ConnectionState {
+	return s.State
+}
+
+type MockableSessionDialer struct {
+	Sess quic.EarlySession
+}
+
+func (d MockableSessionDialer) DialContext(ctx context.Context, network, address string,
+	tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlySession, error) {
+	return d.Sess, nil
+}
+
+func TestUnitHandshakeSaverFailure(t *testing.T) {
+	expected := errors.New("mocked error")
+	saver := new(trace.Saver)
+	d := quicdialer.HandshakeSaver{
+		ContextDialer: &MockableDialer{Err: expected},
+		Saver:         saver,
+	}
+	tlsCfg := &tls.Config{NextProtos: []string{"h3-29"}, ServerName: "dns.google"}
+	sess, err := d.DialContext(
+		context.Background(), "udp", "8.8.8.8:443", tlsCfg, &quic.Config{})
+	if !errors.Is(err, expected) {
+		t.Fatal("not the error we expected")
+	}
+	if sess != nil {
+		t.Fatal("expected a nil sess here")
+	}
+	events := saver.Read()
+	if len(events) != 2 {
+		t.Fatal("unexpected number of events")
+	}
+	if events[0].Name != "quic_handshake_start" {
+		t.Fatal("unexpected Name")
+	}
+	if events[1].Name != "quic_handshake_done" {
+		t.Fatal("unexpected Name")
+	}
+	if !errors.Is(events[1].Err, expected) {
+		t.Fatal("unexpected Err")
+	}
+	for _, ev := range events {
+		if ev.Address != "8.8.8.8:443" {
+			t.Fatal("unexpected Address")
+		}
+		if ev.Proto != "udp" {
+			t.Fatal("unexpected Proto")
+		}
+		if ev.TLSServerName != "dns.google" {
+			t.Fatal("unexpected TLSServerName")
+		}
+		if len(ev.TLSNextProtos) != 1 || ev.TLSNextProtos[0] != "h3-29" {
+			t.Fatal("unexpected TLSNextProtos")
+		}
+	}
+}
+
+func TestUnitHandshakeSaverSuccess(t *testing.T) {
+	saver := new(trace.Saver)
+	d := quicdialer.HandshakeSaver{
+		ContextDialer: MockableSessionDialer{Sess: MockableSession{
+			State: quic.ConnectionState{
+				CipherSuite:        tls.TLS_AES_128_GCM_SHA256,
+				NegotiatedProtocol: "h3-29",
+				Version:            tls.VersionTLS13,
+			},
+		}},
+		Saver: saver,
+	}
+	tlsCfg := &tls.Config{NextProtos: []string{"h3-29"}, ServerName: "dns.google"}
+	sess, err := d.DialContext(
+		context.Background(), "udp", "8.8.8.8:443", tlsCfg, &quic.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sess == nil {
+		t.Fatal("expected non-nil sess here")
+	}
+	events := saver.Read()
+	if len(events) != 2 {
+		t.Fatal("unexpected number of events")
+	}
+	ev := events[1]
+	if ev.Name != "quic_handshake_done" {
+		t.Fatal("unexpected Name")
+	}
+	if ev.Err != nil {
+		t.Fatal("unexpected Err")
+	}
+	if ev.TLSCipherSuite != "TLS_AES_128_GCM_SHA256" {
+		t.Fatal("unexpected TLSCipherSuite")
+	}
+	if ev.TLSNegotiatedProto != "h3-29" {
+		t.Fatal("unexpected TLSNegotiatedProto")
+	}
+	if ev.TLSVersion != "TLSv1.3" {
+		t.Fatal("unexpected TLSVersion")
+	}
+}
+
+func TestIntegrationSystemDialerWithReadWriteSaver(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip test in short mode")
+	}
+	saver := new(trace.Saver)
+	d := quicdialer.SystemDialer{Saver: saver}
+	tlsCfg := &tls.Config{NextProtos: []string{"h3-29"}, ServerName: "dns.google"}
+	sess, err := d.DialContext(
+		context.Background(), "udp", "8.8.8.8:443", tlsCfg, &quic.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess.CloseWithError(0, "")
+	var reads, writes int
+	for _, ev := range saver.Read() {
+		switch ev.Name {
+		case errorx.ReadFromOperation:
+			reads++
+		case errorx.WriteToOperation:
+			writes++
+		default:
+			t.Fatal("unexpected event")
+		}
+	}
+	if reads <= 0 || writes <= 0 {
+		t.Fatal("expected to see reads and writes")
+	}
+}
@@ -0,0 +1,286 @@
+package replay
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ooni/probe-engine/netx/errorx"
+)
+
+// PlaybackDialer is a Dialer that replays recorded dials.
+type PlaybackDialer struct {
+	Replayer *Replayer
+}
+
+// DialContext implements Dialer.DialContext
+func (d PlaybackDialer) DialContext(
+	ctx context.Context, network, address string) (net.Conn, error) {
+	entry := d.Replayer.nextDial(network, address)
+	if entry == nil {
+		return nil, fmt.Errorf("%w: dial %s %s", ErrNotRecorded, network, address)
+	}
+	if err := entry.Failure.toError(); err != nil {
+		return nil, err
+	}
+	return newReplayConn(entry.Conn, nil), nil
+}
+
+// PlaybackResolver is a Resolver that replays recorded lookups.
+type PlaybackResolver struct {
+	Replayer *Replayer
+}
+
+// LookupHost implements Resolver.LookupHost
+func (r PlaybackResolver) LookupHost(ctx context.Context, hostname string) ([]string, error) {
+	entry := r.Replayer.nextLookup(hostname)
+	if entry == nil {
+		return nil, fmt.Errorf("%w: lookup %s", ErrNotRecorded, hostname)
+	}
+	if err := entry.Failure.toError(); err != nil {
+		return nil, err
+	}
+	return entry.Addrs, nil
+}
+
+// Network implements Resolver.Network
+func (r PlaybackResolver) Network() string {
+	return r.Replayer.recording.ResolverNetwork
+}
+
+// Address implements Resolver.Address
+func (r PlaybackResolver) Address() string {
+	return r.Replayer.recording.ResolverAddress
+}
+
+// PlaybackTLSHandshaker is a TLSHandshaker that replays recorded TLS
+// handshakes. It ignores the bytes recorded on conn, which are
+// encrypted, and replays the recorded plaintext instead.
+type PlaybackTLSHandshaker struct {
+	Replayer *Replayer
+}
+
+// Handshake implements TLSHandshaker.Handshake
+func (h PlaybackTLSHandshaker) Handshake(
+	ctx context.Context, conn net.Conn, config *tls.Config,
+) (net.Conn, tls.ConnectionState, error) {
+	remoteAddr := conn.RemoteAddr().String()
+	entry := h.Replayer.nextHandshake(remoteAddr, config.ServerName)
+	if entry == nil {
+		return nil, tls.ConnectionState{}, fmt.Errorf(
+			"%w: TLS handshake %s %s", ErrNotRecorded, remoteAddr, config.ServerName)
+	}
+	if err := entry.Failure.toError(); err != nil {
+		return nil, tls.ConnectionState{}, certificateError(entry, err)
+	}
+	state := tls.ConnectionState{
+		CipherSuite:        entry.CipherSuite,
+		HandshakeComplete:  true,
+		NegotiatedProtocol: entry.NegotiatedProtocol,
+		ServerName:         config.ServerName,
+		Version:            entry.Version,
+	}
+	for _, data := range entry.PeerCertificates {
+		cert, err := x509.ParseCertificate(data)
+		if err != nil {
+			return nil, tls.ConnectionState{}, err
+		}
+		state.PeerCertificates = append(state.PeerCertificates, cert)
+	}
+	return newReplayConn(entry.Conn, conn), state, nil
+}
+
+// certificateError rebuilds the certificate verification error, if
+// any, so that code inspecting the error sees the peer certificate.
+func certificateError(entry *TLSHandshake, err error) error {
+	wrapper, ok := err.(*errorx.ErrWrapper)
+	if !ok || len(entry.PeerCertificates) != 1 {
+		return err
+	}
+	cert, perr := x509.ParseCertificate(entry.PeerCertificates[0])
+	if perr != nil {
+		return err
+	}
+	switch wrapper.Failure {
+	case errorx.FailureSSLInvalidHostname:
+		wrapper.WrappedErr = x509.HostnameError{Certificate: cert, Host: entry.ServerName}
+	case errorx.FailureSSLUnknownAuthority:
+		wrapper.WrappedErr = x509.UnknownAuthorityError{Cert: cert}
+	case errorx.FailureSSLInvalidCertificate:
+		wrapper.WrappedErr = x509.CertificateInvalidError{Cert: cert}
+	}
+	return wrapper
+}
+
+// replayRead is a recorded read along with the number of bytes
+// that have been written before such read.
+type replayRead struct {
+	event        *Event
+	writtenSoFar int
+}
+
+// replayWrite is a recorded write along with its offset.
+type replayWrite struct {
+	event  *Event
+	offset int
+}
+
+// replayConn is a net.Conn replaying a recorded connection.
+type replayConn struct {
+	closed     bool
+	cond       *sync.Cond
+	conn       *Conn
+	mu         sync.Mutex
+	readOffset int // offset into the current read
+	reads      []replayRead
+	underlying net.Conn // may be nil
+	writes     []replayWrite
+	written    int
+}
+
+func newReplayConn(conn *Conn, underlying net.Conn) *replayConn {
+	c := &replayConn{conn: conn, underlying: underlying}
+	c.cond = sync.NewCond(&c.mu)
+	var written int
+	for _, ev := range conn.Events {
+		switch ev.Operation {
+		case errorx.ReadOperation:
+			c.reads = append(c.reads, replayRead{event: ev, writtenSoFar: written})
+		case errorx.WriteOperation:
+			c.writes = append(c.writes, replayWrite{event: ev, offset: written})
+			written += len(ev.Data)
+		}
+	}
+	return c
+}
+
+var errClosed = errors.New("use of closed network connection")
+
+// ready returns whether we can replay read. We need to wait for the code
+// under test to write as much as the code that performed the recording and,
+// if the read completed after close, to close the connection.
+func (c *replayConn) ready(read replayRead) bool {
+	return c.written >= read.writtenSoFar && (!read.event.AfterClose || c.closed)
+}
+
+func (c *replayConn) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for {
+		if len(c.reads) <= 0 {
+			// Nothing else was read before the recording ended, so we
+			// just block until the code under test closes us.
+			if c.closed {
+				return 0, errClosed
+			}
+			c.cond.Wait()
+			continue
+		}
+		read := c.reads[0]
+		if c.ready(read) {
+			break
+		}
+		if c.closed {
+			return 0, errClosed
+		}
+		c.cond.Wait()
+	}
+	read := c.reads[0]
+	count := copy(b, read.event.Data[c.readOffset:])
+	c.readOffset += count
+	if c.readOffset < len(read.event.Data) {
+		return count, nil
+	}
+	c.reads = c.reads[1:]
+	c.readOffset = 0
+	return count, read.event.Failure.toError()
+}
+
+func (c *replayConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return 0, errClosed
+	}
+	for len(c.writes) > 0 {
+		write := c.writes[0]
+		if write.event.Failure != nil && c.written >= write.offset {
+			c.writes = c.writes[1:]
+			return 0, write.event.Failure.toError()
+		}
+		if c.written < write.offset+len(write.event.Data) {
+			break
+		}
+		c.writes = c.writes[1:]
+	}
+	c.written += len(b)
+	c.cond.Broadcast()
+	return len(b), nil
+}
+
+func (c *replayConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return errClosed
+	}
+	c.closed = true
+	c.cond.Broadcast()
+	if c.underlying != nil {
+		c.underlying.Close()
+	}
+	return nil
+}
+
+func (c *replayConn) LocalAddr() net.Addr {
+	return replayAddr{address: c.conn.LocalAddr, network: c.conn.Network}
+}
+
+func (c *replayConn) RemoteAddr() net.Addr {
+	return replayAddr{address: c.conn.RemoteAddr, network: c.conn.Network}
+}
+
+// SetDeadline implements net.Conn.SetDeadline. We do not replay timing,
+// hence we do not need to honour deadlines.
+func (c *replayConn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+// SetReadDeadline implements net.Conn.SetReadDeadline.
+func (c *replayConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+// SetWriteDeadline implements net.Conn.SetWriteDeadline.
+func (c *replayConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+type replayAddr struct {
+	address string
+	network string
+}
+
+func (a replayAddr) Network() string {
+	return a.network
+}
+
+func (a replayAddr) String() string {
+	return a.address
+}
+
+var (
+	_ Dialer        = PlaybackDialer{}
+	_ Resolver      = PlaybackResolver{}
+	_ TLSHandshaker = PlaybackTLSHandshaker{}
+	_ Dialer        = RecordingDialer{}
+	_ Resolver      = RecordingResolver{}
+	_ TLSHandshaker = RecordingTLSHandshaker{}
+	_ net.Conn      = &replayConn{}
+	_ net.Conn      = &recordingConn{}
+)
@@ -0,0 +1,178 @@
+package replay
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+
+	"github.com/ooni/probe-engine/netx/errorx"
+)
+
+// Dialer is the interface we expect from a dialer
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Resolver is the interface we expect from a resolver
+type Resolver interface {
+	LookupHost(ctx context.Context, hostname string) (addrs []string, err error)
+	Network() string
+	Address() string
+}
+
+// TLSHandshaker is the interface we expect from a TLS handshaker
+type TLSHandshaker interface {
+	Handshake(ctx context.Context, conn net.Conn, config *tls.Config) (
+		net.Conn, tls.ConnectionState, error)
+}
+
+// RecordingDialer is a Dialer that records dials and reads/writes.
+type RecordingDialer struct {
+	Dialer
+	Recorder *Recorder
+}
+
+// DialContext implements Dialer.DialContext
+func (d RecordingDialer) DialContext(
+	ctx context.Context, network, address string) (net.Conn, error) {
+	conn, err := d.Dialer.DialContext(ctx, network, address)
+	entry := &Dial{
+		Address: address,
+		Failure: newFailure(err, errorx.ConnectOperation),
+		Network: network,
+	}
+	if err == nil {
+		entry.Conn = newConn(conn)
+		conn = &recordingConn{Conn: conn, conn: entry.Conn, recorder: d.Recorder}
+	}
+	d.Recorder.mu.Lock()
+	d.Recorder.recording.Dials = append(d.Recorder.recording.Dials, entry)
+	d.Recorder.mu.Unlock()
+	return conn, err
+}
+
+// RecordingResolver is a Resolver that records lookups.
+type RecordingResolver struct {
+	Resolver
+	Recorder *Recorder
+}
+
+// LookupHost implements Resolver.LookupHost
+func (r RecordingResolver) LookupHost(ctx context.Context, hostname string) ([]string, error) {
+	addrs, err := r.Resolver.LookupHost(ctx, hostname)
+	entry := &Lookup{
+		Addrs:    addrs,
+		Failure:  newFailure(err, errorx.ResolveOperation),
+		Hostname: hostname,
+	}
+	r.Recorder.mu.Lock()
+	r.Recorder.recording.Lookups = append(r.Recorder.recording.Lookups, entry)
+	r.Recorder.recording.ResolverAddress = r.Resolver.Address()
+	r.Recorder.recording.ResolverNetwork = r.Resolver.Network()
+	r.Recorder.mu.Unlock()
+	return addrs, err
+}
+
+// RecordingTLSHandshaker is a TLSHandshaker that records TLS handshakes
+// and the plaintext read and written on TLS connections.
+type RecordingTLSHandshaker struct {
+	TLSHandshaker
+	Recorder *Recorder
+}
+
+// Handshake implements TLSHandshaker.Handshake
+func (h RecordingTLSHandshaker) Handshake(
+	ctx context.Context, conn net.Conn, config *tls.Config,
+) (net.Conn, tls.ConnectionState, error) {
+	tlsconn, state, err := h.TLSHandshaker.Handshake(ctx, conn, config)
+	entry := &TLSHandshake{
+		Failure:    newFailure(err, errorx.TLSHandshakeOperation),
+		RemoteAddr: conn.RemoteAddr().String(),
+		ServerName: config.ServerName,
+	}
+	if err != nil {
+		entry.PeerCertificates = peerCertificatesOf(err)
+	}
+	if err == nil {
+		entry.CipherSuite = state.CipherSuite
+		entry.Conn = newConn(tlsconn)
+		entry.NegotiatedProtocol = state.NegotiatedProtocol
+		for _, cert := range state.PeerCertificates {
+			entry.PeerCertificates = append(entry.PeerCertificates, cert.Raw)
+		}
+		entry.Version = state.Version
+		tlsconn = &recordingConn{Conn: tlsconn, conn: entry.Conn, recorder: h.Recorder}
+	}
+	h.Recorder.mu.Lock()
+	h.Recorder.recording.TLSHandshakes = append(h.Recorder.recording.TLSHandshakes, entry)
+	h.Recorder.mu.Unlock()
+	return tlsconn, state, err
+}
+
+// peerCertificatesOf returns the certificate that caused a certificate
+// verification error, if any, so that we can replay the error.
+func peerCertificatesOf(err error) [][]byte {
+	var hostnameError x509.HostnameError
+	if errors.As(err, &hostnameError) {
+		return [][]byte{hostnameError.Certificate.Raw}
+	}
+	var unknownAuthorityError x509.UnknownAuthorityError
+	if errors.As(err, &unknownAuthorityError) {
+		return [][]byte{unknownAuthorityError.Cert.Raw}
+	}
+	var certificateInvalidError x509.CertificateInvalidError
+	if errors.As(err, &certificateInvalidError) {
+		return [][]byte{certificateInvalidError.Cert.Raw}
+	}
+	return nil
+}
+
+func newConn(conn net.Conn) *Conn {
+	return &Conn{
+		LocalAddr:  conn.LocalAddr().String(),
+		Network:    conn.RemoteAddr().Network(),
+		RemoteAddr: conn.RemoteAddr().String(),
+	}
+}
+
+type recordingConn struct {
+	net.Conn
+	closed   bool
+	conn     *Conn
+	recorder *Recorder
+}
+
+func (c *recordingConn) Read(b []byte) (int, error) {
+	count, err := c.Conn.Read(b)
+	c.append(errorx.ReadOperation, b[:count], err)
+	return count, err
+}
+
+func (c *recordingConn) Write(b []byte) (int, error) {
+	count, err := c.Conn.Write(b)
+	c.append(errorx.WriteOperation, b[:count], err)
+	return count, err
+}
+
+func (c *recordingConn) Close() error {
+	c.recorder.mu.Lock()
+	c.closed = true
+	c.recorder.mu.Unlock()
+	return c.Conn.Close()
+}
+
+func (c *recordingConn) append(operation string, data []byte, err error) {
+	if len(data) <= 0 && err == nil {
+		return
+	}
+	c.recorder.mu.Lock()
+	defer c.recorder.mu.Unlock()
+	c.conn.Events = append(c.conn.Events, &Event{
+		AfterClose: c.closed,
+		Data:       append([]byte{}, data...),
+		Failure:    newFailure(err, operation),
+		Operation:  operation,
+	})
+}
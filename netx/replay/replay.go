@@ -0,0 +1,252 @@
+// Package replay records and replays network traffic. We use it to
+// run experiments deterministically against real-world captures.
+//
+// When recording, we save the results of every lookup performed by
+// the base resolver, of every dial and read/write performed by the base
+// dialer, and of every TLS handshake and read/write of plaintext data
+// performed by the base TLS handshaker. We save the plaintext because the
+// TLS handshake depends on randomness, thus we cannot replay it.
+//
+// When replaying, we serve back the recorded results. We match lookups
+// using the hostname, dials using the network and the address, and TLS
+// handshakes using the remote address and the SNI. We serve entries with
+// the same key in the order in which we recorded them. We do not check the
+// bytes written by the code under test, because they may legitimately
+// change (e.g., the DNS query ID). We only ensure that the code under
+// test sees recorded reads once it has written as many bytes as the code
+// that performed the recording. We do not replay timing.
+//
+// Because net/http cannot use HTTP/2 unless the connection is a
+// *tls.Conn, the netx package uses HTTP/1.1 when recording or replaying.
+// We do not record or replay QUIC.
+package replay
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/ooni/probe-engine/netx/errorx"
+)
+
+// Failure is a recorded error.
+type Failure struct {
+	Error     string `json:"error"`
+	Failure   string `json:"failure"`
+	Operation string `json:"operation"`
+}
+
+// newFailure returns the recorded form of err, or nil.
+func newFailure(err error, operation string) *Failure {
+	if err == nil {
+		return nil
+	}
+	wrapped := errorx.SafeErrWrapperBuilder{
+		Error:     err,
+		Operation: operation,
+	}.MaybeBuild().(*errorx.ErrWrapper)
+	return &Failure{
+		Error:     err.Error(),
+		Failure:   wrapped.Failure,
+		Operation: wrapped.Operation,
+	}
+}
+
+// toError returns the error corresponding to the failure, or nil. We
+// return an already wrapped error, so that the error wrappers in netx
+// preserve the failure that we have recorded. As a special case, we
+// return io.EOF for EOF, because net/http and crypto/tls expect it.
+func (f *Failure) toError() error {
+	if f == nil {
+		return nil
+	}
+	if f.Failure == errorx.FailureEOFError {
+		return io.EOF
+	}
+	return &errorx.ErrWrapper{
+		Failure:    f.Failure,
+		Operation:  f.Operation,
+		WrappedErr: errors.New(f.Error),
+	}
+}
+
+// Event is a read or a write on a connection.
+type Event struct {
+	AfterClose bool     `json:"after_close,omitempty"`
+	Data       []byte   `json:"data"`
+	Failure    *Failure `json:"failure"`
+	Operation  string   `json:"operation"`
+}
+
+// Conn is a recorded connection.
+type Conn struct {
+	Events     []*Event `json:"events"`
+	LocalAddr  string   `json:"local_addr"`
+	Network    string   `json:"network"`
+	RemoteAddr string   `json:"remote_addr"`
+}
+
+// Dial is a recorded dial.
+type Dial struct {
+	Address string   `json:"address"`
+	Conn    *Conn    `json:"conn"`
+	Failure *Failure `json:"failure"`
+	Network string   `json:"network"`
+}
+
+// Lookup is a recorded lookup.
+type Lookup struct {
+	Addrs    []string `json:"addrs"`
+	Failure  *Failure `json:"failure"`
+	Hostname string   `json:"hostname"`
+}
+
+// TLSHandshake is a recorded TLS handshake. Conn contains the
+// plaintext read and written on the TLS connection.
+type TLSHandshake struct {
+	CipherSuite        uint16   `json:"cipher_suite"`
+	Conn               *Conn    `json:"conn"`
+	Failure            *Failure `json:"failure"`
+	NegotiatedProtocol string   `json:"negotiated_protocol"`
+	PeerCertificates   [][]byte `json:"peer_certificates"`
+	RemoteAddr         string   `json:"remote_addr"`
+	ServerName         string   `json:"server_name"`
+	Version            uint16   `json:"version"`
+}
+
+// Recording contains recorded network traffic.
+type Recording struct {
+	Dials           []*Dial         `json:"dials"`
+	Lookups         []*Lookup       `json:"lookups"`
+	ResolverAddress string          `json:"resolver_address"`
+	ResolverNetwork string          `json:"resolver_network"`
+	TLSHandshakes   []*TLSHandshake `json:"tls_handshakes"`
+}
+
+// Recorder records network traffic. The zero value is invalid; please
+// use NewRecorder to construct a new instance.
+type Recorder struct {
+	mu        sync.Mutex
+	recording *Recording
+}
+
+// NewRecorder creates a new Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{recording: new(Recording)}
+}
+
+// Marshal returns the JSON serialization of the recording.
+func (r *Recorder) Marshal() ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return json.Marshal(r.recording)
+}
+
+// WriteFile writes the recording to the specified file.
+func (r *Recorder) WriteFile(path string) error {
+	data, err := r.Marshal()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// Replayer replays network traffic. The zero value is invalid; please
+// use NewReplayer to construct a new instance.
+type Replayer struct {
+	dials      map[string][]*Dial
+	handshakes map[string][]*TLSHandshake
+	lookups    map[string][]*Lookup
+	mu         sync.Mutex
+	recording  *Recording
+}
+
+// NewReplayer creates a new Replayer that replays recording.
+func NewReplayer(recording *Recording) *Replayer {
+	r := &Replayer{
+		dials:      make(map[string][]*Dial),
+		handshakes: make(map[string][]*TLSHandshake),
+		lookups:    make(map[string][]*Lookup),
+		recording:  recording,
+	}
+	for _, entry := range recording.Dials {
+		key := dialKey(entry.Network, entry.Address)
+		r.dials[key] = append(r.dials[key], entry)
+	}
+	for _, entry := range recording.TLSHandshakes {
+		key := handshakeKey(entry.RemoteAddr, entry.ServerName)
+		r.handshakes[key] = append(r.handshakes[key], entry)
+	}
+	for _, entry := range recording.Lookups {
+		r.lookups[entry.Hostname] = append(r.lookups[entry.Hostname], entry)
+	}
+	return r
+}
+
+// Unmarshal creates a new Replayer from the JSON serialization
+// of a recording, e.g., the one returned by Recorder.Marshal.
+func Unmarshal(data []byte) (*Replayer, error) {
+	var recording Recording
+	if err := json.Unmarshal(data, &recording); err != nil {
+		return nil, err
+	}
+	return NewReplayer(&recording), nil
+}
+
+// ReadFile creates a new Replayer from the specified file.
+func ReadFile(path string) (*Replayer, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Unmarshal(data)
+}
+
+// ErrNotRecorded indicates that we have not recorded what the
+// code under test is trying to do.
+var ErrNotRecorded = errors.New("replay: not recorded")
+
+func dialKey(network, address string) string {
+	return network + " " + address
+}
+
+func handshakeKey(remoteAddr, serverName string) string {
+	return remoteAddr + " " + serverName
+}
+
+func (r *Replayer) nextDial(network, address string) *Dial {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := dialKey(network, address)
+	entries := r.dials[key]
+	if len(entries) <= 0 {
+		return nil
+	}
+	r.dials[key] = entries[1:]
+	return entries[0]
+}
+
+func (r *Replayer) nextHandshake(remoteAddr, serverName string) *TLSHandshake {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := handshakeKey(remoteAddr, serverName)
+	entries := r.handshakes[key]
+	if len(entries) <= 0 {
+		return nil
+	}
+	r.handshakes[key] = entries[1:]
+	return entries[0]
+}
+
+func (r *Replayer) nextLookup(hostname string) *Lookup {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entries := r.lookups[hostname]
+	if len(entries) <= 0 {
+		return nil
+	}
+	r.lookups[hostname] = entries[1:]
+	return entries[0]
+}
@@ -0,0 +1,179 @@
+package replay_test
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ooni/probe-engine/netx"
+	"github.com/ooni/probe-engine/netx/errorx"
+	"github.com/ooni/probe-engine/netx/replay"
+	"github.com/ooni/probe-engine/netx/trace"
+)
+
+// fakeResolver resolves www.example.com and blocked.invalid
+// to 127.0.0.1 and fails for any other domain.
+type fakeResolver struct{}
+
+func (fakeResolver) LookupHost(ctx context.Context, hostname string) ([]string, error) {
+	switch hostname {
+	case "www.example.com", "blocked.invalid":
+		return []string{"127.0.0.1"}, nil
+	}
+	return nil, errors.New("no such host")
+}
+
+func (fakeResolver) Network() string {
+	return "fake"
+}
+
+func (fakeResolver) Address() string {
+	return "fake.example.com"
+}
+
+type result struct {
+	body    string
+	failure string
+}
+
+// fetchAll fetches all the URLs using the specified config and
+// returns the results along with the saved TLS handshakes.
+func fetchAll(config netx.Config, URLs []string) ([]result, []trace.Event) {
+	saver := new(trace.Saver)
+	config.BaseResolver = fakeResolver{}
+	config.TLSSaver = saver
+	txp := netx.NewHTTPTransport(config)
+	defer txp.CloseIdleConnections()
+	var results []result
+	for _, URL := range URLs {
+		results = append(results, fetch(txp, URL))
+	}
+	return results, saver.Read()
+}
+
+func fetch(txp netx.HTTPRoundTripper, URL string) result {
+	req, err := http.NewRequest("GET", URL, nil)
+	if err != nil {
+		return result{failure: err.Error()}
+	}
+	resp, err := txp.RoundTrip(req)
+	if err != nil {
+		return result{failure: err.Error()}
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return result{failure: err.Error()}
+	}
+	return result{body: string(data)}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("hello from " + r.URL.Path))
+		}))
+	savedCertPool := netx.CertPool
+	defer func() {
+		netx.CertPool = savedCertPool
+	}()
+	netx.CertPool = x509.NewCertPool()
+	netx.CertPool.AddCert(server.Certificate())
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, closedPort, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.Close() // so connecting will fail
+	URLs := []string{
+		"https://www.example.com:" + port + "/first",
+		"https://www.example.com:" + port + "/second", // reuses the connection
+		"https://blocked.invalid:" + port + "/",       // invalid certificate
+		"https://www.example.com:" + closedPort + "/", // connection refused
+		"https://nxdomain.example.com/",               // DNS failure
+	}
+	recorder := replay.NewRecorder()
+	expected, expectedTLS := fetchAll(netx.Config{Recorder: recorder}, URLs)
+	server.Close()
+	if expected[0].body != "hello from /first" || expected[1].body != "hello from /second" {
+		t.Fatal("unexpected bodies", expected)
+	}
+	for _, entry := range expected[2:] {
+		if entry.failure == "" {
+			t.Fatal("expected a failure here", expected)
+		}
+	}
+	if expected[2].failure != errorx.FailureSSLInvalidHostname {
+		t.Fatal("unexpected failure", expected[2].failure)
+	}
+	dir, err := ioutil.TempDir("", "replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "recording.json")
+	if err := recorder.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	replayer, err := replay.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, resultsTLS := fetchAll(netx.Config{Replayer: replayer}, URLs)
+	for idx := range expected {
+		if results[idx] != expected[idx] {
+			t.Fatal("unexpected result", idx, results[idx], expected[idx])
+		}
+	}
+	if len(resultsTLS) != len(expectedTLS) {
+		t.Fatal("unexpected number of TLS events")
+	}
+	for idx := range expectedTLS {
+		if resultsTLS[idx].Name != expectedTLS[idx].Name ||
+			resultsTLS[idx].TLSServerName != expectedTLS[idx].TLSServerName ||
+			resultsTLS[idx].TLSNegotiatedProto != expectedTLS[idx].TLSNegotiatedProto ||
+			len(resultsTLS[idx].TLSPeerCerts) != len(expectedTLS[idx].TLSPeerCerts) {
+			t.Fatal("unexpected TLS event", idx)
+		}
+	}
+	// We have consumed the recording, so we cannot connect again
+	result := fetch(netx.NewHTTPTransport(netx.Config{Replayer: replayer}), URLs[0])
+	if result.failure == "" {
+		t.Fatal("expected a failure here")
+	}
+}
+
+func TestReplayNotRecorded(t *testing.T) {
+	replayer := replay.NewReplayer(&replay.Recording{})
+	dialer := replay.PlaybackDialer{Replayer: replayer}
+	if _, err := dialer.DialContext(context.Background(), "tcp", "8.8.8.8:53"); !errors.Is(err, replay.ErrNotRecorded) {
+		t.Fatal("not the error we expected", err)
+	}
+	resolver := replay.PlaybackResolver{Replayer: replayer}
+	if _, err := resolver.LookupHost(context.Background(), "dns.google"); !errors.Is(err, replay.ErrNotRecorded) {
+		t.Fatal("not the error we expected", err)
+	}
+}
+
+func TestReadFileFailures(t *testing.T) {
+	if _, err := replay.ReadFile("/nonexistent"); err == nil {
+		t.Fatal("expected an error here")
+	}
+	if _, err := replay.Unmarshal([]byte("{")); err == nil {
+		t.Fatal("expected an error here")
+	}
+}
@@ -18,18 +18,10 @@ type MiekgDecoder struct{}
 
 // Decode implements Decoder.Decode.
 func (d MiekgDecoder) Decode(qtype uint16, data []byte) ([]string, error) {
-	reply := new(dns.Msg)
-	if err := reply.Unpack(data); err != nil {
+	reply, err := unpackReply(data)
+	if err != nil {
 		return nil, err
 	}
-	// TODO(bassosimone): map more errors to net.DNSError names
-	switch reply.Rcode {
-	case dns.RcodeSuccess:
-	case dns.RcodeNameError:
-		return nil, errors.New("ooniresolver: no such host")
-	default:
-		return nil, errors.New("ooniresolver: query failed")
-	}
 	var addrs []string
 	for _, answer := range reply.Answer {
 		switch qtype {
@@ -51,4 +43,41 @@ func (d MiekgDecoder) Decode(qtype uint16, data []byte) ([]string, error) {
 	return addrs, nil
 }
 
+// decodeRecords decodes a DNS reply and returns the records of the
+// given qtype inside the answer section. Like MiekgDecoder.Decode, it
+// returns an error if there are no such records.
+func decodeRecords(qtype uint16, data []byte) ([]dns.RR, error) {
+	reply, err := unpackReply(data)
+	if err != nil {
+		return nil, err
+	}
+	var records []dns.RR
+	for _, answer := range reply.Answer {
+		if answer.Header().Rrtype == qtype {
+			records = append(records, answer)
+		}
+	}
+	if len(records) <= 0 {
+		return nil, errors.New("ooniresolver: no response returned")
+	}
+	return records, nil
+}
+
+// unpackReply unpacks a DNS reply and maps its rcode to an error.
+func unpackReply(data []byte) (*dns.Msg, error) {
+	reply := new(dns.Msg)
+	if err := reply.Unpack(data); err != nil {
+		return nil, err
+	}
+	// TODO(bassosimone): map more errors to net.DNSError names
+	switch reply.Rcode {
+	case dns.RcodeSuccess:
+	case dns.RcodeNameError:
+		return nil, errors.New("ooniresolver: no such host")
+	default:
+		return nil, errors.New("ooniresolver: query failed")
+	}
+	return reply, nil
+}
+
 var _ Decoder = MiekgDecoder{}
@@ -75,3 +75,30 @@ func (t DNSOverHTTPS) Address() string {
 }
 
 var _ RoundTripper = DNSOverHTTPS{}
+
+// DNSOverHTTP3 is a DNS over HTTP/3 RoundTripper. It behaves exactly like
+// DNSOverHTTPS except that it reports a different network. The caller is
+// responsible for providing a Do function that uses HTTP/3.
+type DNSOverHTTP3 struct {
+	DNSOverHTTPS
+}
+
+// NewDNSOverHTTP3 creates a new DNSOverHTTP3 instance from the specified
+// http.Client, which should be using HTTP/3, and URL.
+func NewDNSOverHTTP3(client *http.Client, URL string) DNSOverHTTP3 {
+	return NewDNSOverHTTP3WithHostOverride(client, URL, "")
+}
+
+// NewDNSOverHTTP3WithHostOverride is like NewDNSOverHTTP3 except that
+// it's creating a resolver where we use the specified host.
+func NewDNSOverHTTP3WithHostOverride(client *http.Client, URL, hostOverride string) DNSOverHTTP3 {
+	return DNSOverHTTP3{DNSOverHTTPS: NewDNSOverHTTPSWithHostOverride(
+		client, URL, hostOverride)}
+}
+
+// Network returns the transport network (e.g., doh, dot)
+func (t DNSOverHTTP3) Network() string {
+	return "doh3"
+}
+
+var _ RoundTripper = DNSOverHTTP3{}
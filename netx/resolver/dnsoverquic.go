@@ -0,0 +1,113 @@
+//go:build !DISABLE_QUIC
+// +build !DISABLE_QUIC
+
+package resolver
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"math"
+	"time"
+
+	"github.com/lucas-clemente/quic-go"
+)
+
+// QUICDialContextFunc is a generic function for dialing a QUIC session.
+type QUICDialContextFunc func(ctx context.Context, network, address string,
+	tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlySession, error)
+
+// DNSOverQUICNextProto is the ALPN used by DNS over QUIC (RFC9250).
+const DNSOverQUICNextProto = "doq"
+
+// DNSOverQUIC is a DNS over QUIC RoundTripper. We implement the
+// protocol described by RFC9250, where each query is sent on its own
+// bidirectional stream and is prefixed by its two-octets length.
+//
+// As a known bug, this implementation always creates a new session
+// for each incoming query, thus increasing the response delay.
+type DNSOverQUIC struct {
+	dial      QUICDialContextFunc
+	address   string
+	tlsConfig *tls.Config
+}
+
+// NewDNSOverQUIC creates a new DNSOverQUIC transport. The tlsConfig
+// argument may be nil, in which case we use an empty config. In any case
+// we always override the ALPN to be the one required by DNS over QUIC.
+func NewDNSOverQUIC(
+	dial QUICDialContextFunc, address string, tlsConfig *tls.Config) DNSOverQUIC {
+	return DNSOverQUIC{dial: dial, address: address, tlsConfig: tlsConfig}
+}
+
+// RoundTrip implements RoundTripper.RoundTrip.
+func (t DNSOverQUIC) RoundTrip(ctx context.Context, query []byte) ([]byte, error) {
+	if len(query) > math.MaxUint16 {
+		return nil, errors.New("query too long")
+	}
+	if len(query) < 2 {
+		return nil, errors.New("query too short")
+	}
+	config := t.tlsConfig
+	if config == nil {
+		config = new(tls.Config)
+	} else {
+		config = config.Clone()
+	}
+	config.NextProtos = []string{DNSOverQUICNextProto}
+	sess, err := t.dial(ctx, "udp", t.address, config, &quic.Config{})
+	if err != nil {
+		return nil, err
+	}
+	defer sess.CloseWithError(0, "")
+	stream, err := sess.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err = stream.SetDeadline(time.Now().Add(10 * time.Second)); err != nil {
+		return nil, err
+	}
+	// Write request. RFC9250 Sec. 4.2.1 says that the message ID MUST
+	// be zero, so we clear it in the copy of the query we send.
+	buf := []byte{byte(len(query) >> 8)}
+	buf = append(buf, byte(len(query)))
+	buf = append(buf, 0, 0)
+	buf = append(buf, query[2:]...)
+	if _, err = stream.Write(buf); err != nil {
+		return nil, err
+	}
+	// Closing the stream only closes its write side and tells the
+	// server that we are not going to send any more data.
+	if err = stream.Close(); err != nil {
+		return nil, err
+	}
+	// Read response
+	header := make([]byte, 2)
+	if _, err = io.ReadFull(stream, header); err != nil {
+		return nil, err
+	}
+	length := int(header[0])<<8 | int(header[1])
+	reply := make([]byte, length)
+	if _, err = io.ReadFull(stream, reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// RequiresPadding returns true for DoQ according to RFC9250.
+func (t DNSOverQUIC) RequiresPadding() bool {
+	return true
+}
+
+// Network returns the transport network (e.g., doh, dot)
+func (t DNSOverQUIC) Network() string {
+	return "doq"
+}
+
+// Address returns the upstream server address.
+func (t DNSOverQUIC) Address() string {
+	return t.address
+}
+
+var _ RoundTripper = DNSOverQUIC{}
@@ -0,0 +1,313 @@
+//go:build !DISABLE_QUIC
+// +build !DISABLE_QUIC
+
+package resolver_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/http3"
+	"github.com/miekg/dns"
+	"github.com/ooni/probe-engine/netx/httptransport"
+	"github.com/ooni/probe-engine/netx/quicdialer"
+	"github.com/ooni/probe-engine/netx/resolver"
+	"github.com/ooni/probe-engine/netx/trace"
+)
+
+func TestUnitDNSOverQUICQueryTooLarge(t *testing.T) {
+	const address = "9.9.9.9:853"
+	txp := resolver.NewDNSOverQUIC(quicdialer.SystemDialer{}.DialContext, address, nil)
+	reply, err := txp.RoundTrip(context.Background(), make([]byte, 1<<18))
+	if err == nil {
+		t.Fatal("expected an error here")
+	}
+	if reply != nil {
+		t.Fatal("expected nil reply here")
+	}
+}
+
+func TestUnitDNSOverQUICQueryTooShort(t *testing.T) {
+	const address = "9.9.9.9:853"
+	txp := resolver.NewDNSOverQUIC(quicdialer.SystemDialer{}.DialContext, address, nil)
+	reply, err := txp.RoundTrip(context.Background(), make([]byte, 1))
+	if err == nil {
+		t.Fatal("expected an error here")
+	}
+	if reply != nil {
+		t.Fatal("expected nil reply here")
+	}
+}
+
+func TestUnitDNSOverQUICDialFailure(t *testing.T) {
+	const address = "9.9.9.9:853"
+	mocked := errors.New("mocked error")
+	var tlsConfig *tls.Config
+	txp := resolver.NewDNSOverQUIC(func(ctx context.Context, network, address string,
+		tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlySession, error) {
+		tlsConfig = tlsCfg
+		return nil, mocked
+	}, address, &tls.Config{ServerName: "dns.quad9.net"})
+	reply, err := txp.RoundTrip(context.Background(), make([]byte, 1<<11))
+	if !errors.Is(err, mocked) {
+		t.Fatal("not the error we expected")
+	}
+	if reply != nil {
+		t.Fatal("expected nil reply here")
+	}
+	if tlsConfig.ServerName != "dns.quad9.net" {
+		t.Fatal("not the ServerName we expected")
+	}
+	if len(tlsConfig.NextProtos) != 1 || tlsConfig.NextProtos[0] != "doq" {
+		t.Fatal("not the NextProtos we expected")
+	}
+}
+
+func TestUnitDNSOverQUICTransportOK(t *testing.T) {
+	const address = "9.9.9.9:853"
+	txp := resolver.NewDNSOverQUIC(quicdialer.SystemDialer{}.DialContext, address, nil)
+	if txp.RequiresPadding() != true {
+		t.Fatal("invalid RequiresPadding")
+	}
+	if txp.Network() != "doq" {
+		t.Fatal("invalid Network")
+	}
+	if txp.Address() != address {
+		t.Fatal("invalid Address")
+	}
+}
+
+func TestUnitDNSOverHTTP3TransportOK(t *testing.T) {
+	const URL = "https://dns.google/dns-query"
+	txp := resolver.NewDNSOverHTTP3(http.DefaultClient, URL)
+	if txp.RequiresPadding() != true {
+		t.Fatal("invalid RequiresPadding")
+	}
+	if txp.Network() != "doh3" {
+		t.Fatal("invalid Network")
+	}
+	if txp.Address() != URL {
+		t.Fatal("invalid Address")
+	}
+}
+
+// newLocalTLSConfigs returns the TLS configs for a local QUIC server
+// and for its clients. We borrow the certificate of httptest, which is
+// valid for example.com and 127.0.0.1.
+func newLocalTLSConfigs(nextProto string) (*tls.Config, *tls.Config) {
+	srv := httptest.NewUnstartedServer(nil)
+	srv.StartTLS()
+	defer srv.Close()
+	serverConfig := &tls.Config{
+		Certificates: srv.TLS.Certificates,
+		NextProtos:   []string{nextProto},
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	clientConfig := &tls.Config{RootCAs: pool}
+	return serverConfig, clientConfig
+}
+
+// genLocalReply generates a reply for the given query that always
+// resolves to 127.0.0.1 when the query type is A.
+func genLocalReply(query *dns.Msg) ([]byte, error) {
+	reply := new(dns.Msg)
+	reply.SetReply(query)
+	if query.Question[0].Qtype == dns.TypeA {
+		rr, err := dns.NewRR(query.Question[0].Name + " 300 IN A 127.0.0.1")
+		if err != nil {
+			return nil, err
+		}
+		reply.Answer = append(reply.Answer, rr)
+	}
+	return reply.Pack()
+}
+
+// serveDoQ implements a minimal DNS over QUIC server. Each query
+// is served using a separate session, like our client does.
+func serveDoQ(listener quic.Listener, errch chan<- error) {
+	for {
+		sess, err := listener.Accept(context.Background())
+		if err != nil {
+			return // the listener has been closed
+		}
+		stream, err := sess.AcceptStream(context.Background())
+		if err != nil {
+			errch <- err
+			continue
+		}
+		data, err := ioutil.ReadAll(stream)
+		if err != nil {
+			errch <- err
+			continue
+		}
+		if len(data) < 2 || int(data[0])<<8|int(data[1]) != len(data)-2 {
+			errch <- errors.New("invalid length prefix")
+			continue
+		}
+		query := new(dns.Msg)
+		if err := query.Unpack(data[2:]); err != nil {
+			errch <- err
+			continue
+		}
+		if query.Id != 0 {
+			errch <- errors.New("the query ID is not zero")
+			continue
+		}
+		reply, err := genLocalReply(query)
+		if err != nil {
+			errch <- err
+			continue
+		}
+		buf := []byte{byte(len(reply) >> 8), byte(len(reply))}
+		if _, err := stream.Write(append(buf, reply...)); err != nil {
+			errch <- err
+			continue
+		}
+		stream.Close()
+	}
+}
+
+func TestDNSOverQUICWithLocalServer(t *testing.T) {
+	serverConfig, clientConfig := newLocalTLSConfigs("doq")
+	listener, err := quic.ListenAddr("127.0.0.1:0", serverConfig, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	errch := make(chan error, 16)
+	go serveDoQ(listener, errch)
+	clientConfig.ServerName = "example.com"
+	saver := new(trace.Saver)
+	txp := resolver.SaverDNSTransport{
+		RoundTripper: resolver.NewDNSOverQUIC(
+			quicdialer.SystemDialer{}.DialContext,
+			listener.Addr().String(), clientConfig),
+		Saver: saver,
+	}
+	r := resolver.NewSerialResolver(txp)
+	addrs, err := r.LookupHost(context.Background(), "www.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 1 || addrs[0] != "127.0.0.1" {
+		t.Fatal("not the addresses we expected")
+	}
+	select {
+	case err := <-errch:
+		t.Fatal(err)
+	default:
+	}
+	events := saver.Read()
+	if len(events) != 4 {
+		t.Fatal("unexpected number of events")
+	}
+	for _, ev := range events {
+		if ev.Proto != "doq" {
+			t.Fatal("unexpected Proto")
+		}
+		if ev.Address != listener.Addr().String() {
+			t.Fatal("unexpected Address")
+		}
+		if ev.DNSQuery == nil {
+			t.Fatal("expected to see the DNS query")
+		}
+		if ev.Name == "dns_round_trip_done" && ev.DNSReply == nil {
+			t.Fatal("expected to see the DNS reply")
+		}
+	}
+}
+
+func TestDNSOverQUICWithLocalServerAndInvalidCertificate(t *testing.T) {
+	serverConfig, _ := newLocalTLSConfigs("doq")
+	listener, err := quic.ListenAddr("127.0.0.1:0", serverConfig, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	errch := make(chan error, 16)
+	go serveDoQ(listener, errch)
+	txp := resolver.NewDNSOverQUIC(quicdialer.SystemDialer{}.DialContext,
+		listener.Addr().String(), &tls.Config{ServerName: "example.com"})
+	r := resolver.NewSerialResolver(txp)
+	addrs, err := r.LookupHost(context.Background(), "www.example.com")
+	if err == nil {
+		t.Fatal("expected an error here")
+	}
+	if addrs != nil {
+		t.Fatal("expected nil addrs here")
+	}
+}
+
+func TestDNSOverHTTP3WithLocalServer(t *testing.T) {
+	serverConfig, clientConfig := newLocalTLSConfigs(http3.NextProtoH3)
+	srv := &http3.Server{Server: &http.Server{
+		Addr: "127.0.0.1:0",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			data, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				w.WriteHeader(400)
+				return
+			}
+			query := new(dns.Msg)
+			if err := query.Unpack(data); err != nil {
+				w.WriteHeader(400)
+				return
+			}
+			reply, err := genLocalReply(query)
+			if err != nil {
+				w.WriteHeader(500)
+				return
+			}
+			w.Header().Set("content-type", "application/dns-message")
+			io.Copy(w, bytes.NewReader(reply))
+		}),
+		TLSConfig: serverConfig,
+	}}
+	udpConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(udpConn)
+	defer srv.Close()
+	clientConfig.ServerName = "example.com"
+	httpClient := &http.Client{Transport: httptransport.NewHTTP3Transport(
+		quicdialer.SystemDialer{}, clientConfig)}
+	defer httpClient.CloseIdleConnections()
+	saver := new(trace.Saver)
+	txp := resolver.SaverDNSTransport{
+		RoundTripper: resolver.NewDNSOverHTTP3(
+			httpClient, "https://"+udpConn.LocalAddr().String()+"/dns-query"),
+		Saver: saver,
+	}
+	r := resolver.NewSerialResolver(txp)
+	addrs, err := r.LookupHost(context.Background(), "www.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 1 || addrs[0] != "127.0.0.1" {
+		t.Fatal("not the addresses we expected")
+	}
+	events := saver.Read()
+	if len(events) != 4 {
+		t.Fatal("unexpected number of events")
+	}
+	for _, ev := range events {
+		if ev.Proto != "doh3" {
+			t.Fatal("unexpected Proto")
+		}
+		if ev.Name == "dns_round_trip_done" && ev.DNSReply == nil {
+			t.Fatal("expected to see the DNS reply")
+		}
+	}
+}
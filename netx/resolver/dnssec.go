@@ -0,0 +1,703 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/ooni/probe-engine/netx/errorx"
+	"github.com/ooni/probe-engine/netx/trace"
+)
+
+const (
+	// DNSSECSecure indicates that we validated the reply.
+	DNSSECSecure = "dnssec_secure"
+
+	// DNSSECInsecure indicates that we proved that the reply
+	// comes from a zone that is not signed.
+	DNSSECInsecure = "dnssec_insecure"
+
+	// DNSSECBogus indicates that the reply should have been signed
+	// but we could not validate it, so it has most likely been forged.
+	DNSSECBogus = "dnssec_bogus"
+)
+
+// RootTrustAnchors contains the DS records of the root zone KSKs
+// published at https://data.iana.org/root-anchors/root-anchors.xml.
+var RootTrustAnchors = []string{
+	". 86400 IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D",
+	". 86400 IN DS 38696 8 2 683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16",
+}
+
+// dnssecMaxDepth is the maximum number of zones we walk through
+// while building a chain of trust. It protects us from loops.
+const dnssecMaxDepth = 32
+
+// DNSSECResolver is a resolver that validates the replies using DNSSEC.
+//
+// We send queries with the DO and CD bits set, such that the upstream
+// resolver gives us the signatures without validating them. Then, we
+// fetch the DS and DNSKEY records required to build the chain of trust
+// from the trust anchors down to the zone that signed the reply. When the
+// reply is not signed, we look for a signed proof that the zone is not
+// signed. We fail the lookups whose replies are bogus.
+//
+// When the Saver is set, we emit a dnssec_validate_done event for
+// each A and AAAA query, telling the result of the validation, and a
+// dnssec_chain_query event for each query we send to build the chain
+// of trust, such that one can tell these queries apart.
+type DNSSECResolver struct {
+	Anchors []string     // default: RootTrustAnchors
+	Saver   *trace.Saver // default: not saving
+	Txp     RoundTripper
+	keys    *dnssecKeyCache
+}
+
+// NewDNSSECResolver creates a new DNSSECResolver instance.
+func NewDNSSECResolver(t RoundTripper) DNSSECResolver {
+	return DNSSECResolver{Txp: t, keys: new(dnssecKeyCache)}
+}
+
+// Transport returns the transport being used.
+func (r DNSSECResolver) Transport() RoundTripper {
+	return r.Txp
+}
+
+// Network implements Resolver.Network
+func (r DNSSECResolver) Network() string {
+	return r.Txp.Network()
+}
+
+// Address implements Resolver.Address
+func (r DNSSECResolver) Address() string {
+	return r.Txp.Address()
+}
+
+// errDNSSECNoData indicates that a reply we validated does not contain
+// any record of the type we asked for.
+var errDNSSECNoData = errors.New("ooniresolver: no response returned")
+
+// LookupHost implements Resolver.LookupHost.
+//
+// Implementation note: unlike other resolvers, we fail when either the A
+// or the AAAA lookup fails, e.g., because its reply is bogus. Otherwise,
+// an attacker could forge one of the two replies and we would not notice
+// because the other reply is fine. The only failure we tolerate is a
+// validated reply not containing any record of the type we asked for.
+func (r DNSSECResolver) LookupHost(ctx context.Context, hostname string) ([]string, error) {
+	var addrs []string
+	addrsA, errA := r.lookupHost(ctx, hostname, dns.TypeA)
+	addrsAAAA, errAAAA := r.lookupHost(ctx, hostname, dns.TypeAAAA)
+	for _, err := range []error{errA, errAAAA} {
+		if err != nil && err != errDNSSECNoData {
+			return nil, err
+		}
+	}
+	addrs = append(addrs, addrsA...)
+	addrs = append(addrs, addrsAAAA...)
+	if len(addrs) <= 0 {
+		return nil, errDNSSECNoData
+	}
+	return addrs, nil
+}
+
+// LookupRecords implements RecordsResolver.LookupRecords.
+func (r DNSSECResolver) LookupRecords(
+	ctx context.Context, domain string, qtype uint16) ([]dns.RR, error) {
+	replydata, err := r.lookup(ctx, domain, qtype)
+	if err != nil {
+		return nil, err
+	}
+	return decodeRecords(qtype, replydata)
+}
+
+func (r DNSSECResolver) lookupHost(
+	ctx context.Context, hostname string, qtype uint16) ([]string, error) {
+	replydata, err := r.lookup(ctx, hostname, qtype)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := unpackReply(replydata); err != nil {
+		return nil, err
+	}
+	addrs, err := MiekgDecoder{}.Decode(qtype, replydata)
+	if err != nil {
+		return nil, errDNSSECNoData
+	}
+	return addrs, nil
+}
+
+// lookup sends the query, validates the reply, and returns the reply
+// unless there was a failure or the reply is bogus.
+func (r DNSSECResolver) lookup(
+	ctx context.Context, hostname string, qtype uint16) ([]byte, error) {
+	start := time.Now()
+	var status string
+	querydata, replydata, err := r.roundTrip(ctx, hostname, qtype)
+	if err == nil {
+		observeTTL(ctx, replydata)
+		status, err = r.validate(ctx, replydata)
+	}
+	stop := time.Now()
+	if r.Saver != nil {
+		r.Saver.Write(trace.Event{
+			Address:      r.Address(),
+			DNSQuery:     querydata,
+			DNSReply:     replydata,
+			DNSSECStatus: status,
+			Duration:     stop.Sub(start),
+			Err:          err,
+			Hostname:     hostname,
+			Name:         "dnssec_validate_done",
+			Proto:        r.Network(),
+			Time:         stop,
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	if status == DNSSECBogus {
+		return nil, errorx.ErrDNSSECBogus
+	}
+	return replydata, nil
+}
+
+func (r DNSSECResolver) roundTrip(
+	ctx context.Context, domain string, qtype uint16) ([]byte, []byte, error) {
+	query := newQuery(domain, qtype)
+	query.CheckingDisabled = true
+	query.SetEdns0(EDNS0MaxResponseSize, true)
+	if r.Txp.RequiresPadding() {
+		padQuery(query)
+	}
+	querydata, err := query.Pack()
+	if err != nil {
+		return nil, nil, err
+	}
+	replydata, err := r.Txp.RoundTrip(ctx, querydata)
+	if err != nil {
+		return querydata, nil, err
+	}
+	return querydata, replydata, nil
+}
+
+// query sends a query and returns the parsed reply. We use it
+// for the queries required to build the chain of trust.
+func (r DNSSECResolver) query(
+	ctx context.Context, domain string, qtype uint16) (*dns.Msg, error) {
+	querydata, replydata, err := r.roundTrip(ctx, domain, qtype)
+	if r.Saver != nil && querydata != nil {
+		r.Saver.Write(trace.Event{
+			Address:  r.Address(),
+			DNSQuery: querydata,
+			Err:      err,
+			Hostname: domain,
+			Name:     "dnssec_chain_query",
+			Proto:    r.Network(),
+			Time:     time.Now(),
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	reply := new(dns.Msg)
+	if err := reply.Unpack(replydata); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// validate returns the DNSSEC status of the given reply. The status is
+// empty when the reply is a failure (e.g. SERVFAIL) that we cannot validate.
+func (r DNSSECResolver) validate(ctx context.Context, data []byte) (string, error) {
+	reply := new(dns.Msg)
+	if err := reply.Unpack(data); err != nil {
+		return "", err
+	}
+	return r.validateMsg(ctx, reply, 0)
+}
+
+func (r DNSSECResolver) validateMsg(
+	ctx context.Context, msg *dns.Msg, depth int) (string, error) {
+	if msg.Rcode != dns.RcodeSuccess && msg.Rcode != dns.RcodeNameError {
+		return "", nil
+	}
+	if len(msg.Question) != 1 {
+		return DNSSECBogus, nil
+	}
+	qtype := msg.Question[0].Qtype
+	target := canonicalName(msg.Question[0].Name)
+	status := DNSSECSecure
+	for _, set := range groupRRsets(msg.Answer) {
+		setStatus, err := r.validateRRset(ctx, set, depth)
+		if err != nil {
+			return "", err
+		}
+		status = worseDNSSECStatus(status, setStatus)
+	}
+	target = followCNAMEs(msg.Answer, target)
+	if msg.Rcode == dns.RcodeNameError || !hasRRType(msg.Answer, target, qtype) {
+		denialStatus, err := r.validateDenial(ctx, msg, target, qtype, depth)
+		if err != nil {
+			return "", err
+		}
+		status = worseDNSSECStatus(status, denialStatus)
+	}
+	return status, nil
+}
+
+func (r DNSSECResolver) validateRRset(
+	ctx context.Context, set *dnssecRRset, depth int) (string, error) {
+	if len(set.sigs) <= 0 {
+		return r.proveInsecure(ctx, set.name, depth+1)
+	}
+	for _, sig := range set.sigs {
+		signer := canonicalName(sig.SignerName)
+		if !dns.IsSubDomain(signer, set.name) {
+			continue
+		}
+		keys, status, err := r.zoneKeys(ctx, signer, depth+1)
+		if err != nil {
+			return "", err
+		}
+		if status != DNSSECSecure {
+			return status, nil
+		}
+		if verifyRRSIG(sig, keys, set.rrs) {
+			return DNSSECSecure, nil
+		}
+	}
+	return DNSSECBogus, nil
+}
+
+// validateDenial validates the NSEC or NSEC3 records proving that the
+// target does not exist or does not have records of the given type.
+func (r DNSSECResolver) validateDenial(ctx context.Context, msg *dns.Msg,
+	target string, qtype uint16, depth int) (string, error) {
+	var (
+		nsecs  []*dns.NSEC
+		nsec3s []*dns.NSEC3
+		status = DNSSECSecure
+		found  bool
+	)
+	for _, set := range groupRRsets(msg.Ns) {
+		if set.rrtype != dns.TypeNSEC && set.rrtype != dns.TypeNSEC3 {
+			continue
+		}
+		found = true
+		setStatus, err := r.validateRRset(ctx, set, depth)
+		if err != nil {
+			return "", err
+		}
+		status = worseDNSSECStatus(status, setStatus)
+		for _, rr := range set.rrs {
+			switch v := rr.(type) {
+			case *dns.NSEC:
+				nsecs = append(nsecs, v)
+			case *dns.NSEC3:
+				nsec3s = append(nsec3s, v)
+			}
+		}
+	}
+	if !found {
+		// Either the zone is not signed or someone removed the proof.
+		return r.proveInsecure(ctx, target, depth+1)
+	}
+	if status != DNSSECSecure {
+		return status, nil
+	}
+	proved := provesNODATA(target, qtype, nsecs, nsec3s)
+	if msg.Rcode == dns.RcodeNameError {
+		proved = provesNXDOMAIN(target, nsecs, nsec3s)
+	}
+	if !proved {
+		return DNSSECBogus, nil
+	}
+	return DNSSECSecure, nil
+}
+
+// proveInsecure checks whether name belongs to a zone that is not signed,
+// which requires a signed proof that one of its ancestors delegated to
+// such zone without a DS record. If name belongs to a signed zone, then
+// an unsigned reply for name is bogus.
+func (r DNSSECResolver) proveInsecure(
+	ctx context.Context, name string, depth int) (string, error) {
+	name = canonicalName(name)
+	if depth > dnssecMaxDepth || name == "." {
+		return DNSSECBogus, nil // the root zone is signed
+	}
+	reply, err := r.query(ctx, name, dns.TypeDS)
+	if err != nil {
+		return "", err
+	}
+	if !hasRRSIG(reply) {
+		// This name belongs to a zone that is not signed, so we need to
+		// find the point where the chain of trust is securely broken.
+		return r.proveInsecure(ctx, parentName(name), depth+1)
+	}
+	status, err := r.validateMsg(ctx, reply, depth+1)
+	if err != nil || status != DNSSECSecure {
+		return status, err
+	}
+	if hasRRType(reply.Answer, name, dns.TypeDS) {
+		return DNSSECBogus, nil // the zone is signed
+	}
+	return DNSSECInsecure, nil
+}
+
+// zoneKeys returns the validated keys of zone. The status is insecure when
+// we proved that zone is not signed and bogus when we could not build the
+// chain of trust from the trust anchors down to zone.
+func (r DNSSECResolver) zoneKeys(
+	ctx context.Context, zone string, depth int) ([]*dns.DNSKEY, string, error) {
+	if depth > dnssecMaxDepth {
+		return nil, DNSSECBogus, nil
+	}
+	if entry, found := r.keys.get(zone); found {
+		return entry.keys, entry.status, nil
+	}
+	var dsset []*dns.DS
+	if zone == "." {
+		anchors, err := r.trustAnchors()
+		if err != nil {
+			return nil, "", err
+		}
+		dsset = anchors
+	} else {
+		reply, err := r.query(ctx, zone, dns.TypeDS)
+		if err != nil {
+			return nil, "", err
+		}
+		status, err := r.validateMsg(ctx, reply, depth)
+		if err != nil {
+			return nil, "", err
+		}
+		if status == DNSSECInsecure {
+			r.keys.set(zone, dnssecKeyCacheEntry{status: status})
+		}
+		if status != DNSSECSecure {
+			return nil, status, nil
+		}
+		for _, rr := range reply.Answer {
+			if ds, ok := rr.(*dns.DS); ok && canonicalName(ds.Hdr.Name) == zone {
+				dsset = append(dsset, ds)
+			}
+		}
+		if len(dsset) <= 0 {
+			// We have a signed proof that zone is not signed
+			r.keys.set(zone, dnssecKeyCacheEntry{status: DNSSECInsecure})
+			return nil, DNSSECInsecure, nil
+		}
+	}
+	reply, err := r.query(ctx, zone, dns.TypeDNSKEY)
+	if err != nil {
+		return nil, "", err
+	}
+	var (
+		keys []*dns.DNSKEY
+		rrs  []dns.RR
+		sigs []*dns.RRSIG
+	)
+	for _, rr := range reply.Answer {
+		if canonicalName(rr.Header().Name) != zone {
+			continue
+		}
+		switch v := rr.(type) {
+		case *dns.DNSKEY:
+			keys = append(keys, v)
+			rrs = append(rrs, v)
+		case *dns.RRSIG:
+			if v.TypeCovered == dns.TypeDNSKEY {
+				sigs = append(sigs, v)
+			}
+		}
+	}
+	for _, ds := range dsset {
+		for _, key := range keys {
+			if key.KeyTag() != ds.KeyTag || key.Algorithm != ds.Algorithm {
+				continue
+			}
+			digest := key.ToDS(ds.DigestType)
+			if digest == nil || !strings.EqualFold(digest.Digest, ds.Digest) {
+				continue
+			}
+			for _, sig := range sigs {
+				if verifyRRSIG(sig, []*dns.DNSKEY{key}, rrs) {
+					r.keys.set(zone, dnssecKeyCacheEntry{keys: keys, status: DNSSECSecure})
+					return keys, DNSSECSecure, nil
+				}
+			}
+		}
+	}
+	return nil, DNSSECBogus, nil
+}
+
+func (r DNSSECResolver) trustAnchors() ([]*dns.DS, error) {
+	anchors := r.Anchors
+	if len(anchors) <= 0 {
+		anchors = RootTrustAnchors
+	}
+	var out []*dns.DS
+	for _, anchor := range anchors {
+		rr, err := dns.NewRR(anchor)
+		if err != nil {
+			return nil, err
+		}
+		ds, ok := rr.(*dns.DS)
+		if !ok || canonicalName(ds.Hdr.Name) != "." {
+			return nil, errors.New("ooniresolver: invalid trust anchor")
+		}
+		out = append(out, ds)
+	}
+	return out, nil
+}
+
+// dnssecKeyCache caches the result of building the chain of trust
+// for a zone, so that we do not need to do that for every query.
+type dnssecKeyCache struct {
+	entries map[string]dnssecKeyCacheEntry
+	mu      sync.Mutex
+}
+
+type dnssecKeyCacheEntry struct {
+	keys   []*dns.DNSKEY
+	status string
+}
+
+func (c *dnssecKeyCache) get(zone string) (dnssecKeyCacheEntry, bool) {
+	if c == nil {
+		return dnssecKeyCacheEntry{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, found := c.entries[zone]
+	return entry, found
+}
+
+func (c *dnssecKeyCache) set(zone string, entry dnssecKeyCacheEntry) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]dnssecKeyCacheEntry)
+	}
+	c.entries[zone] = entry
+}
+
+// dnssecRRset is a set of records with the same owner and
+// type along with the signatures covering them.
+type dnssecRRset struct {
+	name   string
+	rrtype uint16
+	rrs    []dns.RR
+	sigs   []*dns.RRSIG
+}
+
+// groupRRsets groups the records of a section into RRsets.
+func groupRRsets(section []dns.RR) (out []*dnssecRRset) {
+	find := func(name string, rrtype uint16) *dnssecRRset {
+		for _, set := range out {
+			if set.name == name && set.rrtype == rrtype {
+				return set
+			}
+		}
+		set := &dnssecRRset{name: name, rrtype: rrtype}
+		out = append(out, set)
+		return set
+	}
+	for _, rr := range section {
+		if _, ok := rr.(*dns.RRSIG); !ok {
+			set := find(canonicalName(rr.Header().Name), rr.Header().Rrtype)
+			set.rrs = append(set.rrs, rr)
+		}
+	}
+	for _, rr := range section {
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			name := canonicalName(sig.Hdr.Name)
+			for _, set := range out {
+				if set.name == name && set.rrtype == sig.TypeCovered {
+					set.sigs = append(set.sigs, sig)
+				}
+			}
+		}
+	}
+	return
+}
+
+func verifyRRSIG(sig *dns.RRSIG, keys []*dns.DNSKEY, rrs []dns.RR) bool {
+	for _, key := range keys {
+		if key.Flags&dns.ZONE == 0 || key.KeyTag() != sig.KeyTag ||
+			key.Algorithm != sig.Algorithm {
+			continue
+		}
+		if sig.Verify(key, rrs) == nil && sig.ValidityPeriod(time.Time{}) {
+			return true
+		}
+	}
+	return false
+}
+
+// worseDNSSECStatus returns the worse of two statuses.
+func worseDNSSECStatus(a, b string) string {
+	rank := map[string]int{DNSSECSecure: 0, DNSSECInsecure: 1, DNSSECBogus: 2}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
+
+func canonicalName(name string) string {
+	return strings.ToLower(dns.Fqdn(name))
+}
+
+func parentName(name string) string {
+	indexes := dns.Split(name)
+	if len(indexes) < 2 {
+		return "."
+	}
+	return name[indexes[1]:]
+}
+
+// followCNAMEs returns the name at the end of the CNAME chain starting at name.
+func followCNAMEs(section []dns.RR, name string) string {
+	for i := 0; i < len(section); i++ {
+		var found bool
+		for _, rr := range section {
+			if cname, ok := rr.(*dns.CNAME); ok && canonicalName(cname.Hdr.Name) == name {
+				name, found = canonicalName(cname.Target), true
+				break
+			}
+		}
+		if !found {
+			break
+		}
+	}
+	return name
+}
+
+func hasRRType(section []dns.RR, name string, rrtype uint16) bool {
+	for _, rr := range section {
+		if rr.Header().Rrtype == rrtype && canonicalName(rr.Header().Name) == name {
+			return true
+		}
+	}
+	return false
+}
+
+func hasRRSIG(msg *dns.Msg) bool {
+	for _, section := range [][]dns.RR{msg.Answer, msg.Ns} {
+		for _, rr := range section {
+			if _, ok := rr.(*dns.RRSIG); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// provesNODATA returns whether the records prove that name exists but
+// does not have records of type qtype. For DS queries, we also require
+// the proof that name is a delegation point, because a name without DS
+// records inside a signed zone does not prove anything.
+func provesNODATA(name string, qtype uint16,
+	nsecs []*dns.NSEC, nsec3s []*dns.NSEC3) bool {
+	for _, nsec := range nsecs {
+		if canonicalName(nsec.Hdr.Name) == name {
+			return nodataBitmapOK(nsec.TypeBitMap, qtype)
+		}
+	}
+	for _, nsec3 := range nsec3s {
+		if nsec3.Match(name) {
+			return nodataBitmapOK(nsec3.TypeBitMap, qtype)
+		}
+	}
+	if qtype == dns.TypeDS {
+		// With NSEC3 opt-out (RFC5155 Sect. 6), unsigned delegations
+		// may be covered by a record with the opt-out flag set.
+		for _, nsec3 := range nsec3s {
+			if nsec3.Flags&1 != 0 && nsec3.Cover(name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func nodataBitmapOK(bitmap []uint16, qtype uint16) bool {
+	has := func(rrtype uint16) bool {
+		for _, t := range bitmap {
+			if t == rrtype {
+				return true
+			}
+		}
+		return false
+	}
+	if has(qtype) || has(dns.TypeCNAME) {
+		return false
+	}
+	return qtype != dns.TypeDS || (has(dns.TypeNS) && !has(dns.TypeSOA))
+}
+
+// provesNXDOMAIN returns whether the records prove that name does not
+// exist. With NSEC3, this requires the closest encloser proof described
+// in RFC5155 Sect. 7.2.1.
+//
+// Implementation note: we do not check the proof that there is no
+// wildcard that could have matched name.
+func provesNXDOMAIN(name string, nsecs []*dns.NSEC, nsec3s []*dns.NSEC3) bool {
+	for _, nsec := range nsecs {
+		if nsecCovers(nsec, name) {
+			return true
+		}
+	}
+	for next := name; next != "."; next = parentName(next) {
+		closest := parentName(next)
+		for _, nsec3 := range nsec3s {
+			if !nsec3.Match(closest) {
+				continue
+			}
+			for _, other := range nsec3s {
+				if other.Cover(next) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	return false
+}
+
+// nsecCovers returns whether name falls between the owner name of the
+// NSEC record and the next name, using the canonical ordering.
+func nsecCovers(nsec *dns.NSEC, name string) bool {
+	owner := canonicalName(nsec.Hdr.Name)
+	next := canonicalName(nsec.NextDomain)
+	if !canonicalLess(owner, name) {
+		return false
+	}
+	if canonicalLess(owner, next) {
+		return canonicalLess(name, next)
+	}
+	// This is the last NSEC record of the zone, whose next name
+	// is the zone apex, so it covers all the names after owner.
+	return dns.IsSubDomain(next, name)
+}
+
+// canonicalLess implements the canonical ordering of names described
+// in RFC4034 Sect. 6.1, where we compare labels from right to left.
+func canonicalLess(a, b string) bool {
+	la, lb := dns.SplitDomainName(a), dns.SplitDomainName(b)
+	for i, j := len(la)-1, len(lb)-1; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		if la[i] != lb[j] {
+			return la[i] < lb[j]
+		}
+	}
+	return len(la) < len(lb)
+}
+
+var _ RecordsResolver = DNSSECResolver{}
@@ -0,0 +1,538 @@
+package resolver_test
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/ooni/probe-engine/netx/errorx"
+	"github.com/ooni/probe-engine/netx/resolver"
+	"github.com/ooni/probe-engine/netx/trace"
+)
+
+// signedZone is a zone served by fakeDNSSECTransport.
+type signedZone struct {
+	apex string
+	key  *dns.DNSKEY
+	priv crypto.Signer
+	rrs  []dns.RR
+}
+
+func (z *signedZone) records(name string, rrtype uint16) (out []dns.RR) {
+	for _, rr := range z.rrs {
+		if rr.Header().Name != name {
+			continue
+		}
+		if rr.Header().Rrtype == rrtype {
+			out = append(out, rr)
+		}
+		if sig, ok := rr.(*dns.RRSIG); ok && sig.TypeCovered == rrtype {
+			out = append(out, rr)
+		}
+	}
+	return
+}
+
+func (z *signedZone) exists(name string) bool {
+	for _, rr := range z.rrs {
+		if rr.Header().Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (z *signedZone) covering(name string) (out []dns.RR) {
+	for _, rr := range z.rrs {
+		nsec, ok := rr.(*dns.NSEC)
+		if !ok {
+			continue
+		}
+		owner, next := nsec.Hdr.Name, nsec.NextDomain
+		if compareNames(owner, name) < 0 &&
+			(compareNames(name, next) < 0 || next == z.apex) {
+			out = append(out, z.records(owner, dns.TypeNSEC)...)
+		}
+	}
+	return
+}
+
+func compareNames(a, b string) int {
+	la, lb := dns.SplitDomainName(a), dns.SplitDomainName(b)
+	for i, j := len(la)-1, len(lb)-1; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		if la[i] != lb[j] {
+			return strings.Compare(la[i], lb[j])
+		}
+	}
+	return len(la) - len(lb)
+}
+
+func (z *signedZone) sign(t *testing.T) {
+	type key struct {
+		name   string
+		rrtype uint16
+	}
+	sets := make(map[key][]dns.RR)
+	var keys []key
+	for _, rr := range z.rrs {
+		k := key{name: rr.Header().Name, rrtype: rr.Header().Rrtype}
+		if k.rrtype == dns.TypeNS && k.name != z.apex {
+			continue // delegations are not signed
+		}
+		if _, found := sets[k]; !found {
+			keys = append(keys, k)
+		}
+		sets[k] = append(sets[k], rr)
+	}
+	now := time.Now()
+	for _, k := range keys {
+		sig := &dns.RRSIG{
+			Hdr: dns.RR_Header{
+				Name: k.name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: 3600,
+			},
+			TypeCovered: k.rrtype,
+			Algorithm:   z.key.Algorithm,
+			Labels:      uint8(dns.CountLabel(k.name)),
+			OrigTtl:     3600,
+			Expiration:  uint32(now.Add(time.Hour).Unix()),
+			Inception:   uint32(now.Add(-time.Hour).Unix()),
+			KeyTag:      z.key.KeyTag(),
+			SignerName:  z.apex,
+		}
+		if err := sig.Sign(z.priv, sets[k]); err != nil {
+			t.Fatal(err)
+		}
+		z.rrs = append(z.rrs, sig)
+	}
+}
+
+func newSignedZone(t *testing.T, apex string, records ...string) *signedZone {
+	zone := &signedZone{apex: apex}
+	for _, record := range records {
+		rr, err := dns.NewRR(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zone.rrs = append(zone.rrs, rr)
+	}
+	return zone
+}
+
+func (z *signedZone) generateKey(t *testing.T) {
+	z.key = &dns.DNSKEY{
+		Hdr: dns.RR_Header{
+			Name: z.apex, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600,
+		},
+		Flags:     257,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	priv, err := z.key.Generate(256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	z.priv = priv.(crypto.Signer)
+	z.rrs = append(z.rrs, z.key)
+}
+
+func (z *signedZone) delegate(child *signedZone) {
+	ds := child.key.ToDS(dns.SHA256)
+	ds.Hdr.Ttl = 3600
+	z.rrs = append(z.rrs, ds)
+}
+
+// fakeDNSSECTransport answers queries using a set of zones, where
+// example.org is signed and insecure.org is not signed.
+type fakeDNSSECTransport struct {
+	anchor string
+	err    error
+	mutate func(reply *dns.Msg)
+	zones  []*signedZone
+}
+
+func newFakeDNSSECTransport(t *testing.T) *fakeDNSSECTransport {
+	root := newSignedZone(t, ".",
+		". 3600 IN SOA a.root. nstld. 1 1800 900 604800 86400",
+		"org. 3600 IN NS ns.org.",
+		". 3600 IN NSEC org. NS SOA RRSIG NSEC DNSKEY",
+		"org. 3600 IN NSEC . NS DS RRSIG NSEC",
+	)
+	org := newSignedZone(t, "org.",
+		"org. 3600 IN SOA ns.org. hostmaster.org. 1 1800 900 604800 86400",
+		"example.org. 3600 IN NS ns.example.org.",
+		"insecure.org. 3600 IN NS ns.insecure.org.",
+		"org. 3600 IN NSEC example.org. NS SOA RRSIG NSEC DNSKEY",
+		"example.org. 3600 IN NSEC insecure.org. NS DS RRSIG NSEC",
+		"insecure.org. 3600 IN NSEC org. NS RRSIG NSEC",
+	)
+	example := newSignedZone(t, "example.org.",
+		"example.org. 3600 IN SOA ns.example.org. hostmaster.example.org. 1 1800 900 604800 300",
+		"www.example.org. 300 IN A 93.184.216.34",
+		"www.example.org. 300 IN TXT \"v=spf1 -all\"",
+		"alias.example.org. 300 IN CNAME www.example.org.",
+		"example.org. 3600 IN NSEC alias.example.org. NS SOA RRSIG NSEC DNSKEY",
+		"alias.example.org. 3600 IN NSEC www.example.org. CNAME RRSIG NSEC",
+		"www.example.org. 3600 IN NSEC example.org. A TXT RRSIG NSEC",
+	)
+	insecure := newSignedZone(t, "insecure.org.",
+		"insecure.org. 3600 IN SOA ns.insecure.org. hostmaster.insecure.org. 1 1800 900 604800 300",
+		"www.insecure.org. 300 IN A 10.0.0.1",
+	)
+	for _, zone := range []*signedZone{root, org, example} {
+		zone.generateKey(t)
+	}
+	root.delegate(org)
+	org.delegate(example)
+	for _, zone := range []*signedZone{root, org, example} {
+		zone.sign(t)
+	}
+	anchor := root.key.ToDS(dns.SHA256)
+	anchor.Hdr.Ttl = 3600
+	return &fakeDNSSECTransport{
+		anchor: anchor.String(),
+		zones:  []*signedZone{root, org, example, insecure},
+	}
+}
+
+func (txp *fakeDNSSECTransport) zoneFor(name string, qtype uint16) (zone *signedZone) {
+	for _, z := range txp.zones {
+		if !dns.IsSubDomain(z.apex, name) || (qtype == dns.TypeDS && z.apex == name) {
+			continue // the parent zone answers DS queries
+		}
+		if zone == nil || dns.CountLabel(z.apex) > dns.CountLabel(zone.apex) {
+			zone = z
+		}
+	}
+	return
+}
+
+func (txp *fakeDNSSECTransport) answer(query *dns.Msg) *dns.Msg {
+	reply := new(dns.Msg)
+	reply.SetReply(query)
+	name, qtype := strings.ToLower(query.Question[0].Name), query.Question[0].Qtype
+	for {
+		zone := txp.zoneFor(name, qtype)
+		if rrs := zone.records(name, qtype); len(rrs) > 0 {
+			reply.Answer = append(reply.Answer, rrs...)
+			return reply
+		}
+		if rrs := zone.records(name, dns.TypeCNAME); len(rrs) > 0 {
+			reply.Answer = append(reply.Answer, rrs...)
+			name = rrs[0].(*dns.CNAME).Target
+			continue
+		}
+		if zone.exists(name) {
+			reply.Ns = zone.records(name, dns.TypeNSEC)
+			return reply
+		}
+		reply.Rcode = dns.RcodeNameError
+		reply.Ns = zone.covering(name)
+		return reply
+	}
+}
+
+func (txp *fakeDNSSECTransport) RoundTrip(ctx context.Context, query []byte) ([]byte, error) {
+	if txp.err != nil {
+		return nil, txp.err
+	}
+	msg := new(dns.Msg)
+	if err := msg.Unpack(query); err != nil {
+		return nil, err
+	}
+	reply := txp.answer(msg)
+	qtype := msg.Question[0].Qtype
+	if txp.mutate != nil && (qtype == dns.TypeA || qtype == dns.TypeAAAA) {
+		txp.mutate(reply)
+	}
+	return reply.Pack()
+}
+
+func (txp *fakeDNSSECTransport) RequiresPadding() bool {
+	return false
+}
+
+func (txp *fakeDNSSECTransport) Network() string {
+	return "fake"
+}
+
+func (txp *fakeDNSSECTransport) Address() string {
+	return ""
+}
+
+func newDNSSECResolverForTesting(txp *fakeDNSSECTransport) resolver.DNSSECResolver {
+	r := resolver.NewDNSSECResolver(txp)
+	r.Anchors = []string{txp.anchor}
+	r.Saver = new(trace.Saver)
+	return r
+}
+
+// readDNSSECValidateEvents returns the dnssec_validate_done events after
+// checking that all the other events are DS or DNSKEY chain queries.
+func readDNSSECValidateEvents(t *testing.T, saver *trace.Saver) (out []trace.Event) {
+	for _, ev := range saver.Read() {
+		if ev.Name != "dnssec_chain_query" {
+			out = append(out, ev)
+			continue
+		}
+		query := new(dns.Msg)
+		if err := query.Unpack(ev.DNSQuery); err != nil {
+			t.Fatal(err)
+		}
+		if qtype := query.Question[0].Qtype; qtype != dns.TypeDS && qtype != dns.TypeDNSKEY {
+			t.Fatal("unexpected chain query type", qtype)
+		}
+	}
+	return
+}
+
+func checkDNSSECStatus(t *testing.T, saver *trace.Saver, statusA, statusAAAA string) {
+	events := readDNSSECValidateEvents(t, saver)
+	if len(events) != 2 {
+		t.Fatal("expected two events")
+	}
+	for idx, ev := range events {
+		expected := statusA
+		if idx > 0 {
+			expected = statusAAAA
+		}
+		if ev.Name != "dnssec_validate_done" {
+			t.Fatal("unexpected Name")
+		}
+		if ev.DNSQuery == nil || ev.DNSReply == nil {
+			t.Fatal("expected the query and the reply")
+		}
+		if ev.DNSSECStatus != expected {
+			t.Fatalf("expected %s, got %s", expected, ev.DNSSECStatus)
+		}
+	}
+}
+
+func TestUnitDNSSECResolverSecure(t *testing.T) {
+	for _, domain := range []string{"www.example.org", "alias.example.org"} {
+		t.Run(domain, func(t *testing.T) {
+			r := newDNSSECResolverForTesting(newFakeDNSSECTransport(t))
+			addrs, err := r.LookupHost(context.Background(), domain)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(addrs) != 1 || addrs[0] != "93.184.216.34" {
+				t.Fatal("not the addrs we expected")
+			}
+			checkDNSSECStatus(t, r.Saver, resolver.DNSSECSecure, resolver.DNSSECSecure)
+		})
+	}
+}
+
+func TestUnitDNSSECResolverLookupRecords(t *testing.T) {
+	r := newDNSSECResolverForTesting(newFakeDNSSECTransport(t))
+	records, err := r.LookupRecords(context.Background(), "www.example.org", dns.TypeTXT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatal("expected a single record")
+	}
+	txt, ok := records[0].(*dns.TXT)
+	if !ok || len(txt.Txt) != 1 || txt.Txt[0] != "v=spf1 -all" {
+		t.Fatal("not the record we expected")
+	}
+	events := readDNSSECValidateEvents(t, r.Saver)
+	if len(events) != 1 || events[0].DNSSECStatus != resolver.DNSSECSecure {
+		t.Fatal("expected a single secure event")
+	}
+}
+
+func TestUnitDNSSECResolverSecureNXDOMAIN(t *testing.T) {
+	r := newDNSSECResolverForTesting(newFakeDNSSECTransport(t))
+	addrs, err := r.LookupHost(context.Background(), "nonexistent.example.org")
+	if err == nil || !strings.HasSuffix(err.Error(), "no such host") {
+		t.Fatal("not the error we expected")
+	}
+	if addrs != nil {
+		t.Fatal("expected nil addrs here")
+	}
+	checkDNSSECStatus(t, r.Saver, resolver.DNSSECSecure, resolver.DNSSECSecure)
+}
+
+func TestUnitDNSSECResolverInsecure(t *testing.T) {
+	r := newDNSSECResolverForTesting(newFakeDNSSECTransport(t))
+	addrs, err := r.LookupHost(context.Background(), "www.insecure.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 1 || addrs[0] != "10.0.0.1" {
+		t.Fatal("not the addrs we expected")
+	}
+	checkDNSSECStatus(t, r.Saver, resolver.DNSSECInsecure, resolver.DNSSECInsecure)
+}
+
+func TestUnitDNSSECResolverBogus(t *testing.T) {
+	cases := []struct {
+		name       string
+		mutate     func(reply *dns.Msg)
+		statusAAAA string
+	}{{
+		name: "with forged address",
+		mutate: func(reply *dns.Msg) {
+			for _, rr := range reply.Answer {
+				if a, ok := rr.(*dns.A); ok {
+					a.A = []byte{10, 10, 34, 34}
+				}
+			}
+		},
+		statusAAAA: resolver.DNSSECSecure,
+	}, {
+		name: "with removed signatures",
+		mutate: func(reply *dns.Msg) {
+			var answers []dns.RR
+			for _, rr := range reply.Answer {
+				if _, ok := rr.(*dns.RRSIG); !ok {
+					answers = append(answers, rr)
+				}
+			}
+			reply.Answer, reply.Ns = answers, nil
+		},
+		statusAAAA: resolver.DNSSECBogus,
+	}, {
+		name: "with forged NXDOMAIN",
+		mutate: func(reply *dns.Msg) {
+			reply.Rcode = dns.RcodeNameError
+			reply.Answer, reply.Ns = nil, nil
+		},
+		statusAAAA: resolver.DNSSECBogus,
+	}}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			txp := newFakeDNSSECTransport(t)
+			txp.mutate = tc.mutate
+			r := newDNSSECResolverForTesting(txp)
+			addrs, err := r.LookupHost(context.Background(), "www.example.org")
+			if !errors.Is(err, errorx.ErrDNSSECBogus) {
+				t.Fatal("not the error we expected")
+			}
+			if addrs != nil {
+				t.Fatal("expected nil addrs here")
+			}
+			checkDNSSECStatus(t, r.Saver, resolver.DNSSECBogus, tc.statusAAAA)
+		})
+	}
+}
+
+func TestUnitDNSSECResolverBogusAAAA(t *testing.T) {
+	txp := newFakeDNSSECTransport(t)
+	txp.mutate = func(reply *dns.Msg) {
+		if reply.Question[0].Qtype != dns.TypeAAAA {
+			return
+		}
+		reply.Answer = append(reply.Answer, &dns.AAAA{
+			Hdr: dns.RR_Header{
+				Name:   reply.Question[0].Name,
+				Rrtype: dns.TypeAAAA,
+				Class:  dns.ClassINET,
+				Ttl:    300,
+			},
+			AAAA: net.ParseIP("2001:db8::1"),
+		})
+		reply.Ns = nil
+	}
+	r := newDNSSECResolverForTesting(txp)
+	addrs, err := r.LookupHost(context.Background(), "www.example.org")
+	if !errors.Is(err, errorx.ErrDNSSECBogus) {
+		t.Fatal("not the error we expected", err)
+	}
+	if addrs != nil {
+		t.Fatal("expected nil addrs here")
+	}
+	checkDNSSECStatus(t, r.Saver, resolver.DNSSECSecure, resolver.DNSSECBogus)
+}
+
+func TestUnitDNSSECResolverNoData(t *testing.T) {
+	r := newDNSSECResolverForTesting(newFakeDNSSECTransport(t))
+	addrs, err := r.LookupHost(context.Background(), "example.org")
+	if err == nil || err.Error() != "ooniresolver: no response returned" {
+		t.Fatal("not the error we expected", err)
+	}
+	if addrs != nil {
+		t.Fatal("expected nil addrs here")
+	}
+	checkDNSSECStatus(t, r.Saver, resolver.DNSSECSecure, resolver.DNSSECSecure)
+}
+
+func TestUnitDNSSECResolverWrongTrustAnchor(t *testing.T) {
+	r := newDNSSECResolverForTesting(newFakeDNSSECTransport(t))
+	r.Anchors = resolver.RootTrustAnchors
+	addrs, err := r.LookupHost(context.Background(), "www.example.org")
+	if !errors.Is(err, errorx.ErrDNSSECBogus) {
+		t.Fatal("not the error we expected")
+	}
+	if addrs != nil {
+		t.Fatal("expected nil addrs here")
+	}
+}
+
+func TestUnitDNSSECResolverInvalidTrustAnchor(t *testing.T) {
+	r := newDNSSECResolverForTesting(newFakeDNSSECTransport(t))
+	r.Anchors = []string{"org. 3600 IN A 10.0.0.1"}
+	addrs, err := r.LookupHost(context.Background(), "www.example.org")
+	if err == nil || err.Error() != "ooniresolver: invalid trust anchor" {
+		t.Fatal("not the error we expected")
+	}
+	if addrs != nil {
+		t.Fatal("expected nil addrs here")
+	}
+}
+
+func TestUnitDNSSECResolverRoundTripError(t *testing.T) {
+	txp := newFakeDNSSECTransport(t)
+	txp.err = io.EOF
+	r := newDNSSECResolverForTesting(txp)
+	addrs, err := r.LookupHost(context.Background(), "www.example.org")
+	if !errors.Is(err, io.EOF) {
+		t.Fatal("not the error we expected")
+	}
+	if addrs != nil {
+		t.Fatal("expected nil addrs here")
+	}
+	for _, ev := range r.Saver.Read() {
+		if !errors.Is(ev.Err, io.EOF) || ev.DNSSECStatus != "" {
+			t.Fatal("not the event we expected")
+		}
+	}
+}
+
+func TestUnitDNSSECResolverServerFailure(t *testing.T) {
+	txp := newFakeDNSSECTransport(t)
+	txp.mutate = func(reply *dns.Msg) {
+		reply.Rcode = dns.RcodeServerFailure
+		reply.Answer, reply.Ns = nil, nil
+	}
+	r := newDNSSECResolverForTesting(txp)
+	addrs, err := r.LookupHost(context.Background(), "www.example.org")
+	if err == nil || err.Error() != "ooniresolver: query failed" {
+		t.Fatal("not the error we expected")
+	}
+	if addrs != nil {
+		t.Fatal("expected nil addrs here")
+	}
+	checkDNSSECStatus(t, r.Saver, "", "")
+}
+
+func TestUnitDNSSECResolverNetworkAndAddress(t *testing.T) {
+	r := resolver.NewDNSSECResolver(resolver.NewDNSOverUDP(
+		new(net.Dialer), "8.8.8.8:53"))
+	if r.Network() != "udp" {
+		t.Fatal("invalid Network")
+	}
+	if r.Address() != "8.8.8.8:53" {
+		t.Fatal("invalid Address")
+	}
+	if r.Transport() == nil {
+		t.Fatal("invalid Transport")
+	}
+}
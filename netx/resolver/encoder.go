@@ -23,6 +23,16 @@ const (
 
 // Encode implements Encoder.Encode
 func (e MiekgEncoder) Encode(domain string, qtype uint16, padding bool) ([]byte, error) {
+	query := newQuery(domain, qtype)
+	if padding {
+		query.SetEdns0(EDNS0MaxResponseSize, DNSSECEnabled)
+		padQuery(query)
+	}
+	return query.Pack()
+}
+
+// newQuery creates a new recursive query for domain and qtype.
+func newQuery(domain string, qtype uint16) *dns.Msg {
 	question := dns.Question{
 		Name:   dns.Fqdn(domain),
 		Qtype:  qtype,
@@ -33,20 +43,21 @@ func (e MiekgEncoder) Encode(domain string, qtype uint16, padding bool) ([]byte,
 	query.RecursionDesired = true
 	query.Question = make([]dns.Question, 1)
 	query.Question[0] = question
-	if padding {
-		query.SetEdns0(EDNS0MaxResponseSize, DNSSECEnabled)
-		// Clients SHOULD pad queries to the closest multiple of
-		// 128 octets RFC8467#section-4.1. We inflate the query
-		// length by the size of the option (i.e. 4 octets). The
-		// cast to uint is necessary to make the modulus operation
-		// work as intended when the desiredBlockSize is smaller
-		// than (query.Len()+4) ¯\_(ツ)_/¯.
-		remainder := (PaddingDesiredBlockSize - uint(query.Len()+4)) % PaddingDesiredBlockSize
-		opt := new(dns.EDNS0_PADDING)
-		opt.Padding = make([]byte, remainder)
-		query.IsEdns0().Option = append(query.IsEdns0().Option, opt)
-	}
-	return query.Pack()
+	return query
+}
+
+// padQuery pads a query that already contains an EDNS0 OPT record.
+func padQuery(query *dns.Msg) {
+	// Clients SHOULD pad queries to the closest multiple of
+	// 128 octets RFC8467#section-4.1. We inflate the query
+	// length by the size of the option (i.e. 4 octets). The
+	// cast to uint is necessary to make the modulus operation
+	// work as intended when the desiredBlockSize is smaller
+	// than (query.Len()+4) ¯\_(ツ)_/¯.
+	remainder := (PaddingDesiredBlockSize - uint(query.Len()+4)) % PaddingDesiredBlockSize
+	opt := new(dns.EDNS0_PADDING)
+	opt.Padding = make([]byte, remainder)
+	query.IsEdns0().Option = append(query.IsEdns0().Option, opt)
 }
 
 var _ Encoder = MiekgEncoder{}
@@ -0,0 +1,186 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ooni/probe-engine/netx/trace"
+)
+
+// ErrNoResolvers indicates that a RaceResolver has no resolvers.
+var ErrNoResolvers = errors.New("race: no configured resolvers")
+
+// RaceResolver is a resolver that sends the query to all the configured
+// Resolvers at the same time and returns the first successful answer. As
+// soon as we have a winner, we cancel the lookups that are still pending.
+//
+// When Saver is not nil, we save a resolve_race_attempt event for each
+// resolver, containing the time it took and its result, and a final
+// resolve_race_done event whose Network and Address are the ones of the
+// winning resolver, if any.
+type RaceResolver struct {
+	Resolvers []Resolver
+	Saver     *trace.Saver
+}
+
+// RaceAttempt is the result of a lookup performed by one of the
+// resolvers participating into a race.
+type RaceAttempt struct {
+	// Addresses contains the resolved addresses.
+	Addresses []string
+
+	// Canceled is true when the lookup failed after another resolver
+	// had already won, hence most likely because we canceled it.
+	Canceled bool
+
+	// Duration is the time elapsed since the beginning of the race.
+	Duration time.Duration
+
+	// Err is the error that occurred, if any.
+	Err error
+
+	// Resolver is the resolver that performed the lookup.
+	Resolver Resolver
+}
+
+// RaceResult is the result of a race.
+type RaceResult struct {
+	// Attempts contains an attempt for each resolver, in the
+	// same order in which they appear in RaceResolver.Resolvers.
+	Attempts []RaceAttempt
+
+	// Duration is the time elapsed until we have got a winner or
+	// all the resolvers have failed.
+	Duration time.Duration
+
+	// Winner is the index of the winning attempt or -1.
+	Winner int
+}
+
+// Addresses returns the addresses resolved by the winner, if any.
+func (rr RaceResult) Addresses() []string {
+	if rr.Winner < 0 {
+		return nil
+	}
+	return rr.Attempts[rr.Winner].Addresses
+}
+
+// Err returns nil if there is a winner. Otherwise, it returns the error
+// of the first resolver that was configured into the RaceResolver.
+func (rr RaceResult) Err() error {
+	if rr.Winner >= 0 {
+		return nil
+	}
+	if len(rr.Attempts) <= 0 {
+		return ErrNoResolvers
+	}
+	return rr.Attempts[0].Err
+}
+
+type raceOutput struct {
+	idx     int
+	attempt RaceAttempt
+}
+
+// Race runs the race and returns its result. This function waits for
+// all the lookups to terminate before returning.
+func (r RaceResolver) Race(ctx context.Context, hostname string) RaceResult {
+	result := RaceResult{Winner: -1}
+	if len(r.Resolvers) <= 0 {
+		return result
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	start := time.Now()
+	outch := make(chan raceOutput, len(r.Resolvers))
+	for idx, reso := range r.Resolvers {
+		go r.lookup(ctx, start, idx, reso, hostname, outch)
+	}
+	result.Attempts = make([]RaceAttempt, len(r.Resolvers))
+	for i := 0; i < len(r.Resolvers); i++ {
+		out := <-outch
+		if out.attempt.Err == nil && result.Winner < 0 {
+			result.Duration = out.attempt.Duration
+			result.Winner = out.idx
+			cancel() // we don't need the other results anymore
+		} else if out.attempt.Err != nil && result.Winner >= 0 {
+			out.attempt.Canceled = true
+		}
+		result.Attempts[out.idx] = out.attempt
+	}
+	if result.Winner < 0 {
+		result.Duration = time.Since(start)
+	}
+	return result
+}
+
+func (r RaceResolver) lookup(ctx context.Context, start time.Time, idx int,
+	reso Resolver, hostname string, outch chan<- raceOutput) {
+	addrs, err := reso.LookupHost(ctx, hostname)
+	stop := time.Now()
+	if r.Saver != nil {
+		r.Saver.Write(trace.Event{
+			Addresses: addrs,
+			Address:   reso.Address(),
+			Duration:  stop.Sub(start),
+			Err:       err,
+			Hostname:  hostname,
+			Name:      "resolve_race_attempt",
+			Proto:     reso.Network(),
+			Time:      stop,
+		})
+	}
+	outch <- raceOutput{idx: idx, attempt: RaceAttempt{
+		Addresses: addrs,
+		Duration:  stop.Sub(start),
+		Err:       err,
+		Resolver:  reso,
+	}}
+}
+
+// LookupHost implements Resolver.LookupHost
+func (r RaceResolver) LookupHost(ctx context.Context, hostname string) ([]string, error) {
+	start := time.Now()
+	result := r.Race(ctx, hostname)
+	if r.Saver != nil {
+		var address, network string
+		if result.Winner >= 0 {
+			address = result.Attempts[result.Winner].Resolver.Address()
+			network = result.Attempts[result.Winner].Resolver.Network()
+		}
+		r.Saver.Write(trace.Event{
+			Addresses: result.Addresses(),
+			Address:   address,
+			Duration:  result.Duration,
+			Err:       result.Err(),
+			Hostname:  hostname,
+			Name:      "resolve_race_done",
+			Proto:     network,
+			Time:      start.Add(result.Duration),
+		})
+	}
+	return result.Addresses(), result.Err()
+}
+
+// Network implements Resolver.Network
+func (r RaceResolver) Network() string {
+	return "race"
+}
+
+// Address implements Resolver.Address
+func (r RaceResolver) Address() string {
+	return ""
+}
+
+// CloseIdleConnections closes the idle connections of the
+// resolvers that are keeping connections alive, if any.
+func (r RaceResolver) CloseIdleConnections() {
+	for _, reso := range r.Resolvers {
+		if closer, ok := reso.(interface{ CloseIdleConnections() }); ok {
+			closer.CloseIdleConnections()
+		}
+	}
+}
+
+var _ Resolver = RaceResolver{}
@@ -0,0 +1,175 @@
+package resolver_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ooni/probe-engine/netx/resolver"
+	"github.com/ooni/probe-engine/netx/trace"
+)
+
+type delayedResolver struct {
+	address string
+	addrs   []string
+	delay   time.Duration
+	err     error
+}
+
+func (r delayedResolver) LookupHost(ctx context.Context, hostname string) ([]string, error) {
+	select {
+	case <-time.After(r.delay):
+		return r.addrs, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (r delayedResolver) Network() string {
+	return "delayed"
+}
+
+func (r delayedResolver) Address() string {
+	return r.address
+}
+
+func TestUnitRaceResolverNoResolvers(t *testing.T) {
+	r := resolver.RaceResolver{}
+	if r.Network() != "race" {
+		t.Fatal("invalid network")
+	}
+	if r.Address() != "" {
+		t.Fatal("invalid address")
+	}
+	addrs, err := r.LookupHost(context.Background(), "www.google.com")
+	if !errors.Is(err, resolver.ErrNoResolvers) {
+		t.Fatal("not the error we expected")
+	}
+	if addrs != nil {
+		t.Fatal("expected nil addrs here")
+	}
+}
+
+func TestUnitRaceResolverFastestWins(t *testing.T) {
+	saver := new(trace.Saver)
+	r := resolver.RaceResolver{
+		Resolvers: []resolver.Resolver{
+			delayedResolver{address: "slow", addrs: []string{"1.1.1.1"}, delay: time.Minute},
+			delayedResolver{address: "fails", err: errors.New("mocked error")},
+			delayedResolver{address: "fast", addrs: []string{"8.8.8.8"}, delay: 10 * time.Millisecond},
+		},
+		Saver: saver,
+	}
+	result := r.Race(context.Background(), "dns.google")
+	if result.Winner != 2 {
+		t.Fatal("not the winner we expected")
+	}
+	if result.Err() != nil {
+		t.Fatal(result.Err())
+	}
+	addrs := result.Addresses()
+	if len(addrs) != 1 || addrs[0] != "8.8.8.8" {
+		t.Fatal("not the addrs we expected")
+	}
+	if !result.Attempts[0].Canceled || !errors.Is(result.Attempts[0].Err, context.Canceled) {
+		t.Fatal("expected the slow resolver to be canceled")
+	}
+	if result.Attempts[1].Canceled || result.Attempts[1].Err == nil {
+		t.Fatal("expected the failing resolver to fail before the winner")
+	}
+	if result.Attempts[2].Duration != result.Duration {
+		t.Fatal("unexpected duration")
+	}
+	events := saver.Read()
+	if len(events) != 3 {
+		t.Fatal("unexpected number of events")
+	}
+	for _, ev := range events {
+		if ev.Name != "resolve_race_attempt" || ev.Hostname != "dns.google" {
+			t.Fatal("unexpected event")
+		}
+	}
+}
+
+func TestUnitRaceResolverLookupHostSuccess(t *testing.T) {
+	saver := new(trace.Saver)
+	r := resolver.RaceResolver{
+		Resolvers: []resolver.Resolver{
+			resolver.NewFakeResolverThatFails(),
+			resolver.NewFakeResolverWithResult([]string{"8.8.8.8"}),
+		},
+		Saver: saver,
+	}
+	addrs, err := r.LookupHost(context.Background(), "dns.google")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 1 || addrs[0] != "8.8.8.8" {
+		t.Fatal("not the addrs we expected")
+	}
+	events := saver.Read()
+	if len(events) != 3 {
+		t.Fatal("unexpected number of events")
+	}
+	last := events[2]
+	if last.Name != "resolve_race_done" {
+		t.Fatal("unexpected Name")
+	}
+	if last.Proto != "fake" || last.Err != nil {
+		t.Fatal("unexpected winner")
+	}
+}
+
+func TestUnitRaceResolverLookupHostFailure(t *testing.T) {
+	expected := errors.New("mocked error")
+	saver := new(trace.Saver)
+	r := resolver.RaceResolver{
+		Resolvers: []resolver.Resolver{
+			delayedResolver{err: expected, delay: 10 * time.Millisecond},
+			resolver.NewFakeResolverThatFails(),
+		},
+		Saver: saver,
+	}
+	addrs, err := r.LookupHost(context.Background(), "dns.google")
+	if !errors.Is(err, expected) {
+		t.Fatal("not the error we expected")
+	}
+	if addrs != nil {
+		t.Fatal("expected nil addrs here")
+	}
+	events := saver.Read()
+	if len(events) != 3 {
+		t.Fatal("unexpected number of events")
+	}
+	last := events[2]
+	if last.Name != "resolve_race_done" {
+		t.Fatal("unexpected Name")
+	}
+	if last.Proto != "" || !errors.Is(last.Err, expected) {
+		t.Fatal("unexpected event")
+	}
+}
+
+type closeableResolver struct {
+	resolver.FakeResolver
+	closed *bool
+}
+
+func (r closeableResolver) CloseIdleConnections() {
+	*r.closed = true
+}
+
+func TestUnitRaceResolverCloseIdleConnections(t *testing.T) {
+	var closed bool
+	r := resolver.RaceResolver{
+		Resolvers: []resolver.Resolver{
+			resolver.NewFakeResolverThatFails(),
+			closeableResolver{closed: &closed},
+		},
+	}
+	r.CloseIdleConnections()
+	if !closed {
+		t.Fatal("expected CloseIdleConnections to be called")
+	}
+}
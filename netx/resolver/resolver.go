@@ -2,6 +2,11 @@ package resolver
 
 import (
 	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
 )
 
 // Resolver is a DNS resolver. The *net.Resolver used by Go implements
@@ -16,3 +21,50 @@ type Resolver interface {
 	// Address returns the address being used by the resolver
 	Address() string
 }
+
+// RecordsResolver is a Resolver that can also look up records of
+// arbitrary type (e.g. TXT, MX, HTTPS). Only resolvers that send their
+// own DNS queries, such as the SerialResolver, implement it.
+type RecordsResolver interface {
+	Resolver
+
+	// LookupRecords returns the records of type qtype for domain.
+	LookupRecords(ctx context.Context, domain string, qtype uint16) ([]dns.RR, error)
+}
+
+// extraQueryTypes contains the query types that are not known to the
+// version of github.com/miekg/dns we currently use.
+var extraQueryTypes = map[string]uint16{
+	"SVCB":  TypeSVCB,
+	"HTTPS": TypeHTTPS,
+}
+
+// ParseQueryType converts the name of a DNS query type (e.g. "TXT") into
+// its numeric value. It also accepts the RFC3597 generic syntax (e.g.
+// "TYPE65") and the SVCB and HTTPS types.
+func ParseQueryType(s string) (uint16, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if qtype, found := extraQueryTypes[s]; found {
+		return qtype, nil
+	}
+	if qtype, found := dns.StringToType[s]; found {
+		return qtype, nil
+	}
+	if strings.HasPrefix(s, "TYPE") {
+		if qtype, err := strconv.ParseUint(s[4:], 10, 16); err == nil {
+			return uint16(qtype), nil
+		}
+	}
+	return 0, fmt.Errorf("resolver: invalid query type: '%s'", s)
+}
+
+// QueryTypeString is the inverse of ParseQueryType. For unknown
+// types, it returns the RFC3597 generic syntax (e.g. "TYPE99").
+func QueryTypeString(qtype uint16) string {
+	for name, value := range extraQueryTypes {
+		if value == qtype {
+			return name
+		}
+	}
+	return dns.Type(qtype).String()
+}
@@ -0,0 +1,56 @@
+package resolver_test
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/ooni/probe-engine/netx/resolver"
+)
+
+func TestUnitParseQueryType(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected uint16
+		failure  bool
+	}{
+		{input: "TXT", expected: dns.TypeTXT},
+		{input: " mx ", expected: dns.TypeMX},
+		{input: "HTTPS", expected: 65},
+		{input: "svcb", expected: 64},
+		{input: "TYPE99", expected: 99},
+		{input: "TYPE70000", failure: true},
+		{input: "NOTATYPE", failure: true},
+		{input: "", failure: true},
+	}
+	for _, c := range cases {
+		t.Run(c.input, func(t *testing.T) {
+			qtype, err := resolver.ParseQueryType(c.input)
+			if c.failure {
+				if err == nil {
+					t.Fatal("expected an error here")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if qtype != c.expected {
+				t.Fatal("not the qtype we expected")
+			}
+		})
+	}
+}
+
+func TestUnitQueryTypeString(t *testing.T) {
+	cases := map[uint16]string{
+		dns.TypeTXT: "TXT",
+		64:          "SVCB",
+		65:          "HTTPS",
+		65280:       "TYPE65280",
+	}
+	for qtype, expected := range cases {
+		if out := resolver.QueryTypeString(qtype); out != expected {
+			t.Fatalf("expected %s, got %s", expected, out)
+		}
+	}
+}
@@ -109,3 +109,79 @@ func TestUnitOONIWithTimeout(t *testing.T) {
 		t.Fatal("we didn't actually take the timeouts")
 	}
 }
+
+func genReplyWithRecords(t *testing.T, qtype uint16, records ...string) []byte {
+	query := new(dns.Msg)
+	query.SetQuestion("x.org.", qtype)
+	reply := new(dns.Msg)
+	reply.SetReply(query)
+	for _, record := range records {
+		rr, err := dns.NewRR(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reply.Answer = append(reply.Answer, rr)
+	}
+	data, err := reply.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestUnitOONILookupRecords(t *testing.T) {
+	txp := resolver.FakeTransport{
+		Data: genReplyWithRecords(t, dns.TypeMX,
+			"x.org. 300 IN CNAME y.org.",
+			"y.org. 300 IN MX 10 mail.y.org.",
+		),
+	}
+	r := resolver.NewSerialResolver(txp)
+	records, err := r.LookupRecords(context.Background(), "x.org", dns.TypeMX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatal("expected a single record")
+	}
+	mx, ok := records[0].(*dns.MX)
+	if !ok || mx.Mx != "mail.y.org." || mx.Preference != 10 {
+		t.Fatal("not the record we expected")
+	}
+}
+
+func TestUnitOONILookupRecordsWithEmptyReply(t *testing.T) {
+	txp := resolver.FakeTransport{Data: genReplyWithRecords(t, dns.TypeTXT)}
+	r := resolver.NewSerialResolver(txp)
+	records, err := r.LookupRecords(context.Background(), "x.org", dns.TypeTXT)
+	if err == nil || !strings.HasSuffix(err.Error(), "no response returned") {
+		t.Fatal("not the error we expected")
+	}
+	if records != nil {
+		t.Fatal("expected nil records here")
+	}
+}
+
+func TestUnitOONILookupRecordsNXDOMAIN(t *testing.T) {
+	txp := resolver.FakeTransport{Data: resolver.GenReplyError(t, dns.RcodeNameError)}
+	r := resolver.NewSerialResolver(txp)
+	records, err := r.LookupRecords(context.Background(), "x.org", dns.TypeTXT)
+	if err == nil || !strings.HasSuffix(err.Error(), "no such host") {
+		t.Fatal("not the error we expected")
+	}
+	if records != nil {
+		t.Fatal("expected nil records here")
+	}
+}
+
+func TestUnitOONILookupRecordsRoundTripError(t *testing.T) {
+	mocked := errors.New("mocked error")
+	r := resolver.NewSerialResolver(resolver.FakeTransport{Err: mocked})
+	records, err := r.LookupRecords(context.Background(), "x.org", dns.TypeTXT)
+	if !errors.Is(err, mocked) {
+		t.Fatal("not the error we expected")
+	}
+	if records != nil {
+		t.Fatal("expected nil records here")
+	}
+}
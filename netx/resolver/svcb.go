@@ -0,0 +1,83 @@
+package resolver
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// TypeSVCB is the SVCB query type (RFC9460).
+	TypeSVCB uint16 = 64
+
+	// TypeHTTPS is the HTTPS query type (RFC9460).
+	TypeHTTPS uint16 = 65
+)
+
+// svcParamKeyECH is the SvcParamKey of the ECHConfigList.
+const svcParamKeyECH = 5
+
+// ErrNoECHConfigList indicates that none of the SVCB or HTTPS
+// records we inspected contained an ECHConfigList.
+var ErrNoECHConfigList = errors.New("resolver: no ECHConfigList in records")
+
+// ECHConfigList returns the serialized ECHConfigList contained by the
+// first SVCB or HTTPS record in records that has the ech SvcParam. We
+// parse the wire format of each record, so this works regardless of
+// whether github.com/miekg/dns knows about these record types.
+func ECHConfigList(records []dns.RR) ([]byte, error) {
+	for _, rr := range records {
+		if rrtype := rr.Header().Rrtype; rrtype != TypeSVCB && rrtype != TypeHTTPS {
+			continue
+		}
+		rdata, err := packRdata(rr)
+		if err != nil {
+			continue
+		}
+		if value, found := svcParamValue(rdata, svcParamKeyECH); found {
+			return value, nil
+		}
+	}
+	return nil, ErrNoECHConfigList
+}
+
+// packRdata returns the wire format RDATA of rr.
+func packRdata(rr dns.RR) ([]byte, error) {
+	buf := make([]byte, dns.Len(rr)+1)
+	off, err := dns.PackRR(rr, buf, 0, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	rdlength := int(rr.Header().Rdlength)
+	if rdlength > off {
+		return nil, errors.New("resolver: invalid RDATA length")
+	}
+	return buf[off-rdlength : off], nil
+}
+
+// svcParamValue returns the value of the SvcParam with the given key
+// contained by the wire format RDATA of a SVCB or HTTPS record.
+func svcParamValue(rdata []byte, key uint16) ([]byte, bool) {
+	if len(rdata) < 2 {
+		return nil, false
+	}
+	// skip the SvcPriority and the uncompressed TargetName
+	_, off, err := dns.UnpackDomainName(rdata, 2)
+	if err != nil {
+		return nil, false
+	}
+	for off+4 <= len(rdata) {
+		k := binary.BigEndian.Uint16(rdata[off:])
+		length := int(binary.BigEndian.Uint16(rdata[off+2:]))
+		off += 4
+		if off+length > len(rdata) {
+			return nil, false
+		}
+		if k == key {
+			return rdata[off : off+length], true
+		}
+		off += length
+	}
+	return nil, false
+}
@@ -0,0 +1,62 @@
+package resolver_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/ooni/probe-engine/netx/resolver"
+)
+
+func newHTTPSRecord(t *testing.T, rdata []byte) dns.RR {
+	rr, err := dns.NewRR(fmt.Sprintf(
+		"x.org. 300 IN TYPE65 \\# %d %s", len(rdata), hex.EncodeToString(rdata)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rr
+}
+
+func TestUnitECHConfigList(t *testing.T) {
+	ech := []byte{0x00, 0x04, 0xfe, 0x0d, 0x00, 0x00}
+	rdata := []byte{
+		0x00, 0x01, // SvcPriority
+		0x00,                                   // TargetName (root)
+		0x00, 0x01, 0x00, 0x03, 0x02, 'h', '2', // alpn=h2
+		0x00, 0x05, 0x00, byte(len(ech)), // ech
+	}
+	rdata = append(rdata, ech...)
+	records := []dns.RR{
+		newHTTPSRecord(t, []byte{0x00, 0x00, 0x00}), // AliasMode
+		newHTTPSRecord(t, rdata),
+	}
+	out, err := resolver.ECHConfigList(records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, ech) {
+		t.Fatal("not the ECHConfigList we expected")
+	}
+}
+
+func TestUnitECHConfigListNotFound(t *testing.T) {
+	a, err := dns.NewRR("x.org. 300 IN A 8.8.8.8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := []dns.RR{
+		a,
+		newHTTPSRecord(t, []byte{
+			0x00, 0x01, 0x00, 0x00, 0x01, 0x00, 0x03, 0x02, 'h', '2'}),
+	}
+	out, err := resolver.ECHConfigList(records)
+	if !errors.Is(err, resolver.ErrNoECHConfigList) {
+		t.Fatal("not the error we expected")
+	}
+	if out != nil {
+		t.Fatal("expected nil output here")
+	}
+}
@@ -0,0 +1,224 @@
+package resolver
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// DefaultTTL is the TTL we use for successful lookups when the
+	// underlying resolver does not tell us the TTL (e.g., the system
+	// resolver does not give us access to the DNS replies).
+	DefaultTTL = time.Minute
+
+	// DefaultNegativeTTL is the maximum amount of time for which we
+	// cache an NXDOMAIN reply. We use this value as the TTL when the
+	// underlying resolver does not tell us the negative TTL.
+	DefaultNegativeTTL = time.Minute
+)
+
+// KeyValueStore is the key-value store used to persist a TTLCache.
+type KeyValueStore interface {
+	Get(key string) (value []byte, err error)
+	Set(key string, value []byte) (err error)
+}
+
+// TTLCacheEntry is an entry of the TTLCache.
+type TTLCacheEntry struct {
+	Addresses []string  `json:"addresses,omitempty"`
+	Expire    time.Time `json:"expire"`
+	NXDOMAIN  bool      `json:"nxdomain,omitempty"`
+}
+
+// TTLCache is a DNS cache where each entry expires. The zero value
+// is an empty cache ready to use. It is safe to share a TTLCache
+// among several goroutines and resolvers.
+type TTLCache struct {
+	entries map[string]TTLCacheEntry
+	mu      sync.Mutex
+}
+
+// Get returns the entry for domain, if it exists and has not expired yet.
+func (c *TTLCache) Get(domain string) (TTLCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, found := c.entries[domain]
+	if !found {
+		return TTLCacheEntry{}, false
+	}
+	if !time.Now().Before(entry.Expire) {
+		delete(c.entries, domain)
+		return TTLCacheEntry{}, false
+	}
+	return entry, true
+}
+
+// Set adds an entry to the cache, replacing any existing entry for domain.
+func (c *TTLCache) Set(domain string, entry TTLCacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]TTLCacheEntry)
+	}
+	c.entries[domain] = entry
+}
+
+// Snapshot returns a serialized copy of the entries that are still valid.
+func (c *TTLCache) Snapshot() ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	valid := make(map[string]TTLCacheEntry)
+	for domain, entry := range c.entries {
+		if now.Before(entry.Expire) {
+			valid[domain] = entry
+		}
+	}
+	return json.Marshal(valid)
+}
+
+// Restore adds to the cache the entries contained in the snapshot
+// that are still valid. It returns an error if the snapshot is invalid.
+func (c *TTLCache) Restore(data []byte) error {
+	var entries map[string]TTLCacheEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+	now := time.Now()
+	for domain, entry := range entries {
+		if now.Before(entry.Expire) {
+			c.Set(domain, entry)
+		}
+	}
+	return nil
+}
+
+// SaveTo saves a snapshot of the cache into the store using key.
+func (c *TTLCache) SaveTo(store KeyValueStore, key string) error {
+	data, err := c.Snapshot()
+	if err != nil {
+		return err
+	}
+	return store.Set(key, data)
+}
+
+// LoadFrom restores the snapshot saved into the store using key.
+func (c *TTLCache) LoadFrom(store KeyValueStore, key string) error {
+	data, err := store.Get(key)
+	if err != nil {
+		return err
+	}
+	return c.Restore(data)
+}
+
+// TTLCacheResolver is a resolver that caches successful lookups as
+// well as NXDOMAIN replies using the TTLs of the DNS replies. This is
+// possible when the underlying resolver is, or wraps, a SerialResolver,
+// because the SerialResolver tells us the TTL of the replies. Otherwise,
+// we use DefaultTTL and DefaultNegativeTTL.
+type TTLCacheResolver struct {
+	Resolver
+	Cache *TTLCache
+}
+
+// LookupHost implements Resolver.LookupHost
+func (r TTLCacheResolver) LookupHost(ctx context.Context, hostname string) ([]string, error) {
+	if entry, found := r.Cache.Get(hostname); found {
+		if entry.NXDOMAIN {
+			return nil, &net.DNSError{Err: "no such host", Name: hostname, IsNotFound: true}
+		}
+		return entry.Addresses, nil
+	}
+	observer := &ttlObserver{}
+	addrs, err := r.Resolver.LookupHost(withTTLObserver(ctx, observer), hostname)
+	if err == nil {
+		ttl := observer.get(DefaultTTL)
+		r.Cache.Set(hostname, TTLCacheEntry{
+			Addresses: addrs,
+			Expire:    time.Now().Add(ttl),
+		})
+		return addrs, nil
+	}
+	if strings.HasSuffix(err.Error(), "no such host") {
+		ttl := observer.get(DefaultNegativeTTL)
+		if ttl > DefaultNegativeTTL {
+			ttl = DefaultNegativeTTL
+		}
+		r.Cache.Set(hostname, TTLCacheEntry{
+			Expire:   time.Now().Add(ttl),
+			NXDOMAIN: true,
+		})
+	}
+	return nil, err
+}
+
+// ttlObserver keeps track of the minimum TTL of the DNS
+// replies received while performing a lookup.
+type ttlObserver struct {
+	mu   sync.Mutex
+	seen bool
+	ttl  time.Duration
+}
+
+func (o *ttlObserver) observe(ttl time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.seen || ttl < o.ttl {
+		o.ttl = ttl
+	}
+	o.seen = true
+}
+
+// get returns the minimum TTL or defaultTTL if we have not seen any TTL.
+func (o *ttlObserver) get(defaultTTL time.Duration) time.Duration {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.seen {
+		return defaultTTL
+	}
+	return o.ttl
+}
+
+type ttlObserverKey struct{}
+
+func withTTLObserver(ctx context.Context, observer *ttlObserver) context.Context {
+	return context.WithValue(ctx, ttlObserverKey{}, observer)
+}
+
+// observeTTL tells the ttlObserver inside ctx, if any, the TTL of the
+// given DNS reply. For replies with answers, the TTL is the minimum TTL
+// of the answers. Otherwise, we follow RFC2308 and use the minimum of the
+// TTL of the SOA record and of its MINIMUM field.
+func observeTTL(ctx context.Context, data []byte) {
+	observer, _ := ctx.Value(ttlObserverKey{}).(*ttlObserver)
+	if observer == nil {
+		return
+	}
+	reply := new(dns.Msg)
+	if err := reply.Unpack(data); err != nil {
+		return
+	}
+	for _, rr := range reply.Answer {
+		observer.observe(time.Duration(rr.Header().Ttl) * time.Second)
+	}
+	if len(reply.Answer) > 0 {
+		return
+	}
+	for _, rr := range reply.Ns {
+		if soa, ok := rr.(*dns.SOA); ok {
+			ttl := soa.Hdr.Ttl
+			if soa.Minttl < ttl {
+				ttl = soa.Minttl
+			}
+			observer.observe(time.Duration(ttl) * time.Second)
+		}
+	}
+}
+
+var _ Resolver = TTLCacheResolver{}
@@ -0,0 +1,247 @@
+package resolver_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/ooni/probe-engine/internal/kvstore"
+	"github.com/ooni/probe-engine/netx/resolver"
+)
+
+func genReplyWithTTL(t *testing.T, rcode int, answers, authority []string) []byte {
+	query := new(dns.Msg)
+	query.SetQuestion("x.org.", dns.TypeA)
+	reply := new(dns.Msg)
+	reply.SetRcode(query, rcode)
+	for _, s := range answers {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reply.Answer = append(reply.Answer, rr)
+	}
+	for _, s := range authority {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reply.Ns = append(reply.Ns, rr)
+	}
+	data, err := reply.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestUnitTTLCacheHonoursRecordTTL(t *testing.T) {
+	cache := new(resolver.TTLCache)
+	r := resolver.TTLCacheResolver{
+		Resolver: resolver.NewSerialResolver(resolver.FakeTransport{
+			Data: genReplyWithTTL(t, dns.RcodeSuccess, []string{
+				"x.org. 300 IN CNAME y.org.",
+				"y.org. 120 IN A 8.8.8.8",
+			}, nil),
+		}),
+		Cache: cache,
+	}
+	addrs, err := r.LookupHost(context.Background(), "x.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 1 || addrs[0] != "8.8.8.8" {
+		t.Fatal("not the addrs we expected")
+	}
+	entry, found := cache.Get("x.org")
+	if !found {
+		t.Fatal("expected to find the entry")
+	}
+	ttl := time.Until(entry.Expire)
+	if ttl <= 110*time.Second || ttl > 120*time.Second {
+		t.Fatal("not the TTL we expected")
+	}
+	// make sure that now we're going to use the cache
+	r.Resolver = resolver.NewFakeResolverThatFails()
+	addrs, err = r.LookupHost(context.Background(), "x.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 1 || addrs[0] != "8.8.8.8" {
+		t.Fatal("not the addrs we expected")
+	}
+}
+
+func TestUnitTTLCacheZeroTTL(t *testing.T) {
+	cache := new(resolver.TTLCache)
+	r := resolver.TTLCacheResolver{
+		Resolver: resolver.NewSerialResolver(resolver.FakeTransport{
+			Data: genReplyWithTTL(t, dns.RcodeSuccess, []string{
+				"x.org. 0 IN A 8.8.8.8",
+			}, nil),
+		}),
+		Cache: cache,
+	}
+	if _, err := r.LookupHost(context.Background(), "x.org"); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := cache.Get("x.org"); found {
+		t.Fatal("did not expect to find the entry")
+	}
+}
+
+func TestUnitTTLCacheNegativeCaching(t *testing.T) {
+	cache := new(resolver.TTLCache)
+	r := resolver.TTLCacheResolver{
+		Resolver: resolver.NewSerialResolver(resolver.FakeTransport{
+			Data: genReplyWithTTL(t, dns.RcodeNameError, nil, []string{
+				"org. 3600 IN SOA a0.org.afilias-nst.info. hostmaster.donuts.email. 1 7200 900 1209600 30",
+			}),
+		}),
+		Cache: cache,
+	}
+	addrs, err := r.LookupHost(context.Background(), "x.org")
+	if err == nil || !strings.HasSuffix(err.Error(), "no such host") {
+		t.Fatal("not the error we expected")
+	}
+	if addrs != nil {
+		t.Fatal("expected nil addrs here")
+	}
+	entry, found := cache.Get("x.org")
+	if !found || !entry.NXDOMAIN {
+		t.Fatal("expected to find a negative entry")
+	}
+	ttl := time.Until(entry.Expire)
+	if ttl <= 20*time.Second || ttl > 30*time.Second {
+		t.Fatal("not the TTL we expected")
+	}
+	r.Resolver = resolver.NewFakeResolverWithResult([]string{"8.8.8.8"})
+	addrs, err = r.LookupHost(context.Background(), "x.org")
+	if err == nil || !strings.HasSuffix(err.Error(), "no such host") {
+		t.Fatal("not the error we expected")
+	}
+	if addrs != nil {
+		t.Fatal("expected nil addrs here")
+	}
+}
+
+func TestUnitTTLCacheNegativeTTLIsCapped(t *testing.T) {
+	cache := new(resolver.TTLCache)
+	r := resolver.TTLCacheResolver{
+		Resolver: resolver.NewSerialResolver(resolver.FakeTransport{
+			Data: genReplyWithTTL(t, dns.RcodeNameError, nil, []string{
+				"org. 86400 IN SOA a0.org.afilias-nst.info. hostmaster.donuts.email. 1 7200 900 1209600 86400",
+			}),
+		}),
+		Cache: cache,
+	}
+	if _, err := r.LookupHost(context.Background(), "x.org"); err == nil {
+		t.Fatal("expected an error here")
+	}
+	entry, found := cache.Get("x.org")
+	if !found {
+		t.Fatal("expected to find the entry")
+	}
+	if time.Until(entry.Expire) > resolver.DefaultNegativeTTL {
+		t.Fatal("the negative TTL is not capped")
+	}
+}
+
+func TestUnitTTLCacheDefaultTTL(t *testing.T) {
+	cache := new(resolver.TTLCache)
+	r := resolver.TTLCacheResolver{
+		Resolver: resolver.NewFakeResolverWithResult([]string{"8.8.8.8"}),
+		Cache:    cache,
+	}
+	if _, err := r.LookupHost(context.Background(), "x.org"); err != nil {
+		t.Fatal(err)
+	}
+	entry, found := cache.Get("x.org")
+	if !found {
+		t.Fatal("expected to find the entry")
+	}
+	ttl := time.Until(entry.Expire)
+	if ttl <= resolver.DefaultTTL-10*time.Second || ttl > resolver.DefaultTTL {
+		t.Fatal("not the TTL we expected")
+	}
+}
+
+func TestUnitTTLCacheDoesNotCacheOtherErrors(t *testing.T) {
+	expected := errors.New("mocked error")
+	cache := new(resolver.TTLCache)
+	r := resolver.TTLCacheResolver{
+		Resolver: resolver.FakeResolver{Err: expected},
+		Cache:    cache,
+	}
+	addrs, err := r.LookupHost(context.Background(), "x.org")
+	if !errors.Is(err, expected) {
+		t.Fatal("not the error we expected")
+	}
+	if addrs != nil {
+		t.Fatal("expected nil addrs here")
+	}
+	if _, found := cache.Get("x.org"); found {
+		t.Fatal("did not expect to find the entry")
+	}
+}
+
+func TestUnitTTLCacheExpiredEntry(t *testing.T) {
+	cache := new(resolver.TTLCache)
+	cache.Set("x.org", resolver.TTLCacheEntry{
+		Addresses: []string{"8.8.8.8"},
+		Expire:    time.Now().Add(-time.Second),
+	})
+	if _, found := cache.Get("x.org"); found {
+		t.Fatal("did not expect to find the entry")
+	}
+}
+
+func TestUnitTTLCacheSnapshotAndRestore(t *testing.T) {
+	cache := new(resolver.TTLCache)
+	cache.Set("x.org", resolver.TTLCacheEntry{
+		Addresses: []string{"8.8.8.8"},
+		Expire:    time.Now().Add(time.Hour),
+	})
+	cache.Set("y.org", resolver.TTLCacheEntry{
+		Expire:   time.Now().Add(time.Hour),
+		NXDOMAIN: true,
+	})
+	cache.Set("z.org", resolver.TTLCacheEntry{
+		Addresses: []string{"1.1.1.1"},
+		Expire:    time.Now().Add(-time.Hour),
+	})
+	store := kvstore.NewMemoryKeyValueStore()
+	if err := cache.SaveTo(store, "dnscache"); err != nil {
+		t.Fatal(err)
+	}
+	other := new(resolver.TTLCache)
+	if err := other.LoadFrom(store, "dnscache"); err != nil {
+		t.Fatal(err)
+	}
+	if entry, found := other.Get("x.org"); !found || entry.Addresses[0] != "8.8.8.8" {
+		t.Fatal("expected to find x.org")
+	}
+	if entry, found := other.Get("y.org"); !found || !entry.NXDOMAIN {
+		t.Fatal("expected to find y.org")
+	}
+	if _, found := other.Get("z.org"); found {
+		t.Fatal("did not expect to find z.org")
+	}
+}
+
+func TestUnitTTLCacheLoadFromErrors(t *testing.T) {
+	store := kvstore.NewMemoryKeyValueStore()
+	cache := new(resolver.TTLCache)
+	if err := cache.LoadFrom(store, "dnscache"); err == nil {
+		t.Fatal("expected an error here")
+	}
+	if err := store.Set("dnscache", []byte("[]")); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.LoadFrom(store, "dnscache"); err == nil {
+		t.Fatal("expected an error here")
+	}
+}
@@ -0,0 +1,370 @@
+package selfcensor
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	mathrand "math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// lossyRetransmitDelay is the delay we add to TCP writes that we
+// pretend have been lost. It is the minimum RTO used by Linux.
+const lossyRetransmitDelay = 200 * time.Millisecond
+
+// needsConnWrapper returns true if the spec contains rules that
+// we need to enforce on the connections we create.
+func (s *Spec) needsConnWrapper() bool {
+	return s.BlockedFingerprints != nil || s.BlockedSNIs != nil ||
+		s.HTTPBlockpages != nil || s.ThrottledEndpoints != nil ||
+		s.LossyEndpoints != nil
+}
+
+type connWrapper struct {
+	net.Conn
+	blockpages   map[string]string
+	closed       chan interface{}
+	fingerprints map[string]string
+	loss         float64
+	mu           sync.Mutex
+	network      string
+	rate         int64
+	reader       io.Reader // injected by the censor
+	snis         map[string]string
+}
+
+func newConnWrapper(conn net.Conn, network, address string, spec *Spec) *connWrapper {
+	return &connWrapper{
+		Conn:         conn,
+		blockpages:   spec.HTTPBlockpages,
+		closed:       make(chan interface{}, 128),
+		fingerprints: spec.BlockedFingerprints,
+		loss:         spec.LossyEndpoints[address],
+		network:      network,
+		rate:         spec.ThrottledEndpoints[address],
+		snis:         spec.BlockedSNIs,
+	}
+}
+
+func (c *connWrapper) Read(p []byte) (int, error) {
+	if reader := c.injected(); reader != nil {
+		return reader.Read(p)
+	}
+	for {
+		n, err := c.Conn.Read(p)
+		if err != nil {
+			// A concurrent Write may have injected a response and
+			// closed the real connection while we were reading.
+			if reader := c.injected(); reader != nil {
+				return reader.Read(p)
+			}
+		}
+		if err == nil && c.isUDP() && c.lost() {
+			continue
+		}
+		c.throttle(n)
+		return n, err
+	}
+}
+
+func (c *connWrapper) Write(p []byte) (int, error) {
+	if reader := c.injected(); reader != nil {
+		// The censor is now talking with us, so we write to it
+		if w, ok := reader.(io.Writer); ok {
+			return w.Write(p)
+		}
+		return len(p), nil
+	}
+	// TODO(bassosimone): implement reassembly to workaround the
+	// splitting of the ClientHello message.
+	if _, err := c.match(p, len(p)); err != nil {
+		return 0, err
+	}
+	if reader := c.matchSNI(p); reader != nil {
+		return c.inject(reader, p)
+	}
+	if reader := c.matchHost(p); reader != nil {
+		return c.inject(reader, p)
+	}
+	if c.lost() {
+		if c.isUDP() {
+			return len(p), nil
+		}
+		time.Sleep(lossyRetransmitDelay)
+	}
+	return c.Conn.Write(p)
+}
+
+func (c *connWrapper) match(p []byte, n int) (int, error) {
+	p = p[:n] // trim
+	for key, value := range c.fingerprints {
+		if bytes.Index(p, []byte(key)) != -1 {
+			if value == "TIMEOUT" {
+				return 0, errTimeout
+			}
+			return 0, errors.New("connection reset by peer")
+		}
+	}
+	return n, nil
+}
+
+// matchSNI returns the reader of the censor's response if p is a
+// ClientHello whose server_name is one of the blocked SNIs, or nil.
+func (c *connWrapper) matchSNI(p []byte) io.Reader {
+	const (
+		recordTypeHandshake   = 22
+		handshakeClientHello  = 1
+		alertHandshakeFailure = 40
+		alertInternalError    = 80
+	)
+	if len(p) < 6 || p[0] != recordTypeHandshake || p[5] != handshakeClientHello {
+		return nil
+	}
+	names := parseServerNames(p[5:])
+	for sni, value := range c.snis {
+		if !containsName(names, sni) {
+			continue
+		}
+		switch value {
+		case "EOF":
+			return bytes.NewReader(nil)
+		case "HANDSHAKE_FAILURE":
+			return bytes.NewReader(newAlert(alertHandshakeFailure))
+		case "MITM":
+			return newMITM(sni, p)
+		default:
+			return bytes.NewReader(newAlert(alertInternalError))
+		}
+	}
+	return nil
+}
+
+// containsName returns whether names contains sni. Like DNS names,
+// SNIs are case insensitive.
+func containsName(names []string, sni string) bool {
+	for _, name := range names {
+		if strings.EqualFold(name, sni) {
+			return true
+		}
+	}
+	return false
+}
+
+// byteReader reads big endian, length prefixed fields. Once a read
+// fails because there are not enough bytes, all reads fail.
+type byteReader struct {
+	data []byte
+	ok   bool
+}
+
+// next returns the next n bytes.
+func (r *byteReader) next(n int) []byte {
+	if !r.ok || n < 0 || n > len(r.data) {
+		r.ok = false
+		return nil
+	}
+	out := r.data[:n]
+	r.data = r.data[n:]
+	return out
+}
+
+// uint reads an unsigned integer encoded using size bytes.
+func (r *byteReader) uint(size int) int {
+	var out int
+	for _, b := range r.next(size) {
+		out = out<<8 | int(b)
+	}
+	return out
+}
+
+// vector reads a vector whose length is encoded using size bytes.
+func (r *byteReader) vector(size int) *byteReader {
+	return &byteReader{data: r.next(r.uint(size)), ok: r.ok}
+}
+
+// parseServerNames returns the host names in the server_name extension
+// of the ClientHello handshake message in p, or nil. We tolerate a
+// ClientHello that is longer than p, because we do not reassemble
+// records, as long as p contains the whole server_name extension.
+func parseServerNames(p []byte) []string {
+	const (
+		extensionServerName = 0
+		nameTypeHostName    = 0
+	)
+	r := &byteReader{data: p, ok: true}
+	r.next(1 + 3 + 2 + 32) // type, length, version, random
+	r.vector(1)            // session_id
+	r.vector(2)            // cipher_suites
+	r.vector(1)            // compression_methods
+	extensions := r.uint(2)
+	if !r.ok {
+		return nil
+	}
+	if extensions < len(r.data) {
+		r.data = r.data[:extensions]
+	}
+	for r.ok && len(r.data) > 0 {
+		extType := r.uint(2)
+		extData := r.vector(2)
+		if !r.ok || extType != extensionServerName {
+			continue
+		}
+		var names []string
+		list := extData.vector(2)
+		for list.ok && len(list.data) > 0 {
+			nameType := list.uint(1)
+			name := list.vector(2)
+			if name.ok && nameType == nameTypeHostName {
+				names = append(names, string(name.data))
+			}
+		}
+		return names
+	}
+	return nil
+}
+
+// newAlert returns a fatal TLS alert with the given description.
+func newAlert(description byte) []byte {
+	return []byte{
+		21,          // alert
+		3,           // version[0]
+		3,           // version[1]
+		0,           // length[0]
+		2,           // length[1]
+		2,           // fatal
+		description, // description
+	}
+}
+
+// matchHost returns the reader of the censor's response if p is an
+// HTTP request for one of the blocked hosts, or nil.
+func (c *connWrapper) matchHost(p []byte) io.Reader {
+	if c.blockpages == nil {
+		return nil
+	}
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(p)))
+	if err != nil {
+		return nil
+	}
+	body, found := c.blockpages[req.Host]
+	if !found {
+		body, found = c.blockpages["*"]
+	}
+	if !found {
+		return nil
+	}
+	return strings.NewReader(fmt.Sprintf(
+		"HTTP/1.1 200 OK\r\nContent-Type: text/html\r\nContent-Length: %d\r\n"+
+			"Connection: close\r\n\r\n%s", len(body), body))
+}
+
+// inject makes the censor's response available to Read, and closes
+// the real connection, because the censor has taken it over.
+func (c *connWrapper) inject(reader io.Reader, p []byte) (int, error) {
+	c.mu.Lock()
+	c.reader = reader
+	c.mu.Unlock()
+	c.Conn.Close()
+	return len(p), nil
+}
+
+func (c *connWrapper) injected() io.Reader {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.reader
+}
+
+func (c *connWrapper) isUDP() bool {
+	return strings.HasPrefix(c.network, "udp")
+}
+
+func (c *connWrapper) lost() bool {
+	return c.loss > 0 && mathrand.Float64() < c.loss
+}
+
+// throttle sleeps as much as needed to receive n bytes at c.rate.
+func (c *connWrapper) throttle(n int) {
+	if c.rate > 0 && n > 0 {
+		time.Sleep(time.Duration(n) * time.Second / time.Duration(c.rate))
+	}
+}
+
+func (c *connWrapper) Close() error {
+	// Implementation note: we will block here if we attempt to close
+	// too many times and noone's reading. Because we have a large buffer,
+	// and because this is integration testing code, that's fine.
+	c.closed <- true
+	if reader, ok := c.injected().(io.Closer); ok {
+		reader.Close()
+	}
+	return c.Conn.Close()
+}
+
+// newMITM returns a connection to a TLS server, owned by the censor, using
+// a self-signed certificate for sni. We feed it the ClientHello in hello. We
+// use a loopback connection rather than net.Pipe, because both peers may
+// write at the same time during the handshake and net.Pipe is unbuffered. If
+// anything fails, the client will see an EOF.
+func newMITM(sni string, hello []byte) io.Reader {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return bytes.NewReader(nil)
+	}
+	defer listener.Close()
+	client, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		return bytes.NewReader(nil)
+	}
+	server, err := listener.Accept()
+	if err != nil {
+		client.Close()
+		return bytes.NewReader(nil)
+	}
+	go func() {
+		defer server.Close()
+		cert, err := newSelfSignedCert(sni)
+		if err != nil {
+			return
+		}
+		tls.Server(server, &tls.Config{
+			Certificates: []tls.Certificate{cert},
+		}).Handshake()
+	}()
+	client.Write(hello)
+	return client
+}
+
+// newSelfSignedCert creates a self-signed certificate for sni.
+func newSelfSignedCert(sni string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: sni},
+		DNSNames:     []string{sni},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
@@ -16,13 +16,27 @@
 //
 //     selfcensor.Enable(`{"BlockedFingerprints":{"dns.google":"RST"}}`)
 //
+// The following example injects a TLS alert after the ClientHello
+// containing the `dns.google` SNI:
+//
+//     selfcensor.Enable(`{"BlockedSNIs":{"dns.google":"ALERT"}}`)
+//
+// The following example returns a blockpage for HTTP requests
+// whose Host header is `example.com`:
+//
+//     selfcensor.Enable(`{"HTTPBlockpages":{"example.com":"<html>blocked</html>"}}`)
+//
+// The following example limits the download speed from `8.8.8.8:443`
+// to 10,000 bytes per second and drops 10% of the writes:
+//
+//     selfcensor.Enable(`{"ThrottledEndpoints":{"8.8.8.8:443":10000},"LossyEndpoints":{"8.8.8.8:443":0.1}}`)
+//
 // The documentation of the Spec structure contains further information on
 // how to populate the JSON. Miniooni uses the `--self-censor-spec flag` to
 // which you are supposed to pass a serialized JSON.
 package selfcensor
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -58,6 +72,37 @@ type Spec struct {
 	// is "TIMEOUT", then the code will return claiming "i/o timeout". If
 	// the value is anything else, we will perform a "RST".
 	BlockedFingerprints map[string]string
+
+	// BlockedSNIs allows you to block TLS handshakes whose ClientHello
+	// contains specific SNIs. The key is the SNI, which must be equal, except
+	// for the case, to the server_name in the ClientHello. If the value is "ALERT",
+	// the censor injects an internal_error alert. If the value is
+	// "HANDSHAKE_FAILURE", the censor injects a handshake_failure alert. If
+	// the value is "EOF", the censor closes the connection. If the value
+	// is "MITM", the censor completes the handshake using a self-signed
+	// certificate for the SNI. If the value is anything else, we will
+	// perform an "ALERT".
+	BlockedSNIs map[string]string
+
+	// HTTPBlockpages allows you to inject a blockpage in response to
+	// HTTP requests for specific hosts. The key is the value of the Host
+	// header, including the port, if any. The "*" key matches any host
+	// that has no key of its own, which is useful when the Host header is
+	// random. The value is the body of the blockpage, which we return
+	// with a 200 status code.
+	HTTPBlockpages map[string]string
+
+	// ThrottledEndpoints allows you to throttle the download speed of
+	// specific IP endpoints. The key is `IP:port`, like in BlockedEndpoints,
+	// and the value is the maximum speed in bytes per second.
+	ThrottledEndpoints map[string]int64
+
+	// LossyEndpoints allows you to emulate packet loss for specific IP
+	// endpoints. The key is `IP:port`, like in BlockedEndpoints, and the
+	// value is the probability of losing a write, between 0 and 1. For UDP
+	// endpoints we silently drop the datagram. Because TCP retransmits lost
+	// segments, for TCP endpoints we delay the write by lossyRetransmitDelay.
+	LossyEndpoints map[string]float64
 }
 
 var (
@@ -180,51 +225,15 @@ func (d SystemDialer) DialContext(
 				}
 			}
 		}
-		if spec.BlockedFingerprints != nil {
+		if spec.needsConnWrapper() {
 			conn, err := defaultNetDialer.DialContext(ctx, network, address)
 			if err != nil {
 				return nil, err
 			}
-			return connWrapper{Conn: conn, closed: make(chan interface{}, 128),
-				fingerprints: spec.BlockedFingerprints}, nil
+			return newConnWrapper(conn, network, address, spec), nil
 		}
 		// FALLTHROUGH
 	}
 	return defaultNetDialer.DialContext(ctx, network, address)
 }
 
-type connWrapper struct {
-	net.Conn
-	closed       chan interface{}
-	fingerprints map[string]string
-}
-
-func (c connWrapper) Write(p []byte) (int, error) {
-	// TODO(bassosimone): implement reassembly to workaround the
-	// splitting of the ClientHello message.
-	if _, err := c.match(p, len(p)); err != nil {
-		return 0, err
-	}
-	return c.Conn.Write(p)
-}
-
-func (c connWrapper) match(p []byte, n int) (int, error) {
-	p = p[:n] // trim
-	for key, value := range c.fingerprints {
-		if bytes.Index(p, []byte(key)) != -1 {
-			if value == "TIMEOUT" {
-				return 0, errTimeout
-			}
-			return 0, errors.New("connection reset by peer")
-		}
-	}
-	return n, nil
-}
-
-func (c connWrapper) Close() error {
-	// Implementation note: we will block here if we attempt to close
-	// too many times and noone's reading. Because we have a large buffer,
-	// and because this is integration testing code, that's fine.
-	c.closed <- true
-	return c.Conn.Close()
-}
@@ -2,6 +2,12 @@ package selfcensor_test
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
@@ -269,3 +275,193 @@ func TestBlockedFingerprintsConnectionReset(t *testing.T) {
 		t.Fatal("expected nil conn here")
 	}
 }
+
+func TestBlockedSNIs(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	savedCertPool := netx.CertPool
+	defer func() {
+		netx.CertPool = savedCertPool
+	}()
+	netx.CertPool = x509.NewCertPool()
+	netx.CertPool.AddCert(server.Certificate())
+	cases := []struct {
+		action   string
+		sni      string
+		expected string
+	}{{
+		action:   "ALERT",
+		sni:      "www.example.com",
+		expected: "unknown_failure: remote error: tls: internal error",
+	}, {
+		action:   "HANDSHAKE_FAILURE",
+		sni:      "www.example.com",
+		expected: "unknown_failure: remote error: tls: handshake failure",
+	}, {
+		action:   "EOF",
+		sni:      "www.example.com",
+		expected: "eof_error",
+	}, {
+		action:   "MITM",
+		sni:      "www.example.com",
+		expected: "ssl_unknown_authority",
+	}, {
+		action:   "ALERT",
+		sni:      "WWW.EXAMPLE.COM", // SNIs are case insensitive
+		expected: "unknown_failure: remote error: tls: internal error",
+	}, {
+		action: "MITM",
+		sni:    "example.com", // not matching
+	}, {
+		action:   "MITM",
+		sni:      "www.example.com.org", // not matching, reaches the server
+		expected: "ssl_invalid_hostname",
+	}}
+	for _, c := range cases {
+		t.Run(c.action+" with "+c.sni, func(t *testing.T) {
+			err := selfcensor.MaybeEnable(`{"BlockedSNIs":{"www.example.com":"` + c.action + `"}}`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tlsDialer := netx.NewTLSDialer(netx.Config{
+				Dialer:    selfcensor.SystemDialer{},
+				TLSConfig: &tls.Config{ServerName: c.sni},
+			})
+			conn, err := tlsDialer.DialTLSContext(
+				context.Background(), "tcp", server.Listener.Addr().String())
+			if c.expected == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				conn.Close()
+				return
+			}
+			if err == nil || err.Error() != c.expected {
+				t.Fatal("not the error we expected", err)
+			}
+			if conn != nil {
+				t.Fatal("expected nil conn here")
+			}
+		})
+	}
+}
+
+func TestHTTPBlockpages(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("not blocked"))
+		}))
+	defer server.Close()
+	address := server.Listener.Addr().String()
+	for _, key := range []string{address, "*"} {
+		t.Run("with "+key, func(t *testing.T) {
+			err := selfcensor.MaybeEnable(`{"HTTPBlockpages":{"` + key + `":"<html>blocked</html>"}}`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			txp := netx.NewHTTPTransport(netx.Config{Dialer: selfcensor.SystemDialer{}})
+			defer txp.CloseIdleConnections()
+			req, err := http.NewRequest("GET", server.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := txp.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			data, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != 200 || string(data) != "<html>blocked</html>" {
+				t.Fatal("expected to see the blockpage")
+			}
+		})
+	}
+}
+
+func TestThrottledEndpoints(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write(make([]byte, 20000))
+		}))
+	defer server.Close()
+	address := server.Listener.Addr().String()
+	err := selfcensor.MaybeEnable(`{"ThrottledEndpoints":{"` + address + `":100000}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txp := netx.NewHTTPTransport(netx.Config{Dialer: selfcensor.SystemDialer{}})
+	defer txp.CloseIdleConnections()
+	req, err := http.NewRequest("GET", server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	begin := time.Now()
+	resp, err := txp.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if _, err := ioutil.ReadAll(resp.Body); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(begin); elapsed < 190*time.Millisecond {
+		t.Fatal("the download was not throttled", elapsed)
+	}
+}
+
+func TestLossyEndpoints(t *testing.T) {
+	t.Run("for UDP", func(t *testing.T) {
+		pconn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer pconn.Close()
+		address := pconn.LocalAddr().String()
+		err = selfcensor.MaybeEnable(`{"LossyEndpoints":{"` + address + `":1}}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn, err := selfcensor.SystemDialer{}.DialContext(
+			context.Background(), "udp", address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		if _, err := conn.Write([]byte("antani")); err != nil {
+			t.Fatal(err)
+		}
+		pconn.SetDeadline(time.Now().Add(250 * time.Millisecond))
+		buffer := make([]byte, 1024)
+		if _, _, err := pconn.ReadFrom(buffer); err == nil {
+			t.Fatal("expected the datagram to be lost")
+		}
+	})
+	t.Run("for TCP", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer listener.Close()
+		address := listener.Addr().String()
+		err = selfcensor.MaybeEnable(`{"LossyEndpoints":{"` + address + `":1}}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn, err := selfcensor.SystemDialer{}.DialContext(
+			context.Background(), "tcp", address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		begin := time.Now()
+		if _, err := conn.Write([]byte("antani")); err != nil {
+			t.Fatal(err)
+		}
+		if elapsed := time.Since(begin); elapsed < 190*time.Millisecond {
+			t.Fatal("the write was not delayed", elapsed)
+		}
+	})
+}
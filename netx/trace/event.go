@@ -12,6 +12,7 @@ type Event struct {
 	Address            string              `json:",omitempty"`
 	DNSQuery           []byte              `json:",omitempty"`
 	DNSReply           []byte              `json:",omitempty"`
+	DNSSECStatus       string              `json:",omitempty"`
 	DataIsTruncated    bool                `json:",omitempty"`
 	Data               []byte              `json:",omitempty"`
 	Duration           time.Duration       `json:",omitempty"`
@@ -27,6 +28,9 @@ type Event struct {
 	Proto              string              `json:",omitempty"`
 	TLSServerName      string              `json:",omitempty"`
 	TLSCipherSuite     string              `json:",omitempty"`
+	TLSECHAccepted     bool                `json:",omitempty"`
+	TLSECHOffered      bool                `json:",omitempty"`
+	TLSFingerprint     string              `json:",omitempty"`
 	TLSNegotiatedProto string              `json:",omitempty"`
 	TLSNextProtos      []string            `json:",omitempty"`
 	TLSPeerCerts       []*x509.Certificate `json:",omitempty"`
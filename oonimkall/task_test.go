@@ -121,10 +121,10 @@ func TestIntegrationInvalidJSON(t *testing.T) {
 func TestIntegrationUnsupportedSetting(t *testing.T) {
 	task, err := oonimkall.StartTask(`{
 		"assets_dir": "../testdata/oonimkall/assets",
-		"input_filepaths": ["/nonexistent"],
 		"log_level": "DEBUG",
 		"name": "Example",
 		"options": {
+			"backend": "foo",
 			"software_name": "oonimkall-test",
 			"software_version": "0.1.0"
 		},
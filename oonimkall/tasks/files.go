@@ -0,0 +1,142 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	engine "github.com/ooni/probe-engine"
+)
+
+var (
+	// errEmptyFilepath indicates that a file path is empty.
+	errEmptyFilepath = errors.New("empty file path")
+
+	// errFilepathInsideEngineDir indicates that a file path points
+	// inside a directory that belongs to the engine.
+	errFilepathInsideEngineDir = errors.New("file path inside StateDir or AssetsDir")
+)
+
+// validateFilepath checks whether path is a valid InputFilepaths or
+// OutputFilepath entry. Like StateDir, path must not be empty. We also
+// refuse paths inside StateDir or AssetsDir. They belong to the engine:
+// we do not want to overwrite its files with measurements, nor to read
+// secrets, e.g. the orchestra credentials, as inputs.
+func (r *Runner) validateFilepath(path string) error {
+	if path == "" {
+		return errEmptyFilepath
+	}
+	for _, dir := range []string{r.settings.StateDir, r.settings.AssetsDir} {
+		inside, err := isInsideDir(dir, path)
+		if err != nil {
+			return err
+		}
+		if inside {
+			return errFilepathInsideEngineDir
+		}
+	}
+	return nil
+}
+
+// isInsideDir returns whether path is dir or is inside dir. We resolve
+// the symbolic links of both, so that a symbolic link pointing inside dir
+// counts as being inside dir.
+func isInsideDir(dir, path string) (bool, error) {
+	if dir == "" {
+		return false, nil
+	}
+	absdir, err := resolvePath(dir)
+	if err != nil {
+		return false, err
+	}
+	abspath, err := resolvePath(path)
+	if err != nil {
+		return false, err
+	}
+	rel, err := filepath.Rel(absdir, abspath)
+	if err != nil {
+		return false, nil // e.g. on a different Windows volume
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)), nil
+}
+
+// resolvePath returns the absolute path of path with all the symbolic
+// links resolved. When path does not exist, e.g. an OutputFilepath we
+// have not created yet, we resolve its parent directory instead. When
+// path is a dangling symbolic link, we resolve its target, because that
+// is the file that we would create when writing into path.
+func resolvePath(path string) (string, error) {
+	abspath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(abspath)
+	if err == nil {
+		return resolved, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+	if info, err := os.Lstat(abspath); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(abspath)
+		if err != nil {
+			return "", err
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(abspath), target)
+		}
+		return resolvePath(target)
+	}
+	parent := filepath.Dir(abspath)
+	if parent == abspath {
+		return abspath, nil // we reached the root
+	}
+	resolved, err = resolvePath(parent)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(resolved, filepath.Base(abspath)), nil
+}
+
+// loadInputFilepaths appends to the inputs the content of the files in
+// InputFilepaths. Like measurement-kit, we read an input per line. We
+// skip empty lines, including the one at the end of the file.
+func (r *Runner) loadInputFilepaths() error {
+	for _, path := range r.settings.InputFilepaths {
+		if err := r.validateFilepath(path); err != nil {
+			return fmt.Errorf("InputFilepaths: %s: %w", path, err)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("InputFilepaths: %w", err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if input := strings.TrimSpace(line); input != "" {
+				r.settings.Inputs = append(r.settings.Inputs, input)
+			}
+		}
+	}
+	return nil
+}
+
+// newOutputFilepathSink returns the sink that appends measurements to
+// OutputFilepath, like measurement-kit does, or nil if we should not
+// write measurements to file because OutputFilepath is empty or the
+// NoFileReport option is set.
+func (r *Runner) newOutputFilepathSink() (engine.MeasurementSink, error) {
+	path := r.settings.OutputFilepath
+	if path == "" || r.settings.Options.NoFileReport {
+		return nil, nil
+	}
+	if err := r.validateFilepath(path); err != nil {
+		return nil, fmt.Errorf("OutputFilepath: %s: %w", path, err)
+	}
+	sink, err := engine.NewJSONLMeasurementSink(path)
+	if err != nil {
+		return nil, fmt.Errorf("OutputFilepath: %w", err)
+	}
+	return sink, nil
+}
@@ -0,0 +1,168 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-engine/model"
+)
+
+func newFilesTestRunner(t *testing.T) (*Runner, string) {
+	dir, err := ioutil.TempDir("", "oonimkall")
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := &Settings{
+		AssetsDir: filepath.Join(dir, "assets"),
+		StateDir:  filepath.Join(dir, "state"),
+	}
+	return NewRunner(settings, make(chan *Event)), dir
+}
+
+func TestUnitValidateFilepath(t *testing.T) {
+	r, dir := newFilesTestRunner(t)
+	defer os.RemoveAll(dir)
+	cases := []struct {
+		path     string
+		expected error
+	}{
+		{"", errEmptyFilepath},
+		{filepath.Join(dir, "report.jsonl"), nil},
+		{filepath.Join(dir, "state-report.jsonl"), nil},
+		{filepath.Join(dir, "state"), errFilepathInsideEngineDir},
+		{filepath.Join(dir, "state", "orchestra.state"), errFilepathInsideEngineDir},
+		{filepath.Join(dir, "assets", "..", "state", "report.jsonl"), errFilepathInsideEngineDir},
+		{filepath.Join(dir, "assets", "report.jsonl"), errFilepathInsideEngineDir},
+	}
+	for _, c := range cases {
+		if err := r.validateFilepath(c.path); !errors.Is(err, c.expected) {
+			t.Fatal("not the error we expected", c.path, err)
+		}
+	}
+}
+
+func TestUnitValidateFilepathWithSymlinks(t *testing.T) {
+	r, dir := newFilesTestRunner(t)
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(r.settings.StateDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(
+		filepath.Join(r.settings.StateDir, "orchestra.state"), []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	links := map[string]string{
+		"state-link":    r.settings.StateDir,
+		"secrets.txt":   filepath.Join(r.settings.StateDir, "orchestra.state"),
+		"dangling.json": filepath.Join(r.settings.StateDir, "report.jsonl"),
+		"elsewhere":     dir,
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			t.Skip("cannot create symbolic links", err)
+		}
+	}
+	cases := []struct {
+		path     string
+		expected error
+	}{
+		{filepath.Join(dir, "state-link"), errFilepathInsideEngineDir},
+		{filepath.Join(dir, "state-link", "report.jsonl"), errFilepathInsideEngineDir},
+		{filepath.Join(dir, "state-link", "new", "report.jsonl"), errFilepathInsideEngineDir},
+		{filepath.Join(dir, "secrets.txt"), errFilepathInsideEngineDir},
+		{filepath.Join(dir, "dangling.json"), errFilepathInsideEngineDir},
+		{filepath.Join(dir, "elsewhere", "report.jsonl"), nil},
+	}
+	for _, c := range cases {
+		if err := r.validateFilepath(c.path); !errors.Is(err, c.expected) {
+			t.Fatal("not the error we expected", c.path, err)
+		}
+	}
+	// the engine directories may themselves be symbolic links
+	r.settings.StateDir = filepath.Join(dir, "state-link")
+	if err := r.validateFilepath(filepath.Join(dir, "state", "report.jsonl")); !errors.Is(
+		err, errFilepathInsideEngineDir) {
+		t.Fatal("not the error we expected", err)
+	}
+}
+
+func TestUnitLoadInputFilepaths(t *testing.T) {
+	r, dir := newFilesTestRunner(t)
+	defer os.RemoveAll(dir)
+	first := filepath.Join(dir, "first.txt")
+	second := filepath.Join(dir, "second.txt")
+	// the second file has Windows line endings and empty lines
+	if err := ioutil.WriteFile(first, []byte("a\nb\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(second, []byte("c\r\n\r\nd"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	r.settings.Inputs = []string{"x"}
+	r.settings.InputFilepaths = []string{first, second}
+	if err := r.loadInputFilepaths(); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"x", "a", "b", "c", "d"}, r.settings.Inputs); diff != "" {
+		t.Fatal(diff)
+	}
+	r.settings.InputFilepaths = []string{filepath.Join(dir, "nonexistent.txt")}
+	if err := r.loadInputFilepaths(); err == nil || !strings.HasPrefix(err.Error(), "InputFilepaths: ") {
+		t.Fatal("not the error we expected", err)
+	}
+	r.settings.InputFilepaths = []string{filepath.Join(dir, "state", "orchestra.state")}
+	if err := r.loadInputFilepaths(); !errors.Is(err, errFilepathInsideEngineDir) {
+		t.Fatal("not the error we expected", err)
+	}
+}
+
+func TestUnitNewOutputFilepathSink(t *testing.T) {
+	r, dir := newFilesTestRunner(t)
+	defer os.RemoveAll(dir)
+	sink, err := r.newOutputFilepathSink()
+	if err != nil || sink != nil {
+		t.Fatal("expected no sink and no error", sink, err)
+	}
+	r.settings.OutputFilepath = filepath.Join(dir, "report.jsonl")
+	r.settings.Options.NoFileReport = true
+	sink, err = r.newOutputFilepathSink()
+	if err != nil || sink != nil {
+		t.Fatal("expected no sink and no error", sink, err)
+	}
+	r.settings.Options.NoFileReport = false
+	// like measurement-kit, we must append to an existing file
+	for _, input := range []string{"a", "b"} {
+		sink, err := r.newOutputFilepathSink()
+		if err != nil {
+			t.Fatal(err)
+		}
+		measurement := &model.Measurement{Input: model.MeasurementTarget(input)}
+		if err := sink.SaveMeasurement(context.Background(), measurement); err != nil {
+			t.Fatal(err)
+		}
+		if err := sink.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := ioutil.ReadFile(r.settings.OutputFilepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 2 {
+		t.Fatal("unexpected number of lines", lines)
+	}
+	r.settings.OutputFilepath = filepath.Join(dir, "nonexistent", "report.jsonl")
+	if _, err := r.newOutputFilepathSink(); err == nil || !strings.HasPrefix(err.Error(), "OutputFilepath: ") {
+		t.Fatal("not the error we expected", err)
+	}
+	r.settings.OutputFilepath = filepath.Join(dir, "state", "report.jsonl")
+	if _, err := r.newOutputFilepathSink(); !errors.Is(err, errFilepathInsideEngineDir) {
+		t.Fatal("not the error we expected", err)
+	}
+}
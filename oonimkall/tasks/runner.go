@@ -62,9 +62,6 @@ func (r *Runner) hasUnsupportedSettings(logger *ChanLogger) (unsupported bool) {
 		r.emitter.EmitFailureStartup(why)
 		unsupported = true
 	}
-	if r.settings.InputFilepaths != nil {
-		sadly("InputFilepaths: not supported")
-	}
 	if r.settings.Options.AllEndpoints != nil {
 		logger.Warn("Options.AllEndpoints: not supported")
 	}
@@ -158,9 +155,6 @@ func (r *Runner) hasUnsupportedSettings(logger *ChanLogger) (unsupported bool) {
 	if r.settings.Options.UUID != nil {
 		sadly("Options.UUID: not supported")
 	}
-	if r.settings.OutputFilepath != "" && r.settings.Options.NoFileReport == false {
-		sadly("OutputFilepath && !NoFileReport: not supported")
-	}
 	// TODO(bassosimone): intercept IgnoreBouncerFailureError and
 	// return a failure if such variable is true.
 	return
@@ -202,6 +196,54 @@ func (r *Runner) contextForExperiment(
 	return context.Background()
 }
 
+// submissionQueueFlushTimeout is the maximum time we spend retrying
+// to submit the measurements we previously failed to submit.
+const submissionQueueFlushTimeout = 30 * time.Second
+
+// flushSubmissionQueue retries submitting the measurements that we
+// failed to submit in previous runs. We do not fail the task if we
+// cannot submit them, since we'll try again in the next run.
+func (r *Runner) flushSubmissionQueue(
+	ctx context.Context, sess *engine.Session, logger *ChanLogger) {
+	if sess.SubmissionQueueStats().Pending <= 0 {
+		return
+	}
+	logger.Info("Submitting previously queued measurements... please, be patient")
+	ctx, cancel := context.WithTimeout(ctx, submissionQueueFlushTimeout)
+	defer cancel()
+	stats, err := sess.FlushSubmissionQueue(ctx)
+	if err != nil {
+		logger.Warnf("cannot submit queued measurements: %s", err.Error())
+		return
+	}
+	logger.Infof("submission queue: pending=%d submitted=%d failed=%d dropped=%d",
+		stats.Pending, stats.Submitted, stats.Failed, stats.Dropped)
+}
+
+// newMeasurementSinks creates the sinks specified by the settings.
+func (r *Runner) newMeasurementSinks(
+	sess *engine.Session) ([]engine.MeasurementSink, error) {
+	var sinks []engine.MeasurementSink
+	sink, err := r.newOutputFilepathSink()
+	if err != nil {
+		return nil, err
+	}
+	if sink != nil {
+		sinks = append(sinks, sink)
+	}
+	for _, spec := range r.settings.MeasurementSinks {
+		sink, err := engine.NewMeasurementSink(spec, sess.DefaultHTTPClient())
+		if err != nil {
+			for _, sink := range sinks {
+				sink.Close()
+			}
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
 type runnerCallbacks struct {
 	emitter *EventEmitter
 }
@@ -227,6 +269,10 @@ func (r *Runner) Run(ctx context.Context) {
 		return
 	}
 	r.emitter.Emit(statusStarted, eventEmpty{})
+	if err := r.loadInputFilepaths(); err != nil {
+		r.emitter.EmitFailureStartup(err.Error())
+		return
+	}
 	sess, err := r.newsession(logger)
 	if err != nil {
 		r.emitter.EmitFailureStartup(err.Error())
@@ -287,6 +333,24 @@ func (r *Runner) Run(ctx context.Context) {
 		return
 	}
 
+	if !r.settings.Options.NoCollector && !r.settings.Options.NoBouncer &&
+		!r.settings.Options.NoGeoIP {
+		r.flushSubmissionQueue(ctx, sess, logger)
+	}
+
+	sinks, err := r.newMeasurementSinks(sess)
+	if err != nil {
+		r.emitter.EmitFailureStartup(err.Error())
+		return
+	}
+	defer func() {
+		for _, sink := range sinks {
+			if err := sink.Close(); err != nil {
+				logger.Warnf("cannot close measurement sink: %s", err.Error())
+			}
+		}
+	}()
+
 	builder.SetCallbacks(&runnerCallbacks{emitter: r.emitter})
 	if len(r.settings.Inputs) <= 0 {
 		if builder.InputPolicy() == engine.InputRequired {
@@ -327,6 +391,9 @@ func (r *Runner) Run(ctx context.Context) {
 		)
 		defer cancel()
 	}
+	// We submit and save the pending measurements every time we have
+	// SubmitBatchSize of them as well as when we are done.
+	var pending []pendingMeasurement
 	for idx, input := range r.settings.Inputs {
 		if ctx.Err() != nil {
 			break
@@ -361,19 +428,58 @@ func (r *Runner) Run(ctx context.Context) {
 			Input:   input,
 			JSONStr: string(data),
 		})
-		if !r.settings.Options.NoCollector {
-			logger.Info("Submitting measurement... please, be patient")
-			err := experiment.SubmitAndUpdateMeasurement(m)
-			r.emitter.Emit(measurementSubmissionEventName(err), eventMeasurementGeneric{
-				Idx:     int64(idx),
-				Input:   input,
-				JSONStr: string(data),
-				Failure: measurementSubmissionFailure(err),
+		pending = append(pending, pendingMeasurement{
+			data: data, idx: idx, input: input, measurement: m,
+		})
+		if int64(len(pending)) >= r.settings.Options.SubmitBatchSize {
+			r.submitAndSave(experiment, pending, sinks, logger)
+			pending = nil
+		}
+	}
+	r.submitAndSave(experiment, pending, sinks, logger)
+}
+
+// pendingMeasurement is a measurement waiting to be submitted.
+type pendingMeasurement struct {
+	data        []byte
+	idx         int
+	input       string
+	measurement *model.Measurement
+}
+
+// submitAndSave submits the pending measurements, unless we should
+// not use a collector, and then saves them into the sinks.
+func (r *Runner) submitAndSave(experiment *engine.Experiment,
+	pending []pendingMeasurement, sinks []engine.MeasurementSink, logger *ChanLogger) {
+	if len(pending) <= 0 {
+		return
+	}
+	if !r.settings.Options.NoCollector {
+		logger.Infof("Submitting %d measurement(s)... please, be patient", len(pending))
+		var measurements []*model.Measurement
+		for _, p := range pending {
+			measurements = append(measurements, p.measurement)
+		}
+		errs := experiment.SubmitAndUpdateMeasurements(measurements)
+		for idx, p := range pending {
+			failure := errs[idx]
+			r.emitter.Emit(measurementSubmissionEventName(failure), eventMeasurementGeneric{
+				Idx:     int64(p.idx),
+				Input:   p.input,
+				JSONStr: string(p.data),
+				Failure: measurementSubmissionFailure(failure),
 			})
 		}
+	}
+	for _, p := range pending {
+		for _, sink := range sinks {
+			if err := experiment.SaveMeasurementTo(sink, p.measurement); err != nil {
+				logger.Warnf("cannot save measurement: %s", err.Error())
+			}
+		}
 		r.emitter.Emit(statusMeasurementDone, eventMeasurementGeneric{
-			Idx:   int64(idx),
-			Input: input,
+			Idx:   int64(p.idx),
+			Input: p.input,
 		})
 	}
 }
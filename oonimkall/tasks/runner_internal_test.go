@@ -19,7 +19,6 @@ func TestUnitRunnerHasUnsupportedSettings(t *testing.T) {
 	var zero int64
 	var emptystring string
 	settings := &Settings{
-		InputFilepaths: []string{"foo"},
 		Options: SettingsOptions{
 			AllEndpoints:          &falsebool,
 			Backend:               "foo",
@@ -54,7 +53,6 @@ func TestUnitRunnerHasUnsupportedSettings(t *testing.T) {
 			Timeout:               &zerodotzero,
 			UUID:                  &emptystring,
 		},
-		OutputFilepath: "foo",
 	}
 	go func() {
 		defer close(out)
@@ -84,7 +82,6 @@ func TestUnitRunnerHasUnsupportedSettings(t *testing.T) {
 		}
 	}
 	expectedFatal := []string{
-		"InputFilepaths: not supported",
 		"Options.Backend: not supported",
 		"Options.BouncerBaseURL: not supported",
 		"Options.CollectorBaseURL: not supported",
@@ -95,7 +92,6 @@ func TestUnitRunnerHasUnsupportedSettings(t *testing.T) {
 		"Options.TestSuite: not supported",
 		"Options.Timeout: not supported",
 		"Options.UUID: not supported",
-		"OutputFilepath && !NoFileReport: not supported",
 	}
 	if diff := cmp.Diff(expectedFatal, fatal); diff != "" {
 		t.Fatal(diff)
@@ -2,9 +2,13 @@ package tasks_test
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
@@ -137,11 +141,11 @@ func TestIntegrationRunnerWithUnsupportedSettings(t *testing.T) {
 		LogLevel:  "DEBUG",
 		Name:      "Example",
 		Options: tasks.SettingsOptions{
+			Backend:         "foo",
 			SoftwareName:    "oonimkall-test",
 			SoftwareVersion: "0.1.0",
 		},
-		OutputFilepath: "/nonexistent",
-		StateDir:       "../../testdata/oonimkall/state",
+		StateDir: "../../testdata/oonimkall/state",
 	}
 	go func() {
 		tasks.Run(context.Background(), settings, out)
@@ -415,3 +419,82 @@ func TestIntegrationRunnerWithFailedMeasurement(t *testing.T) {
 		t.Fatal("failure.measurement event not found")
 	}
 }
+
+func TestIntegrationRunnerWithMeasurementSinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oonimkall")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "report.jsonl")
+	out := make(chan *tasks.Event)
+	settings := &tasks.Settings{
+		AssetsDir:        "../../testdata/oonimkall/assets",
+		LogLevel:         "DEBUG",
+		MeasurementSinks: []string{"jsonl:" + filename},
+		Name:             "Example",
+		Options: tasks.SettingsOptions{
+			NoBouncer:        true,
+			NoCollector:      true,
+			NoGeoIP:          true,
+			NoResolverLookup: true,
+			SoftwareName:     "oonimkall-test",
+			SoftwareVersion:  "0.1.0",
+		},
+		StateDir: "../../testdata/oonimkall/state",
+	}
+	go func() {
+		tasks.Run(context.Background(), settings, out)
+		close(out)
+	}()
+	for ev := range out {
+		if ev.Key == "failure.startup" {
+			t.Fatal("unexpected failure.startup event", ev.Value)
+		}
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var measurement struct {
+		TestName string `json:"test_name"`
+	}
+	if err := json.Unmarshal(data, &measurement); err != nil {
+		t.Fatal(err)
+	}
+	if measurement.TestName != "example" {
+		t.Fatal("unexpected test name", measurement.TestName)
+	}
+}
+
+func TestIntegrationRunnerWithInvalidMeasurementSink(t *testing.T) {
+	out := make(chan *tasks.Event)
+	settings := &tasks.Settings{
+		AssetsDir:        "../../testdata/oonimkall/assets",
+		LogLevel:         "DEBUG",
+		MeasurementSinks: []string{"csv:report.csv"},
+		Name:             "Example",
+		Options: tasks.SettingsOptions{
+			NoBouncer:        true,
+			NoCollector:      true,
+			NoGeoIP:          true,
+			NoResolverLookup: true,
+			SoftwareName:     "oonimkall-test",
+			SoftwareVersion:  "0.1.0",
+		},
+		StateDir: "../../testdata/oonimkall/state",
+	}
+	go func() {
+		tasks.Run(context.Background(), settings, out)
+		close(out)
+	}()
+	var found bool
+	for ev := range out {
+		if ev.Key == "failure.startup" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("failure.startup event not found")
+	}
+}
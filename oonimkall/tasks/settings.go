@@ -20,15 +20,23 @@ type Settings struct {
 	// requires input and you provide no input.
 	Inputs []string `json:"inputs,omitempty"`
 
-	// InputFilepaths contains the input file paths. This
-	// setting is not implemented by this library. Attempting
-	// to set it will cause a startup error.
+	// InputFilepaths contains the input file paths. Each file
+	// contains an input per line. We add the inputs read from
+	// these files to Inputs. The task won't start if we cannot
+	// read a file or if a file is inside StateDir or AssetsDir.
 	InputFilepaths []string `json:"input_filepaths,omitempty"`
 
 	// LogLevel contains the logs level. See https://git.io/Jv4Rv
 	// for the names of the available log levels.
 	LogLevel string `json:"log_level,omitempty"`
 
+	// MeasurementSinks contains the specifications of additional
+	// sinks where to save measurements, e.g., `webhook:URL`. See the
+	// documentation of engine.NewMeasurementSink for the format. This
+	// field is an extension of MK's specification. The task won't
+	// start if any specification is invalid.
+	MeasurementSinks []string `json:"measurement_sinks,omitempty"`
+
 	// Name contains the task name. By https://git.io/Jv4Rv the
 	// names are in camel case, e.g. `Ndt`.
 	Name string `json:"name"`
@@ -36,10 +44,10 @@ type Settings struct {
 	// Options contains the task options.
 	Options SettingsOptions `json:"options"`
 
-	// OutputFilepath contains the output filepath. This
-	// setting is not implemented by this library. Attempting
-	// to set it will cause a startup error unless the
-	// Options.NoFileReport setting is true.
+	// OutputFilepath contains the output filepath. Unless the
+	// Options.NoFileReport setting is true, we append measurements
+	// to this file using the JSONL format. The task won't start if
+	// we cannot open the file or if it is inside StateDir or AssetsDir.
 	OutputFilepath string `json:"output_filepath,omitempty"`
 
 	// StateDir is the directory where to store persistent data. This
@@ -162,10 +170,9 @@ type SettingsOptions struct {
 	// NoCollector indicates whether to use a collector
 	NoCollector bool `json:"no_collector,omitempty"`
 
-	// NoFileReport indicates whether to write a report file. Saving
-	// the report to file is currently not implemented by this
-	// library. Hence, if NoFileReport is false and OutputFilepath
-	// is not empty, there will be a startup error.
+	// NoFileReport indicates whether to write a report file. When
+	// NoFileReport is false, we write measurements to OutputFilepath,
+	// unless it is empty.
 	NoFileReport bool `json:"no_file_report,omitempty"`
 
 	// NoGeoIP indicates whether to perform a GeoIP lookup. This
@@ -240,6 +247,13 @@ type SettingsOptions struct {
 	// present, then the library startup will fail.
 	SoftwareVersion string `json:"software_version,omitempty"`
 
+	// SubmitBatchSize is the number of measurements that we submit at
+	// once, when the collector supports it, to reduce the number of
+	// requests. When it is zero or one, we submit each measurement right
+	// after measuring it. Otherwise, we also submit the remaining
+	// measurements at the end of the task.
+	SubmitBatchSize int64 `json:"submit_batch_size,omitempty"`
+
 	// TestSuite is a legacy option that this library does not support.
 	TestSuite *int64 `json:"test_suite,omitempty"`
 
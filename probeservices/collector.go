@@ -8,6 +8,7 @@ import (
 	"reflect"
 	"sync"
 
+	"github.com/ooni/probe-engine/internal/httpx"
 	"github.com/ooni/probe-engine/model"
 )
 
@@ -81,9 +82,15 @@ func NewReportTemplate(m *model.Measurement) ReportTemplate {
 	}
 }
 
+// collectorOpenResponse is the response to opening a report. The
+// SupportedEncodings and SupportsBatch fields are an extension to the
+// collector spec, which allows the collector to tell us that it accepts
+// gzip request bodies and several measurements at once.
 type collectorOpenResponse struct {
-	ID               string   `json:"report_id"`
-	SupportedFormats []string `json:"supported_formats"`
+	ID                 string   `json:"report_id"`
+	SupportedEncodings []string `json:"supported_encodings"`
+	SupportedFormats   []string `json:"supported_formats"`
+	SupportsBatch      bool     `json:"supports_batch"`
 }
 
 // Report is an open report
@@ -91,6 +98,9 @@ type Report struct {
 	// ID is the report ID
 	ID string
 
+	// batch indicates whether the collector accepts batches.
+	batch bool
+
 	// client is the client that was used.
 	client Client
 
@@ -112,9 +122,14 @@ func (c Client) OpenReport(ctx context.Context, rt ReportTemplate) (*Report, err
 	if err := c.Client.PostJSON(ctx, "/report", rt, &cor); err != nil {
 		return nil, err
 	}
+	for _, encoding := range cor.SupportedEncodings {
+		if encoding == "gzip" {
+			c.Client.GzipRequestBody = true
+		}
+	}
 	for _, format := range cor.SupportedFormats {
 		if format == "json" {
-			return &Report{ID: cor.ID, client: c, tmpl: rt}, nil
+			return &Report{ID: cor.ID, batch: cor.SupportsBatch, client: c, tmpl: rt}, nil
 		}
 	}
 	return nil, ErrJSONFormatNotSupported
@@ -159,6 +174,102 @@ func (r Report) SubmitMeasurement(ctx context.Context, m *model.Measurement) err
 	return err
 }
 
+type collectorBatchRequest struct {
+	// Format is the data format
+	Format string `json:"format"`
+
+	// Content contains the measurements
+	Content []*model.Measurement `json:"content"`
+}
+
+type collectorBatchResponse struct {
+	// IDs contains the measurement IDs
+	IDs []string `json:"measurement_ids"`
+}
+
+// ErrSubmissionSkipped indicates that SubmitMeasurements did not try
+// to submit a measurement because a previous submission failed with an
+// error suggesting that the collector is not reachable.
+var ErrSubmissionSkipped = errors.New("probeservices: submission skipped")
+
+// SubmitMeasurements is like SubmitMeasurement but submits several
+// measurements belonging to the report. When the collector supports it,
+// we submit all the measurements using a single request. We fall back
+// to submitting the measurements one at a time when the collector tells
+// us that it does not implement batches, in which case we remember not
+// to use batches anymore for this report, or when it rejects the batch,
+// e.g., because it is too large (413) or because some measurement is
+// invalid. Returns a slice containing, for each measurement, the error
+// that occurred when submitting it, or nil on success.
+//
+// When submitting one at a time, we continue after the collector rejects
+// a measurement, but we stop after any other error and we mark the
+// remaining measurements with an error wrapping ErrSubmissionSkipped.
+//
+// When a batch request fails, we cannot know whether the collector stored
+// some measurements before failing, e.g., when the connection breaks
+// while we are reading the response. Hence, submitting again the
+// measurements, e.g., from the submission queue, may create duplicates.
+// These duplicates have the same report_id and content, so the consumers
+// of the collected measurements can remove them.
+func (r *Report) SubmitMeasurements(ctx context.Context, ms []*model.Measurement) []error {
+	errs := make([]error, len(ms))
+	if r.batch && len(ms) > 1 {
+		err := r.submitBatch(ctx, ms)
+		if err == nil {
+			return errs
+		}
+		var statusErr *httpx.StatusError
+		switch {
+		case errors.As(err, &statusErr) && (statusErr.StatusCode == 404 ||
+			statusErr.StatusCode == 405 || statusErr.StatusCode == 501):
+			r.client.Logger.Debug("collector.go: batch not implemented; falling back")
+			r.batch = false
+		case isPermanentFailure(err):
+			// Implementation note: this includes 413, i.e., the batch is
+			// too large, and the case where the collector rejects the batch
+			// because of a measurement. Submitting one at a time allows us
+			// to only lose the measurements the collector rejects.
+			r.client.Logger.Debugf("collector.go: batch rejected: %s; falling back", err.Error())
+		default:
+			for idx := range errs {
+				errs[idx] = err
+			}
+			return errs
+		}
+	}
+	for idx, m := range ms {
+		err := r.SubmitMeasurement(ctx, m)
+		errs[idx] = err
+		if err != nil && !isPermanentFailure(err) {
+			for rest := idx + 1; rest < len(ms); rest++ {
+				errs[rest] = fmt.Errorf("%w: %s", ErrSubmissionSkipped, err.Error())
+			}
+			break
+		}
+	}
+	return errs
+}
+
+func (r *Report) submitBatch(ctx context.Context, ms []*model.Measurement) error {
+	var batchResponse collectorBatchResponse
+	for _, m := range ms {
+		m.ReportID = r.ID
+	}
+	err := r.client.Client.PostJSON(
+		ctx, fmt.Sprintf("/report/%s/batch", r.ID), collectorBatchRequest{
+			Format:  "json",
+			Content: ms,
+		}, &batchResponse,
+	)
+	if err == nil && len(batchResponse.IDs) == len(ms) {
+		for idx, m := range ms {
+			m.OOID = batchResponse.IDs[idx]
+		}
+	}
+	return err
+}
+
 // Close closes the report. Returns nil on success; an error on failure.
 func (r Report) Close(ctx context.Context) error {
 	var input, output struct{}
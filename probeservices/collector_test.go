@@ -3,15 +3,18 @@ package probeservices_test
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-engine/internal/probeservicesd"
 	"github.com/ooni/probe-engine/model"
 	"github.com/ooni/probe-engine/probeservices"
 )
@@ -460,3 +463,197 @@ func TestSubmitterCannotOpenNewChannel(t *testing.T) {
 		t.Fatal("unexpected number of channels")
 	}
 }
+
+// newBatchServer returns a stand-in for the probe services that counts
+// the requests and the gzipped requests it receives.
+func newBatchServer(t *testing.T) (
+	*probeservicesd.Handler, *probeservices.Client, *int64, *int64, func()) {
+	handler := probeservicesd.NewHandler()
+	var requests, gzipped int64
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt64(&requests, 1)
+			if r.Header.Get("Content-Encoding") == "gzip" {
+				atomic.AddInt64(&gzipped, 1)
+			}
+			handler.ServeHTTP(w, r)
+		}))
+	return handler, newLocalClient(t, server.URL), &requests, &gzipped, server.Close
+}
+
+func makeBatch(count int) []*model.Measurement {
+	var out []*model.Measurement
+	for idx := 0; idx < count; idx++ {
+		out = append(out, newQueueMeasurement(fmt.Sprintf("%d", idx)))
+	}
+	return out
+}
+
+// countFailures returns the number of non-nil errors in errs.
+func countFailures(errs []error) (count int) {
+	for _, err := range errs {
+		if err != nil {
+			count++
+		}
+	}
+	return
+}
+
+func TestSubmitMeasurementsBatch(t *testing.T) {
+	handler, client, requests, gzipped, cleanup := newBatchServer(t)
+	defer cleanup()
+	ms := makeBatch(3)
+	report, err := client.OpenReport(context.Background(), probeservices.NewReportTemplate(ms[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := report.SubmitMeasurements(context.Background(), ms)
+	if len(errs) != 3 || countFailures(errs) != 0 {
+		t.Fatal("unexpected errors", errs)
+	}
+	if len(handler.Measurements()) != 3 {
+		t.Fatal("unexpected number of measurements")
+	}
+	if *requests != 2 || *gzipped != 1 {
+		t.Fatal("unexpected number of requests", *requests, *gzipped)
+	}
+	for _, m := range ms {
+		if m.ReportID != report.ID || m.OOID == "" {
+			t.Fatal("measurement not updated")
+		}
+	}
+}
+
+func TestSubmitMeasurementsFallback(t *testing.T) {
+	handler, client, requests, gzipped, cleanup := newBatchServer(t)
+	defer cleanup()
+	ms := makeBatch(3)
+	report, err := client.OpenReport(context.Background(), probeservices.NewReportTemplate(ms[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler.SupportsBatch = false // pretend the collector changed its mind
+	if errs := report.SubmitMeasurements(context.Background(), ms); countFailures(errs) != 0 {
+		t.Fatal("unexpected errors", errs)
+	}
+	if len(handler.Measurements()) != 3 {
+		t.Fatal("unexpected number of measurements")
+	}
+	if *requests != 5 || *gzipped != 4 {
+		t.Fatal("unexpected number of requests", *requests, *gzipped)
+	}
+	// We must remember that the collector does not support batches.
+	if errs := report.SubmitMeasurements(context.Background(), ms); countFailures(errs) != 0 {
+		t.Fatal("unexpected errors", errs)
+	}
+	if *requests != 8 {
+		t.Fatal("unexpected number of requests", *requests)
+	}
+}
+
+func TestSubmitMeasurementsFallbackWhenBatchIsTooLarge(t *testing.T) {
+	handler, client, requests, _, cleanup := newBatchServer(t)
+	defer cleanup()
+	ms := makeBatch(3)
+	report, err := client.OpenReport(context.Background(), probeservices.NewReportTemplate(ms[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler.SetFault(probeservicesd.BatchEndpoint, &probeservicesd.Fault{
+		Count:      1,
+		StatusCode: 413,
+	})
+	if errs := report.SubmitMeasurements(context.Background(), ms); countFailures(errs) != 0 {
+		t.Fatal("unexpected errors", errs)
+	}
+	if len(handler.Measurements()) != 3 {
+		t.Fatal("unexpected number of measurements")
+	}
+	if *requests != 5 {
+		t.Fatal("unexpected number of requests", *requests)
+	}
+	// A too large batch does not mean that we cannot use batches.
+	if errs := report.SubmitMeasurements(context.Background(), ms); countFailures(errs) != 0 {
+		t.Fatal("unexpected errors", errs)
+	}
+	if *requests != 6 {
+		t.Fatal("unexpected number of requests", *requests)
+	}
+}
+
+func TestSubmitMeasurementsNoExtensions(t *testing.T) {
+	handler, client, requests, gzipped, cleanup := newBatchServer(t)
+	defer cleanup()
+	handler.SupportsBatch = false
+	handler.SupportsGzip = false
+	ms := makeBatch(2)
+	report, err := client.OpenReport(context.Background(), probeservices.NewReportTemplate(ms[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := report.SubmitMeasurements(context.Background(), ms); countFailures(errs) != 0 {
+		t.Fatal("unexpected errors", errs)
+	}
+	if len(handler.Measurements()) != 2 {
+		t.Fatal("unexpected number of measurements")
+	}
+	if *requests != 3 || *gzipped != 0 {
+		t.Fatal("unexpected number of requests", *requests, *gzipped)
+	}
+}
+
+func TestSubmitMeasurementsSkipsRejectedMeasurements(t *testing.T) {
+	handler, client, _, _, cleanup := newBatchServer(t)
+	defer cleanup()
+	handler.SupportsBatch = false
+	ms := makeBatch(3)
+	report, err := client.OpenReport(context.Background(), probeservices.NewReportTemplate(ms[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler.SetFault(probeservicesd.SubmitEndpoint, &probeservicesd.Fault{
+		Count:      1,
+		StatusCode: 400,
+	})
+	errs := report.SubmitMeasurements(context.Background(), ms)
+	if errs[0] == nil || errs[1] != nil || errs[2] != nil {
+		t.Fatal("unexpected errors", errs)
+	}
+	if len(handler.Measurements()) != 2 {
+		t.Fatal("unexpected number of measurements")
+	}
+}
+
+func TestSubmitMeasurementsFailure(t *testing.T) {
+	handler, client, _, _, cleanup := newBatchServer(t)
+	defer cleanup()
+	ms := makeBatch(3)
+	report, err := client.OpenReport(context.Background(), probeservices.NewReportTemplate(ms[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler.SetFault(probeservicesd.BatchEndpoint, &probeservicesd.Fault{
+		Count:      1,
+		StatusCode: 500,
+	})
+	if errs := report.SubmitMeasurements(context.Background(), ms); countFailures(errs) != 3 {
+		t.Fatal("expected all the measurements to fail", errs)
+	}
+	handler.SupportsBatch = false
+	handler.SetFault(probeservicesd.SubmitEndpoint, &probeservicesd.Fault{
+		Count:      1,
+		StatusCode: 500,
+	})
+	errs := report.SubmitMeasurements(context.Background(), ms)
+	if errs[0] == nil || errors.Is(errs[0], probeservices.ErrSubmissionSkipped) {
+		t.Fatal("not the error we expected", errs[0])
+	}
+	for _, err := range errs[1:] {
+		if !errors.Is(err, probeservices.ErrSubmissionSkipped) {
+			t.Fatal("not the error we expected", err)
+		}
+	}
+	if len(handler.Measurements()) != 0 {
+		t.Fatal("unexpected number of measurements")
+	}
+}
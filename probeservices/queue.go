@@ -0,0 +1,367 @@
+package probeservices
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ooni/probe-engine/internal/httpx"
+	"github.com/ooni/probe-engine/model"
+)
+
+const (
+	// DefaultQueueBaseDelay is the default value of Queue.BaseDelay.
+	DefaultQueueBaseDelay = 5 * time.Minute
+
+	// DefaultQueueMaxAttempts is the default value of Queue.MaxAttempts.
+	DefaultQueueMaxAttempts = 10
+
+	// DefaultQueueMaxDelay is the default value of Queue.MaxDelay.
+	DefaultQueueMaxDelay = 24 * time.Hour
+
+	// DefaultQueueMaxEntries is the default value of Queue.MaxEntries.
+	DefaultQueueMaxEntries = 256
+)
+
+// QueueEntry is a measurement waiting to be submitted.
+type QueueEntry struct {
+	// Attempts is the number of failed submission attempts.
+	Attempts int `json:"attempts"`
+
+	// CreatedAt is when we added the measurement to the queue.
+	CreatedAt time.Time `json:"created_at"`
+
+	// ID identifies the measurement. It is the SHA256 of the measurement
+	// serialization at the moment in which we queued it.
+	ID string `json:"id"`
+
+	// LastError is the error that occurred in the last attempt.
+	LastError string `json:"last_error"`
+
+	// Measurement is the serialized measurement.
+	Measurement json.RawMessage `json:"measurement"`
+
+	// NextAttempt is the time before which we won't retry.
+	NextAttempt time.Time `json:"next_attempt"`
+}
+
+// QueueStats contains statistics about the queue.
+type QueueStats struct {
+	// Dropped is the number of measurements that we dropped because
+	// the queue was full or we attempted too many times.
+	Dropped int64 `json:"dropped"`
+
+	// Failed is the number of failed submission attempts.
+	Failed int64 `json:"failed"`
+
+	// Pending is the number of measurements in the queue.
+	Pending int64 `json:"pending"`
+
+	// Submitted is the number of measurements submitted from the queue.
+	Submitted int64 `json:"submitted"`
+}
+
+// queueIndex is the index of the queue, which we save into the key-value
+// store using its own key. We save each entry using the key of a slot. The
+// Slots field maps the ID of each entry to its slot.
+type queueIndex struct {
+	IDs   []string       `json:"ids"`
+	Slots map[string]int `json:"slots"`
+	Stats QueueStats     `json:"stats"`
+}
+
+// ErrNotQueueable indicates that we did not add a measurement to the
+// queue, because the collector rejected it, so retrying is pointless.
+var ErrNotQueueable = errors.New("probeservices: measurement not queueable")
+
+// Queue is a persistent queue of measurements whose submission has
+// failed. We retry submitting them, with exponential backoff, every time
+// one calls Flush, e.g. in later sessions. The queue is backed by a
+// generic key-value store configured by the user. We store each entry
+// using its own key and an index of the entries using another key, so
+// that we do not rewrite the whole queue on every change.
+//
+// Implementation note: because the key-value store cannot delete keys, we
+// do not use the ID of an entry as its key, which would leave behind a key
+// for every entry we ever queued. Instead, we store each entry into one of
+// MaxEntries slots, and we reuse the slots of the entries we remove.
+//
+// The zero value is invalid; please use NewQueue to construct a new
+// instance. You may change the public fields after construction.
+type Queue struct {
+	// BaseDelay is the delay after the first failed attempt. We double
+	// the delay after each subsequent failure.
+	BaseDelay time.Duration
+
+	// MaxAttempts is the maximum number of attempts, after which we
+	// drop the measurement.
+	MaxAttempts int
+
+	// MaxDelay is the maximum delay between attempts.
+	MaxDelay time.Duration
+
+	// MaxEntries is the maximum number of entries. When the queue is
+	// full, we drop the oldest entry to make room for a new one.
+	MaxEntries int
+
+	// Store is the key-value store.
+	Store model.KeyValueStore
+
+	key     string
+	mu      sync.Mutex
+	timeNow func() time.Time
+}
+
+// NewQueue creates a new queue backed by a key-value store.
+func NewQueue(kvstore model.KeyValueStore) *Queue {
+	return &Queue{
+		BaseDelay:   DefaultQueueBaseDelay,
+		MaxAttempts: DefaultQueueMaxAttempts,
+		MaxDelay:    DefaultQueueMaxDelay,
+		MaxEntries:  DefaultQueueMaxEntries,
+		Store:       kvstore,
+		key:         "submission.queue",
+		timeNow:     time.Now,
+	}
+}
+
+// Add adds to the queue a measurement that we failed to submit because
+// of err. We ignore measurements that are already in the queue. When err
+// tells us that the collector rejected the measurement, we do not add it
+// to the queue and we return an error wrapping ErrNotQueueable.
+func (q *Queue) Add(m *model.Measurement, err error) error {
+	if isPermanentFailure(err) {
+		return fmt.Errorf("%w: %s", ErrNotQueueable, err.Error())
+	}
+	data, merr := json.Marshal(m)
+	if merr != nil {
+		return merr
+	}
+	sum := sha256.Sum256(data)
+	entry := &QueueEntry{
+		Attempts:    1,
+		CreatedAt:   q.timeNow(),
+		ID:          hex.EncodeToString(sum[:]),
+		Measurement: data,
+	}
+	entry.LastError = err.Error()
+	entry.NextAttempt = entry.CreatedAt.Add(q.delay(entry.Attempts))
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	index := q.loadIndex()
+	for _, ID := range index.IDs {
+		if ID == entry.ID {
+			return nil
+		}
+	}
+	index.Stats.Failed++
+	for len(index.IDs) > 0 && len(index.IDs) >= q.MaxEntries {
+		index.Stats.Dropped++
+		q.removeEntry(&index, index.IDs[0])
+	}
+	slot := index.freeSlot()
+	if err := q.storeEntry(slot, entry); err != nil {
+		return err
+	}
+	index.IDs = append(index.IDs, entry.ID)
+	index.Slots[entry.ID] = slot
+	return q.storeIndex(index)
+}
+
+// Entries returns the entries in the queue.
+func (q *Queue) Entries() (out []*QueueEntry) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	index := q.loadIndex()
+	for _, ID := range index.IDs {
+		if entry := q.loadEntry(index, ID); entry != nil {
+			out = append(out, entry)
+		}
+	}
+	return
+}
+
+// Stats returns statistics about the queue.
+func (q *Queue) Stats() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.loadIndex().Stats
+}
+
+// Flush attempts to submit the measurements in the queue whose backoff
+// has expired using the provided opener. We stop early if the context
+// is done. Returns the statistics after the flush or the error that
+// occurred when updating the queue.
+func (q *Queue) Flush(ctx context.Context, opener ReportOpener) (QueueStats, error) {
+	submitter := NewSubmitter(opener)
+	defer submitter.Close(ctx)
+	for _, entry := range q.Entries() {
+		if ctx.Err() != nil {
+			break
+		}
+		if q.timeNow().Before(entry.NextAttempt) {
+			continue
+		}
+		var m model.Measurement
+		err := json.Unmarshal(entry.Measurement, &m)
+		if err == nil {
+			err = submitter.Submit(ctx, &m)
+		}
+		if err := q.update(entry.ID, err); err != nil {
+			return QueueStats{}, err
+		}
+	}
+	return q.Stats(), nil
+}
+
+// update updates the entry with the given ID using the result of the
+// submission. We remove the entry on success. On failure, we schedule
+// a new attempt, or drop the entry if we attempted too many times or
+// the collector rejected the measurement.
+func (q *Queue) update(ID string, err error) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	index := q.loadIndex()
+	for _, existing := range index.IDs {
+		if existing != ID {
+			continue
+		}
+		entry := q.loadEntry(index, ID)
+		switch {
+		case err == nil:
+			index.Stats.Submitted++
+		case entry == nil, entry.Attempts+1 >= q.MaxAttempts, isPermanentFailure(err):
+			index.Stats.Failed++
+			index.Stats.Dropped++
+		default:
+			index.Stats.Failed++
+			entry.Attempts++
+			entry.LastError = err.Error()
+			entry.NextAttempt = q.timeNow().Add(q.delay(entry.Attempts))
+			if err := q.storeEntry(index.Slots[ID], entry); err != nil {
+				return err
+			}
+			return q.storeIndex(index)
+		}
+		q.removeEntry(&index, ID)
+		return q.storeIndex(index)
+	}
+	return nil // somebody else has already removed the entry
+}
+
+// delay returns the delay after the given number of failed attempts.
+func (q *Queue) delay(attempts int) time.Duration {
+	delay := q.BaseDelay
+	for idx := 1; idx < attempts && delay < q.MaxDelay; idx++ {
+		delay *= 2
+	}
+	if delay > q.MaxDelay {
+		delay = q.MaxDelay
+	}
+	return delay
+}
+
+// isPermanentFailure returns whether err tells us that the collector
+// rejected the measurement, i.e., it is a 4xx status code other than 401
+// and 429, which may go away, so that retrying is pointless.
+func isPermanentFailure(err error) bool {
+	var statusErr *httpx.StatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+	code := statusErr.StatusCode
+	return code >= 400 && code < 500 && code != 401 && code != 429
+}
+
+// slotKey returns the key of the given slot.
+func (q *Queue) slotKey(slot int) string {
+	return q.key + "." + strconv.Itoa(slot)
+}
+
+// freeSlot returns the lowest slot that is not used by any entry.
+func (index *queueIndex) freeSlot() int {
+	used := make(map[int]bool)
+	for _, slot := range index.Slots {
+		used[slot] = true
+	}
+	slot := 0
+	for used[slot] {
+		slot++
+	}
+	return slot
+}
+
+// loadIndex loads the index. In case of any error with the underlying
+// key-value store, we return an empty index.
+func (q *Queue) loadIndex() (index queueIndex) {
+	defer func() {
+		if index.Slots == nil {
+			index.Slots = make(map[string]int)
+		}
+	}()
+	data, err := q.Store.Get(q.key)
+	if err != nil {
+		return
+	}
+	if err := json.Unmarshal(data, &index); err != nil {
+		return queueIndex{}
+	}
+	return
+}
+
+func (q *Queue) storeIndex(index queueIndex) error {
+	index.Stats.Pending = int64(len(index.IDs))
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	return q.Store.Set(q.key, data)
+}
+
+// loadEntry loads the entry with the given ID. In case of any error
+// with the underlying key-value store, we return nil.
+func (q *Queue) loadEntry(index queueIndex, ID string) *QueueEntry {
+	slot, found := index.Slots[ID]
+	if !found {
+		return nil
+	}
+	data, err := q.Store.Get(q.slotKey(slot))
+	if err != nil {
+		return nil
+	}
+	var entry QueueEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.ID != ID {
+		return nil
+	}
+	return &entry
+}
+
+func (q *Queue) storeEntry(slot int, entry *QueueEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return q.Store.Set(q.slotKey(slot), data)
+}
+
+// removeEntry removes the entry with the given ID from the index and frees
+// its slot. We overwrite the slot with an empty value, so that we do not
+// keep the measurement around. We ignore errors, since the slot is free.
+func (q *Queue) removeEntry(index *queueIndex, ID string) {
+	for idx, existing := range index.IDs {
+		if existing == ID {
+			index.IDs = append(index.IDs[:idx], index.IDs[idx+1:]...)
+			break
+		}
+	}
+	if slot, found := index.Slots[ID]; found {
+		delete(index.Slots, ID)
+		q.Store.Set(q.slotKey(slot), []byte{})
+	}
+}
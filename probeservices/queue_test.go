@@ -0,0 +1,269 @@
+package probeservices_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/ooni/probe-engine/internal/httpx"
+	"github.com/ooni/probe-engine/internal/kvstore"
+	"github.com/ooni/probe-engine/internal/mockable"
+	"github.com/ooni/probe-engine/internal/probeservicesd"
+	"github.com/ooni/probe-engine/model"
+	"github.com/ooni/probe-engine/probeservices"
+)
+
+func newQueueMeasurement(input string) *model.Measurement {
+	return &model.Measurement{
+		DataFormatVersion: probeservices.DefaultDataFormatVersion,
+		Input:             model.MeasurementTarget(input),
+		ProbeASN:          "AS30722",
+		ProbeCC:           "IT",
+		ReportID:          "20201016T153512Z_example_IT_30722_n1_xxx",
+		TestName:          "example",
+	}
+}
+
+func newLocalClient(t *testing.T, URL string) *probeservices.Client {
+	client, err := probeservices.NewClient(
+		&mockable.Session{
+			MockableHTTPClient: http.DefaultClient,
+			MockableLogger:     log.Log,
+		},
+		model.Service{Address: URL, Type: "https"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func newQueueServer(t *testing.T) (*probeservicesd.Handler, *httptest.Server, *probeservices.Client) {
+	handler := probeservicesd.NewHandler()
+	server := httptest.NewServer(handler)
+	return handler, server, newLocalClient(t, server.URL)
+}
+
+var errSubmit = errors.New("mocked error")
+
+func TestQueueAdd(t *testing.T) {
+	store := kvstore.NewMemoryKeyValueStore()
+	queue := probeservices.NewQueue(store)
+	queue.MaxEntries = 2
+	for _, input := range []string{"a", "a", "b", "c"} {
+		if err := queue.Add(newQueueMeasurement(input), errSubmit); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stats := queue.Stats()
+	if stats.Pending != 2 || stats.Failed != 3 || stats.Dropped != 1 || stats.Submitted != 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	// make sure we persist the queue and drop the oldest entries
+	entries := probeservices.NewQueue(store).Entries()
+	if len(entries) != 2 {
+		t.Fatal("unexpected number of entries")
+	}
+	for _, entry := range entries {
+		if entry.Attempts != 1 || entry.LastError != errSubmit.Error() {
+			t.Fatalf("unexpected entry: %+v", entry)
+		}
+		if !entry.NextAttempt.After(entry.CreatedAt) {
+			t.Fatal("expected to wait before the next attempt")
+		}
+	}
+	if string(entries[0].Measurement) == string(entries[1].Measurement) {
+		t.Fatal("expected different measurements")
+	}
+}
+
+func TestQueueStoresEntriesInBoundedSlots(t *testing.T) {
+	store := kvstore.NewMemoryKeyValueStore()
+	queue := probeservices.NewQueue(store)
+	queue.MaxEntries = 1
+	for _, input := range []string{"a", "b", "c"} {
+		if err := queue.Add(newQueueMeasurement(input), errSubmit); err != nil {
+			t.Fatal(err)
+		}
+	}
+	index, err := store.Get("submission.queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(index), `"input"`) {
+		t.Fatal("the index should not contain the measurements")
+	}
+	entries := queue.Entries()
+	if len(entries) != 1 {
+		t.Fatal("unexpected number of entries")
+	}
+	data, err := store.Get("submission.queue.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"input":"c"`) {
+		t.Fatal("unexpected entry", string(data))
+	}
+	if _, err := store.Get("submission.queue.1"); err == nil {
+		t.Fatal("expected the queue to reuse its slots")
+	}
+	if err := queue.Add(newQueueMeasurement("d"), errSubmit); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get("submission.queue.1"); err == nil {
+		t.Fatal("expected the queue to reuse its slots")
+	}
+}
+
+func TestQueueAddNotQueueable(t *testing.T) {
+	queue := probeservices.NewQueue(kvstore.NewMemoryKeyValueStore())
+	for _, code := range []int{400, 404, 413} {
+		err := queue.Add(newQueueMeasurement("a"), &httpx.StatusError{StatusCode: code})
+		if !errors.Is(err, probeservices.ErrNotQueueable) {
+			t.Fatal("not the error we expected", err)
+		}
+	}
+	for _, code := range []int{401, 429, 500} {
+		err := queue.Add(newQueueMeasurement(strconv.Itoa(code)), &httpx.StatusError{StatusCode: code})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stats := queue.Stats(); stats.Pending != 3 || stats.Failed != 3 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestQueueCorruptedStore(t *testing.T) {
+	store := kvstore.NewMemoryKeyValueStore()
+	if err := store.Set("submission.queue", []byte("{")); err != nil {
+		t.Fatal(err)
+	}
+	queue := probeservices.NewQueue(store)
+	if len(queue.Entries()) != 0 {
+		t.Fatal("expected no entries")
+	}
+	if err := queue.Add(newQueueMeasurement("a"), errSubmit); err != nil {
+		t.Fatal(err)
+	}
+	if queue.Stats().Pending != 1 {
+		t.Fatal("expected a pending entry")
+	}
+}
+
+func TestQueueFlushSuccess(t *testing.T) {
+	handler, server, client := newQueueServer(t)
+	defer server.Close()
+	queue := probeservices.NewQueue(kvstore.NewMemoryKeyValueStore())
+	queue.BaseDelay = 0
+	for _, input := range []string{"a", "b"} {
+		if err := queue.Add(newQueueMeasurement(input), errSubmit); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stats, err := queue.Flush(context.Background(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Pending != 0 || stats.Submitted != 2 || stats.Failed != 2 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if len(handler.Measurements()) != 2 {
+		t.Fatal("unexpected number of submitted measurements")
+	}
+}
+
+func TestQueueFlushBackoff(t *testing.T) {
+	handler, server, client := newQueueServer(t)
+	defer server.Close()
+	queue := probeservices.NewQueue(kvstore.NewMemoryKeyValueStore())
+	if err := queue.Add(newQueueMeasurement("a"), errSubmit); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := queue.Flush(context.Background(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Pending != 1 || stats.Submitted != 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if len(handler.Measurements()) != 0 {
+		t.Fatal("we should not have submitted anything")
+	}
+}
+
+func TestQueueFlushFailure(t *testing.T) {
+	handler, server, client := newQueueServer(t)
+	defer server.Close()
+	handler.SetFault(probeservicesd.OpenReportEndpoint, &probeservicesd.Fault{
+		StatusCode: 500,
+	})
+	queue := probeservices.NewQueue(kvstore.NewMemoryKeyValueStore())
+	queue.BaseDelay = 0
+	queue.MaxAttempts = 3
+	if err := queue.Add(newQueueMeasurement("a"), errSubmit); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := queue.Flush(context.Background(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Pending != 1 || stats.Failed != 2 || stats.Dropped != 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	entries := queue.Entries()
+	if entries[0].Attempts != 2 || entries[0].LastError == errSubmit.Error() {
+		t.Fatalf("unexpected entry: %+v", entries[0])
+	}
+	stats, err = queue.Flush(context.Background(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Pending != 0 || stats.Failed != 3 || stats.Dropped != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestQueueFlushRejected(t *testing.T) {
+	handler, server, client := newQueueServer(t)
+	defer server.Close()
+	handler.SetFault(probeservicesd.SubmitEndpoint, &probeservicesd.Fault{
+		StatusCode: 400,
+	})
+	queue := probeservices.NewQueue(kvstore.NewMemoryKeyValueStore())
+	queue.BaseDelay = 0
+	if err := queue.Add(newQueueMeasurement("a"), errSubmit); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := queue.Flush(context.Background(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Pending != 0 || stats.Failed != 2 || stats.Dropped != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestQueueFlushCancelledContext(t *testing.T) {
+	handler, server, client := newQueueServer(t)
+	defer server.Close()
+	queue := probeservices.NewQueue(kvstore.NewMemoryKeyValueStore())
+	queue.BaseDelay = 0
+	if err := queue.Add(newQueueMeasurement("a"), errSubmit); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	stats, err := queue.Flush(ctx, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Pending != 1 || len(handler.Measurements()) != 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
@@ -0,0 +1,216 @@
+package probeservices
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"unicode/utf16"
+
+	"github.com/ooni/probe-engine/model"
+)
+
+// SignatureAlgorithm is the algorithm we use to sign measurements.
+const SignatureAlgorithm = "ed25519"
+
+var (
+	// ErrMissingSignature indicates that the measurement is not signed.
+	ErrMissingSignature = errors.New("probe services: missing signature")
+
+	// ErrInvalidSignature indicates that the signature is not valid.
+	ErrInvalidSignature = errors.New("probe services: invalid signature")
+
+	// ErrUnsupportedSignatureAlgorithm indicates that the measurement
+	// has been signed using an algorithm that we do not support.
+	ErrUnsupportedSignatureAlgorithm = errors.New(
+		"probe services: unsupported signature algorithm",
+	)
+)
+
+// SignMeasurement signs the measurement using the given key. If the
+// measurement is already signed, we replace the signature. You must sign
+// again if you modify the measurement, unless you only modify the fields
+// stamped by the collector, which the signature does not cover.
+func SignMeasurement(m *model.Measurement, key ed25519.PrivateKey) error {
+	m.Signature = nil
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	canonical, err := canonicalizeMeasurement(data)
+	if err != nil {
+		return err
+	}
+	m.Signature = &model.MeasurementSignature{
+		Algorithm: SignatureAlgorithm,
+		PublicKey: key.Public().(ed25519.PublicKey),
+		Value:     ed25519.Sign(key, canonical),
+	}
+	return nil
+}
+
+// VerifyMeasurement verifies the signature of the serialized measurement
+// and returns the public key of the probe that signed it. Note that this
+// function only tells you that the measurement has not been modified after
+// being signed. It is up to you to decide whether to trust the key.
+func VerifyMeasurement(data []byte) (ed25519.PublicKey, error) {
+	var envelope struct {
+		Signature *model.MeasurementSignature `json:"signature"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, err
+	}
+	signature := envelope.Signature
+	if signature == nil {
+		return nil, ErrMissingSignature
+	}
+	if signature.Algorithm != SignatureAlgorithm {
+		return nil, ErrUnsupportedSignatureAlgorithm
+	}
+	if len(signature.PublicKey) != ed25519.PublicKeySize {
+		return nil, ErrInvalidSignature
+	}
+	canonical, err := canonicalizeMeasurement(data)
+	if err != nil {
+		return nil, err
+	}
+	key := ed25519.PublicKey(signature.PublicKey)
+	if !ed25519.Verify(key, canonical, signature.Value) {
+		return nil, ErrInvalidSignature
+	}
+	return key, nil
+}
+
+// canonicalizeMeasurement returns the canonical serialization of the
+// serialized measurement, i.e., the serialization defined by the JSON
+// Canonicalization Scheme (JCS, RFC 8785) of the measurement without the
+// signature and the fields stamped by the collector. Because JCS does not
+// escape HTML characters, nor U+2028 and U+2029, we cannot obtain it from
+// json.Marshal, not even using an encoder with SetEscapeHTML(false), and
+// we write the serialization ourselves using writeCanonicalJSON.
+func canonicalizeMeasurement(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var measurement map[string]interface{}
+	if err := decoder.Decode(&measurement); err != nil {
+		return nil, err
+	}
+	delete(measurement, "ooid")
+	delete(measurement, "report_id")
+	delete(measurement, "signature")
+	var buf bytes.Buffer
+	if err := writeCanonicalJSON(&buf, measurement); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeCanonicalJSON writes the JCS serialization of v, which must be
+// the result of decoding JSON using json.Decoder.UseNumber, into buf.
+func writeCanonicalJSON(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case json.Number:
+		// JCS serializes numbers like ECMAScript does, which is also
+		// what encoding/json does with float64, except for -0.
+		number, err := strconv.ParseFloat(string(v), 64)
+		if err != nil {
+			return err
+		}
+		if number == 0 {
+			number = 0 // i.e., not -0
+		}
+		data, err := json.Marshal(number)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+	case string:
+		writeCanonicalString(buf, v)
+	case []interface{}:
+		buf.WriteByte('[')
+		for idx, entry := range v {
+			if idx > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonicalJSON(buf, entry); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		// JCS sorts keys by their UTF-16 code units.
+		sort.Slice(keys, func(i, j int) bool {
+			return lessUTF16(keys[i], keys[j])
+		})
+		buf.WriteByte('{')
+		for idx, key := range keys {
+			if idx > 0 {
+				buf.WriteByte(',')
+			}
+			writeCanonicalString(buf, key)
+			buf.WriteByte(':')
+			if err := writeCanonicalJSON(buf, v[key]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return fmt.Errorf("probe services: cannot canonicalize %T", v)
+	}
+	return nil
+}
+
+// writeCanonicalString writes the JCS serialization of s into buf. We only
+// escape the quote, the backslash, and the control characters, using the
+// short escapes where possible. We do not need to care about invalid UTF-8
+// because json.Decoder replaces it with U+FFFD.
+func writeCanonicalString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	for idx := 0; idx < len(s); idx++ {
+		switch c := s[idx]; c {
+		case '"', '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if c < 0x20 {
+				fmt.Fprintf(buf, `\u%04x`, c)
+				continue
+			}
+			buf.WriteByte(c)
+		}
+	}
+	buf.WriteByte('"')
+}
+
+// lessUTF16 returns whether a comes before b when comparing their
+// UTF-16 code units, which is the order of keys mandated by JCS.
+func lessUTF16(a, b string) bool {
+	ua, ub := utf16.Encode([]rune(a)), utf16.Encode([]rune(b))
+	for idx := 0; idx < len(ua) && idx < len(ub); idx++ {
+		if ua[idx] != ub[idx] {
+			return ua[idx] < ub[idx]
+		}
+	}
+	return len(ua) < len(ub)
+}
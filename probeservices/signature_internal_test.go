@@ -0,0 +1,6 @@
+package probeservices
+
+// CanonicalizeMeasurement exposes the internal function canonicalizeMeasurement
+func CanonicalizeMeasurement(data []byte) ([]byte, error) {
+	return canonicalizeMeasurement(data)
+}
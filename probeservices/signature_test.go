@@ -0,0 +1,221 @@
+package probeservices_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"testing"
+
+	"github.com/ooni/probe-engine/internal/kvstore"
+	"github.com/ooni/probe-engine/model"
+	"github.com/ooni/probe-engine/probeservices"
+)
+
+func newSignedMeasurement(t *testing.T) (*model.Measurement, ed25519.PrivateKey) {
+	key, err := probeservices.NewStateFile(kvstore.NewMemoryKeyValueStore()).SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	measurement := newQueueMeasurement("https://www.example.com/")
+	measurement.TestKeys = map[string]interface{}{"value": 1.1}
+	if err := probeservices.SignMeasurement(measurement, key); err != nil {
+		t.Fatal(err)
+	}
+	return measurement, key
+}
+
+func TestSignAndVerifyMeasurement(t *testing.T) {
+	measurement, key := newSignedMeasurement(t)
+	// The collector may change the report ID and the measurement ID
+	// without invalidating the signature.
+	measurement.ReportID = "20201016T153512Z_example_IT_30722_n1_yyy"
+	measurement.OOID = "20201016153512.000000_xxx"
+	data, err := json.Marshal(measurement)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := probeservices.VerifyMeasurement(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(publicKey, key.Public().(ed25519.PublicKey)) {
+		t.Fatal("unexpected public key")
+	}
+	// Signing again must replace the signature.
+	if err := probeservices.SignMeasurement(measurement, key); err != nil {
+		t.Fatal(err)
+	}
+	if data, err = json.Marshal(measurement); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := probeservices.VerifyMeasurement(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyMeasurementFailures(t *testing.T) {
+	cases := []struct {
+		name     string
+		modify   func(m *model.Measurement)
+		expected error
+	}{{
+		name: "with modified measurement",
+		modify: func(m *model.Measurement) {
+			m.ProbeCC = "DE"
+		},
+		expected: probeservices.ErrInvalidSignature,
+	}, {
+		name: "with modified test keys",
+		modify: func(m *model.Measurement) {
+			m.TestKeys = map[string]interface{}{"value": 1.10001}
+		},
+		expected: probeservices.ErrInvalidSignature,
+	}, {
+		name: "with missing signature",
+		modify: func(m *model.Measurement) {
+			m.Signature = nil
+		},
+		expected: probeservices.ErrMissingSignature,
+	}, {
+		name: "with unsupported algorithm",
+		modify: func(m *model.Measurement) {
+			m.Signature.Algorithm = "rsa"
+		},
+		expected: probeservices.ErrUnsupportedSignatureAlgorithm,
+	}, {
+		name: "with invalid public key",
+		modify: func(m *model.Measurement) {
+			m.Signature.PublicKey = m.Signature.PublicKey[1:]
+		},
+		expected: probeservices.ErrInvalidSignature,
+	}}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			measurement, _ := newSignedMeasurement(t)
+			c.modify(measurement)
+			data, err := json.Marshal(measurement)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := probeservices.VerifyMeasurement(data); err != c.expected {
+				t.Fatal("not the error we expected", err)
+			}
+		})
+	}
+	t.Run("with invalid JSON", func(t *testing.T) {
+		if _, err := probeservices.VerifyMeasurement([]byte("{")); err == nil {
+			t.Fatal("expected an error here")
+		}
+	})
+}
+
+func TestSignAndVerifyMeasurementWithHTML(t *testing.T) {
+	key, err := probeservices.NewStateFile(kvstore.NewMemoryKeyValueStore()).SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	measurement := newQueueMeasurement("https://www.example.com/")
+	measurement.TestKeys = map[string]interface{}{
+		"body": "<html><a href=\"/?a=1&b=2\">\u2028\u2029</a></html>",
+	}
+	if err := probeservices.SignMeasurement(measurement, key); err != nil {
+		t.Fatal(err)
+	}
+	// The signature must not depend on whether the serialization of
+	// the measurement escapes HTML characters.
+	escaped, err := json.Marshal(measurement)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(escaped, []byte(`\u003chtml\u003e`)) {
+		t.Fatal("expected HTML characters to be escaped")
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(measurement); err != nil {
+		t.Fatal(err)
+	}
+	for _, data := range [][]byte{escaped, buf.Bytes()} {
+		if _, err := probeservices.VerifyMeasurement(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	canonical, err := probeservices.CanonicalizeMeasurement(escaped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "\"test_keys\":{\"body\":\"<html><a href=\\\"/?a=1&b=2\\\">\u2028\u2029</a></html>\"}"
+	if !bytes.Contains(canonical, []byte(expected)) {
+		t.Fatal("unexpected canonical serialization", string(canonical))
+	}
+}
+
+func TestCanonicalizeMeasurement(t *testing.T) {
+	cases := []struct {
+		name     string
+		input    string
+		expected string
+		err      bool
+	}{{
+		name:     "with collector fields and signature",
+		input:    `{"ooid":"x","report_id":"y","signature":{"algorithm":"ed25519"},"a":1}`,
+		expected: `{"a":1}`,
+	}, {
+		name:     "with keys sorted by UTF-16 code units",
+		input:    `{"\ufb01":3,"\ud83d\ude00":2,"\u00e9":1,"b":{"z":null,"y":true}}`,
+		expected: "{\"b\":{\"y\":true,\"z\":null},\"\u00e9\":1,\"\U0001f600\":2,\"\ufb01\":3}",
+	}, {
+		name:     "with numbers",
+		input:    `{"a":[1.0,-0,1E21,0.000001,1e-7,1.10,-12.5e1]}`,
+		expected: `{"a":[1,0,1e+21,0.000001,1e-7,1.1,-125]}`,
+	}, {
+		name:     "with strings",
+		input:    `{"a":"\u003c\u003e\u0026\u2028\/\"\\\b\f\n\r\t\u0001\u001f\u007f"}`,
+		expected: "{\"a\":\"<>&\u2028/\\\"\\\\\\b\\f\\n\\r\\t\\u0001\\u001f\u007f\"}",
+	}, {
+		name:  "with number out of range",
+		input: `{"a":1e400}`,
+		err:   true,
+	}, {
+		name:  "with invalid JSON",
+		input: `{`,
+		err:   true,
+	}}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			canonical, err := probeservices.CanonicalizeMeasurement([]byte(c.input))
+			if (err != nil) != c.err {
+				t.Fatal("unexpected error", err)
+			}
+			if string(canonical) != c.expected {
+				t.Fatalf("expected %q, got %q", c.expected, string(canonical))
+			}
+		})
+	}
+}
+
+func TestStateFileSigningKey(t *testing.T) {
+	sf := probeservices.NewStateFile(kvstore.NewMemoryKeyValueStore())
+	if err := sf.Set(probeservices.State{ClientID: "xx", Password: "xy"}); err != nil {
+		t.Fatal(err)
+	}
+	key, err := sf.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(key) != ed25519.PrivateKeySize {
+		t.Fatal("unexpected key size")
+	}
+	// We must reuse the saved key and preserve the rest of the state.
+	other, err := probeservices.NewStateFile(sf.Store).SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(key, other) {
+		t.Fatal("expected to reuse the saved key")
+	}
+	if sf.Get().Credentials() == nil {
+		t.Fatal("expected to preserve the credentials")
+	}
+}
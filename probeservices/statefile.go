@@ -1,6 +1,8 @@
 package probeservices
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
 	"encoding/json"
 	"time"
 
@@ -9,10 +11,11 @@ import (
 
 // State is the state stored inside the state file
 type State struct {
-	ClientID string
-	Expire   time.Time
-	Password string
-	Token    string
+	ClientID   string
+	Expire     time.Time
+	Password   string
+	SigningKey ed25519.PrivateKey
+	Token      string
 }
 
 // Auth returns an authentication structure, if possible, otherwise
@@ -85,3 +88,21 @@ func (sf StateFile) Get() (state State) {
 	state, _ = sf.GetMockable(sf.Store.Get, json.Unmarshal)
 	return
 }
+
+// SigningKey returns the ed25519 key with which this probe signs
+// measurements. We generate and save the key on first use.
+func (sf StateFile) SigningKey() (ed25519.PrivateKey, error) {
+	state := sf.Get()
+	if len(state.SigningKey) == ed25519.PrivateKeySize {
+		return state.SigningKey, nil
+	}
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	state.SigningKey = key
+	if err := sf.Set(state); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
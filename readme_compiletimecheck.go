@@ -3,5 +3,5 @@
 
 package engine
 
-ATTENTION: If you are compiling probe-engine with go1.15 please make sure
+ATTENTION: If you are compiling probe-engine with go1.15 or later please make sure
 to pass -tags DISABLE_QUIC. Alternatively use ./build-cli.sh.
@@ -2,11 +2,14 @@ package resources
 
 const (
 	// Version contains the assets version.
-	Version = 20200929203018
+	Version = 20201016000000
 
 	// ASNDatabaseName is the ASN-DB file name
 	ASNDatabaseName = "asn.mmdb"
 
+	// BlockpagesDatabaseName is the blockpages fingerprints DB file name
+	BlockpagesDatabaseName = "blockpages.json"
+
 	// CABundleName is the name of the CA bundle file
 	CABundleName = "ca-bundle.pem"
 
@@ -37,6 +40,11 @@ var All = map[string]ResourceInfo{
 		GzSHA256: "abfed7750af355c2e75feed73cb5a4cf44f4ecb9866199900c65a1e3cb58bda9",
 		SHA256:   "3958d1248b13b5aedc5f03e528a3ef2f2ef4ebdc4449bcd6667d03f722988dc9",
 	},
+	"blockpages.json": {
+		URLPath:  "/ooni/probe-assets/releases/download/20201016000000/blockpages.json.gz",
+		GzSHA256: "391e3fa398b23bebad5dd2e5b5ac6f95f2022a118774d99f566dd6ec4176e65e",
+		SHA256:   "ce262582f881e80c51fa920b7a7c1182a4a56bdf48c8d145bb0c48bd0f99a1d6",
+	},
 	"ca-bundle.pem": {
 		URLPath:  "/ooni/probe-assets/releases/download/20200929203018/ca-bundle.pem.gz",
 		GzSHA256: "3a99970bc782e5f7899de9011618bbadde5057d380e8fc7dc58ee96335bc1c30",
@@ -2,6 +2,7 @@ package engine
 
 import (
 	"context"
+	"crypto/ed25519"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -23,6 +24,7 @@ import (
 	"github.com/ooni/probe-engine/model"
 	"github.com/ooni/probe-engine/netx"
 	"github.com/ooni/probe-engine/netx/bytecounter"
+	"github.com/ooni/probe-engine/netx/resolver"
 	"github.com/ooni/probe-engine/probeservices"
 	"github.com/ooni/probe-engine/resources"
 )
@@ -35,6 +37,9 @@ type SessionConfig struct {
 	Logger                 model.Logger
 	PrivacySettings        model.PrivacySettings
 	ProxyURL               *url.URL
+	RaceResolvers          bool
+	ResolverURLs           []string
+	SignMeasurements       bool
 	SoftwareName           string
 	SoftwareVersion        string
 	TempDir                string
@@ -48,6 +53,7 @@ type Session struct {
 	availableProbeServices   []model.Service
 	availableTestHelpers     map[string][]model.Service
 	byteCounter              *bytecounter.Counter
+	dnsCache                 *resolver.TTLCache
 	httpDefaultTransport     netx.HTTPRoundTripper
 	kvStore                  model.KeyValueStore
 	privacySettings          model.PrivacySettings
@@ -58,8 +64,10 @@ type Session struct {
 	resolver                 *sessionresolver.Resolver
 	selectedProbeServiceHook func(*model.Service)
 	selectedProbeService     *model.Service
+	signingKey               ed25519.PrivateKey
 	softwareName             string
 	softwareVersion          string
+	submitQueue              *probeservices.Queue
 	tempDir                  string
 	torArgs                  []string
 	torBinary                string
@@ -68,6 +76,9 @@ type Session struct {
 	tunnel                   sessiontunnel.Tunnel
 }
 
+// dnsCacheKey is the key used to persist the DNS cache into the key-value store.
+const dnsCacheKey = "session.dnscache"
+
 // NewSession creates a new session or returns an error
 func NewSession(config SessionConfig) (*Session, error) {
 	if config.AssetsDir == "" {
@@ -85,6 +96,14 @@ func NewSession(config SessionConfig) (*Session, error) {
 	if config.KVStore == nil {
 		config.KVStore = kvstore.NewMemoryKeyValueStore()
 	}
+	var signingKey ed25519.PrivateKey
+	if config.SignMeasurements {
+		var err error
+		signingKey, err = probeservices.NewStateFile(config.KVStore).SigningKey()
+		if err != nil {
+			return nil, err
+		}
+	}
 	// Implementation note: if config.TempDir is empty, then Go will
 	// use the temporary directory on the current system. This should
 	// work on Desktop. We tested that it did also work on iOS, but
@@ -97,13 +116,16 @@ func NewSession(config SessionConfig) (*Session, error) {
 		assetsDir:               config.AssetsDir,
 		availableProbeServices:  config.AvailableProbeServices,
 		byteCounter:             bytecounter.New(),
+		dnsCache:                new(resolver.TTLCache),
 		kvStore:                 config.KVStore,
 		privacySettings:         config.PrivacySettings,
 		logger:                  config.Logger,
 		proxyURL:                config.ProxyURL,
 		queryProbeServicesCount: atomicx.NewInt64(),
+		signingKey:              signingKey,
 		softwareName:            config.SoftwareName,
 		softwareVersion:         config.SoftwareVersion,
+		submitQueue:             probeservices.NewQueue(config.KVStore),
 		tempDir:                 tempDir,
 		torArgs:                 config.TorArgs,
 		torBinary:               config.TorBinary,
@@ -113,13 +135,34 @@ func NewSession(config SessionConfig) (*Session, error) {
 		BogonIsError: true,
 		Logger:       sess.logger,
 	}
-	sess.resolver = sessionresolver.New(httpConfig)
-	httpConfig.FullResolver = sess.resolver
+	sess.resolver, err = sessionresolver.New(sessionresolver.Config{
+		HTTPConfig: httpConfig,
+		KVStore:    config.KVStore,
+		Race:       config.RaceResolvers,
+		URLs:       config.ResolverURLs,
+	})
+	if err != nil {
+		os.RemoveAll(tempDir)
+		return nil, err
+	}
+	// Loading the DNS cache is best effort: if it fails, for example
+	// because this is the first session, we start with an empty cache.
+	sess.dnsCache.LoadFrom(config.KVStore, dnsCacheKey)
+	httpConfig.FullResolver = resolver.TTLCacheResolver{
+		Resolver: sess.resolver,
+		Cache:    sess.dnsCache,
+	}
 	httpConfig.ProxyURL = config.ProxyURL // no need to proxy the resolver
 	sess.httpDefaultTransport = netx.NewHTTPTransport(httpConfig)
 	return sess, nil
 }
 
+// AssetsDir returns the directory where we store the resources that
+// we download with s.FetchResourcesIdempotent.
+func (s *Session) AssetsDir() string {
+	return s.assetsDir
+}
+
 // ASNDatabasePath returns the path where the ASN database path should
 // be if you have called s.FetchResourcesIdempotent.
 func (s *Session) ASNDatabasePath() string {
@@ -149,7 +192,8 @@ func (s *Session) CABundlePath() string {
 // as well as excessive usage of disk space.
 func (s *Session) Close() error {
 	s.httpDefaultTransport.CloseIdleConnections()
-	s.resolver.CloseIdleConnections()
+	s.resolver.Close()
+	s.dnsCache.SaveTo(s.kvStore, dnsCacheKey) // best effort
 	if s.tunnel != nil {
 		s.tunnel.Stop()
 	}
@@ -269,6 +313,36 @@ func (s *Session) NewProbeServicesClient(ctx context.Context) (*probeservices.Cl
 	return probeservices.NewClient(s, *s.selectedProbeService)
 }
 
+// FlushSubmissionQueue attempts to submit the measurements that we
+// failed to submit in this session or in previous sessions. We only
+// retry the measurements whose backoff has expired. Returns the
+// statistics about the queue after the flush.
+func (s *Session) FlushSubmissionQueue(ctx context.Context) (probeservices.QueueStats, error) {
+	if len(s.submitQueue.Entries()) <= 0 {
+		return s.submitQueue.Stats(), nil
+	}
+	clnt, err := s.NewProbeServicesClient(ctx)
+	if err != nil {
+		return probeservices.QueueStats{}, err
+	}
+	return s.submitQueue.Flush(ctx, clnt)
+}
+
+// SigningPublicKey returns the public key with which we sign the
+// measurements, or nil if we are not signing measurements.
+func (s *Session) SigningPublicKey() ed25519.PublicKey {
+	if s.signingKey == nil {
+		return nil
+	}
+	return s.signingKey.Public().(ed25519.PublicKey)
+}
+
+// SubmissionQueueStats returns statistics about the measurements
+// that we failed to submit and that we will retry submitting.
+func (s *Session) SubmissionQueueStats() probeservices.QueueStats {
+	return s.submitQueue.Stats()
+}
+
 // NewOrchestraClient creates a new orchestra client. This client is registered
 // and logged in with the OONI orchestra. An error is returned on failure.
 func (s *Session) NewOrchestraClient(ctx context.Context) (model.ExperimentOrchestraClient, error) {
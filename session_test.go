@@ -8,15 +8,19 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
 	"syscall"
 	"testing"
 	"time"
 
 	"github.com/apex/log"
 	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-engine/internal/kvstore"
 	"github.com/ooni/probe-engine/model"
 	"github.com/ooni/probe-engine/netx"
+	"github.com/ooni/probe-engine/netx/resolver"
 	"github.com/ooni/probe-engine/probeservices"
+	"github.com/ooni/probe-engine/resources"
 )
 
 func TestNewSessionBuilderChecks(t *testing.T) {
@@ -50,6 +54,15 @@ func TestNewSessionBuilderChecks(t *testing.T) {
 			TempDir:         "./nonexistent",
 		})
 	})
+	t.Run("with invalid resolver URL", func(t *testing.T) {
+		newSessionMustFail(t, SessionConfig{
+			AssetsDir:       "testdata",
+			Logger:          log.Log,
+			ResolverURLs:    []string{"\t\t\t"},
+			SoftwareName:    "ooniprobe-engine",
+			SoftwareVersion: "0.0.1",
+		})
+	})
 }
 
 func TestNewSessionBuilderGood(t *testing.T) {
@@ -104,6 +117,39 @@ func TestSessionTorArgsTorBinary(t *testing.T) {
 	}
 }
 
+func TestSessionSignMeasurements(t *testing.T) {
+	store := kvstore.NewMemoryKeyValueStore()
+	newSession := func(sign bool) *Session {
+		sess, err := NewSession(SessionConfig{
+			AssetsDir:        "testdata",
+			KVStore:          store,
+			Logger:           log.Log,
+			SignMeasurements: sign,
+			SoftwareName:     "ooniprobe-engine",
+			SoftwareVersion:  "0.0.1",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sess
+	}
+	sess := newSession(false)
+	defer sess.Close()
+	if sess.SigningPublicKey() != nil {
+		t.Fatal("expected no signing key")
+	}
+	first := newSession(true)
+	defer first.Close()
+	second := newSession(true)
+	defer second.Close()
+	if first.SigningPublicKey() == nil {
+		t.Fatal("expected a signing key")
+	}
+	if diff := cmp.Diff(first.SigningPublicKey(), second.SigningPublicKey()); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
 func newSessionForTestingNoLookupsWithProxyURL(t *testing.T, URL *url.URL) *Session {
 	sess, err := NewSession(SessionConfig{
 		AssetsDir: "testdata",
@@ -308,6 +354,37 @@ func TestIntegrationSessionCloseCancelsTempDir(t *testing.T) {
 	}
 }
 
+func TestUnitSessionPersistsDNSCache(t *testing.T) {
+	store := kvstore.NewMemoryKeyValueStore()
+	config := SessionConfig{
+		AssetsDir:       "testdata",
+		KVStore:         store,
+		Logger:          log.Log,
+		SoftwareName:    "ooniprobe-engine",
+		SoftwareVersion: "0.0.1",
+	}
+	sess, err := NewSession(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess.dnsCache.Set("dns.google", resolver.TTLCacheEntry{
+		Addresses: []string{"8.8.8.8"},
+		Expire:    time.Now().Add(time.Hour),
+	})
+	if err := sess.Close(); err != nil {
+		t.Fatal(err)
+	}
+	sess, err = NewSession(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sess.Close()
+	entry, found := sess.dnsCache.Get("dns.google")
+	if !found || len(entry.Addresses) != 1 || entry.Addresses[0] != "8.8.8.8" {
+		t.Fatal("the DNS cache was not restored")
+	}
+}
+
 func TestIntegrationSessionDownloadResources(t *testing.T) {
 	tmpdir, err := ioutil.TempDir("", "test-download-resources-idempotent")
 	if err != nil {
@@ -334,6 +411,10 @@ func TestIntegrationSessionDownloadResources(t *testing.T) {
 	if err := readfile(sess.CountryDatabasePath()); err != nil {
 		t.Fatal(err)
 	}
+	blockpagesDB := filepath.Join(sess.AssetsDir(), resources.BlockpagesDatabaseName)
+	if err := readfile(blockpagesDB); err != nil {
+		t.Fatal(err)
+	}
 }
 
 func TestUnitGetAvailableProbeServices(t *testing.T) {